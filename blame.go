@@ -1,16 +1,20 @@
 package git
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"io"
+	"sort"
 	"strings"
-	"unicode/utf8"
+	"unicode"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 // BlameResult represents the result of a Blame operation.
@@ -26,78 +30,7 @@ type BlameResult struct {
 // Blame returns a BlameResult with the information about the last author of
 // each line from file `path` at commit `c`.
 func Blame(c *object.Commit, path string) (*BlameResult, error) {
-	// The file to blame is identified by the input arguments:
-	// commit and path. commit is a Commit object obtained from a Repository. Path
-	// represents a path to a specific file contained into the repository.
-	//
-	// Blaming a file is a two step process:
-	//
-	// 1. Create a linear history of the commits affecting a file. We use
-	// revlist.New for that.
-	//
-	// 2. Then build a graph with a node for every line in every file in
-	// the history of the file.
-	//
-	// Each node is assigned a commit: Start by the nodes in the first
-	// commit. Assign that commit as the creator of all its lines.
-	//
-	// Then jump to the nodes in the next commit, and calculate the diff
-	// between the two files. Newly created lines get
-	// assigned the new commit as its origin. Modified lines also get
-	// this new commit. Untouched lines retain the old commit.
-	//
-	// All this work is done in the assignOrigin function which holds all
-	// the internal relevant data in a "blame" struct, that is not
-	// exported.
-	//
-	// TODO: ways to improve the efficiency of this function:
-	// 1. Improve revlist
-	// 2. Improve how to traverse the history (example a backward traversal will
-	// be much more efficient)
-	//
-	// TODO: ways to improve the function in general:
-	// 1. Add memoization between revlist and assign.
-	// 2. It is using much more memory than needed, see the TODOs below.
-
-	b := new(blame)
-	b.fRev = c
-	b.path = path
-
-	// get all the file revisions
-	if err := b.fillRevs(); err != nil {
-		return nil, err
-	}
-
-	// calculate the line tracking graph and fill in
-	// file contents in data.
-	if err := b.fillGraphAndData(); err != nil {
-		return nil, err
-	}
-
-	file, err := b.fRev.File(b.path)
-	if err != nil {
-		return nil, err
-	}
-	finalLines, err := file.Lines()
-	if err != nil {
-		return nil, err
-	}
-
-	// Each node (line) holds the commit where it was introduced or
-	// last modified. To achieve that we use the FORWARD algorithm
-	// described in Zimmermann, et al. "Mining Version Archives for
-	// Co-changed Lines", in proceedings of the Mining Software
-	// Repositories workshop, Shanghai, May 22-23, 2006.
-	lines, err := newLines(finalLines, b.sliceGraph(len(b.graph)-1))
-	if err != nil {
-		return nil, err
-	}
-
-	return &BlameResult{
-		Path:  path,
-		Rev:   c.Hash,
-		Lines: lines,
-	}, nil
+	return BlameWithOptions(c, path, nil)
 }
 
 // Line values represent the contents and author of a line in BlamedResult values.
@@ -110,191 +43,640 @@ type Line struct {
 	Author object.Signature
 	// Message is the commit message that introduced the original line
 	Message string
+	// LineNumber is the number of the line in the blamed file, starting at 1.
+	LineNumber int
+	// OriginalLine is the number of the line in the file at the commit that
+	// introduced it, starting at 1.
+	OriginalLine int
+	// OriginalPath is the path of the file at the commit that introduced the
+	// line, it differs from the blamed path if the file was renamed or the
+	// line was copied from another file.
+	OriginalPath string
+	// Boundary is true if the line comes from a commit out of the blamed
+	// range, which is then the commit where the blame stopped.
+	Boundary bool
 }
 
 func newLine(author object.Signature, text string, hash plumbing.Hash, message string) *Line {
 	return &Line{
-		Author: author,
-		Text:   text,
-		Hash:   hash,
+		Author:  author,
+		Text:    text,
+		Hash:    hash,
 		Message: message,
 	}
 }
 
-func newLines(contents []string, commits []*object.Commit) ([]*Line, error) {
-	lcontents := len(contents)
-	lcommits := len(commits)
+var (
+	// ErrInvalidLineRange is returned by BlameWithOptions when a line range
+	// is not valid.
+	ErrInvalidLineRange = errors.New("invalid line range")
+)
 
-	if lcontents != lcommits {
-		if lcontents == lcommits-1 && contents[lcontents-1] != "\n" {
-			contents = append(contents, "\n")
-		} else {
-			return nil, errors.New("contents and commits have different length")
+// blameCopyScore is the minimum number of alphanumeric characters of the
+// lines found in another file for them to be considered as copied from it,
+// as `git blame -C` does.
+const blameCopyScore = 20
+
+// BlameWithOptions returns a BlameResult with the information about the last
+// author of each line from file `path` at commit `c`, as `git blame` does.
+//
+// The history is walked backwards from `c`, passing the lines that a commit
+// didn't change to the parents having them, until each line reaches the
+// commit introducing it. Merges pass the lines to all their parents, and the
+// lines are followed across renames and copies if requested in the options.
+// The lines of the result are sorted by line number.
+func BlameWithOptions(c *object.Commit, path string, o *BlameOptions) (*BlameResult, error) {
+	lines := make([]*Line, 0)
+	err := BlameIncremental(context.Background(), c, path, o, func(h *BlameHunk) error {
+		lines = append(lines, h.lines()...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].LineNumber < lines[j].LineNumber
+	})
+
+	return &BlameResult{
+		Path:  path,
+		Rev:   c.Hash,
+		Lines: lines,
+	}, nil
+}
+
+// BlameHunk is a range of consecutive lines of a blamed file, coming from the
+// same consecutive lines of the file at the commit that introduced them.
+type BlameHunk struct {
+	// Commit is the commit that introduced the lines.
+	Commit *object.Commit
+	// Path is the path of the file at Commit.
+	Path string
+	// Line is the number of the first line of the hunk in the blamed file,
+	// starting at 1.
+	Line int
+	// OriginalLine is the number of the first line of the hunk in the file at
+	// Commit, starting at 1.
+	OriginalLine int
+	// Text is the content of every line of the hunk, without the newline.
+	Text []string
+	// Boundary is true if Commit is out of the blamed range, and then the
+	// commit where the blame stopped.
+	Boundary bool
+	// Previous is the first parent of Commit having the file, if any.
+	Previous *object.Commit
+	// PreviousPath is the path of the file at Previous.
+	PreviousPath string
+}
+
+func (h *BlameHunk) lines() []*Line {
+	lines := make([]*Line, 0, len(h.Text))
+	for i, text := range h.Text {
+		l := newLine(h.Commit.Author, text, h.Commit.Hash, h.Commit.Message)
+		l.LineNumber = h.Line + i
+		l.OriginalLine = h.OriginalLine + i
+		l.OriginalPath = h.Path
+		l.Boundary = h.Boundary
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// BlameIncremental blames the file `path` at commit `c` as BlameWithOptions
+// does, but instead of building a result it calls fn with every hunk of lines
+// as soon as the commit introducing them is found, as
+// `git blame --incremental` does. The hunks are not sorted by line number.
+// The blame stops when the context is cancelled or fn returns an error,
+// storer.ErrStop stops it without error.
+func BlameIncremental(ctx context.Context, c *object.Commit, path string, o *BlameOptions, fn func(*BlameHunk) error) error {
+	if o == nil {
+		o = &BlameOptions{}
+	}
+
+	b, err := newBlamer(c, path, o)
+	if err != nil {
+		return err
+	}
+
+	err = b.run(ctx, fn)
+	if err == storer.ErrStop {
+		return nil
+	}
+
+	return err
+}
+
+// ReadIgnoreRevs reads a list of commits to ignore while blaming, in the
+// format of the `.git-blame-ignore-revs` files: one full commit hash per line,
+// blank lines and comments starting with '#' are skipped.
+func ReadIgnoreRevs(r io.Reader) ([]plumbing.Hash, error) {
+	var revs []plumbing.Hash
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
 		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if !plumbing.IsHash(line) {
+			return nil, fmt.Errorf("invalid object name: %s", line)
+		}
+
+		revs = append(revs, plumbing.NewHash(line))
 	}
 
-	result := make([]*Line, 0, lcontents)
-	for i := range contents {
-		result = append(result, newLine(
-			commits[i].Author, contents[i], commits[i].Hash, commits[i].Message,
-		))
+	if err := s.Err(); err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	return revs, nil
 }
 
-// this struct is internally used by the blame function to hold its
-// inputs, outputs and state.
-type blame struct {
-	// the path of the file to blame
-	path string
-	// the commit of the final revision of the file to blame
-	fRev *object.Commit
-	// the chain of revisions affecting the the file to blame
-	revs []*object.Commit
-	// the contents of the file across all its revisions
-	data []string
-	// the graph of the lines in the file across all the revisions
-	graph [][]*object.Commit
+// blameEntry is a line of the blamed file assigned to a suspect.
+type blameEntry struct {
+	// final is the index of the line in the blamed file
+	final int
+	// line is the index of the line in the file of the suspect
+	line int
 }
 
-// calculate the history of a file "path", starting from commit "from", sorted by commit date.
-func (b *blame) fillRevs() error {
-	var err error
+// blameSuspect is a version of the blamed file, that may have introduced some
+// of its lines.
+type blameSuspect struct {
+	commit  *object.Commit
+	path    string
+	entries []blameEntry
+}
 
-	b.revs, err = references(b.fRev, b.path)
-	return err
+type blameSuspectKey struct {
+	hash plumbing.Hash
+	path string
 }
 
-// build graph of a file from its revision history
-func (b *blame) fillGraphAndData() error {
-	//TODO: not all commits are needed, only the current rev and the prev
-	b.graph = make([][]*object.Commit, len(b.revs))
-	b.data = make([]string, len(b.revs)) // file contents in all the revisions
-	// for every revision of the file, starting with the first
-	// one...
-	for i, rev := range b.revs {
-		// get the contents of the file
-		file, err := rev.File(b.path)
-		if err != nil {
+// blamer walks the history of a file assigning its lines to the commits that
+// introduced them.
+type blamer struct {
+	o *BlameOptions
+	// the lines of the blamed file
+	lines []string
+	// the commits out of the blamed range
+	exclude map[plumbing.Hash]bool
+	ignore  map[plumbing.Hash]bool
+	// the suspects not processed yet, by key and in processing order
+	suspects map[blameSuspectKey]*blameSuspect
+	queue    []*blameSuspect
+}
+
+func newBlamer(c *object.Commit, path string, o *BlameOptions) (*blamer, error) {
+	file, err := c.File(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := file.Lines()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := blameLineIndexes(o.LineRanges, path, len(lines))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &blamer{
+		o:        o,
+		lines:    lines,
+		exclude:  make(map[plumbing.Hash]bool),
+		ignore:   make(map[plumbing.Hash]bool),
+		suspects: make(map[blameSuspectKey]*blameSuspect),
+	}
+
+	for _, h := range o.IgnoreRevs {
+		b.ignore[h] = true
+	}
+
+	for _, ex := range o.Exclude {
+		err := object.NewCommitPreorderIter(ex, b.exclude, nil).ForEach(func(c *object.Commit) error {
+			b.exclude[c.Hash] = true
 			return nil
-		}
-		b.data[i], err = file.Contents()
+		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		nLines := countLines(b.data[i])
-		// create a node for each line
-		b.graph[i] = make([]*object.Commit, nLines)
-		// assign a commit to each node
-		// if this is the first revision, then the node is assigned to
-		// this first commit.
-		if i == 0 {
-			for j := 0; j < nLines; j++ {
-				b.graph[i][j] = b.revs[i]
-			}
-		} else {
-			// if this is not the first commit, then assign to the old
-			// commit or to the new one, depending on what the diff
-			// says.
-			b.assignOrigin(i, i-1)
+	}
+
+	entries := make([]blameEntry, 0, len(indexes))
+	for _, i := range indexes {
+		entries = append(entries, blameEntry{final: i, line: i})
+	}
+
+	b.push(c, path, entries)
+	return b, nil
+}
+
+// blameLineIndexes returns the indexes of the lines in the given ranges of a
+// file with n lines, or all of them if there are no ranges.
+func blameLineIndexes(ranges []LineRange, path string, n int) ([]int, error) {
+	selected := make([]bool, n)
+	if len(ranges) == 0 {
+		for i := range selected {
+			selected[i] = true
 		}
 	}
+
+	for _, r := range ranges {
+		if r.Start < 1 || r.End != 0 && r.End < r.Start {
+			return nil, ErrInvalidLineRange
+		}
+
+		if r.Start > n {
+			return nil, fmt.Errorf("file %s has only %d lines", path, n)
+		}
+
+		end := r.End
+		if end == 0 || end > n {
+			end = n
+		}
+
+		for i := r.Start - 1; i < end; i++ {
+			selected[i] = true
+		}
+	}
+
+	var indexes []int
+	for i, ok := range selected {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes, nil
+}
+
+// run processes the suspects, newest commits first, calling fn for every hunk
+// once its origin is found.
+func (b *blamer) run(ctx context.Context, fn func(*BlameHunk) error) error {
+	for len(b.queue) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := b.pass(b.pop(), fn); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// sliceGraph returns a slice of commits (one per line) for a particular
-// revision of a file (0=first revision).
-func (b *blame) sliceGraph(i int) []*object.Commit {
-	fVs := b.graph[i]
-	result := make([]*object.Commit, 0, len(fVs))
-	for _, v := range fVs {
-		c := *v
-		result = append(result, &c)
+func (b *blamer) push(c *object.Commit, path string, entries []blameEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	key := blameSuspectKey{c.Hash, path}
+	if s, ok := b.suspects[key]; ok {
+		s.entries = append(s.entries, entries...)
+		return
 	}
-	return result
+
+	s := &blameSuspect{commit: c, path: path, entries: entries}
+	b.suspects[key] = s
+	b.queue = append(b.queue, s)
 }
 
-// Assigns origin to vertexes in current (c) rev from data in its previous (p)
-// revision
-func (b *blame) assignOrigin(c, p int) {
-	// assign origin based on diff info
-	hunks := diff.Do(b.data[p], b.data[c])
-	sl := -1 // source line
-	dl := -1 // destination line
-	for h := range hunks {
-		hLines := countLines(hunks[h].Text)
-		for hl := 0; hl < hLines; hl++ {
-			switch {
-			case hunks[h].Type == 0:
-				sl++
-				dl++
-				b.graph[c][dl] = b.graph[p][sl]
-			case hunks[h].Type == 1:
-				dl++
-				b.graph[c][dl] = b.revs[c]
-			case hunks[h].Type == -1:
-				sl++
-			default:
-				panic("unreachable")
-			}
+// pop removes and returns the suspect with the newest commit.
+func (b *blamer) pop() *blameSuspect {
+	next := 0
+	for i, s := range b.queue {
+		if s.commit.Committer.When.After(b.queue[next].commit.Committer.When) {
+			next = i
 		}
 	}
+
+	s := b.queue[next]
+	b.queue = append(b.queue[:next], b.queue[next+1:]...)
+	delete(b.suspects, blameSuspectKey{s.commit.Hash, s.path})
+	return s
 }
 
-// GoString prints the results of a Blame using git-blame's style.
-func (b *blame) GoString() string {
-	var buf bytes.Buffer
+func (b *blamer) isBoundary(c *object.Commit) bool {
+	return b.exclude[c.Hash] || b.o.Since != nil && c.Committer.When.Before(*b.o.Since)
+}
 
-	file, err := b.fRev.File(b.path)
+// pass passes the lines of the suspect not changed by its commit to the
+// parents, and blames the rest on the commit.
+func (b *blamer) pass(s *blameSuspect, fn func(*BlameHunk) error) error {
+	if b.isBoundary(s.commit) {
+		return b.blame(s, s.entries, true, nil, "", fn)
+	}
+
+	file, err := s.commit.File(s.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := file.Contents()
+	if err != nil {
+		return err
+	}
+
+	tree, err := s.commit.Tree()
 	if err != nil {
-		panic("PrettyPrint: internal error in repo.Data")
+		return err
 	}
-	contents, err := file.Contents()
+
+	var parents []*object.Commit
+	err = s.commit.Parents().ForEach(func(p *object.Commit) error {
+		parents = append(parents, p)
+		return nil
+	})
 	if err != nil {
-		panic("PrettyPrint: internal error in repo.Data")
+		return err
+	}
+
+	var first *blameLineMap
+	var previous *object.Commit
+	var previousPath string
+
+	entries := s.entries
+	for _, p := range parents {
+		if len(entries) == 0 {
+			break
+		}
+
+		pfile, ppath, err := b.parentFile(p, tree, s.path)
+		if err != nil {
+			return err
+		}
+
+		if pfile == nil {
+			continue
+		}
+
+		if previous == nil {
+			previous, previousPath = p, ppath
+		}
+
+		if pfile.Hash == file.Hash {
+			b.push(p, ppath, entries)
+			entries = nil
+			break
+		}
+
+		pdata, err := pfile.Contents()
+		if err != nil {
+			return err
+		}
+
+		m := newBlameLineMap(pdata, data, 0)
+		entries = b.passTo(p, ppath, entries, m.unchanged)
+
+		if first == nil {
+			first = m
+		}
 	}
 
-	lines := strings.Split(contents, "\n")
-	// max line number length
-	mlnl := len(strconv.Itoa(len(lines)))
-	// max author length
-	mal := b.maxAuthorLength()
-	format := fmt.Sprintf("%%s (%%-%ds %%%dd) %%s\n",
-		mal, mlnl)
+	if len(entries) > 0 && b.o.DetectCopies && len(parents) > 0 {
+		entries, err = b.passCopies(s, parents[0], tree, data, entries)
+		if err != nil {
+			return err
+		}
+	}
 
-	fVs := b.graph[len(b.graph)-1]
-	for ln, v := range fVs {
-		fmt.Fprintf(&buf, format, v.Hash.String()[:8],
-			prettyPrintAuthor(fVs[ln]), ln+1, lines[ln])
+	if len(entries) > 0 && b.ignore[s.commit.Hash] && first != nil {
+		entries = b.passTo(previous, previousPath, entries, first.guessed)
 	}
-	return buf.String()
+
+	return b.blame(s, entries, false, previous, previousPath, fn)
 }
 
-// utility function to pretty print the author.
-func prettyPrintAuthor(c *object.Commit) string {
-	return fmt.Sprintf("%s %s", c.Author.Name, c.Author.When.Format("2006-01-02"))
+// parentFile returns the version of the file at path in the given parent,
+// looking for its previous name if it was renamed. It returns a nil file if
+// the parent doesn't have it.
+func (b *blamer) parentFile(p *object.Commit, tree *object.Tree, path string) (*object.File, string, error) {
+	ptree, err := p.Tree()
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := ptree.File(path)
+	if err == nil {
+		return f, path, nil
+	}
+
+	if err != object.ErrFileNotFound {
+		return nil, "", err
+	}
+
+	if !b.o.DetectRenames && !b.o.DetectCopies {
+		return nil, "", nil
+	}
+
+	changes, err := object.DiffTree(ptree, tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	changes, err = object.DetectRenames(changes, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, ch := range changes {
+		if ch.To.Name != path || ch.From.Name == "" {
+			continue
+		}
+
+		f, err := ptree.File(ch.From.Name)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return f, ch.From.Name, nil
+	}
+
+	return nil, "", nil
 }
 
-// utility function to calculate the number of runes needed
-// to print the longest author name in the blame of a file.
-func (b *blame) maxAuthorLength() int {
-	memo := make(map[plumbing.Hash]struct{}, len(b.graph)-1)
-	fVs := b.graph[len(b.graph)-1]
-	m := 0
-	for ln := range fVs {
-		if _, ok := memo[fVs[ln].Hash]; ok {
+// passCopies passes the lines copied from the files modified by the commit of
+// the suspect to them, and returns the rest.
+func (b *blamer) passCopies(s *blameSuspect, p *object.Commit, tree *object.Tree, data string, entries []blameEntry) ([]blameEntry, error) {
+	ptree, err := p.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(ptree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range changes {
+		if len(entries) == 0 {
+			break
+		}
+
+		if ch.From.Name == "" || ch.From.Name == s.path {
+			continue
+		}
+
+		pfile, err := ptree.File(ch.From.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if isBinary, err := pfile.IsBinary(); err != nil || isBinary {
 			continue
 		}
-		memo[fVs[ln].Hash] = struct{}{}
-		m = max(m, utf8.RuneCountInString(prettyPrintAuthor(fVs[ln])))
+
+		pdata, err := pfile.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		m := newBlameLineMap(pdata, data, blameCopyScore)
+		entries = b.passTo(p, ch.From.Name, entries, m.unchanged)
+	}
+
+	return entries, nil
+}
+
+// passTo passes the entries mapped to a line of the parent file to it, and
+// returns the rest.
+func (b *blamer) passTo(p *object.Commit, path string, entries []blameEntry, lines []int) []blameEntry {
+	var passed, rest []blameEntry
+	for _, e := range entries {
+		if l := lines[e.line]; l >= 0 {
+			passed = append(passed, blameEntry{final: e.final, line: l})
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	b.push(p, path, passed)
+	return rest
+}
+
+// blame assigns the entries to the commit of the suspect, calling fn with
+// every hunk of consecutive lines.
+func (b *blamer) blame(s *blameSuspect, entries []blameEntry, boundary bool,
+	previous *object.Commit, previousPath string, fn func(*BlameHunk) error) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].final < entries[j].final
+	})
+
+	for len(entries) > 0 {
+		n := 1
+		for n < len(entries) &&
+			entries[n].final == entries[0].final+n &&
+			entries[n].line == entries[0].line+n {
+			n++
+		}
+
+		h := &BlameHunk{
+			Commit:       s.commit,
+			Path:         s.path,
+			Line:         entries[0].final + 1,
+			OriginalLine: entries[0].line + 1,
+			Text:         b.lines[entries[0].final : entries[0].final+n],
+			Boundary:     boundary,
+			Previous:     previous,
+			PreviousPath: previousPath,
+		}
+
+		if err := fn(h); err != nil {
+			return err
+		}
+
+		entries = entries[n:]
+	}
+
+	return nil
+}
+
+// blameLineMap maps the lines of a file to the lines of a previous version.
+type blameLineMap struct {
+	// unchanged holds the index of the same line in the previous version, or
+	// -1 if the line was added.
+	unchanged []int
+	// guessed holds, for the added lines replacing other lines, the index of
+	// the replaced line at the same offset in the hunk, or -1.
+	guessed []int
+}
+
+// newBlameLineMap diffs the src and dst versions of a file. The unchanged
+// lines are mapped only if the hunk they belong has at least minScore
+// alphanumeric characters.
+func newBlameLineMap(src, dst string, minScore int) *blameLineMap {
+	n := countLines(dst)
+	m := &blameLineMap{
+		unchanged: make([]int, n),
+		guessed:   make([]int, n),
+	}
+
+	for i := range m.unchanged {
+		m.unchanged[i] = -1
+		m.guessed[i] = -1
 	}
+
+	var deleted, added []int
+	flush := func() {
+		for i := 0; i < len(added) && i < len(deleted); i++ {
+			m.guessed[added[i]] = deleted[i]
+		}
+
+		deleted, added = deleted[:0], added[:0]
+	}
+
+	sl, dl := 0, 0
+	for _, h := range diff.Do(src, dst) {
+		hLines := countLines(h.Text)
+		switch h.Type {
+		case diffmatchpatch.DiffEqual:
+			flush()
+			match := minScore <= 0 || alphanumCount(h.Text) >= minScore
+			for i := 0; i < hLines; i++ {
+				if match {
+					m.unchanged[dl] = sl
+				}
+
+				sl++
+				dl++
+			}
+		case diffmatchpatch.DiffInsert:
+			for i := 0; i < hLines; i++ {
+				added = append(added, dl)
+				dl++
+			}
+		case diffmatchpatch.DiffDelete:
+			for i := 0; i < hLines; i++ {
+				deleted = append(deleted, sl)
+				sl++
+			}
+		}
+	}
+
+	flush()
 	return m
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+func alphanumCount(s string) int {
+	var n int
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			n++
+		}
 	}
-	return b
+
+	return n
 }
@@ -0,0 +1,143 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// BlameFormat is the output format of a BlameEncoder.
+type BlameFormat int8
+
+const (
+	// BlamePorcelain is the format of `git blame --porcelain`, the details of
+	// a commit are written only the first time it appears.
+	BlamePorcelain BlameFormat = iota
+	// BlameLinePorcelain is the format of `git blame --line-porcelain`, the
+	// details of the commit are written for every line.
+	BlameLinePorcelain
+	// BlameIncrementalFormat is the format of `git blame --incremental`, the
+	// content of the lines isn't written.
+	BlameIncrementalFormat
+)
+
+// BlameEncoder writes blame hunks in the machine readable formats of
+// `git blame`.
+type BlameEncoder struct {
+	// ShowRoot doesn't write the root commits as boundaries, as
+	// `git blame --root` does.
+	ShowRoot bool
+
+	w      io.Writer
+	format BlameFormat
+	// the path of the commits already written
+	paths map[plumbing.Hash]string
+}
+
+// NewBlameEncoder returns a new BlameEncoder writing to w in the given format.
+func NewBlameEncoder(w io.Writer, format BlameFormat) *BlameEncoder {
+	return &BlameEncoder{
+		w:      w,
+		format: format,
+		paths:  make(map[plumbing.Hash]string),
+	}
+}
+
+// Encode writes a hunk. In the incremental format the hunks can be written as
+// soon as BlameIncremental finds them, while the porcelain formats expect them
+// sorted by line number, as `git blame` writes them.
+func (e *BlameEncoder) Encode(h *BlameHunk) error {
+	hash := h.Commit.Hash.String()
+	if _, err := fmt.Fprintf(e.w, "%s %d %d %d\n", hash, h.OriginalLine, h.Line, len(h.Text)); err != nil {
+		return err
+	}
+
+	if err := e.encodeDetails(h, e.format == BlameLinePorcelain); err != nil {
+		return err
+	}
+
+	if e.format == BlameIncrementalFormat {
+		return nil
+	}
+
+	for i, text := range h.Text {
+		if i > 0 {
+			_, err := fmt.Fprintf(e.w, "%s %d %d\n", hash, h.OriginalLine+i, h.Line+i)
+			if err != nil {
+				return err
+			}
+
+			if e.format == BlameLinePorcelain {
+				if err := e.encodeDetails(h, true); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := fmt.Fprintf(e.w, "\t%s\n", text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeDetails writes the details of the commit of the hunk if they weren't
+// written yet or repeat is true, and its file name if needed.
+func (e *BlameEncoder) encodeDetails(h *BlameHunk, repeat bool) error {
+	path, seen := e.paths[h.Commit.Hash]
+	if seen && !repeat && path == h.Path && e.format != BlameIncrementalFormat {
+		return nil
+	}
+
+	if !seen || repeat {
+		e.paths[h.Commit.Hash] = h.Path
+
+		c := h.Commit
+		_, err := fmt.Fprintf(e.w,
+			"author %s\nauthor-mail <%s>\nauthor-time %d\nauthor-tz %s\n"+
+				"committer %s\ncommitter-mail <%s>\ncommitter-time %d\ncommitter-tz %s\n"+
+				"summary %s\n",
+			c.Author.Name, c.Author.Email, c.Author.When.Unix(), c.Author.When.Format("-0700"),
+			c.Committer.Name, c.Committer.Email, c.Committer.When.Unix(), c.Committer.When.Format("-0700"),
+			blameSummary(c.Message),
+		)
+		if err != nil {
+			return err
+		}
+
+		if h.Boundary || !e.ShowRoot && c.NumParents() == 0 {
+			if _, err := fmt.Fprintln(e.w, "boundary"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if h.Previous != nil {
+		_, err := fmt.Fprintf(e.w, "previous %s %s\n", h.Previous.Hash, h.PreviousPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(e.w, "filename %s\n", h.Path)
+	return err
+}
+
+// blameSummary returns the subject of a commit message: its first paragraph
+// joined in a single line.
+func blameSummary(msg string) string {
+	var lines []string
+	for _, l := range strings.Split(strings.TrimLeft(msg, "\n"), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			break
+		}
+
+		lines = append(lines, l)
+	}
+
+	return strings.Join(lines, " ")
+}
@@ -0,0 +1,200 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	. "gopkg.in/check.v1"
+)
+
+// newBlameEncoderTestCommit returns a commit with file "bar", renamed from
+// "foo", whose lines come from three commits.
+func newBlameEncoderTestCommit(c *C) *object.Commit {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	when := defaultSignature().When
+	blameCommit(c, w, when, nil, map[string]string{
+		"foo": "one\ntwo\nthree\nfour\n",
+	})
+	blameCommit(c, w, when.Add(time.Hour), nil, map[string]string{
+		"foo": "one\nTWO\nthree\nfour\nfive\n",
+	})
+	return blameCommit(c, w, when.Add(2*time.Hour), map[string]string{"foo": "bar"}, map[string]string{
+		"bar": "zero\none\nTWO\nthree\nfour\nfive\n",
+	})
+}
+
+func encodeBlame(c *C, commit *object.Commit, format BlameFormat) string {
+	var hunks []*BlameHunk
+	err := BlameIncremental(context.Background(), commit, "bar", &BlameOptions{DetectRenames: true}, func(h *BlameHunk) error {
+		hunks = append(hunks, h)
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	if format != BlameIncrementalFormat {
+		sort.Slice(hunks, func(i, j int) bool {
+			return hunks[i].Line < hunks[j].Line
+		})
+	}
+
+	var buf bytes.Buffer
+	e := NewBlameEncoder(&buf, format)
+	for _, h := range hunks {
+		c.Assert(e.Encode(h), IsNil)
+	}
+
+	return buf.String()
+}
+
+func (s *BlameSuite) TestBlameEncoderPorcelain(c *C) {
+	commit := newBlameEncoderTestCommit(c)
+	c.Assert(encodeBlame(c, commit, BlamePorcelain), Equals, ""+
+		"6afccb8c87d0c466d9a57cc3d0259efa37dcdabe 1 1 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493856223\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493856223\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"previous 92c3719edf0cd764cfe24a7b516b5c020f9a39f9 foo\n"+
+		"filename bar\n"+
+		"\tzero\n"+
+		"4a9ab7db17248fec6dbec5e26a2b5dc6902d460d 1 2 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493849023\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493849023\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"boundary\n"+
+		"filename foo\n"+
+		"\tone\n"+
+		"92c3719edf0cd764cfe24a7b516b5c020f9a39f9 2 3 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493852623\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493852623\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"previous 4a9ab7db17248fec6dbec5e26a2b5dc6902d460d foo\n"+
+		"filename foo\n"+
+		"\tTWO\n"+
+		"4a9ab7db17248fec6dbec5e26a2b5dc6902d460d 3 4 2\n"+
+		"\tthree\n"+
+		"4a9ab7db17248fec6dbec5e26a2b5dc6902d460d 4 5\n"+
+		"\tfour\n"+
+		"92c3719edf0cd764cfe24a7b516b5c020f9a39f9 5 6 1\n"+
+		"\tfive\n",
+	)
+}
+
+func (s *BlameSuite) TestBlameEncoderLinePorcelain(c *C) {
+	commit := newBlameEncoderTestCommit(c)
+	out := encodeBlame(c, commit, BlameLinePorcelain)
+
+	root := "" +
+		"author foo\n" +
+		"author-mail <foo@foo.foo>\n" +
+		"author-time 1493849023\n" +
+		"author-tz +0200\n" +
+		"committer foo\n" +
+		"committer-mail <foo@foo.foo>\n" +
+		"committer-time 1493849023\n" +
+		"committer-tz +0200\n" +
+		"summary changes\n" +
+		"boundary\n" +
+		"filename foo\n"
+
+	c.Assert(bytes.Count([]byte(out), []byte(root)), Equals, 3)
+	c.Assert(bytes.Count([]byte(out), []byte("\nauthor foo\n")), Equals, 6)
+}
+
+func (s *BlameSuite) TestBlameEncoderIncremental(c *C) {
+	commit := newBlameEncoderTestCommit(c)
+	c.Assert(encodeBlame(c, commit, BlameIncrementalFormat), Equals, ""+
+		"6afccb8c87d0c466d9a57cc3d0259efa37dcdabe 1 1 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493856223\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493856223\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"previous 92c3719edf0cd764cfe24a7b516b5c020f9a39f9 foo\n"+
+		"filename bar\n"+
+		"92c3719edf0cd764cfe24a7b516b5c020f9a39f9 2 3 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493852623\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493852623\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"previous 4a9ab7db17248fec6dbec5e26a2b5dc6902d460d foo\n"+
+		"filename foo\n"+
+		"92c3719edf0cd764cfe24a7b516b5c020f9a39f9 5 6 1\n"+
+		"previous 4a9ab7db17248fec6dbec5e26a2b5dc6902d460d foo\n"+
+		"filename foo\n"+
+		"4a9ab7db17248fec6dbec5e26a2b5dc6902d460d 1 2 1\n"+
+		"author foo\n"+
+		"author-mail <foo@foo.foo>\n"+
+		"author-time 1493849023\n"+
+		"author-tz +0200\n"+
+		"committer foo\n"+
+		"committer-mail <foo@foo.foo>\n"+
+		"committer-time 1493849023\n"+
+		"committer-tz +0200\n"+
+		"summary changes\n"+
+		"boundary\n"+
+		"filename foo\n"+
+		"4a9ab7db17248fec6dbec5e26a2b5dc6902d460d 3 4 2\n"+
+		"filename foo\n",
+	)
+}
+
+func (s *BlameSuite) TestBlameEncoderShowRoot(c *C) {
+	commit := newBlameEncoderTestCommit(c)
+	hunks := []*BlameHunk{}
+	err := BlameIncremental(context.Background(), commit, "bar", nil, func(h *BlameHunk) error {
+		hunks = append(hunks, h)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(hunks, HasLen, 1)
+
+	var buf bytes.Buffer
+	e := NewBlameEncoder(&buf, BlameIncrementalFormat)
+	e.ShowRoot = true
+	hunks[0].Commit = &object.Commit{Hash: commit.Hash, Author: commit.Author, Committer: commit.Committer, Message: "root\n"}
+	c.Assert(e.Encode(hunks[0]), IsNil)
+	c.Assert(bytes.Contains(buf.Bytes(), []byte("boundary")), Equals, false)
+	c.Assert(bytes.Contains(buf.Bytes(), []byte("summary root\n")), Equals, true)
+}
+
+func (s *BlameSuite) TestBlameSummary(c *C) {
+	c.Assert(blameSummary("\nfoo\n  bar  baz \n\nbody\n"), Equals, "foo bar  baz")
+	c.Assert(blameSummary("foo"), Equals, "foo")
+}
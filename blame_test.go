@@ -1,10 +1,18 @@
 package git
 
 import (
+	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
 	. "gopkg.in/check.v1"
@@ -16,29 +24,33 @@ type BlameSuite struct {
 
 var _ = Suite(&BlameSuite{})
 
-func (s *BlameSuite) TestNewLines(c *C) {
-	h := plumbing.NewHash("ce9f123d790717599aaeb76bc62510de437761be")
-	lines, err := newLines([]string{"foo"}, []*object.Commit{{
-		Hash:    h,
-		Message: "foo",
-	}})
-
-	c.Assert(err, IsNil)
-	c.Assert(lines, HasLen, 1)
-	c.Assert(lines[0].Text, Equals, "foo")
-	c.Assert(lines[0].Hash, Equals, h)
-}
+func (s *BlameSuite) TestBlameLines(c *C) {
+	_, w := newTestRepository(c, nil)
 
-func (s *BlameSuite) TestNewLinesWithNewLine(c *C) {
-	lines, err := newLines([]string{"foo"}, []*object.Commit{
-		{Message: "foo"},
-		{Message: "bar"},
+	when := defaultSignature().When
+	first := blameCommit(c, w, when, nil, map[string]string{"foo": "foo\n"})
+	second := blameCommit(c, w, when.Add(time.Hour), nil, map[string]string{
+		"foo": "foo\nbar",
 	})
 
+	result, err := Blame(second, "foo")
 	c.Assert(err, IsNil)
-	c.Assert(lines, HasLen, 2)
-	c.Assert(lines[0].Text, Equals, "foo")
-	c.Assert(lines[1].Text, Equals, "\n")
+	c.Assert(result.Lines, HasLen, 2)
+
+	for i, expected := range []struct {
+		text   string
+		commit *object.Commit
+	}{
+		{"foo", first},
+		{"bar", second},
+	} {
+		l := result.Lines[i]
+		c.Assert(l.Text, Equals, expected.text)
+		c.Assert(l.Hash, Equals, expected.commit.Hash)
+		c.Assert(l.Author.Name, Equals, expected.commit.Author.Name)
+		c.Assert(l.Message, Equals, expected.commit.Message)
+		c.Assert(l.LineNumber, Equals, i+1)
+	}
 }
 
 type blameTest struct {
@@ -66,6 +78,7 @@ func (s *BlameSuite) TestBlame(c *C) {
 
 		obt, err := Blame(commit, t.path)
 		c.Assert(err, IsNil)
+		s.assertOriginalLines(c, r, obt, exp)
 		c.Assert(obt, DeepEquals, exp)
 
 		for i, l := range obt.Lines {
@@ -82,6 +95,7 @@ func (s *BlameSuite) TestBlame(c *C) {
 
 		obt, err := Blame(commit, t.base.path)
 		c.Assert(err, IsNil)
+		s.assertOriginalLines(c, r, obt, exp)
 		c.Assert(obt, DeepEquals, exp)
 
 		for i, l := range obt.Lines {
@@ -110,10 +124,12 @@ func (s *BlameSuite) mockBlame(c *C, t blameTest, r *Repository) (blame *BlameRe
 		commit, err := r.CommitObject(plumbing.NewHash(t.blames[i]))
 		c.Assert(err, IsNil)
 		l := &Line{
-			Author: commit.Author,
-			Text:   lines[i],
-			Hash:   commit.Hash,
-			Message: commit.Message,
+			Author:       commit.Author,
+			Text:         lines[i],
+			Hash:         commit.Hash,
+			Message:      commit.Message,
+			LineNumber:   i + 1,
+			OriginalPath: t.path,
 		}
 		blamedLines = append(blamedLines, l)
 	}
@@ -125,6 +141,256 @@ func (s *BlameSuite) mockBlame(c *C, t blameTest, r *Repository) (blame *BlameRe
 	}
 }
 
+// assertOriginalLines checks that the original line of every obtained line
+// holds its text, and copies it to the expected result.
+func (s *BlameSuite) assertOriginalLines(c *C, r *Repository, obt, exp *BlameResult) {
+	c.Assert(obt.Lines, HasLen, len(exp.Lines))
+	for i, l := range obt.Lines {
+		commit, err := r.CommitObject(l.Hash)
+		c.Assert(err, IsNil)
+		f, err := commit.File(l.OriginalPath)
+		c.Assert(err, IsNil)
+		lines, err := f.Lines()
+		c.Assert(err, IsNil)
+		c.Assert(l.OriginalLine > 0 && l.OriginalLine <= len(lines), Equals, true)
+		c.Assert(lines[l.OriginalLine-1], Equals, l.Text)
+
+		exp.Lines[i].OriginalLine = l.OriginalLine
+	}
+}
+
+// blameCommit commits the given files at the given time, moving the files in
+// moves first.
+func blameCommit(c *C, w *Worktree, when time.Time, moves map[string]string, files map[string]string) *object.Commit {
+	for from, to := range moves {
+		_, err := w.Move(from, to)
+		c.Assert(err, IsNil)
+	}
+
+	for name, content := range files {
+		err := util.WriteFile(w.Filesystem, name, []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	sig := defaultSignature()
+	sig.When = when
+	h, err := w.Commit("changes\n", &CommitOptions{Author: sig})
+	c.Assert(err, IsNil)
+
+	commit, err := w.r.CommitObject(h)
+	c.Assert(err, IsNil)
+	return commit
+}
+
+type blameOrigin struct {
+	hash     plumbing.Hash
+	path     string
+	line     int
+	boundary bool
+}
+
+func blameOrigins(c *C, commit *object.Commit, path string, o *BlameOptions) []blameOrigin {
+	b, err := BlameWithOptions(commit, path, o)
+	c.Assert(err, IsNil)
+
+	var origins []blameOrigin
+	for _, l := range b.Lines {
+		origins = append(origins, blameOrigin{l.Hash, l.OriginalPath, l.OriginalLine, l.Boundary})
+	}
+
+	return origins
+}
+
+func (s *BlameSuite) TestBlameWithOptions(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	when := defaultSignature().When
+	first := blameCommit(c, w, when, nil, map[string]string{
+		"foo": "one\ntwo\nthree\n",
+	})
+	second := blameCommit(c, w, when.Add(time.Hour), nil, map[string]string{
+		"foo": "one\nTWO\nthree\n",
+	})
+	third := blameCommit(c, w, when.Add(2*time.Hour), map[string]string{"foo": "bar"}, map[string]string{
+		"bar": "one\nTWO\nthree\nfour\n",
+	})
+
+	c.Assert(blameOrigins(c, third, "bar", nil), DeepEquals, []blameOrigin{
+		{third.Hash, "bar", 1, false},
+		{third.Hash, "bar", 2, false},
+		{third.Hash, "bar", 3, false},
+		{third.Hash, "bar", 4, false},
+	})
+
+	c.Assert(blameOrigins(c, third, "bar", &BlameOptions{DetectRenames: true}), DeepEquals, []blameOrigin{
+		{first.Hash, "foo", 1, false},
+		{second.Hash, "foo", 2, false},
+		{first.Hash, "foo", 3, false},
+		{third.Hash, "bar", 4, false},
+	})
+
+	c.Assert(blameOrigins(c, third, "bar", &BlameOptions{
+		DetectRenames: true,
+		IgnoreRevs:    []plumbing.Hash{second.Hash},
+	}), DeepEquals, []blameOrigin{
+		{first.Hash, "foo", 1, false},
+		{first.Hash, "foo", 2, false},
+		{first.Hash, "foo", 3, false},
+		{third.Hash, "bar", 4, false},
+	})
+
+	c.Assert(blameOrigins(c, third, "bar", &BlameOptions{
+		DetectRenames: true,
+		Exclude:       []*object.Commit{second},
+	}), DeepEquals, []blameOrigin{
+		{second.Hash, "foo", 1, true},
+		{second.Hash, "foo", 2, true},
+		{second.Hash, "foo", 3, true},
+		{third.Hash, "bar", 4, false},
+	})
+
+	since := when.Add(30 * time.Minute)
+	c.Assert(blameOrigins(c, third, "bar", &BlameOptions{
+		DetectRenames: true,
+		Since:         &since,
+	}), DeepEquals, []blameOrigin{
+		{first.Hash, "foo", 1, true},
+		{second.Hash, "foo", 2, false},
+		{first.Hash, "foo", 3, true},
+		{third.Hash, "bar", 4, false},
+	})
+}
+
+func (s *BlameSuite) TestBlameWithOptionsLineRanges(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	when := defaultSignature().When
+	blameCommit(c, w, when, nil, map[string]string{"foo": "1\n2\n3\n4\n5\n6\n"})
+	commit := blameCommit(c, w, when.Add(time.Hour), nil, map[string]string{"foo": "1\n2\n3\n4\n5\nsix\n"})
+
+	b, err := BlameWithOptions(commit, "foo", &BlameOptions{
+		LineRanges: []LineRange{{Start: 5}, {Start: 2, End: 3}, {Start: 3, End: 3}},
+	})
+	c.Assert(err, IsNil)
+
+	var numbers []int
+	var texts []string
+	for _, l := range b.Lines {
+		numbers = append(numbers, l.LineNumber)
+		texts = append(texts, l.Text)
+	}
+
+	c.Assert(numbers, DeepEquals, []int{2, 3, 5, 6})
+	c.Assert(texts, DeepEquals, []string{"2", "3", "5", "six"})
+	c.Assert(b.Lines[3].Hash, Equals, commit.Hash)
+	c.Assert(b.Lines[2].Hash, Not(Equals), commit.Hash)
+
+	for _, lr := range []LineRange{{Start: 0, End: 2}, {Start: 3, End: 2}} {
+		_, err = BlameWithOptions(commit, "foo", &BlameOptions{LineRanges: []LineRange{lr}})
+		c.Assert(err, Equals, ErrInvalidLineRange)
+	}
+
+	_, err = BlameWithOptions(commit, "foo", &BlameOptions{LineRanges: []LineRange{{Start: 7}}})
+	c.Assert(err, ErrorMatches, "file foo has only 6 lines")
+}
+
+func (s *BlameSuite) TestBlameWithOptionsCopies(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	block := "func copied(a, b int) int {\n\treturn a + b\n}\n"
+	when := defaultSignature().When
+	first := blameCommit(c, w, when, nil, map[string]string{
+		"foo.go": "package foo\n\n" + block,
+		"bar.go": "package bar\n",
+	})
+	second := blameCommit(c, w, when.Add(time.Hour), nil, map[string]string{
+		"foo.go": "package foo\n",
+		"bar.go": "package bar\n\n" + block,
+	})
+
+	c.Assert(blameOrigins(c, second, "bar.go", nil), DeepEquals, []blameOrigin{
+		{first.Hash, "bar.go", 1, false},
+		{second.Hash, "bar.go", 2, false},
+		{second.Hash, "bar.go", 3, false},
+		{second.Hash, "bar.go", 4, false},
+		{second.Hash, "bar.go", 5, false},
+	})
+
+	c.Assert(blameOrigins(c, second, "bar.go", &BlameOptions{DetectCopies: true}), DeepEquals, []blameOrigin{
+		{first.Hash, "bar.go", 1, false},
+		{first.Hash, "foo.go", 2, false},
+		{first.Hash, "foo.go", 3, false},
+		{first.Hash, "foo.go", 4, false},
+		{first.Hash, "foo.go", 5, false},
+	})
+}
+
+func (s *BlameSuite) TestBlameIncremental(c *C) {
+	r := s.NewRepositoryFromPackfile(fixtures.Basic().One())
+	commit, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	result, err := Blame(commit, "CHANGELOG")
+	c.Assert(err, IsNil)
+
+	var lines []*Line
+	err = BlameIncremental(context.Background(), commit, "CHANGELOG", nil, func(h *BlameHunk) error {
+		c.Assert(h.Text, Not(HasLen), 0)
+		lines = append(lines, h.lines()...)
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].LineNumber < lines[j].LineNumber
+	})
+	c.Assert(lines, DeepEquals, result.Lines)
+
+	var calls int
+	err = BlameIncremental(context.Background(), commit, "CHANGELOG", nil, func(h *BlameHunk) error {
+		calls++
+		return storer.ErrStop
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = BlameIncremental(ctx, commit, "CHANGELOG", nil, func(h *BlameHunk) error {
+		c.Fatal("unexpected hunk")
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *BlameSuite) TestReadIgnoreRevs(c *C) {
+	revs, err := ReadIgnoreRevs(strings.NewReader(`# formatting
+6ecf0ef2c2dffb796033e5a02219af86ec6584e5
+
+  b8e471f58bcbca63b07bda20e428190409c2db47 # typo fixes
+`))
+	c.Assert(err, IsNil)
+	c.Assert(revs, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"),
+	})
+
+	_, err = ReadIgnoreRevs(strings.NewReader("6ecf0ef\n"))
+	c.Assert(err, ErrorMatches, "invalid object name: 6ecf0ef")
+}
+
 // utility function to avoid writing so many repeated commits
 func repeat(s string, n int) []string {
 	if n < 0 {
@@ -59,6 +59,24 @@ type Config struct {
 		// CommentChar is the character indicating the start of a
 		// comment for commands like commit and tag
 		CommentChar string
+		// SparseCheckout enables the sparse checkout, only the files matching
+		// the patterns of .git/info/sparse-checkout being checked out.
+		SparseCheckout bool
+		// SparseCheckoutCone restricts the sparse checkout patterns to
+		// directories, as written by the cone mode.
+		SparseCheckoutCone bool
+		// AutoCRLF converts the line endings of the text files without text
+		// or eol attributes: "true" converts them to CRLF on checkout and to
+		// LF when adding them, "input" only converts them when adding them.
+		AutoCRLF string
+		// EOL is the line ending of the text files in the worktree when
+		// neither the eol attribute nor AutoCRLF sets it: "lf", "crlf" or
+		// "native", the default.
+		EOL string
+		// SafeCRLF checks that the line ending conversions of the files being
+		// added are reversible. If "true" the irreversible conversions are
+		// rejected.
+		SafeCRLF string
 	}
 
 	User struct {
@@ -89,6 +107,13 @@ type Config struct {
 		Window uint
 	}
 
+	Index struct {
+		// Sparse enables the sparse index in cone mode sparse checkouts,
+		// the directories outside of the sparse checkout being recorded as
+		// a single entry of the index.
+		Sparse bool
+	}
+
 	// Remotes list of repository remotes, the key of the map is the name
 	// of the remote, should equal to RemoteConfig.Name.
 	Remotes map[string]*RemoteConfig
@@ -98,6 +123,9 @@ type Config struct {
 	// Branches list of branches, the key is the branch name and should
 	// equal Branch.Name
 	Branches map[string]*Branch
+	// Filters list of filter drivers, the key is the name of the driver and
+	// should equal Filter.Name
+	Filters map[string]*Filter
 	// Raw contains the raw information of a config file. The main goal is
 	// preserve the parsed information from the original format, to avoid
 	// dropping unsupported fields.
@@ -110,6 +138,7 @@ func NewConfig() *Config {
 		Remotes:    make(map[string]*RemoteConfig),
 		Submodules: make(map[string]*Submodule),
 		Branches:   make(map[string]*Branch),
+		Filters:    make(map[string]*Filter),
 		Raw:        format.New(),
 	}
 
@@ -211,28 +240,50 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for name, f := range c.Filters {
+		if f.Name != name {
+			return ErrInvalid
+		}
+
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 const (
-	remoteSection    = "remote"
-	submoduleSection = "submodule"
-	branchSection    = "branch"
-	coreSection      = "core"
-	packSection      = "pack"
-	userSection      = "user"
-	authorSection    = "author"
-	committerSection = "committer"
-	fetchKey         = "fetch"
-	urlKey           = "url"
-	bareKey          = "bare"
-	worktreeKey      = "worktree"
-	commentCharKey   = "commentChar"
-	windowKey        = "window"
-	mergeKey         = "merge"
-	rebaseKey        = "rebase"
-	nameKey          = "name"
-	emailKey         = "email"
+	remoteSection         = "remote"
+	submoduleSection      = "submodule"
+	branchSection         = "branch"
+	filterSection         = "filter"
+	coreSection           = "core"
+	packSection           = "pack"
+	indexSection          = "index"
+	userSection           = "user"
+	authorSection         = "author"
+	committerSection      = "committer"
+	fetchKey              = "fetch"
+	urlKey                = "url"
+	bareKey               = "bare"
+	worktreeKey           = "worktree"
+	commentCharKey        = "commentChar"
+	sparseCheckoutKey     = "sparseCheckout"
+	sparseCheckoutConeKey = "sparseCheckoutCone"
+	autoCRLFKey           = "autocrlf"
+	eolKey                = "eol"
+	safeCRLFKey           = "safecrlf"
+	windowKey             = "window"
+	sparseKey             = "sparse"
+	mergeKey              = "merge"
+	rebaseKey             = "rebase"
+	nameKey               = "name"
+	cleanKey              = "clean"
+	smudgeKey             = "smudge"
+	processKey            = "process"
+	requiredKey           = "required"
+	emailKey              = "email"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
@@ -251,6 +302,7 @@ func (c *Config) Unmarshal(b []byte) error {
 
 	c.unmarshalCore()
 	c.unmarshalUser()
+	c.unmarshalIndex()
 	if err := c.unmarshalPack(); err != nil {
 		return err
 	}
@@ -260,6 +312,10 @@ func (c *Config) Unmarshal(b []byte) error {
 		return err
 	}
 
+	if err := c.unmarshalFilters(); err != nil {
+		return err
+	}
+
 	return c.unmarshalRemotes()
 }
 
@@ -271,6 +327,11 @@ func (c *Config) unmarshalCore() {
 
 	c.Core.Worktree = s.Options.Get(worktreeKey)
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
+	c.Core.SparseCheckout = s.Options.Get(sparseCheckoutKey) == "true"
+	c.Core.SparseCheckoutCone = s.Options.Get(sparseCheckoutConeKey) == "true"
+	c.Core.AutoCRLF = s.Options.Get(autoCRLFKey)
+	c.Core.EOL = s.Options.Get(eolKey)
+	c.Core.SafeCRLF = s.Options.Get(safeCRLFKey)
 }
 
 func (c *Config) unmarshalUser() {
@@ -287,6 +348,11 @@ func (c *Config) unmarshalUser() {
 	c.Committer.Email = s.Options.Get(emailKey)
 }
 
+func (c *Config) unmarshalIndex() {
+	s := c.Raw.Section(indexSection)
+	c.Index.Sparse = s.Options.Get(sparseKey) == "true"
+}
+
 func (c *Config) unmarshalPack() error {
 	s := c.Raw.Section(packSection)
 	window := s.Options.Get(windowKey)
@@ -344,14 +410,30 @@ func (c *Config) unmarshalBranches() error {
 	return nil
 }
 
+func (c *Config) unmarshalFilters() error {
+	fs := c.Raw.Section(filterSection)
+	for _, sub := range fs.Subsections {
+		f := &Filter{}
+
+		if err := f.unmarshal(sub); err != nil {
+			return err
+		}
+
+		c.Filters[f.Name] = f
+	}
+	return nil
+}
+
 // Marshal returns Config encoded as a git-config file.
 func (c *Config) Marshal() ([]byte, error) {
 	c.marshalCore()
 	c.marshalUser()
 	c.marshalPack()
+	c.marshalIndex()
 	c.marshalRemotes()
 	c.marshalSubmodules()
 	c.marshalBranches()
+	c.marshalFilters()
 
 	buf := bytes.NewBuffer(nil)
 	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
@@ -368,6 +450,27 @@ func (c *Config) marshalCore() {
 	if c.Core.Worktree != "" {
 		s.SetOption(worktreeKey, c.Core.Worktree)
 	}
+
+	// the sparse checkout options are only written once set
+	if c.Core.SparseCheckout || s.Options.Get(sparseCheckoutKey) != "" {
+		s.SetOption(sparseCheckoutKey, fmt.Sprintf("%t", c.Core.SparseCheckout))
+	}
+
+	if c.Core.SparseCheckoutCone || s.Options.Get(sparseCheckoutConeKey) != "" {
+		s.SetOption(sparseCheckoutConeKey, fmt.Sprintf("%t", c.Core.SparseCheckoutCone))
+	}
+
+	if c.Core.AutoCRLF != "" {
+		s.SetOption(autoCRLFKey, c.Core.AutoCRLF)
+	}
+
+	if c.Core.EOL != "" {
+		s.SetOption(eolKey, c.Core.EOL)
+	}
+
+	if c.Core.SafeCRLF != "" {
+		s.SetOption(safeCRLFKey, c.Core.SafeCRLF)
+	}
 }
 
 func (c *Config) marshalUser() {
@@ -406,6 +509,13 @@ func (c *Config) marshalPack() {
 	}
 }
 
+func (c *Config) marshalIndex() {
+	s := c.Raw.Section(indexSection)
+	if c.Index.Sparse || s.Options.Get(sparseKey) != "" {
+		s.SetOption(sparseKey, fmt.Sprintf("%t", c.Index.Sparse))
+	}
+}
+
 func (c *Config) marshalRemotes() {
 	s := c.Raw.Section(remoteSection)
 	newSubsections := make(format.Subsections, 0, len(c.Remotes))
@@ -475,6 +585,33 @@ func (c *Config) marshalBranches() {
 	s.Subsections = newSubsections
 }
 
+func (c *Config) marshalFilters() {
+	s := c.Raw.Section(filterSection)
+	newSubsections := make(format.Subsections, 0, len(c.Filters))
+	added := make(map[string]bool)
+	for _, subsection := range s.Subsections {
+		if filter, ok := c.Filters[subsection.Name]; ok {
+			newSubsections = append(newSubsections, filter.marshal())
+			added[subsection.Name] = true
+		}
+	}
+
+	filterNames := make([]string, 0, len(c.Filters))
+	for name := range c.Filters {
+		filterNames = append(filterNames, name)
+	}
+
+	sort.Strings(filterNames)
+
+	for _, name := range filterNames {
+		if !added[name] {
+			newSubsections = append(newSubsections, c.Filters[name].marshal())
+		}
+	}
+
+	s.Subsections = newSubsections
+}
+
 // RemoteConfig contains the configuration for a given remote repository.
 type RemoteConfig struct {
 	// Name of the remote
@@ -174,6 +174,42 @@ func (s *ConfigSuite) TestUnmarshalMarshal(c *C) {
 	c.Assert(string(output), DeepEquals, string(input))
 }
 
+func (s *ConfigSuite) TestSparseCheckout(c *C) {
+	cfg := NewConfig()
+	err := cfg.Unmarshal([]byte("[core]\n\tsparseCheckout = true\n\tsparseCheckoutCone = true\n[index]\n\tsparse = true\n"))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.SparseCheckout, Equals, true)
+	c.Assert(cfg.Core.SparseCheckoutCone, Equals, true)
+	c.Assert(cfg.Index.Sparse, Equals, true)
+
+	cfg.Core.SparseCheckout = false
+	cfg.Core.SparseCheckoutCone = false
+	cfg.Index.Sparse = false
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "[core]\n\tbare = false\n\tsparseCheckout = false\n\tsparseCheckoutCone = false\n[index]\n\tsparse = false\n")
+
+	output, err = NewConfig().Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "[core]\n\tbare = false\n")
+}
+
+func (s *ConfigSuite) TestLineEndings(c *C) {
+	cfg := NewConfig()
+	err := cfg.Unmarshal([]byte("[core]\n\tautocrlf = input\n\teol = crlf\n\tsafecrlf = true\n"))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.AutoCRLF, Equals, "input")
+	c.Assert(cfg.Core.EOL, Equals, "crlf")
+	c.Assert(cfg.Core.SafeCRLF, Equals, "true")
+
+	cfg = NewConfig()
+	cfg.Core.AutoCRLF = "true"
+	cfg.Core.EOL = "lf"
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "[core]\n\tbare = false\n\tautocrlf = true\n\teol = lf\n")
+}
+
 func (s *ConfigSuite) TestLoadConfig(c *C) {
 	cfg, err := LoadConfig(GlobalScope)
 	c.Assert(cfg.User.Email, Not(Equals), "")
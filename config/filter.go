@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+)
+
+var (
+	errFilterEmptyName = errors.New("filter config: empty name")
+)
+
+// Filter contains the commands of a filter driver, converting the content of
+// the files with the filter attribute naming it.
+type Filter struct {
+	// Name of the filter driver.
+	Name string
+	// Clean is the command converting the content of the files when adding
+	// them to the repository.
+	Clean string
+	// Smudge is the command converting the content of the files when
+	// checking them out.
+	Smudge string
+	// Process is the command of a long-running process converting the
+	// content of all the files, used in place of Clean and Smudge.
+	Process string
+	// Required makes the conversions fail if the filter fails, instead of
+	// leaving the content of the files untouched.
+	Required bool
+
+	raw *format.Subsection
+}
+
+// Validate validates fields of filter
+func (f *Filter) Validate() error {
+	if f.Name == "" {
+		return errFilterEmptyName
+	}
+
+	return nil
+}
+
+func (f *Filter) marshal() *format.Subsection {
+	if f.raw == nil {
+		f.raw = &format.Subsection{}
+	}
+
+	f.raw.Name = f.Name
+
+	for _, o := range []struct{ key, value string }{
+		{cleanKey, f.Clean},
+		{smudgeKey, f.Smudge},
+		{processKey, f.Process},
+	} {
+		if o.value == "" {
+			f.raw.RemoveOption(o.key)
+		} else {
+			f.raw.SetOption(o.key, o.value)
+		}
+	}
+
+	if f.Required || f.raw.Options.Get(requiredKey) != "" {
+		f.raw.SetOption(requiredKey, fmt.Sprintf("%t", f.Required))
+	}
+
+	return f.raw
+}
+
+func (f *Filter) unmarshal(s *format.Subsection) error {
+	f.raw = s
+
+	f.Name = f.raw.Name
+	f.Clean = f.raw.Options.Get(cleanKey)
+	f.Smudge = f.raw.Options.Get(smudgeKey)
+	f.Process = f.raw.Options.Get(processKey)
+	f.Required = f.raw.Options.Get(requiredKey) == "true"
+
+	return f.Validate()
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+func (s *FilterSuite) TestValidateName(c *C) {
+	c.Assert((&Filter{Name: "lfs"}).Validate(), IsNil)
+	c.Assert((&Filter{Clean: "cat"}).Validate(), NotNil)
+}
+
+func (s *FilterSuite) TestMarshal(c *C) {
+	expected := []byte(`[core]
+	bare = false
+[filter "lfs"]
+	process = git-lfs filter-process
+	required = true
+[filter "upper"]
+	clean = tr a-z A-Z
+	smudge = tr A-Z a-z
+`)
+
+	cfg := NewConfig()
+	cfg.Filters["upper"] = &Filter{
+		Name:   "upper",
+		Clean:  "tr a-z A-Z",
+		Smudge: "tr A-Z a-z",
+	}
+	cfg.Filters["lfs"] = &Filter{
+		Name:     "lfs",
+		Process:  "git-lfs filter-process",
+		Required: true,
+	}
+
+	actual, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(actual), Equals, string(expected))
+}
+
+func (s *FilterSuite) TestUnmarshal(c *C) {
+	input := []byte(`[core]
+	bare = false
+[filter "lfs"]
+	clean = git-lfs clean -- %f
+	smudge = git-lfs smudge -- %f
+	process = git-lfs filter-process
+	required = true
+`)
+
+	cfg := NewConfig()
+	err := cfg.Unmarshal(input)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Filters, HasLen, 1)
+
+	f := cfg.Filters["lfs"]
+	c.Assert(f.Name, Equals, "lfs")
+	c.Assert(f.Clean, Equals, "git-lfs clean -- %f")
+	c.Assert(f.Smudge, Equals, "git-lfs smudge -- %f")
+	c.Assert(f.Process, Equals, "git-lfs filter-process")
+	c.Assert(f.Required, Equals, true)
+
+	f.Required = false
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, strings.Replace(string(input), "required = true", "required = false", 1))
+}
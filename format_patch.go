@@ -0,0 +1,584 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/mbox"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// FormatPatch returns the patches of the commits selected by
+// FormatPatchOptions.Revisions as email messages, the oldest first, as git
+// format-patch does. Each message holds the author, the date and the message
+// of the commit, followed by a diffstat and the patch, including the binary
+// files. The messages can be written to a mailbox with mbox.Encoder, and
+// applied with Worktree.ApplyMailbox or git am.
+func (r *Repository) FormatPatch(o *FormatPatchOptions) ([]*mbox.Message, error) {
+	if o == nil {
+		o = &FormatPatchOptions{}
+	}
+
+	if err := o.Validate(r); err != nil {
+		return nil, err
+	}
+
+	commits, err := r.formatPatchCommits(o.Revisions, o.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(commits)
+	numbered := !o.NoNumbered && (o.Numbered || o.CoverLetter || total > 1)
+	subject := func(n int, s string) string {
+		if !numbered {
+			return fmt.Sprintf("[%s] %s", o.SubjectPrefix, s)
+		}
+
+		last := o.StartNumber + total - 1
+		return fmt.Sprintf("[%s %0*d/%d] %s", o.SubjectPrefix, len(fmt.Sprint(last)), n, last, s)
+	}
+
+	var messages []*mbox.Message
+	if o.CoverLetter && total != 0 {
+		m, err := r.coverLetter(commits, o)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Subject = subject(0, o.CoverLetterSubject)
+		messages = append(messages, m)
+	}
+
+	for i, c := range commits {
+		changes, patch, err := r.commitPatch(c, o.PatchOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		b := &strings.Builder{}
+		title, body := splitCommitMessage(c.Message)
+		if body != "" {
+			b.WriteString(body)
+		}
+
+		b.WriteString("---\n")
+		if err := writeDiffstat(b, changes, patch); err != nil {
+			return nil, err
+		}
+
+		b.WriteByte('\n')
+
+		err = fdiff.NewUnifiedEncoder(b, fdiff.DefaultContextLines).SetBinary(true).Encode(patch)
+		if err != nil {
+			return nil, err
+		}
+
+		writeMailSignature(b, o.Signature)
+		messages = append(messages, &mbox.Message{
+			Hash: c.Hash,
+			Author: mbox.Signature{
+				Name:  c.Author.Name,
+				Email: c.Author.Email,
+				When:  c.Author.When,
+			},
+			Subject: subject(o.StartNumber+i, title),
+			Body:    b.String(),
+		})
+	}
+
+	return messages, nil
+}
+
+// formatPatchCommits returns the commits selected by the revisions, the
+// oldest first, skipping the merge commits.
+func (r *Repository) formatPatchCommits(revisions []string, root bool) ([]*object.Commit, error) {
+	if !root && len(revisions) == 1 && !strings.Contains(revisions[0], "..") && !strings.HasPrefix(revisions[0], "^") {
+		revisions = []string{revisions[0] + "..HEAD"}
+	}
+
+	maxParents := 1
+	iter, err := r.Log(&LogOptions{Revisions: revisions, MaxParents: &maxParents})
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	err = iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil && err != storer.ErrStop {
+		return nil, err
+	}
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	return commits, nil
+}
+
+// commitPatch returns the changes introduced by the commit, detecting the
+// renames, and their patch.
+func (r *Repository) commitPatch(c *object.Commit, opts *object.PatchOptions) (object.Changes, *object.Patch, error) {
+	var from *object.Tree
+	if c.NumParents() != 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if from, err = parent.Tree(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	to, err := c.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return treesPatch(from, to, opts)
+}
+
+// treesPatch returns the changes between the trees and their patch, holding
+// a file patch per change.
+func treesPatch(from, to *object.Tree, opts *object.PatchOptions) (object.Changes, *object.Patch, error) {
+	ctx := context.Background()
+	changes, err := object.DiffTreeWithOptions(ctx, from, to, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	patch, err := changes.PatchWithOptions(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return changes, patch, nil
+}
+
+// coverLetter returns the cover letter of the patches of the commits, with
+// a shortlog of the commits and the diffstat of all their changes.
+func (r *Repository) coverLetter(commits []*object.Commit, o *FormatPatchOptions) (*mbox.Message, error) {
+	first, last := commits[0], commits[len(commits)-1]
+	var from *object.Tree
+	if first.NumParents() != 0 {
+		parent, err := first.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if from, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	to, err := last.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, patch, err := treesPatch(from, to, o.PatchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(strings.TrimRight(o.CoverLetterBody, "\n"))
+	b.WriteString("\n\n")
+	writeShortlog(b, commits)
+	if err := writeDiffstat(b, changes, patch); err != nil {
+		return nil, err
+	}
+
+	b.WriteByte('\n')
+	writeMailSignature(b, o.Signature)
+
+	when := o.Author.When
+	if when.IsZero() {
+		when = time.Now()
+	}
+
+	return &mbox.Message{
+		Hash: last.Hash,
+		Author: mbox.Signature{
+			Name:  o.Author.Name,
+			Email: o.Author.Email,
+			When:  when,
+		},
+		Body: b.String(),
+	}, nil
+}
+
+// writeShortlog writes the subjects of the commits grouped by author, as git
+// shortlog does.
+func writeShortlog(b *strings.Builder, commits []*object.Commit) {
+	subjects := make(map[string][]string)
+	var authors []string
+	for _, c := range commits {
+		if _, ok := subjects[c.Author.Name]; !ok {
+			authors = append(authors, c.Author.Name)
+		}
+
+		title, _ := splitCommitMessage(c.Message)
+		subjects[c.Author.Name] = append(subjects[c.Author.Name], title)
+	}
+
+	sort.Strings(authors)
+	for _, author := range authors {
+		fmt.Fprintf(b, "%s (%d):\n", author, len(subjects[author]))
+		for _, s := range subjects[author] {
+			fmt.Fprintf(b, "  %s\n", s)
+		}
+
+		b.WriteByte('\n')
+	}
+}
+
+// diffstatWidth is the width of the diffstats of the messages, as the
+// MAIL_DEFAULT_WRAP of git.
+const diffstatWidth = 72
+
+// diffstatFile is the line of a file in a diffstat, counting the changed
+// lines of a text file or the sizes of a binary file.
+type diffstatFile struct {
+	name           string
+	binary         bool
+	added, deleted int
+}
+
+func newDiffstatFile(fp fdiff.FilePatch) (*diffstatFile, error) {
+	from, to := fp.Files()
+	f := &diffstatFile{binary: fp.IsBinary()}
+	switch {
+	case from == nil:
+		f.name = to.Path()
+	case to == nil:
+		f.name = from.Path()
+	case from.Path() != to.Path():
+		f.name = renameName(from.Path(), to.Path())
+	default:
+		f.name = to.Path()
+	}
+
+	if f.binary {
+		if from != nil && to != nil && from.Hash() == to.Hash() {
+			return f, nil
+		}
+
+		bfp, ok := fp.(fdiff.BinaryFilePatch)
+		if !ok {
+			return f, nil
+		}
+
+		fromContent, toContent, err := bfp.BinaryContents()
+		if err != nil {
+			return nil, err
+		}
+
+		f.deleted, f.added = len(fromContent), len(toContent)
+		return f, nil
+	}
+
+	// the changes left out of the patch are not counted, as in git
+	ignored := fdiff.IgnoredChunks(fp.Chunks(), fdiff.DefaultContextLines)
+	for i, chunk := range fp.Chunks() {
+		s := chunk.Content()
+		if len(s) == 0 || (ignored != nil && ignored[i]) {
+			continue
+		}
+
+		lines := strings.Count(s, "\n")
+		if s[len(s)-1] != '\n' {
+			lines++
+		}
+
+		switch chunk.Type() {
+		case fdiff.Add:
+			f.added += lines
+		case fdiff.Delete:
+			f.deleted += lines
+		}
+	}
+
+	return f, nil
+}
+
+// writeDiffstat writes the diffstat of the patch, followed by a summary of
+// the changes and of the created, deleted, renamed files and of the mode
+// changes, as git diff --stat --summary does. The patch holds a file patch
+// per change.
+func writeDiffstat(b *strings.Builder, changes object.Changes, patch *object.Patch) error {
+	var files []*diffstatFile
+	var maxLen, maxChange, binWidth, numberWidth int
+	var insertions, deletions int
+	for _, fp := range patch.FilePatches() {
+		f, err := newDiffstatFile(fp)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		if n := utf8.RuneCountInString(f.name); maxLen < n {
+			maxLen = n
+		}
+
+		if f.binary {
+			// "Bin XXX -> YYY bytes"
+			if w := 14 + decimalWidth(f.added) + decimalWidth(f.deleted); binWidth < w {
+				binWidth = w
+			}
+
+			numberWidth = 3
+			continue
+		}
+
+		insertions += f.added
+		deletions += f.deleted
+		if maxChange < f.added+f.deleted {
+			maxChange = f.added + f.deleted
+		}
+	}
+
+	if w := decimalWidth(maxChange); numberWidth < w {
+		numberWidth = w
+	}
+
+	// the widths of the names and of the graphs are computed as git does
+	width := diffstatWidth
+	if width < 16+6+numberWidth {
+		width = 16 + 6 + numberWidth
+	}
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+
+	nameWidth := maxLen
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	for _, f := range files {
+		fmt.Fprintf(b, " %s | ", scaleName(f.name, nameWidth))
+		if f.binary {
+			fmt.Fprintf(b, "%*s", numberWidth, "Bin")
+			if f.added != 0 || f.deleted != 0 {
+				fmt.Fprintf(b, " %d -> %d bytes", f.deleted, f.added)
+			}
+
+			b.WriteByte('\n')
+			continue
+		}
+
+		added, deleted := f.added, f.deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(added+deleted, graphWidth, maxChange)
+			if total < 2 && added != 0 && deleted != 0 {
+				total = 2
+			}
+
+			if added < deleted {
+				added = scaleLinear(added, graphWidth, maxChange)
+				deleted = total - added
+			} else {
+				deleted = scaleLinear(deleted, graphWidth, maxChange)
+				added = total - deleted
+			}
+		}
+
+		fmt.Fprintf(b, "%*d", numberWidth, f.added+f.deleted)
+		if f.added+f.deleted != 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(strings.Repeat("+", added))
+		b.WriteString(strings.Repeat("-", deleted))
+		b.WriteByte('\n')
+	}
+
+	if len(files) == 0 {
+		b.WriteString(" 0 files changed\n")
+		return nil
+	}
+
+	fmt.Fprintf(b, " %d %s changed", len(files), plural(len(files), "file", "files"))
+	if insertions != 0 || deletions == 0 {
+		fmt.Fprintf(b, ", %d %s(+)", insertions, plural(insertions, "insertion", "insertions"))
+	}
+
+	if deletions != 0 || insertions == 0 {
+		fmt.Fprintf(b, ", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+
+	b.WriteByte('\n')
+	for i, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		switch {
+		case from == nil:
+			fmt.Fprintf(b, " create mode %06o %s\n", to.Mode(), to.Path())
+			continue
+		case to == nil:
+			fmt.Fprintf(b, " delete mode %06o %s\n", from.Mode(), from.Path())
+			continue
+		case from.Path() != to.Path():
+			fromFile, toFile, err := changes[i].Files()
+			if err != nil {
+				return err
+			}
+
+			score, err := object.FileSimilarity(fromFile, toFile)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(b, " rename %s (%d%%)\n", renameName(from.Path(), to.Path()), score)
+			if from.Mode() != to.Mode() {
+				fmt.Fprintf(b, " mode change %06o => %06o\n", from.Mode(), to.Mode())
+			}
+		case from.Mode() != to.Mode():
+			fmt.Fprintf(b, " mode change %06o => %06o %s\n", from.Mode(), to.Mode(), to.Path())
+		}
+	}
+
+	return nil
+}
+
+// renameName returns the name of a renamed file in a diffstat, with the
+// common leading and trailing directories of the paths written once, as
+// "dir/{from => to}/file".
+func renameName(from, to string) string {
+	var prefix int
+	for i := 0; i < len(from) && i < len(to) && from[i] == to[i]; i++ {
+		if from[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// the common suffix can start with the slash ending the common prefix
+	var suffix int
+	min := prefix
+	if min > 0 {
+		min--
+	}
+
+	for i, j := len(from)-1, len(to)-1; i >= min && j >= min && from[i] == to[j]; i, j = i-1, j-1 {
+		if from[i] == '/' {
+			suffix = len(from) - i
+		}
+	}
+
+	fromMid := len(from) - prefix - suffix
+	if fromMid < 0 {
+		fromMid = 0
+	}
+
+	toMid := len(to) - prefix - suffix
+	if toMid < 0 {
+		toMid = 0
+	}
+
+	name := from[prefix:prefix+fromMid] + " => " + to[prefix:prefix+toMid]
+	if prefix+suffix == 0 {
+		return name
+	}
+
+	return from[:prefix] + "{" + name + "}" + from[len(from)-suffix:]
+}
+
+// scaleName pads the name to the width, replacing its leading directories by
+// "..." if it's too long.
+func scaleName(name string, width int) string {
+	n := utf8.RuneCountInString(name)
+	prefix := ""
+	if width < n {
+		prefix = "..."
+		runes := []rune(name)
+		keep := width - 3
+		if keep < 0 {
+			keep = 0
+		}
+
+		name = string(runes[len(runes)-keep:])
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[i:]
+		}
+
+		n = utf8.RuneCountInString(name)
+		width = keep
+	}
+
+	if n < width {
+		name += strings.Repeat(" ", width-n)
+	}
+
+	return prefix + name
+}
+
+// scaleLinear scales the count of changes to the width of the graph.
+func scaleLinear(n, width, max int) int {
+	if n == 0 {
+		return 0
+	}
+
+	return 1 + n*(width-1)/max
+}
+
+func decimalWidth(n int) int {
+	return len(fmt.Sprint(n))
+}
+
+func writeMailSignature(b *strings.Builder, signature string) {
+	if signature == "" {
+		return
+	}
+
+	b.WriteString("-- \n")
+	b.WriteString(strings.TrimRight(signature, "\n"))
+	b.WriteByte('\n')
+}
+
+// splitCommitMessage returns the subject of the commit message, its first
+// paragraph joined in a single line, and the rest of the message.
+func splitCommitMessage(msg string) (subject, body string) {
+	msg = strings.TrimLeft(msg, "\n")
+	title := msg
+	if i := strings.Index(msg, "\n\n"); i >= 0 {
+		title, body = msg[:i], strings.TrimLeft(msg[i:], "\n")
+	}
+
+	subject = strings.Join(strings.Fields(title), " ")
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	return subject, body
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+
+	return plural
+}
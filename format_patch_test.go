@@ -0,0 +1,199 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/mbox"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newFormatPatchTestRepository returns a repository with three commits: the
+// first one adds the file "f", the second one changes it and the third one
+// adds the file "g".
+func newFormatPatchTestRepository(c *C) (*Repository, *Worktree) {
+	r, w := newTestRepository(c, nil)
+	for _, step := range []struct {
+		file, content, message string
+	}{
+		{"f", "a\nb\n", "init\n"},
+		{"f", "a\nB\n", "Change b\n\nLonger body.\n"},
+		{"g", "x\n", "Add g\n"},
+	} {
+		err := util.WriteFile(w.Filesystem, step.file, []byte(step.content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = w.Add(step.file)
+		c.Assert(err, IsNil)
+
+		_, err = w.Commit(step.message, &CommitOptions{Author: defaultSignature()})
+		c.Assert(err, IsNil)
+	}
+
+	return r, w
+}
+
+func (s *RepositorySuite) TestFormatPatch(c *C) {
+	r, _ := newFormatPatchTestRepository(c)
+
+	messages, err := r.FormatPatch(&FormatPatchOptions{
+		Revisions: []string{"HEAD~2"},
+		Signature: "go-git",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 2)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(messages[1].Hash, Equals, head.Hash())
+
+	buf := &bytes.Buffer{}
+	err = mbox.NewEncoder(buf).Encode(messages[0])
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "From "+messages[0].Hash.String()+" Mon Sep 17 00:00:00 2001\n"+
+		"From: foo <foo@foo.foo>\n"+
+		"Date: Thu, 4 May 2017 00:03:43 +0200\n"+
+		"Subject: [PATCH 1/2] Change b\n"+
+		"\n"+
+		"Longer body.\n"+
+		"---\n"+
+		" f | 2 +-\n"+
+		" 1 file changed, 1 insertion(+), 1 deletion(-)\n"+
+		"\n"+
+		"diff --git a/f b/f\n"+
+		"index 422c2b7ab3b3c668038da977e4e93a5fc623169c..55dce135f5939fc45738aec42a917794a39cbfce 100644\n"+
+		"--- a/f\n"+
+		"+++ b/f\n"+
+		"@@ -1,2 +1,2 @@\n"+
+		" a\n"+
+		"-b\n"+
+		"+B\n"+
+		"-- \n"+
+		"go-git\n"+
+		"\n",
+	)
+
+	c.Assert(messages[1].Subject, Equals, "[PATCH 2/2] Add g")
+	c.Assert(strings.HasPrefix(messages[1].Body, "---\n"+
+		" g | 1 +\n"+
+		" 1 file changed, 1 insertion(+)\n"+
+		" create mode 100644 g\n"+
+		"\n"+
+		"diff --git a/g b/g\n"+
+		"new file mode 100644\n"), Equals, true)
+}
+
+func (s *RepositorySuite) TestFormatPatchNumbering(c *C) {
+	r, _ := newFormatPatchTestRepository(c)
+
+	messages, err := r.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD~1"}})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].Subject, Equals, "[PATCH] Add g")
+
+	messages, err = r.FormatPatch(&FormatPatchOptions{
+		Revisions:     []string{"HEAD~1"},
+		SubjectPrefix: "RFC PATCH",
+		Numbered:      true,
+		StartNumber:   9,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(messages[0].Subject, Equals, "[RFC PATCH 9/9] Add g")
+
+	messages, err = r.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD~2..HEAD"}, NoNumbered: true})
+	c.Assert(err, IsNil)
+	c.Assert(messages[0].Subject, Equals, "[PATCH] Change b")
+	c.Assert(messages[1].Subject, Equals, "[PATCH] Add g")
+
+	_, err = r.FormatPatch(&FormatPatchOptions{Numbered: true, NoNumbered: true})
+	c.Assert(err, Equals, ErrNumberedExclusive)
+}
+
+func (s *RepositorySuite) TestFormatPatchRootCommit(c *C) {
+	r, _ := newFormatPatchTestRepository(c)
+
+	messages, err := r.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD"}})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 0)
+
+	messages, err = r.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD~2"}, Root: true})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].Subject, Equals, "[PATCH] init")
+	c.Assert(strings.Contains(messages[0].Body, " create mode 100644 f\n"), Equals, true)
+}
+
+func (s *RepositorySuite) TestFormatPatchCoverLetter(c *C) {
+	r, _ := newFormatPatchTestRepository(c)
+
+	author := &object.Signature{Name: "bar", Email: "bar@bar.bar", When: defaultSignature().When}
+	messages, err := r.FormatPatch(&FormatPatchOptions{
+		Revisions:          []string{"HEAD~2"},
+		CoverLetter:        true,
+		CoverLetterSubject: "Improve f and add g",
+		Author:             author,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 3)
+
+	cover := messages[0]
+	c.Assert(cover.Hash, Equals, messages[2].Hash)
+	c.Assert(cover.Author.Name, Equals, "bar")
+	c.Assert(cover.Subject, Equals, "[PATCH 0/2] Improve f and add g")
+	c.Assert(cover.Body, Equals, ""+
+		"*** BLURB HERE ***\n"+
+		"\n"+
+		"foo (2):\n"+
+		"  Change b\n"+
+		"  Add g\n"+
+		"\n"+
+		" f | 2 +-\n"+
+		" g | 1 +\n"+
+		" 2 files changed, 2 insertions(+), 1 deletion(-)\n"+
+		" create mode 100644 g\n"+
+		"\n",
+	)
+}
+
+func (s *RepositorySuite) TestFormatPatchDiffstat(c *C) {
+	r, w := newFormatPatchTestRepository(c)
+	commitFiles(c, w, map[string]string{
+		"b.bin":     "ab\x00c",
+		"dir/x.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		"m.sh":      "echo m\n",
+	})
+
+	err := util.WriteFile(w.Filesystem, "f", []byte("a\nc\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "b.bin", []byte("ab\x00cd"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Move("dir/x.txt", "dir/y.txt")
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "dir/y.txt", []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Remove("m.sh")
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "n.sh", []byte("echo m\n"), 0755)
+	c.Assert(err, IsNil)
+	err = w.AddWithOptions(&AddOptions{All: true})
+	c.Assert(err, IsNil)
+	_, err = w.Commit("Change everything\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	messages, err := r.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD~1"}})
+	c.Assert(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Assert(strings.HasPrefix(messages[0].Body, "---\n"+
+		" b.bin                | Bin 4 -> 5 bytes\n"+
+		" dir/{x.txt => y.txt} |   1 -\n"+
+		" f                    |   2 +-\n"+
+		" m.sh => n.sh         |   0\n"+
+		" 4 files changed, 1 insertion(+), 2 deletions(-)\n"+
+		" rename dir/{x.txt => y.txt} (85%)\n"+
+		" rename m.sh => n.sh (100%)\n"+
+		" mode change 100644 => 100755\n"+
+		"\n"), Equals, true)
+}
@@ -0,0 +1,689 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+)
+
+var (
+	// ErrWorktreeNotExists is returned when a linked worktree is not found.
+	ErrWorktreeNotExists = errors.New("worktree does not exist")
+	// ErrWorktreeExists is returned by AddWorktree when the path of the
+	// worktree already exists and it's not an empty directory.
+	ErrWorktreeExists = errors.New("worktree path already exists")
+	// ErrWorktreeLocked is returned when a locked worktree is removed or
+	// locked again.
+	ErrWorktreeLocked = errors.New("worktree is locked")
+	// ErrWorktreeNotLocked is returned when a worktree not locked is
+	// unlocked.
+	ErrWorktreeNotLocked = errors.New("worktree is not locked")
+	// ErrWorktreeDirty is returned by RemoveWorktree when the worktree has
+	// modified or untracked files.
+	ErrWorktreeDirty = errors.New("worktree contains modified or untracked files")
+	// ErrBranchCheckedOut is returned when a branch checked out by another
+	// worktree is checked out.
+	ErrBranchCheckedOut = errors.New("branch is already checked out by another worktree")
+	// ErrInvalidWorktreeName is returned when a worktree name is empty, has a
+	// path separator, starts with a dot or contains "..".
+	ErrInvalidWorktreeName = errors.New("invalid worktree name")
+	// ErrLinkedWorktreesNotSupported is returned when the linked worktrees are
+	// used with a storer that is not filesystem based.
+	ErrLinkedWorktreesNotSupported = errors.New("linked worktrees are only supported by filesystem storers")
+)
+
+const (
+	worktreesDir = "worktrees"
+
+	// the files of the directory of a linked worktree, in .git/worktrees
+	worktreeGitDirFile    = "gitdir"
+	worktreeCommonDirFile = "commondir"
+	worktreeLockedFile    = "locked"
+)
+
+// LinkedWorktree describes a linked worktree of a repository, as listed by
+// git worktree list.
+type LinkedWorktree struct {
+	// Name of the worktree, its directory in .git/worktrees.
+	Name string
+	// Path of the worktree.
+	Path string
+	// HEAD of the worktree, a symbolic reference to the branch checked out,
+	// or the commit checked out if HEAD is detached.
+	HEAD *plumbing.Reference
+	// Locked tells whether the worktree is locked, LockReason being the
+	// reason given, if any.
+	Locked     bool
+	LockReason string
+	// Prunable tells whether the worktree is missing and not locked, so it's
+	// removed by PruneWorktrees.
+	Prunable bool
+}
+
+// AddWorktree creates a linked worktree at path, as git worktree add does, and
+// returns its Repository. The worktree shares the objects, the references and
+// the config of the repository, and it has its own HEAD and index. It's named
+// after the base name of path, a number being appended if the name is already
+// used.
+func (r *Repository) AddWorktree(path string, opts *AddWorktreeOptions) (wr *Repository, err error) {
+	if opts == nil {
+		opts = &AddWorktreeOptions{}
+	}
+
+	if err := opts.Validate(r); err != nil {
+		return nil, err
+	}
+
+	common, err := r.commonDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+
+	// as git does, the leading dots are left out of the name
+	base := strings.TrimLeft(filepath.Base(path), ".")
+	if err := validateWorktreeName(base); err != nil {
+		return nil, err
+	}
+
+	exists, err := checkWorktreePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkWorktreeBranch(common, opts); err != nil {
+		return nil, err
+	}
+
+	name, err := worktreeName(common, base)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := common.Chroot(common.Join(worktreesDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = util.RemoveAll(common, common.Join(worktreesDir, name))
+			removeWorktreeDir(path, exists)
+		}
+	}()
+
+	head, err := r.worktreeStartCommit(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the worktree is locked until it's checked out, so it isn't pruned
+	files := []struct{ name, content string }{
+		{worktreeLockedFile, "initializing\n"},
+		{worktreeGitDirFile, filepath.Join(path, GitDirName) + "\n"},
+		{worktreeCommonDirFile, "../..\n"},
+		{plumbing.HEAD.String(), head.String() + "\n"},
+	}
+
+	for _, f := range files {
+		if err := util.WriteFile(admin, f.name, []byte(f.content), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	wt := osfs.New(path)
+	dotGit := fmt.Sprintf("gitdir: %s\n", admin.Root())
+	if err := util.WriteFile(wt, GitDirName, []byte(dotGit), 0644); err != nil {
+		return nil, err
+	}
+
+	if wr, err = openLinkedWorktree(common, admin, wt); err != nil {
+		return nil, err
+	}
+
+	w, err := wr.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Checkout(&CheckoutOptions{
+		Branch: opts.Branch,
+		Hash:   opts.Hash,
+		Create: opts.Create,
+		Force:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Lock {
+		return wr, writeLockReason(admin, opts.LockReason)
+	}
+
+	return wr, admin.Remove(worktreeLockedFile)
+}
+
+// checkWorktreePath checks that a worktree can be created at path, which must
+// not exist or be an empty directory, and tells whether it exists.
+func checkWorktreePath(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !fi.IsDir() {
+		return false, ErrWorktreeExists
+	}
+
+	fis, err := osfs.New(path).ReadDir("")
+	if err != nil {
+		return false, err
+	}
+
+	if len(fis) != 0 {
+		return false, ErrWorktreeExists
+	}
+
+	return true, nil
+}
+
+// removeWorktreeDir removes the content of the directory of a worktree not
+// created, and the directory itself unless it already existed.
+func removeWorktreeDir(path string, exists bool) {
+	if !exists {
+		_ = util.RemoveAll(osfs.New(filepath.Dir(path)), filepath.Base(path))
+		return
+	}
+
+	fs := osfs.New(path)
+	fis, _ := fs.ReadDir("")
+	for _, fi := range fis {
+		_ = util.RemoveAll(fs, fi.Name())
+	}
+}
+
+// checkWorktreeBranch checks that the branch of the options can be checked
+// out in a new worktree.
+func (r *Repository) checkWorktreeBranch(common billy.Filesystem, opts *AddWorktreeOptions) error {
+	if opts.Branch == "" {
+		return nil
+	}
+
+	_, err := r.Storer.Reference(opts.Branch)
+	switch {
+	case opts.Create && err == nil:
+		return ErrBranchExists
+	case opts.Create && err == plumbing.ErrReferenceNotFound:
+	case err != nil:
+		return err
+	}
+
+	if opts.Force {
+		return nil
+	}
+
+	checkedOut, err := r.isBranchCheckedOut(common, opts.Branch)
+	if err != nil {
+		return err
+	}
+
+	if checkedOut {
+		return ErrBranchCheckedOut
+	}
+
+	return nil
+}
+
+// checkCheckoutBranch checks that the branch can be checked out by the
+// worktree of the repository, not being checked out by another worktree.
+func (r *Repository) checkCheckoutBranch(branch plumbing.ReferenceName) error {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	if head != nil && head.Type() == plumbing.SymbolicReference && head.Target() == branch {
+		return nil
+	}
+
+	common, err := r.commonDir()
+	if err == ErrLinkedWorktreesNotSupported {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	wts, err := r.Worktrees()
+	if err != nil || len(wts) == 0 {
+		return err
+	}
+
+	checkedOut, err := r.isBranchCheckedOut(common, branch)
+	if err != nil {
+		return err
+	}
+
+	if checkedOut {
+		return ErrBranchCheckedOut
+	}
+
+	return nil
+}
+
+// isBranchCheckedOut tells whether the branch is checked out by the main
+// worktree or by a linked worktree.
+func (r *Repository) isBranchCheckedOut(common billy.Filesystem, branch plumbing.ReferenceName) (bool, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return false, err
+	}
+
+	var heads []*plumbing.Reference
+	if !cfg.Core.IsBare {
+		head, err := readWorktreeHEAD(common)
+		if err != nil {
+			return false, err
+		}
+
+		heads = append(heads, head)
+	}
+
+	wts, err := r.Worktrees()
+	if err != nil {
+		return false, err
+	}
+
+	for _, wt := range wts {
+		heads = append(heads, wt.HEAD)
+	}
+
+	for _, head := range heads {
+		if head != nil && head.Type() == plumbing.SymbolicReference && head.Target() == branch {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// worktreeStartCommit returns the commit checked out by a new worktree.
+func (r *Repository) worktreeStartCommit(opts *AddWorktreeOptions) (plumbing.Hash, error) {
+	if !opts.Hash.IsZero() {
+		return opts.Hash, nil
+	}
+
+	ref, err := r.Reference(opts.Branch, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+// worktreeName returns the first name, made of base and a number, not used
+// by a worktree yet.
+func worktreeName(common billy.Filesystem, base string) (string, error) {
+	for i := 0; ; i++ {
+		name := base
+		if i != 0 {
+			name += strconv.Itoa(i)
+		}
+
+		_, err := common.Stat(common.Join(worktreesDir, name))
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// validateWorktreeName returns ErrInvalidWorktreeName if name can not be the
+// name of a directory in the worktrees directory, so it never resolves to
+// another path of the repository.
+func validateWorktreeName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) ||
+		strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return ErrInvalidWorktreeName
+	}
+
+	return nil
+}
+
+// Worktrees returns the linked worktrees of the repository, the main worktree
+// being left out.
+func (r *Repository) Worktrees() ([]*LinkedWorktree, error) {
+	common, err := r.commonDir()
+	if err != nil {
+		return nil, err
+	}
+
+	fis, err := common.ReadDir(worktreesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var wts []*LinkedWorktree
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+
+		wt, err := linkedWorktree(common, fi.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		wts = append(wts, wt)
+	}
+
+	return wts, nil
+}
+
+// LockWorktree locks the linked worktree with the given name, so it's not
+// pruned or removed, as git worktree lock does. The reason is optional.
+func (r *Repository) LockWorktree(name, reason string) error {
+	if err := validateWorktreeName(name); err != nil {
+		return err
+	}
+
+	common, err := r.commonDir()
+	if err != nil {
+		return err
+	}
+
+	wt, err := linkedWorktree(common, name)
+	if err != nil {
+		return err
+	}
+
+	if wt.Locked {
+		return ErrWorktreeLocked
+	}
+
+	admin, err := common.Chroot(common.Join(worktreesDir, name))
+	if err != nil {
+		return err
+	}
+
+	return writeLockReason(admin, reason)
+}
+
+// UnlockWorktree unlocks the linked worktree with the given name.
+func (r *Repository) UnlockWorktree(name string) error {
+	if err := validateWorktreeName(name); err != nil {
+		return err
+	}
+
+	common, err := r.commonDir()
+	if err != nil {
+		return err
+	}
+
+	wt, err := linkedWorktree(common, name)
+	if err != nil {
+		return err
+	}
+
+	if !wt.Locked {
+		return ErrWorktreeNotLocked
+	}
+
+	return common.Remove(common.Join(worktreesDir, name, worktreeLockedFile))
+}
+
+// PruneWorktrees removes the administrative files of the linked worktrees
+// whose directory is missing, unless they are locked, as git worktree prune
+// does. It returns the names of the worktrees pruned.
+func (r *Repository) PruneWorktrees() ([]string, error) {
+	common, err := r.commonDir()
+	if err != nil {
+		return nil, err
+	}
+
+	wts, err := r.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, wt := range wts {
+		if !wt.Prunable {
+			continue
+		}
+
+		if err := util.RemoveAll(common, common.Join(worktreesDir, wt.Name)); err != nil {
+			return nil, err
+		}
+
+		pruned = append(pruned, wt.Name)
+	}
+
+	return pruned, removeEmptyWorktreesDir(common)
+}
+
+// RemoveWorktree removes the linked worktree with the given name, its
+// directory and its administrative files, as git worktree remove does. A
+// locked worktree is never removed.
+func (r *Repository) RemoveWorktree(name string, opts *RemoveWorktreeOptions) error {
+	if opts == nil {
+		opts = &RemoveWorktreeOptions{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateWorktreeName(name); err != nil {
+		return err
+	}
+
+	common, err := r.commonDir()
+	if err != nil {
+		return err
+	}
+
+	wt, err := linkedWorktree(common, name)
+	if err != nil {
+		return err
+	}
+
+	if wt.Locked {
+		return ErrWorktreeLocked
+	}
+
+	if !wt.Prunable {
+		if err := removeLinkedWorktreeDir(common, wt, opts.Force); err != nil {
+			return err
+		}
+	}
+
+	if err := util.RemoveAll(common, common.Join(worktreesDir, name)); err != nil {
+		return err
+	}
+
+	return removeEmptyWorktreesDir(common)
+}
+
+// removeLinkedWorktreeDir removes the directory of the worktree, checking
+// that it's clean unless force is set.
+func removeLinkedWorktreeDir(common billy.Filesystem, wt *LinkedWorktree, force bool) error {
+	fs := osfs.New(wt.Path)
+	if !force {
+		admin, err := common.Chroot(common.Join(worktreesDir, wt.Name))
+		if err != nil {
+			return err
+		}
+
+		wr, err := openLinkedWorktree(common, admin, fs)
+		if err != nil {
+			return err
+		}
+
+		w, err := wr.Worktree()
+		if err != nil {
+			return err
+		}
+
+		status, err := w.Status()
+		if err != nil {
+			return err
+		}
+
+		if !status.IsClean() {
+			return ErrWorktreeDirty
+		}
+	}
+
+	return util.RemoveAll(osfs.New(filepath.Dir(wt.Path)), filepath.Base(wt.Path))
+}
+
+// commonDir returns the filesystem of the common directory of the repository,
+// where the linked worktrees are administered.
+func (r *Repository) commonDir() (billy.Filesystem, error) {
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	fs, ok := r.Storer.(fsBased)
+	if !ok {
+		return nil, ErrLinkedWorktreesNotSupported
+	}
+
+	if rfs, ok := fs.Filesystem().(*dotgit.RepositoryFilesystem); ok {
+		return rfs.CommonDir(), nil
+	}
+
+	return fs.Filesystem(), nil
+}
+
+// openLinkedWorktree opens the repository of a linked worktree, admin being
+// its directory in .git/worktrees.
+func openLinkedWorktree(common, admin, wt billy.Filesystem) (*Repository, error) {
+	fs := dotgit.NewRepositoryFilesystem(admin, common)
+	return Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), wt)
+}
+
+// linkedWorktree reads the linked worktree with the given name.
+func linkedWorktree(common billy.Filesystem, name string) (*LinkedWorktree, error) {
+	_, err := common.Stat(common.Join(worktreesDir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrWorktreeNotExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := common.Chroot(common.Join(worktreesDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	wt := &LinkedWorktree{Name: name}
+	if wt.HEAD, err = readWorktreeHEAD(admin); err != nil {
+		return nil, err
+	}
+
+	gitDir, err := readWorktreeAdminFile(admin, worktreeGitDirFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if gitDir != "" {
+		wt.Path = filepath.Dir(gitDir)
+		if _, err := os.Stat(gitDir); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			wt.Prunable = true
+		}
+	} else {
+		wt.Prunable = true
+	}
+
+	wt.LockReason, err = readWorktreeAdminFile(admin, worktreeLockedFile)
+	switch {
+	case err == nil:
+		wt.Locked = true
+		wt.Prunable = false
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	return wt, nil
+}
+
+// readWorktreeHEAD reads the HEAD of a worktree, nil if it's missing.
+func readWorktreeHEAD(fs billy.Filesystem) (*plumbing.Reference, error) {
+	head, err := readWorktreeAdminFile(fs, plumbing.HEAD.String())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewReferenceFromStrings(plumbing.HEAD.String(), head), nil
+}
+
+// readWorktreeAdminFile returns the content of a file of the directory of a
+// worktree, without the surrounding whitespace.
+func readWorktreeAdminFile(fs billy.Filesystem, name string) (string, error) {
+	content, err := readFile(fs, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func writeLockReason(admin billy.Filesystem, reason string) error {
+	if reason != "" {
+		reason += "\n"
+	}
+
+	return util.WriteFile(admin, worktreeLockedFile, []byte(reason), 0644)
+}
+
+// removeEmptyWorktreesDir removes .git/worktrees once it's empty, as git does.
+func removeEmptyWorktreesDir(common billy.Filesystem) error {
+	fis, err := common.ReadDir(worktreesDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil || len(fis) != 0 {
+		return err
+	}
+
+	return common.Remove(worktreesDir)
+}
@@ -0,0 +1,322 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newLinkedWorktreeTestRepository returns a repository in a temporary
+// directory, with a commit adding the file "foo", and the directory.
+func newLinkedWorktreeTestRepository(c *C) (*Repository, string) {
+	dir, err := ioutil.TempDir("", "linked-worktree")
+	c.Assert(err, IsNil)
+
+	r, err := PlainInit(filepath.Join(dir, "main"), false)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	return r, dir
+}
+
+func (s *RepositorySuite) TestAddWorktree(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "feature")
+	wr, err := r.AddWorktree(path, &AddWorktreeOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+
+	head, err := wr.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.NewBranchReferenceName("feature"))
+
+	master, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, master.Hash())
+
+	w, err := wr.Worktree()
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	// the worktree can be opened as git does
+	wr, err = PlainOpenWithOptions(path, &PlainOpenOptions{EnableDotGitCommonDir: true})
+	c.Assert(err, IsNil)
+
+	head, err = wr.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.NewBranchReferenceName("feature"))
+
+	// the commits of the worktree are seen by the repository
+	w, err = wr.Worktree()
+	c.Assert(err, IsNil)
+
+	h := commitFiles(c, w, map[string]string{"bar": "bar\n"})
+	ref, err := r.Reference(plumbing.NewBranchReferenceName("feature"), true)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, h)
+
+	master, err = r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(master.Name(), Equals, plumbing.Master)
+}
+
+func (s *RepositorySuite) TestAddWorktreeDetached(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	master, err := r.Head()
+	c.Assert(err, IsNil)
+
+	wr, err := r.AddWorktree(filepath.Join(dir, "detached"), nil)
+	c.Assert(err, IsNil)
+
+	head, err := wr.Storer.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Type(), Equals, plumbing.HashReference)
+	c.Assert(head.Hash(), Equals, master.Hash())
+
+	wts, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts, HasLen, 1)
+	c.Assert(wts[0].Name, Equals, "detached")
+	c.Assert(wts[0].HEAD.Hash(), Equals, master.Hash())
+}
+
+func (s *RepositorySuite) TestAddWorktreeBranchCheckedOut(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	_, err := r.AddWorktree(filepath.Join(dir, "master"), &AddWorktreeOptions{
+		Branch: plumbing.Master,
+	})
+	c.Assert(err, Equals, ErrBranchCheckedOut)
+
+	_, err = os.Stat(filepath.Join(dir, "master"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	_, err = r.AddWorktree(filepath.Join(dir, "feature"), &AddWorktreeOptions{
+		Branch: feature,
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{
+		Branch: feature,
+	})
+	c.Assert(err, Equals, ErrBranchCheckedOut)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{
+		Branch: feature,
+		Create: true,
+	})
+	c.Assert(err, Equals, ErrBranchExists)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{
+		Branch: feature,
+		Force:  true,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *RepositorySuite) TestCheckoutBranchCheckedOut(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	wr, err := r.AddWorktree(filepath.Join(dir, "feature"), &AddWorktreeOptions{
+		Branch: feature,
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Branch: feature})
+	c.Assert(err, Equals, ErrBranchCheckedOut)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+
+	ww, err := wr.Worktree()
+	c.Assert(err, IsNil)
+
+	err = ww.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, Equals, ErrBranchCheckedOut)
+
+	err = ww.Checkout(&CheckoutOptions{Branch: feature})
+	c.Assert(err, IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Branch: feature, Force: true})
+	c.Assert(err, IsNil)
+
+	head, err = r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, feature)
+}
+
+func (s *RepositorySuite) TestAddWorktreeName(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	_, err := r.AddWorktree(filepath.Join(dir, "a", "wt"), nil)
+	c.Assert(err, IsNil)
+	_, err = r.AddWorktree(filepath.Join(dir, "b", "wt"), nil)
+	c.Assert(err, IsNil)
+
+	wts, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts, HasLen, 2)
+	c.Assert(wts[0].Name, Equals, "wt")
+	c.Assert(wts[0].Path, Equals, filepath.Join(dir, "a", "wt"))
+	c.Assert(wts[1].Name, Equals, "wt1")
+	c.Assert(wts[1].Path, Equals, filepath.Join(dir, "b", "wt"))
+}
+
+func (s *RepositorySuite) TestAddWorktreePathExists(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	_, err := r.AddWorktree(filepath.Join(dir, "main"), nil)
+	c.Assert(err, Equals, ErrWorktreeExists)
+
+	err = os.Mkdir(filepath.Join(dir, "empty"), 0755)
+	c.Assert(err, IsNil)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "empty"), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *RepositorySuite) TestAddWorktreeNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AddWorktree("foo", &AddWorktreeOptions{Hash: plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")})
+	c.Assert(err, Equals, ErrLinkedWorktreesNotSupported)
+}
+
+func (s *RepositorySuite) TestLockWorktree(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	_, err := r.AddWorktree(filepath.Join(dir, "wt"), &AddWorktreeOptions{
+		Lock:       true,
+		LockReason: "on a usb stick",
+	})
+	c.Assert(err, IsNil)
+
+	wts, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts[0].Locked, Equals, true)
+	c.Assert(wts[0].LockReason, Equals, "on a usb stick")
+
+	c.Assert(r.LockWorktree("wt", ""), Equals, ErrWorktreeLocked)
+	c.Assert(r.RemoveWorktree("wt", nil), Equals, ErrWorktreeLocked)
+	c.Assert(r.UnlockWorktree("wt"), IsNil)
+	c.Assert(r.UnlockWorktree("wt"), Equals, ErrWorktreeNotLocked)
+
+	c.Assert(r.LockWorktree("wt", ""), IsNil)
+	wts, err = r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts[0].Locked, Equals, true)
+	c.Assert(wts[0].LockReason, Equals, "")
+
+	c.Assert(r.LockWorktree("foo", ""), Equals, ErrWorktreeNotExists)
+}
+
+func (s *RepositorySuite) TestPruneWorktrees(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"kept", "pruned", "locked"} {
+		_, err := r.AddWorktree(filepath.Join(dir, name), nil)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(r.LockWorktree("locked", ""), IsNil)
+	c.Assert(os.RemoveAll(filepath.Join(dir, "pruned")), IsNil)
+	c.Assert(os.RemoveAll(filepath.Join(dir, "locked")), IsNil)
+
+	wts, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts, HasLen, 3)
+	c.Assert(wts[0].Prunable, Equals, false)
+	c.Assert(wts[1].Prunable, Equals, false)
+	c.Assert(wts[2].Prunable, Equals, true)
+
+	pruned, err := r.PruneWorktrees()
+	c.Assert(err, IsNil)
+	c.Assert(pruned, DeepEquals, []string{"pruned"})
+
+	wts, err = r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(wts, HasLen, 2)
+	c.Assert(wts[0].Name, Equals, "kept")
+	c.Assert(wts[1].Name, Equals, "locked")
+}
+
+func (s *RepositorySuite) TestRemoveWorktree(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	wr, err := r.AddWorktree(filepath.Join(dir, "wt"), nil)
+	c.Assert(err, IsNil)
+
+	w, err := wr.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0644)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.RemoveWorktree("wt", nil), Equals, ErrWorktreeDirty)
+	c.Assert(r.RemoveWorktree("wt", &RemoveWorktreeOptions{Force: true}), IsNil)
+
+	_, err = os.Stat(filepath.Join(dir, "wt"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = os.Stat(filepath.Join(dir, "main", GitDirName, "worktrees"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	c.Assert(r.RemoveWorktree("wt", nil), Equals, ErrWorktreeNotExists)
+}
+
+func (s *RepositorySuite) TestWorktreeInvalidName(c *C) {
+	r, dir := newLinkedWorktreeTestRepository(c)
+	defer os.RemoveAll(dir)
+
+	_, err := r.AddWorktree(filepath.Join(dir, "wt"), nil)
+	c.Assert(err, IsNil)
+
+	for _, name := range []string{"", ".", "..", "../refs", "wt/..", `..\refs`, "wt/x", ".wt", "w..t"} {
+		c.Assert(r.RemoveWorktree(name, &RemoveWorktreeOptions{Force: true}), Equals, ErrInvalidWorktreeName, Commentf("%q", name))
+		c.Assert(r.LockWorktree(name, ""), Equals, ErrInvalidWorktreeName, Commentf("%q", name))
+		c.Assert(r.UnlockWorktree(name), Equals, ErrInvalidWorktreeName, Commentf("%q", name))
+	}
+
+	for _, path := range []string{"refs", "worktrees/wt"} {
+		_, err = os.Stat(filepath.Join(dir, "main", GitDirName, path))
+		c.Assert(err, IsNil, Commentf("%s", path))
+	}
+
+	_, err = r.AddWorktree(string(filepath.Separator), nil)
+	c.Assert(err, Equals, ErrInvalidWorktreeName)
+}
@@ -0,0 +1,789 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrFollowWithoutFileName is returned by Log when following the renames of
+// a file without giving its name.
+var ErrFollowWithoutFileName = errors.New("following renames requires a file name")
+
+// LogMark tells how a commit listed by Repository.LogMarked relates to the
+// requested revision ranges, as shown by `git log --left-right --boundary`.
+type LogMark int
+
+const (
+	// LogMarkNone is the mark of the commits outside of symmetric ranges.
+	LogMarkNone LogMark = iota
+	// LogMarkLeft is the mark of the commits reachable from the left side
+	// of a symmetric range, shown as "<" by git.
+	LogMarkLeft
+	// LogMarkRight is the mark of the commits reachable from the right side
+	// of a symmetric range, shown as ">" by git.
+	LogMarkRight
+	// LogMarkBoundary is the mark of the boundary commits, shown as "-" by
+	// git.
+	LogMarkBoundary
+)
+
+// LogMarked calls fn with each of the commits listed by Log with the given
+// options, along with its mark.
+func (r *Repository) LogMarked(o *LogOptions, fn func(*object.Commit, LogMark) error) error {
+	it, w, err := r.logIter(o)
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	lr := w.lr
+	left := make(map[plumbing.Hash]bool)
+	if lr != nil {
+		for _, c := range lr.left {
+			err := object.NewCommitPreorderIter(c, lr.exclude, nil).ForEach(func(c *object.Commit) error {
+				left[c.Hash] = true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return it.ForEach(func(c *object.Commit) error {
+		mark := LogMarkNone
+		switch {
+		case lr == nil:
+		case lr.exclude[c.Hash]:
+			mark = LogMarkBoundary
+		case left[c.Hash]:
+			mark = LogMarkLeft
+		case lr.symmetric:
+			mark = LogMarkRight
+		}
+
+		return fn(c, mark)
+	})
+}
+
+// LogFollow calls fn with each of the commits listed by Log with the given
+// options, following the renames of FileName, along with the path the file
+// has in the commit.
+func (r *Repository) LogFollow(o *LogOptions, fn func(*object.Commit, string) error) error {
+	follow := *o
+	follow.Follow = true
+
+	it, w, err := r.logIter(&follow)
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	return it.ForEach(func(c *object.Commit) error {
+		return fn(c, w.paths[c.Hash])
+	})
+}
+
+// logWalk describes the commits listed by Log.
+type logWalk struct {
+	// lr holds the revision ranges of the commits, if any
+	lr *logRange
+	// paths holds the path of the followed file in the commits, if any
+	paths map[plumbing.Hash]string
+}
+
+// follow returns an iterator over the commits of the given one changing the
+// file at the given path, following its renames and recording its path in
+// each commit.
+func (w *logWalk) follow(path string, it object.CommitIter) object.CommitIter {
+	follow := object.NewCommitFollowIterFromIter(path, it)
+	w.paths = make(map[plumbing.Hash]string)
+
+	return object.NewCommitFilterIterFromIter(follow, func(c *object.Commit) bool {
+		w.paths[c.Hash] = follow.Path()
+		return true
+	})
+}
+
+// isRange reports whether the options list revision ranges, rather than the
+// history of a single commit or of all the references.
+func (o *LogOptions) isRange() bool {
+	return len(o.Include) > 0 || len(o.Exclude) > 0 || len(o.Revisions) > 0 || o.Boundary
+}
+
+// logRange holds the commits included and excluded by the options of a log.
+type logRange struct {
+	include []*object.Commit
+	// exclude holds the excluded commits along with the part of their
+	// history reached by the walk of the range
+	exclude map[plumbing.Hash]bool
+	// bottoms holds the excluded commits, without their history
+	bottoms []*object.Commit
+	// left holds the included left sides of the symmetric ranges
+	left      []*object.Commit
+	symmetric bool
+}
+
+func (r *Repository) logRange(o *LogOptions) (*logRange, error) {
+	lr := &logRange{exclude: make(map[plumbing.Hash]bool)}
+
+	add := func(h plumbing.Hash, exclude bool) (*object.Commit, error) {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if exclude {
+			lr.bottoms = append(lr.bottoms, c)
+		} else {
+			lr.include = append(lr.include, c)
+		}
+
+		return c, nil
+	}
+
+	var hashes []plumbing.Hash
+	if !o.From.IsZero() {
+		hashes = append(hashes, o.From)
+	}
+
+	if o.All {
+		tips, err := r.logAllTips()
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, tips...)
+	}
+
+	for _, h := range append(hashes, o.Include...) {
+		if _, err := add(h, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range o.Exclude {
+		if _, err := add(h, true); err != nil {
+			return nil, err
+		}
+	}
+
+	var not bool
+	for _, rev := range o.Revisions {
+		if rev == "--not" {
+			not = !not
+			continue
+		}
+
+		if err := r.addLogRevision(lr, rev, not, add); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(lr.include) == 0 {
+		head, err := r.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := add(head.Hash(), false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := lr.limit(r.Storer); err != nil {
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+// limitSlop is the count of commits walked by logRange.limit once only
+// excluded commits are left, to cope with the clock skews, as in git.
+const limitSlop = 5
+
+// limit marks the excluded commits and their ancestors as excluded, walking
+// the histories of the included and excluded commits together in committer
+// time order, as the revision walk of git does. The walk stops once only
+// excluded commits are left to walk, so the excluded history older than the
+// range isn't walked: lr.exclude only holds the excluded commits reached by
+// the walk, which are enough to stop the walks of the included commits.
+func (lr *logRange) limit(s storer.EncodedObjectStorer) error {
+	if len(lr.bottoms) == 0 {
+		return nil
+	}
+
+	seen := make(map[plumbing.Hash]*object.Commit)
+	queue := binaryheap.NewWith(func(a, b interface{}) int {
+		if a.(*object.Commit).Committer.When.Before(b.(*object.Commit).Committer.When) {
+			return 1
+		}
+
+		return -1
+	})
+
+	push := func(c *object.Commit) {
+		if _, ok := seen[c.Hash]; !ok {
+			seen[c.Hash] = c
+			queue.Push(c)
+		}
+	}
+
+	for _, c := range lr.bottoms {
+		lr.exclude[c.Hash] = true
+		push(c)
+	}
+
+	for _, c := range lr.include {
+		push(c)
+	}
+
+	// date is the committer time of the last included commit walked
+	var date *time.Time
+	slop := limitSlop
+	for {
+		v, ok := queue.Pop()
+		if !ok {
+			return nil
+		}
+
+		c := v.(*object.Commit)
+		excluded := lr.exclude[c.Hash]
+		for _, h := range c.ParentHashes {
+			if excluded {
+				lr.markExcluded(h, seen)
+			}
+
+			if _, ok := seen[h]; ok {
+				continue
+			}
+
+			p, err := object.GetCommit(s, h)
+			if err != nil {
+				return err
+			}
+
+			push(p)
+		}
+
+		if !excluded {
+			date = &c.Committer.When
+			continue
+		}
+
+		if slop = lr.stillIncluding(queue, date, slop); slop == 0 {
+			return nil
+		}
+	}
+}
+
+// markExcluded marks the commit with the given hash as excluded, along with
+// its ancestors already walked.
+func (lr *logRange) markExcluded(h plumbing.Hash, seen map[plumbing.Hash]*object.Commit) {
+	pending := []plumbing.Hash{h}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if lr.exclude[h] {
+			continue
+		}
+
+		lr.exclude[h] = true
+		if c, ok := seen[h]; ok {
+			pending = append(pending, c.ParentHashes...)
+		}
+	}
+}
+
+// stillIncluding returns the count of commits left to walk by limit: none if
+// the queue is empty, limitSlop if it still holds included commits or
+// commits more recent than the last included commit walked, slop-1
+// otherwise.
+func (lr *logRange) stillIncluding(queue *binaryheap.Heap, date *time.Time, slop int) int {
+	v, ok := queue.Peek()
+	if !ok {
+		return 0
+	}
+
+	if date != nil && !date.After(v.(*object.Commit).Committer.When) {
+		return limitSlop
+	}
+
+	for _, v := range queue.Values() {
+		if !lr.exclude[v.(*object.Commit).Hash] {
+			return limitSlop
+		}
+	}
+
+	return slop - 1
+}
+
+// addLogRevision adds the commits of the given revision range to the log
+// range, reversing their meaning if not is set.
+func (r *Repository) addLogRevision(
+	lr *logRange,
+	rev string,
+	not bool,
+	add func(plumbing.Hash, bool) (*object.Commit, error),
+) error {
+	if i := strings.Index(rev, "..."); i >= 0 {
+		a, err := r.logRevisionCommit(rev[:i])
+		if err != nil {
+			return err
+		}
+
+		b, err := r.logRevisionCommit(rev[i+3:])
+		if err != nil {
+			return err
+		}
+
+		bases, err := a.MergeBase(b)
+		if err != nil {
+			return err
+		}
+
+		if _, err := add(a.Hash, not); err != nil {
+			return err
+		}
+
+		if _, err := add(b.Hash, not); err != nil {
+			return err
+		}
+
+		for _, base := range bases {
+			if _, err := add(base.Hash, !not); err != nil {
+				return err
+			}
+		}
+
+		if !not {
+			lr.left = append(lr.left, a)
+			lr.symmetric = true
+		}
+
+		return nil
+	}
+
+	if i := strings.Index(rev, ".."); i >= 0 {
+		a, err := r.logRevisionCommit(rev[:i])
+		if err != nil {
+			return err
+		}
+
+		b, err := r.logRevisionCommit(rev[i+2:])
+		if err != nil {
+			return err
+		}
+
+		if _, err := add(a.Hash, !not); err != nil {
+			return err
+		}
+
+		_, err = add(b.Hash, not)
+		return err
+	}
+
+	exclude := not
+	if strings.HasPrefix(rev, "^") {
+		rev = rev[1:]
+		exclude = !exclude
+	}
+
+	c, err := r.logRevisionCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	_, err = add(c.Hash, exclude)
+	return err
+}
+
+// logRevisionCommit resolves the given revision to a commit, HEAD if empty.
+func (r *Repository) logRevisionCommit(rev string) (*object.Commit, error) {
+	if rev == "" {
+		rev = string(plumbing.HEAD)
+	}
+
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CommitObject(*h)
+}
+
+// logAllTips returns the commits HEAD and the references point to, peeling
+// the annotated tags.
+func (r *Repository) logAllTips() ([]plumbing.Hash, error) {
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		ref, err := storer.ResolveReference(r.Storer, ref.Name())
+		if err != nil {
+			return nil
+		}
+
+		if c, err := r.revisionCommit(ref.Hash()); err == nil {
+			hashes = append(hashes, c.Hash)
+		}
+
+		return nil
+	})
+
+	if head := resolvedHash(r.Storer, plumbing.HEAD); !head.IsZero() {
+		hashes = append([]plumbing.Hash{head}, hashes...)
+	}
+
+	return hashes, err
+}
+
+// iter returns an iterator over the commits of the range, walked as requested
+// by the given options, followed by the boundary commits if requested.
+func (lr *logRange) iter(s storer.EncodedObjectStorer, o *LogOptions) object.CommitIter {
+	ignore := make(map[plumbing.Hash]bool, len(lr.exclude))
+	for h := range lr.exclude {
+		ignore[h] = true
+	}
+
+	var it object.CommitIter = &commitRangeIter{
+		order:       o.Order,
+		firstParent: o.FirstParent,
+		pending:     lr.include,
+		ignore:      ignore,
+	}
+
+	if o.Boundary {
+		it = &commitBoundaryIter{
+			s:           s,
+			iter:        it,
+			firstParent: o.FirstParent,
+			exclude:     lr.exclude,
+			added:       make(map[plumbing.Hash]bool),
+		}
+	}
+
+	return it
+}
+
+// ancestryPath returns the commits of the range that are descendants of the
+// excluded commits.
+func (lr *logRange) ancestryPath(s storer.EncodedObjectStorer, o *LogOptions) (map[plumbing.Hash]bool, error) {
+	parents := make(map[plumbing.Hash][]plumbing.Hash)
+	it := lr.iter(s, &LogOptions{Order: o.Order, FirstParent: o.FirstParent})
+	err := it.ForEach(func(c *object.Commit) error {
+		parents[c.Hash] = c.ParentHashes
+		if o.FirstParent && len(c.ParentHashes) > 1 {
+			parents[c.Hash] = c.ParentHashes[:1]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	onPath := make(map[plumbing.Hash]bool, len(lr.bottoms))
+	for _, c := range lr.bottoms {
+		onPath[c.Hash] = true
+	}
+
+	visited := make(map[plumbing.Hash]bool)
+	var visit func(h plumbing.Hash) bool
+	visit = func(h plumbing.Hash) bool {
+		if visited[h] {
+			return onPath[h]
+		}
+
+		visited[h] = true
+		for _, p := range parents[h] {
+			if visit(p) {
+				onPath[h] = true
+			}
+		}
+
+		return onPath[h]
+	}
+
+	path := make(map[plumbing.Hash]bool)
+	for h := range parents {
+		if visit(h) {
+			path[h] = true
+		}
+	}
+
+	return path, nil
+}
+
+// logCommitFilter returns the filter of the commits matching the options, or
+// nil if there is nothing to filter.
+func (r *Repository) logCommitFilter(o *LogOptions, lr *logRange) (object.CommitFilter, error) {
+	var filters []object.CommitFilter
+	if o.Author != nil {
+		filters = append(filters, func(c *object.Commit) bool {
+			return matchSignature(o.Author, &c.Author)
+		})
+	}
+
+	if o.Committer != nil {
+		filters = append(filters, func(c *object.Commit) bool {
+			return matchSignature(o.Committer, &c.Committer)
+		})
+	}
+
+	if len(o.Grep) > 0 {
+		filters = append(filters, func(c *object.Commit) bool {
+			return matchMessage(o.Grep, o.AllMatch, c.Message) != o.InvertGrep
+		})
+	}
+
+	if o.MinParents > 0 || o.MaxParents != nil {
+		filters = append(filters, func(c *object.Commit) bool {
+			n := c.NumParents()
+			return n >= o.MinParents && (o.MaxParents == nil || n <= *o.MaxParents)
+		})
+	}
+
+	if o.AncestryPath && lr != nil && len(lr.bottoms) > 0 {
+		path, err := lr.ancestryPath(r.Storer, o)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, func(c *object.Commit) bool {
+			return path[c.Hash]
+		})
+	}
+
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	return func(c *object.Commit) bool {
+		for _, filter := range filters {
+			if !filter(c) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+func matchSignature(re *regexp.Regexp, s *object.Signature) bool {
+	return re.MatchString(fmt.Sprintf("%s <%s>", s.Name, s.Email))
+}
+
+// matchMessage reports whether the message matches any of the regexps, or all
+// of them if all is set.
+func matchMessage(res []*regexp.Regexp, all bool, msg string) bool {
+	for _, re := range res {
+		if re.MatchString(msg) != all {
+			return !all
+		}
+	}
+
+	return all
+}
+
+// commitRangeIter walks the history of several commits, listing each commit
+// once. When ordered by committer time, the histories are merged, otherwise
+// they are walked one after another, each walk skipping the commits already
+// listed.
+type commitRangeIter struct {
+	order       LogOrder
+	firstParent bool
+	pending     []*object.Commit
+	// ignore holds the excluded commits and the ones already listed
+	ignore map[plumbing.Hash]bool
+	iters  []object.CommitIter
+	heads  []*object.Commit
+}
+
+func (it *commitRangeIter) Next() (*object.Commit, error) {
+	for {
+		c, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if it.ignore[c.Hash] {
+			continue
+		}
+
+		it.ignore[c.Hash] = true
+		return c, nil
+	}
+}
+
+func (it *commitRangeIter) next() (*object.Commit, error) {
+	for len(it.iters) == 0 && len(it.pending) > 0 {
+		if err := it.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(it.iters) == 0 {
+		return nil, io.EOF
+	}
+
+	i := 0
+	for j, c := range it.heads {
+		if c.Committer.When.After(it.heads[i].Committer.When) {
+			i = j
+		}
+	}
+
+	c := it.heads[i]
+	next, err := it.iters[i].Next()
+	switch err {
+	case nil:
+		it.heads[i] = next
+	case io.EOF:
+		it.iters = append(it.iters[:i], it.iters[i+1:]...)
+		it.heads = append(it.heads[:i], it.heads[i+1:]...)
+	default:
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// start starts walking the pending commits: all of them when ordered by
+// committer time, the next one otherwise.
+func (it *commitRangeIter) start() error {
+	n := 1
+	if it.order == LogOrderCommitterTime {
+		n = len(it.pending)
+	}
+
+	ignore := make([]plumbing.Hash, 0, len(it.ignore))
+	for h := range it.ignore {
+		ignore = append(ignore, h)
+	}
+
+	fn := commitIterFunc(it.order, it.firstParent, ignore)
+	for _, c := range it.pending[:n] {
+		iter := fn(c)
+		head, err := iter.Next()
+		if err == io.EOF {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		it.iters = append(it.iters, iter)
+		it.heads = append(it.heads, head)
+	}
+
+	it.pending = it.pending[n:]
+	return nil
+}
+
+func (it *commitRangeIter) ForEach(cb func(*object.Commit) error) error {
+	return forEachCommit(it, cb)
+}
+
+func (it *commitRangeIter) Close() {
+	for _, iter := range it.iters {
+		iter.Close()
+	}
+
+	it.iters, it.heads, it.pending = nil, nil, nil
+}
+
+// commitBoundaryIter lists the commits of the given iterator, followed by the
+// excluded commits that are parents of them.
+type commitBoundaryIter struct {
+	s           storer.EncodedObjectStorer
+	iter        object.CommitIter
+	firstParent bool
+	exclude     map[plumbing.Hash]bool
+	added       map[plumbing.Hash]bool
+	boundary    []plumbing.Hash
+	done        bool
+}
+
+func (it *commitBoundaryIter) Next() (*object.Commit, error) {
+	if !it.done {
+		c, err := it.iter.Next()
+		if err == nil {
+			parents := c.ParentHashes
+			if it.firstParent && len(parents) > 1 {
+				parents = parents[:1]
+			}
+
+			for _, h := range parents {
+				if it.exclude[h] && !it.added[h] {
+					it.added[h] = true
+					it.boundary = append(it.boundary, h)
+				}
+			}
+
+			return c, nil
+		}
+
+		if err != io.EOF {
+			return nil, err
+		}
+
+		it.done = true
+	}
+
+	if len(it.boundary) == 0 {
+		return nil, io.EOF
+	}
+
+	h := it.boundary[0]
+	it.boundary = it.boundary[1:]
+	return object.GetCommit(it.s, h)
+}
+
+func (it *commitBoundaryIter) ForEach(cb func(*object.Commit) error) error {
+	return forEachCommit(it, cb)
+}
+
+func (it *commitBoundaryIter) Close() {
+	it.iter.Close()
+	it.boundary = nil
+}
+
+// forEachCommit calls cb with each commit of the given iterator, stopping
+// without error when cb returns storer.ErrStop.
+func forEachCommit(it object.CommitIter, cb func(*object.Commit) error) error {
+	for {
+		c, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := cb(c); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
@@ -3,6 +3,8 @@ package git
 import (
 	"errors"
 	"fmt"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/utils/diff"
 	"golang.org/x/crypto/openpgp"
 )
 
@@ -105,8 +108,30 @@ type PullOptions struct {
 	// Force allows the pull to update a local branch even when the remote
 	// branch does not descend from it.
 	Force bool
+	// Mode defines how the fetched changes are integrated into the current
+	// branch when they can not be applied as a fast-forward. By default
+	// PullFastForwardOnly is used.
+	Mode PullMode
+	// Author and Committer are the signatures used for the commits created
+	// by the pull, if any. If nil they are read from the config.
+	Author, Committer *object.Signature
 }
 
+// PullMode defines how a pull integrates the fetched changes.
+type PullMode int8
+
+const (
+	// PullFastForwardOnly only accepts updates that can be resolved as a
+	// fast-forward, ErrNonFastForwardUpdate is returned otherwise.
+	PullFastForwardOnly PullMode = iota
+	// PullMerge creates a merge commit joining both histories when the update
+	// is not a fast-forward.
+	PullMerge
+	// PullRebase replays the local commits on top of the fetched reference
+	// when the update is not a fast-forward.
+	PullRebase
+)
+
 // Validate validates the fields and sets the default values.
 func (o *PullOptions) Validate() error {
 	if o.RemoteName == "" {
@@ -244,6 +269,8 @@ type CheckoutOptions struct {
 	// exclusive.
 	Hash plumbing.Hash
 	// Branch to be checked out, if Branch and Hash are empty is set to `master`.
+	// A branch checked out by another worktree is refused with
+	// ErrBranchCheckedOut, unless Force is used.
 	Branch plumbing.ReferenceName
 	// Create a new branch named Branch and start it at Hash.
 	Create bool
@@ -299,6 +326,21 @@ const (
 	SoftReset
 )
 
+// ConflictResolution defines how an unmerged path is resolved.
+type ConflictResolution int8
+
+const (
+	// ResolveWithWorktree stages the current content of the file in the
+	// worktree, this is what `git add <path>` does after editing the file.
+	ResolveWithWorktree ConflictResolution = iota
+	// ResolveWithOurs checks out and stages the version of the current
+	// branch (stage 2).
+	ResolveWithOurs
+	// ResolveWithTheirs checks out and stages the version being merged
+	// (stage 3).
+	ResolveWithTheirs
+)
+
 // ResetOptions describes how a reset operation should be performed.
 type ResetOptions struct {
 	// Commit, if commit is present set the current branch head (HEAD) to it.
@@ -350,6 +392,11 @@ type LogOptions struct {
 	// this field is kept for compatility, it can be replaced with PathFilter
 	FileName *string
 
+	// Follow continues listing the history of FileName beyond its renames.
+	// It is equivalent to running `git log --follow -- <file-name>`.
+	// Repository.LogFollow also gives the path of the file in each commit.
+	Follow bool
+
 	// Filter commits based on the path of files that are updated
 	// takes file path as argument and should return true if the file is desired
 	// It can be used to implement `git log -- <path>`
@@ -368,6 +415,73 @@ type LogOptions struct {
 	// Show commits older than a specific date.
 	// It is equivalent to running `git log --until <date>` or `git log --before <date>`.
 	Until *time.Time
+
+	// Include lists more commits whose history is shown, along with From.
+	// It is equivalent to running `git log <commit>...`.
+	Include []plumbing.Hash
+
+	// Exclude lists commits whose history is hidden. It is equivalent to
+	// running `git log ^<commit>` or `git log --not <commit>...`.
+	// If no commit is included, the history of HEAD is shown.
+	Exclude []plumbing.Hash
+
+	// Revisions lists revision ranges, as given to git log: a revision
+	// includes its history, "^<rev>" excludes it, "<rev1>..<rev2>" shows the
+	// commits reachable from rev2 but not from rev1 and "<rev1>...<rev2>" the
+	// ones reachable from either of them but not from both. An omitted side
+	// of a range means HEAD. "--not" reverses the meaning of the revisions
+	// following it, up to the next "--not".
+	Revisions []string
+
+	// Boundary also shows the excluded commits that are parents of the
+	// shown ones, after them. It is equivalent to running `git log --boundary`.
+	Boundary bool
+
+	// Show only the commits whose author, formatted as "Name <email>",
+	// matches the regexp. It is equivalent to running `git log --author <pattern>`.
+	Author *regexp.Regexp
+
+	// Show only the commits whose committer, formatted as "Name <email>",
+	// matches the regexp. It is equivalent to running `git log --committer <pattern>`.
+	Committer *regexp.Regexp
+
+	// Show only the commits whose message matches any of the regexps.
+	// It is equivalent to running `git log --grep <pattern>...`.
+	Grep []*regexp.Regexp
+
+	// AllMatch shows only the commits whose message matches all the Grep
+	// regexps. It is equivalent to running `git log --all-match`.
+	AllMatch bool
+
+	// InvertGrep shows only the commits whose message doesn't match the Grep
+	// regexps. It is equivalent to running `git log --invert-grep`.
+	InvertGrep bool
+
+	// Show only the commits having at least the given number of parents.
+	// Setting it to 2 is equivalent to running `git log --merges`.
+	MinParents int
+
+	// Show only the commits having at most the given number of parents, if
+	// not nil. Setting it to 1 is equivalent to running `git log --no-merges`.
+	MaxParents *int
+
+	// FirstParent follows only the first parent of the merge commits.
+	// It is equivalent to running `git log --first-parent`.
+	FirstParent bool
+
+	// AncestryPath shows only the commits that are descendants of the
+	// excluded commits and ancestors of the included ones.
+	// It is equivalent to running `git log --ancestry-path`.
+	AncestryPath bool
+
+	// Skip the given number of commits before starting to show them.
+	// It is equivalent to running `git log --skip <n>`.
+	Skip int
+
+	// Limit the number of commits shown, when positive. The history isn't
+	// walked further once the limit is reached.
+	// It is equivalent to running `git log --max-count <n>`.
+	MaxCount int
 }
 
 var (
@@ -387,6 +501,11 @@ type AddOptions struct {
 	// Glob adds all paths, matching pattern, to the index. If pattern matches a
 	// directory path, all directory contents are added to the index recursively.
 	Glob string
+	// Renormalize adds again the tracked files under Path, or all of them if
+	// Path is empty, applying the line ending conversions even to the files
+	// with CRLF line endings in the index, equivalent to `git add
+	// --renormalize`. It's used after changing the text or eol attributes.
+	Renormalize bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -395,6 +514,10 @@ func (o *AddOptions) Validate(r *Repository) error {
 		return fmt.Errorf("fields Path and Glob are mutual exclusive")
 	}
 
+	if o.Renormalize && (o.All || o.Glob != "") {
+		return fmt.Errorf("field Renormalize is not compatible with All and Glob")
+	}
+
 	return nil
 }
 
@@ -410,7 +533,8 @@ type CommitOptions struct {
 	// nil the Author signature is used.
 	Committer *object.Signature
 	// Parents are the parents commits for the new commit, by default when
-	// len(Parents) is zero, the hash of HEAD reference is used.
+	// len(Parents) is zero, the hash of HEAD reference is used, followed by
+	// the hash of MERGE_HEAD if a merge is in progress.
 	Parents []plumbing.Hash
 	// SignKey denotes a key to sign the commit with. A nil value here means the
 	// commit will not be signed. The private key must be present and already
@@ -439,6 +563,15 @@ func (o *CommitOptions) Validate(r *Repository) error {
 		if head != nil {
 			o.Parents = []plumbing.Hash{head.Hash()}
 		}
+
+		merge, err := r.Storer.Reference(plumbing.MergeHead)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		if merge != nil {
+			o.Parents = append(o.Parents, merge.Hash())
+		}
 	}
 
 	return nil
@@ -481,6 +614,530 @@ func (o *CommitOptions) loadConfigAuthorAndCommitter(r *Repository) error {
 	return nil
 }
 
+// FastForwardMode defines how a merge behaves when it can be resolved as a
+// fast-forward.
+type FastForwardMode int8
+
+const (
+	// FastForwardAllowed updates the branch without creating a merge commit
+	// when possible. This is the default.
+	FastForwardAllowed FastForwardMode = iota
+	// FastForwardOnly refuses to merge unless the branch can be updated as a
+	// fast-forward, returning ErrNonFastForwardUpdate otherwise.
+	FastForwardOnly
+	// NoFastForward always creates a merge commit, even when the branch could
+	// be updated as a fast-forward.
+	NoFastForward
+)
+
+var (
+	ErrMissingCommit   = errors.New("commit field is required")
+	ErrMissingUpstream = errors.New("upstream field is required")
+)
+
+// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD.
+	Commit plumbing.Hash
+	// Message is the message of the merge commit. If empty a message is
+	// generated from Commit.
+	Message string
+	// FastForward defines the behavior when the merge can be resolved as a
+	// fast-forward, by default FastForwardAllowed.
+	FastForward FastForwardMode
+	// NoCommit performs the merge but stops before creating the merge commit,
+	// the result is left in the index and the worktree and MERGE_HEAD is set,
+	// so a later call to Worktree.Commit concludes the merge.
+	NoCommit bool
+	// AllowUnrelatedHistories allows merging commits that don't share any
+	// common ancestor.
+	AllowUnrelatedHistories bool
+	// ConflictStyle defines how the conflicting regions of the files are
+	// written to the worktree, by default diff.MergeStyle.
+	ConflictStyle diff.ConflictStyle
+	// Author is the author's signature of the merge commit. If Author is empty
+	// the Name and Email is read from the config, and time.Now it's used as
+	// When.
+	Author *object.Signature
+	// Committer is the committer's signature of the merge commit. If Committer
+	// is nil the Author signature is used.
+	Committer *object.Signature
+	// SignKey denotes a key to sign the merge commit with. A nil value here
+	// means the commit will not be signed. The private key must be present and
+	// already decrypted.
+	SignKey *openpgp.Entity
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate(r *Repository) error {
+	if o.Commit.IsZero() {
+		return ErrMissingCommit
+	}
+
+	if o.Message == "" {
+		o.Message = fmt.Sprintf("Merge commit '%s'\n", o.Commit)
+	}
+
+	return nil
+}
+
+// CherryPickOptions describes how a cherry-pick should be performed.
+type CherryPickOptions struct {
+	// Mainline is the number, starting at 1, of the parent of a merge commit
+	// its changes are computed against. It is required to cherry-pick merge
+	// commits, and must be zero for any other commit.
+	Mainline int
+	// NoCommit applies the changes to the index and the worktree without
+	// creating a new commit.
+	NoCommit bool
+	// RecordOrigin appends the line "(cherry picked from commit <hash>)" to
+	// the message of the new commit.
+	RecordOrigin bool
+	// ConflictStyle defines how the conflicting regions of the files are
+	// written to the worktree, by default diff.MergeStyle.
+	ConflictStyle diff.ConflictStyle
+	// Committer is the committer's signature of the new commit. If Committer
+	// is nil the Name and Email is read from the config, and time.Now it's
+	// used as When. The author of the picked commit is preserved.
+	Committer *object.Signature
+	// SignKey denotes a key to sign the new commit with. A nil value here
+	// means the commit will not be signed. The private key must be present and
+	// already decrypted.
+	SignKey *openpgp.Entity
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CherryPickOptions) Validate(r *Repository) error {
+	if o.Mainline < 0 {
+		return ErrInvalidMainline
+	}
+
+	return nil
+}
+
+// RevertOptions describes how a revert should be performed.
+type RevertOptions struct {
+	// Mainline is the number, starting at 1, of the parent of a merge commit
+	// its changes are computed against. It is required to revert merge
+	// commits, and must be zero for any other commit.
+	Mainline int
+	// NoCommit applies the inverse changes to the index and the worktree
+	// without creating a new commit.
+	NoCommit bool
+	// Message is the message of the new commit. If empty a message is
+	// generated from the reverted commit.
+	Message string
+	// ConflictStyle defines how the conflicting regions of the files are
+	// written to the worktree, by default diff.MergeStyle.
+	ConflictStyle diff.ConflictStyle
+	// Author is the author's signature of the new commit. If Author is empty
+	// the Name and Email is read from the config, and time.Now it's used as
+	// When.
+	Author *object.Signature
+	// Committer is the committer's signature of the new commit. If Committer
+	// is nil the Author signature is used.
+	Committer *object.Signature
+	// SignKey denotes a key to sign the new commit with. A nil value here
+	// means the commit will not be signed. The private key must be present and
+	// already decrypted.
+	SignKey *openpgp.Entity
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RevertOptions) Validate(r *Repository) error {
+	if o.Mainline < 0 {
+		return ErrInvalidMainline
+	}
+
+	return nil
+}
+
+// RebaseOptions describes how a rebase should be performed.
+type RebaseOptions struct {
+	// Upstream is the commit the branch is compared to. The commits of the
+	// branch not reachable from Upstream are replayed.
+	Upstream plumbing.Hash
+	// Onto is the commit the replayed commits are applied on top of, by
+	// default Upstream.
+	Onto plumbing.Hash
+	// Branch is the branch to be rebased, if given it is checked out before
+	// starting. By default the current HEAD is rebased.
+	Branch plumbing.ReferenceName
+	// Todo is the list of actions to be performed. If empty, the commits of
+	// the branch not reachable from Upstream are picked, oldest first. The
+	// list returned by Worktree.RebaseTodo can be used as a starting point.
+	Todo []RebaseTodo
+	// IncludeMerges includes the merge commits in the default todo list.
+	// Their changes are computed against their first parent, linearizing
+	// the history.
+	IncludeMerges bool
+	// ConflictStyle defines how the conflicting regions of the files are
+	// written to the worktree, by default diff.MergeStyle.
+	ConflictStyle diff.ConflictStyle
+	// Committer is the committer's signature of the replayed commits. If
+	// Committer is nil the Name and Email is read from the config, and
+	// time.Now it's used as When. The authors of the commits are preserved.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RebaseOptions) Validate(r *Repository) error {
+	if o.Upstream.IsZero() {
+		return ErrMissingUpstream
+	}
+
+	if o.Onto.IsZero() {
+		o.Onto = o.Upstream
+	}
+
+	for i, t := range o.Todo {
+		if t.Action < RebasePick || t.Action > RebaseDrop || t.Commit.IsZero() {
+			return ErrInvalidRebaseTodo
+		}
+
+		if i == 0 && (t.Action == RebaseSquash || t.Action == RebaseFixup) {
+			return ErrInvalidRebaseTodo
+		}
+
+		if t.Action == RebaseReword && t.Message == "" {
+			return ErrInvalidRebaseTodo
+		}
+	}
+
+	return nil
+}
+
+// RebaseContinueOptions describes how a stopped rebase is resumed. As git,
+// the options given when the rebase was started are not remembered.
+type RebaseContinueOptions struct {
+	// ConflictStyle defines how the conflicting regions of the files are
+	// written to the worktree, by default diff.MergeStyle.
+	ConflictStyle diff.ConflictStyle
+	// Committer is the committer's signature of the replayed commits. If
+	// Committer is nil the Name and Email is read from the config, and
+	// time.Now it's used as When.
+	Committer *object.Signature
+}
+
+// StashOptions describes how a stash should be created.
+type StashOptions struct {
+	// Message is the description of the stash. If empty a description is
+	// generated from HEAD.
+	Message string
+	// IncludeUntracked stashes the untracked files too, removing them from
+	// the worktree.
+	IncludeUntracked bool
+	// Author is the signature of the stash commits. If Author is empty the
+	// Name and Email is read from the config, and time.Now it's used as When.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StashOptions) Validate(r *Repository) error {
+	if o.Author == nil {
+		co := &CommitOptions{}
+		if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+
+		o.Author = co.Committer
+		if o.Author == nil {
+			o.Author = co.Author
+		}
+	}
+
+	return nil
+}
+
+// ApplyOptions describes how a patch should be applied.
+type ApplyOptions struct {
+	// Index applies the patch to both the worktree and the index. The files
+	// of the worktree must match the index.
+	Index bool
+	// Cached applies the patch to the index only, without touching the
+	// worktree.
+	Cached bool
+	// Reverse applies the patch in reverse, undoing its changes.
+	Reverse bool
+	// Check only verifies that the patch applies, without changing anything.
+	Check bool
+	// Fuzz is the number of context lines at the start and at the end of
+	// each hunk that may be ignored when they don't match. By default all
+	// the context lines must match.
+	Fuzz int
+	// ThreeWay falls back to a three-way merge when the patch of a file
+	// doesn't apply, using the blob the patch was generated from, given by
+	// its index line, as the base. The conflicts are recorded in the index
+	// as with Worktree.Merge. It implies Index, unless Cached is set.
+	ThreeWay bool
+	// Reject applies the hunks that apply and writes the others, for each
+	// file, to a file with the same name and the ".rej" extension, instead
+	// of applying nothing.
+	Reject bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ApplyOptions) Validate(r *Repository) error {
+	if o.Fuzz < 0 {
+		return ErrInvalidFuzz
+	}
+
+	if o.ThreeWay && !o.Cached {
+		o.Index = true
+	}
+
+	return nil
+}
+
+// ErrNumberedExclusive is returned when both Numbered and NoNumbered are set
+// in FormatPatchOptions.
+var ErrNumberedExclusive = errors.New("Numbered and NoNumbered are mutually exclusive")
+
+// FormatPatchOptions describes how the patches of Repository.FormatPatch are
+// generated.
+type FormatPatchOptions struct {
+	// Revisions selects the commits to format, as LogOptions.Revisions does,
+	// e.g. "origin/master..HEAD". As with git format-patch, a single
+	// revision "<rev>" selects the commits since rev, "<rev>..HEAD". The
+	// merge commits are skipped.
+	Revisions []string
+	// Root takes a single revision as a range, selecting all the commits
+	// reachable from it, including the root commit.
+	Root bool
+	// SubjectPrefix is written in brackets before the subjects, "PATCH" by
+	// default.
+	SubjectPrefix string
+	// Numbered numbers the subjects as "[PATCH n/m]" even if there is a
+	// single patch. By default they are numbered if there are several
+	// patches or a cover letter.
+	Numbered bool
+	// NoNumbered never numbers the subjects.
+	NoNumbered bool
+	// StartNumber is the number of the first patch, 1 by default.
+	StartNumber int
+	// CoverLetter adds a first message, numbered 0, with a summary of the
+	// patches to be filled in with CoverLetterSubject and CoverLetterBody.
+	CoverLetter bool
+	// CoverLetterSubject and CoverLetterBody are the subject and the text
+	// of the cover letter, by default the placeholders of git.
+	CoverLetterSubject, CoverLetterBody string
+	// Author is the sender of the cover letter. If Author is nil the Name
+	// and Email of the committer is read from the config, and time.Now it's
+	// used as When.
+	Author *object.Signature
+	// Signature is written at the end of each message, after a "-- " line.
+	// No signature is written if it is empty.
+	Signature string
+	// PatchOptions describes how the changes are computed, by default
+	// object.DefaultPatchOptions.
+	PatchOptions *object.PatchOptions
+}
+
+// Validate validates the fields and sets the default values.
+func (o *FormatPatchOptions) Validate(r *Repository) error {
+	if o.Numbered && o.NoNumbered {
+		return ErrNumberedExclusive
+	}
+
+	if o.SubjectPrefix == "" {
+		o.SubjectPrefix = "PATCH"
+	}
+
+	if o.StartNumber == 0 {
+		o.StartNumber = 1
+	}
+
+	if o.CoverLetterSubject == "" {
+		o.CoverLetterSubject = "*** SUBJECT HERE ***"
+	}
+
+	if o.CoverLetterBody == "" {
+		o.CoverLetterBody = "*** BLURB HERE ***"
+	}
+
+	if o.PatchOptions == nil {
+		o.PatchOptions = object.DefaultPatchOptions
+	}
+
+	if o.CoverLetter && o.Author == nil {
+		co := &CommitOptions{}
+		if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+
+		o.Author = co.Committer
+		if o.Author == nil {
+			o.Author = co.Author
+		}
+	}
+
+	return nil
+}
+
+// ApplyMailboxOptions describes how the patches of a mailbox should be
+// applied.
+type ApplyMailboxOptions struct {
+	// Committer is the committer's signature of the new commits. If
+	// Committer is nil the Name and Email is read from the config, and
+	// time.Now it's used as When. The author of the patches is preserved.
+	Committer *object.Signature
+	// ThreeWay falls back to a three-way merge when a patch doesn't apply,
+	// as ApplyOptions.ThreeWay does.
+	ThreeWay bool
+	// KeepSubject keeps the bracketed prefixes of the subjects, as
+	// "[PATCH 1/2]", in the messages of the commits.
+	KeepSubject bool
+	// SignKey denotes a key to sign the new commits with. A nil value here
+	// means the commits will not be signed. The private key must be present
+	// and already decrypted.
+	SignKey *openpgp.Entity
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ApplyMailboxOptions) Validate(r *Repository) error {
+	return nil
+}
+
+// DiffOptions describes how the diff of a worktree is computed. By default
+// the worktree is compared with the index, as git diff does.
+type DiffOptions struct {
+	// Cached compares the index with Commit instead of the worktree, as git
+	// diff --cached does.
+	Cached bool
+	// Commit is the hash of the commit compared with the worktree, or with
+	// the index if Cached is set. If Cached is set, the commit is HEAD by
+	// default.
+	Commit plumbing.Hash
+	// PathSpecs are compiled Regexp objects of pathspec limiting the diff to
+	// the matching files.
+	PathSpecs []*regexp.Regexp
+	// DiffTreeOptions describes how the renames are detected. If nil, no
+	// rename detection is performed, the recommended options are
+	// object.DefaultDiffTreeOptions.
+	DiffTreeOptions *object.DiffTreeOptions
+	// PatchOptions describes how the changes of the files are computed, by
+	// default object.DefaultPatchOptions.
+	PatchOptions *object.PatchOptions
+}
+
+// Validate validates the fields and sets the default values.
+func (o *DiffOptions) Validate(r *Repository) error {
+	if o.Cached && o.Commit.IsZero() {
+		head, err := r.Head()
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		if head != nil {
+			o.Commit = head.Hash()
+		}
+	}
+
+	if o.PatchOptions == nil {
+		o.PatchOptions = object.DefaultPatchOptions
+	}
+
+	return nil
+}
+
+// AddWorktreeOptions describes how a linked worktree is added by
+// Repository.AddWorktree.
+type AddWorktreeOptions struct {
+	// Branch to be checked out in the worktree. If Branch is empty, HEAD is
+	// detached at Hash, as git worktree add --detach does.
+	Branch plumbing.ReferenceName
+	// Hash is the commit to be checked out, HEAD by default. If Create is
+	// not used, Branch and Hash are mutually exclusive.
+	Hash plumbing.Hash
+	// Create a new branch named Branch and start it at Hash.
+	Create bool
+	// Force checks out Branch even if it is already checked out by another
+	// worktree.
+	Force bool
+	// Lock keeps the worktree locked once added, with LockReason as reason.
+	Lock       bool
+	LockReason string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *AddWorktreeOptions) Validate(r *Repository) error {
+	if !o.Create && !o.Hash.IsZero() && o.Branch != "" {
+		return ErrBranchHashExclusive
+	}
+
+	if o.Create && o.Branch == "" {
+		return ErrCreateRequiresBranch
+	}
+
+	if o.Branch != "" && !o.Create {
+		return nil
+	}
+
+	if o.Hash.IsZero() {
+		head, err := r.Head()
+		if err != nil {
+			return err
+		}
+
+		o.Hash = head.Hash()
+	}
+
+	return nil
+}
+
+// RemoveWorktreeOptions describes how a linked worktree is removed by
+// Repository.RemoveWorktree.
+type RemoveWorktreeOptions struct {
+	// Force removes the worktree even if it has modified or untracked files.
+	Force bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RemoveWorktreeOptions) Validate() error { return nil }
+
+// ErrSparseConePattern is returned when a pattern is given instead of a
+// directory to a sparse checkout in cone mode.
+var ErrSparseConePattern = errors.New("cone mode sparse checkout requires directories, not patterns")
+
+// SparseCheckoutOptions describes the sparse checkout set by
+// Worktree.SetSparseCheckout.
+type SparseCheckoutOptions struct {
+	// Patterns select the files checked out, with the format of the
+	// gitignore patterns. In cone mode they are the directories checked out
+	// recursively, the files at the root and in the parents of the
+	// directories being always checked out.
+	Patterns []string
+	// Cone enables the cone mode, as git sparse-checkout set --cone does.
+	Cone bool
+	// SparseIndex enables the sparse index, as git sparse-checkout set
+	// --sparse-index does: the directories outside of the sparse checkout are
+	// recorded in the index as a single sparse directory entry. It's only
+	// supported in cone mode, being ignored otherwise.
+	SparseIndex bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *SparseCheckoutOptions) Validate() error {
+	if !o.Cone {
+		return nil
+	}
+
+	var dirs []string
+	for _, p := range o.Patterns {
+		if strings.ContainsAny(p, "*?[\\!") {
+			return ErrSparseConePattern
+		}
+
+		p = path.Clean("/" + filepath.ToSlash(p))[1:]
+		if p != "" {
+			dirs = append(dirs, p)
+		}
+	}
+
+	o.Patterns = dirs
+	return nil
+}
+
 var (
 	ErrMissingName    = errors.New("name field is required")
 	ErrMissingTagger  = errors.New("tagger field is required")
@@ -596,6 +1253,45 @@ func (o *GrepOptions) Validate(w *Worktree) error {
 	return nil
 }
 
+// LineRange is a range of lines of a file, both ends included. Lines are
+// numbered from 1.
+type LineRange struct {
+	// Start is the first line of the range.
+	Start int
+	// End is the last line of the range, if zero the range ends at the end of
+	// the file.
+	End int
+}
+
+// BlameOptions describes how a blame should be performed.
+type BlameOptions struct {
+	// LineRanges restricts the blame to the given ranges of lines. If empty
+	// the whole file is blamed. It is equivalent to running
+	// `git blame -L <start>,<end>...`.
+	LineRanges []LineRange
+	// DetectRenames follows the file when it is renamed. The previous name is
+	// found with object.DetectRenames when the file is added by a commit.
+	DetectRenames bool
+	// DetectCopies looks for the lines added by a commit in the files modified
+	// by the same commit, so the lines moved or copied from them are blamed on
+	// their origin. It implies DetectRenames and is equivalent to running
+	// `git blame -C`.
+	DetectCopies bool
+	// IgnoreRevs are the commits whose changes are ignored, the lines they
+	// change are blamed on the previous commit changing them instead. It is
+	// equivalent to running `git blame --ignore-rev <rev>...`, use
+	// ReadIgnoreRevs to read a `.git-blame-ignore-revs` file.
+	IgnoreRevs []plumbing.Hash
+	// Exclude stops the blame at the given commits and their ancestors, the
+	// lines coming from them are blamed on the boundary commit. Blaming commit
+	// `c` excluding `a` is equivalent to running `git blame a..c`.
+	Exclude []*object.Commit
+	// Since stops the blame at the commits older than the given time, the
+	// lines coming from them are blamed on the boundary commit. It is
+	// equivalent to running `git blame --since <date>`.
+	Since *time.Time
+}
+
 // PlainOpenOptions describes how opening a plain repository should be
 // performed.
 type PlainOpenOptions struct {
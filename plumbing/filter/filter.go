@@ -0,0 +1,111 @@
+// Package filter implements the filter drivers of git, converting the content
+// of the files with a filter attribute when adding them to the repository
+// (clean) and when checking them out (smudge).
+//
+// See https://git-scm.com/docs/gitattributes#_filter
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned by the filters not supporting a conversion,
+	// the content of the file being left untouched unless the filter is
+	// required.
+	ErrUnsupported = errors.New("filter: conversion not supported")
+	// ErrProcessFailed is returned when a filter process reports the
+	// failure of a conversion.
+	ErrProcessFailed = errors.New("filter: process failed")
+	// ErrInvalidHandshake is returned when a filter process doesn't follow
+	// the handshake of the protocol.
+	ErrInvalidHandshake = errors.New("filter: invalid process handshake")
+)
+
+// Filter is a filter driver. The content written to dst is discarded if an
+// error is returned.
+type Filter interface {
+	// Clean writes to dst the content of the file at path to store in the
+	// repository, from its content in the worktree read from src.
+	Clean(path string, dst io.Writer, src io.Reader) error
+	// Smudge writes to dst the content of the file at path to write in the
+	// worktree, from its content in the repository read from src.
+	Smudge(path string, dst io.Writer, src io.Reader) error
+}
+
+// command is a Filter running a shell command for each file.
+type command struct {
+	clean, smudge string
+	dir           string
+}
+
+// NewCommand returns a Filter running the given shell commands for each
+// file, as the filter.<driver>.clean and filter.<driver>.smudge configs of
+// git. The content of the file is written to the standard input of the
+// command, and read from its standard output. The %f in the commands are
+// replaced by the quoted path of the file. An empty command makes the
+// conversion unsupported.
+func NewCommand(clean, smudge, dir string) Filter {
+	return &command{clean: clean, smudge: smudge, dir: dir}
+}
+
+func (c *command) Clean(path string, dst io.Writer, src io.Reader) error {
+	return c.run(c.clean, path, dst, src)
+}
+
+func (c *command) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return c.run(c.smudge, path, dst, src)
+}
+
+func (c *command) run(cmdline, path string, dst io.Writer, src io.Reader) error {
+	if cmdline == "" {
+		return ErrUnsupported
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", expandPath(cmdline, path))
+	cmd.Dir = c.dir
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("filter: %s: %s", err, msg)
+		}
+
+		return fmt.Errorf("filter: %s", err)
+	}
+
+	return nil
+}
+
+// expandPath replaces the %f of the command by the quoted path, and the %% by
+// a %.
+func expandPath(cmdline, path string) string {
+	var b strings.Builder
+	for i := 0; i < len(cmdline); i++ {
+		if cmdline[i] != '%' || i+1 == len(cmdline) {
+			b.WriteByte(cmdline[i])
+			continue
+		}
+
+		switch cmdline[i+1] {
+		case 'f':
+			b.WriteString("'" + strings.Replace(path, "'", `'\''`, -1) + "'")
+			i++
+		case '%':
+			b.WriteByte('%')
+			i++
+		default:
+			b.WriteByte('%')
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package filter
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+func (s *FilterSuite) SetUpTest(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("the commands are run by sh")
+	}
+}
+
+func (s *FilterSuite) TestCommand(c *C) {
+	f := NewCommand("tr a-z A-Z", "", "")
+
+	buf := &bytes.Buffer{}
+	err := f.Clean("foo", buf, strings.NewReader("foo\n"))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "FOO\n")
+
+	err = f.Smudge("foo", buf, strings.NewReader("FOO\n"))
+	c.Assert(err, Equals, ErrUnsupported)
+}
+
+func (s *FilterSuite) TestCommandPath(c *C) {
+	f := NewCommand("echo %f 100%%", "", "")
+
+	buf := &bytes.Buffer{}
+	err := f.Clean("foo bar's", buf, strings.NewReader(""))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "foo bar's 100%\n")
+}
+
+func (s *FilterSuite) TestCommandFailure(c *C) {
+	f := NewCommand("", "echo qux >&2; exit 1", "")
+
+	err := f.Smudge("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, ErrorMatches, "filter: exit status 1: qux")
+}
+
+func (s *FilterSuite) TestExpandPath(c *C) {
+	c.Assert(expandPath("cat %f", "foo"), Equals, "cat 'foo'")
+	c.Assert(expandPath("cat %f %%f %d %", "it's"), Equals, `cat 'it'\''s' %f %d %`)
+}
@@ -0,0 +1,303 @@
+package filter
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+)
+
+// Process is a Filter running a single long-running process for all the
+// files, as the filter.<driver>.process config of git, talking to it with the
+// pkt-line based protocol of git. The process is started by the first
+// conversion, and stopped by Close. It's not safe for concurrent use.
+//
+// See https://git-scm.com/docs/gitattributes#_long_running_filter_process
+type Process struct {
+	command string
+	dir     string
+
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	enc *pktline.Encoder
+	out *pktline.Scanner
+
+	started      bool
+	capabilities map[string]bool
+	// err is the error making the process unusable
+	err error
+}
+
+// NewProcess returns a Process running the given shell command in dir.
+func NewProcess(command, dir string) *Process {
+	return &Process{command: command, dir: dir}
+}
+
+// newPipeProcess returns a Process talking to an already running process
+// through the given pipes.
+func newPipeProcess(in io.WriteCloser, out io.Reader) *Process {
+	p := &Process{}
+	p.init(in, out)
+	return p
+}
+
+func (p *Process) init(in io.WriteCloser, out io.Reader) {
+	p.in = in
+	p.enc = pktline.NewEncoder(in)
+	p.out = pktline.NewScanner(out)
+}
+
+// Clean implements the Filter interface.
+func (p *Process) Clean(path string, dst io.Writer, src io.Reader) error {
+	return p.filter("clean", path, dst, src)
+}
+
+// Smudge implements the Filter interface.
+func (p *Process) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return p.filter("smudge", path, dst, src)
+}
+
+// Close stops the process, closing its standard input.
+func (p *Process) Close() error {
+	if p.in == nil {
+		return nil
+	}
+
+	err := p.in.Close()
+	p.in = nil
+	if p.cmd != nil {
+		// as git, the exit status of the process is ignored
+		_ = p.cmd.Wait()
+	}
+
+	return err
+}
+
+func (p *Process) filter(command, path string, dst io.Writer, src io.Reader) error {
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	if !p.capabilities[command] {
+		return ErrUnsupported
+	}
+
+	status, err := p.request(command, path, dst, src)
+	if err != nil {
+		p.err = err
+		if p.cmd != nil && p.cmd.Process != nil {
+			_ = p.cmd.Process.Kill()
+		}
+
+		p.Close()
+		return err
+	}
+
+	switch status {
+	case "success":
+		return nil
+	case "abort":
+		// the conversion isn't requested anymore
+		delete(p.capabilities, command)
+	}
+
+	return fmt.Errorf("%s: %s of %s returned status %q", ErrProcessFailed, command, path, status)
+}
+
+func (p *Process) start() error {
+	if p.started {
+		return p.err
+	}
+
+	p.started = true
+	if p.in == nil {
+		if p.err = p.run(); p.err != nil {
+			return p.err
+		}
+	}
+
+	if p.err = p.handshake(); p.err != nil {
+		if p.cmd != nil {
+			_ = p.cmd.Process.Kill()
+		}
+
+		p.Close()
+	}
+
+	return p.err
+}
+
+func (p *Process) run() error {
+	cmd := exec.Command("sh", "-c", p.command)
+	cmd.Dir = p.dir
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.init(in, out)
+	return nil
+}
+
+// handshake negotiates the version of the protocol and the capabilities of
+// the process.
+func (p *Process) handshake() error {
+	if err := p.writeList("git-filter-client", "version=2"); err != nil {
+		return err
+	}
+
+	lines, err := p.readList()
+	if err != nil {
+		return err
+	}
+
+	if len(lines) < 2 || lines[0] != "git-filter-server" || !contains(lines[1:], "version=2") {
+		return ErrInvalidHandshake
+	}
+
+	if err := p.writeList("capability=clean", "capability=smudge"); err != nil {
+		return err
+	}
+
+	if lines, err = p.readList(); err != nil {
+		return err
+	}
+
+	p.capabilities = make(map[string]bool)
+	for _, l := range lines {
+		if strings.HasPrefix(l, "capability=") {
+			p.capabilities[strings.TrimPrefix(l, "capability=")] = true
+		}
+	}
+
+	return nil
+}
+
+// request sends the file to the process, writing the converted content to
+// dst, and returns the status of the conversion.
+func (p *Process) request(command, path string, dst io.Writer, src io.Reader) (string, error) {
+	if err := p.writeList("command="+command, "pathname="+path); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, pktline.MaxPayloadSize)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if err := p.enc.Encode(buf[:n]); err != nil {
+				return "", err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := p.enc.Flush(); err != nil {
+		return "", err
+	}
+
+	status, err := p.readStatus("")
+	if err != nil || status != "success" {
+		return status, err
+	}
+
+	for {
+		if !p.out.Scan() {
+			return "", p.scanError()
+		}
+
+		content := p.out.Bytes()
+		if len(content) == 0 {
+			break
+		}
+
+		if _, err := dst.Write(content); err != nil {
+			return "", err
+		}
+	}
+
+	// an empty list keeps the previous status
+	return p.readStatus(status)
+}
+
+// readStatus reads a list of the protocol, returning its status or the given
+// one if there is none.
+func (p *Process) readStatus(status string) (string, error) {
+	lines, err := p.readList()
+	if err != nil {
+		return "", err
+	}
+
+	for _, l := range lines {
+		if strings.HasPrefix(l, "status=") {
+			status = strings.TrimPrefix(l, "status=")
+		}
+	}
+
+	return status, nil
+}
+
+// writeList writes the lines of text followed by a flush-pkt.
+func (p *Process) writeList(lines ...string) error {
+	for _, l := range lines {
+		if err := p.enc.EncodeString(l + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return p.enc.Flush()
+}
+
+// readList reads lines of text until a flush-pkt.
+func (p *Process) readList() ([]string, error) {
+	var lines []string
+	for {
+		if !p.out.Scan() {
+			return nil, p.scanError()
+		}
+
+		l := p.out.Bytes()
+		if len(l) == 0 {
+			return lines, nil
+		}
+
+		lines = append(lines, strings.TrimSuffix(string(l), "\n"))
+	}
+}
+
+func (p *Process) scanError() error {
+	if err := p.out.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+func contains(lines []string, s string) bool {
+	for _, l := range lines {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProcessSuite struct{}
+
+var _ = Suite(&ProcessSuite{})
+
+// handler converts a file in a fake filter process, returning the status of
+// the conversion.
+type handler func(command, path string, content []byte) (string, []byte)
+
+// serve runs a fake filter process with the given capabilities, until the
+// standard input is closed.
+func serve(in io.Reader, out io.WriteCloser, capabilities []string, h handler) {
+	defer out.Close()
+
+	s := pktline.NewScanner(in)
+	e := pktline.NewEncoder(out)
+	readList := func() []string {
+		var lines []string
+		for s.Scan() && len(s.Bytes()) != 0 {
+			lines = append(lines, strings.TrimSuffix(string(s.Bytes()), "\n"))
+		}
+
+		return lines
+	}
+
+	if readList() == nil {
+		return
+	}
+
+	e.EncodeString("git-filter-server\n", "version=2\n")
+	e.Flush()
+	readList()
+	for _, c := range capabilities {
+		e.EncodeString("capability=" + c + "\n")
+	}
+	e.Flush()
+
+	for {
+		request := readList()
+		if request == nil {
+			return
+		}
+
+		var content []byte
+		for s.Scan() && len(s.Bytes()) != 0 {
+			content = append(content, s.Bytes()...)
+		}
+
+		status, result := h(
+			strings.TrimPrefix(request[0], "command="),
+			strings.TrimPrefix(request[1], "pathname="),
+			content,
+		)
+
+		e.EncodeString("status=" + status + "\n")
+		e.Flush()
+		if status != "success" {
+			continue
+		}
+
+		for len(result) > 0 {
+			n := len(result)
+			if n > pktline.MaxPayloadSize {
+				n = pktline.MaxPayloadSize
+			}
+
+			e.Encode(result[:n])
+			result = result[n:]
+		}
+		e.Flush()
+		e.Flush()
+	}
+}
+
+func newTestProcess(capabilities []string, h handler) *Process {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go serve(inR, outW, capabilities, h)
+
+	return newPipeProcess(inW, outR)
+}
+
+func (s *ProcessSuite) TestProcess(c *C) {
+	p := newTestProcess([]string{"clean", "smudge"}, func(command, path string, content []byte) (string, []byte) {
+		if command == "clean" {
+			return "success", bytes.ToUpper(content)
+		}
+
+		return "success", append([]byte(path+":"), bytes.ToLower(content)...)
+	})
+
+	defer p.Close()
+
+	buf := &bytes.Buffer{}
+	err := p.Clean("foo", buf, strings.NewReader("foo\n"))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "FOO\n")
+
+	buf.Reset()
+	err = p.Smudge("bar", buf, strings.NewReader("BAR\n"))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "bar:bar\n")
+
+	// the contents bigger than a pkt-line are split
+	large := strings.Repeat("qux", pktline.MaxPayloadSize)
+	buf.Reset()
+	err = p.Clean("qux", buf, strings.NewReader(large))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, strings.ToUpper(large))
+
+	buf.Reset()
+	err = p.Clean("empty", buf, strings.NewReader(""))
+	c.Assert(err, IsNil)
+	c.Assert(buf.Len(), Equals, 0)
+}
+
+func (s *ProcessSuite) TestProcessCapabilities(c *C) {
+	p := newTestProcess([]string{"clean"}, func(command, path string, content []byte) (string, []byte) {
+		return "success", content
+	})
+
+	defer p.Close()
+
+	err := p.Smudge("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, Equals, ErrUnsupported)
+
+	err = p.Clean("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, IsNil)
+}
+
+func (s *ProcessSuite) TestProcessStatus(c *C) {
+	p := newTestProcess([]string{"clean", "smudge"}, func(command, path string, content []byte) (string, []byte) {
+		if command == "clean" {
+			return "error", nil
+		}
+
+		return "abort", nil
+	})
+
+	defer p.Close()
+
+	err := p.Clean("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, ErrorMatches, `filter: process failed: clean of foo returned status "error"`)
+	err = p.Clean("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, NotNil)
+	c.Assert(err, Not(Equals), ErrUnsupported)
+
+	err = p.Smudge("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, ErrorMatches, `filter: process failed: smudge of foo returned status "abort"`)
+	err = p.Smudge("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, Equals, ErrUnsupported)
+}
+
+func (s *ProcessSuite) TestProcessInvalidHandshake(c *C) {
+	p := NewProcess("echo foo", "")
+	defer p.Close()
+
+	err := p.Clean("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err, NotNil)
+
+	// the process isn't started again
+	err2 := p.Clean("foo", &bytes.Buffer{}, strings.NewReader("foo\n"))
+	c.Assert(err2, Equals, err)
+}
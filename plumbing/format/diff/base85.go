@@ -0,0 +1,86 @@
+package diff
+
+import "errors"
+
+// ErrInvalidBase85 is returned when the data of a binary patch is not valid
+// base85.
+var ErrInvalidBase85 = errors.New("invalid base85 data")
+
+// base85Alphabet is the alphabet of the base85 encoding used by git in binary
+// patches, which differs from the ones of RFC 1924 and Ascii85.
+const base85Alphabet = "0123456789" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"abcdefghijklmnopqrstuvwxyz" +
+	"!#$%&()*+-;<=>?@^_`{|}~"
+
+var base85Values [256]int
+
+func init() {
+	for i := range base85Values {
+		base85Values[i] = -1
+	}
+
+	for i := 0; i < len(base85Alphabet); i++ {
+		base85Values[base85Alphabet[i]] = i
+	}
+}
+
+// decodeBase85 decodes src into n bytes. Every 5 characters of src are
+// decoded into 4 bytes, the extra bytes of the last group are discarded.
+func decodeBase85(src []byte, n int) ([]byte, error) {
+	if len(src) != (n+3)/4*5 {
+		return nil, ErrInvalidBase85
+	}
+
+	dst := make([]byte, 0, (n+3)/4*4)
+	for len(src) > 0 {
+		var acc uint64
+		for _, c := range src[:5] {
+			v := base85Values[c]
+			if v < 0 {
+				return nil, ErrInvalidBase85
+			}
+
+			acc = acc*85 + uint64(v)
+		}
+
+		if acc > 0xffffffff {
+			return nil, ErrInvalidBase85
+		}
+
+		dst = append(dst, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+		src = src[5:]
+	}
+
+	return dst[:n], nil
+}
+
+// encodeBase85 encodes src, every 4 bytes of src are encoded into 5
+// characters, the last group is padded with zeros.
+func encodeBase85(src []byte) []byte {
+	dst := make([]byte, 0, (len(src)+3)/4*5)
+	for len(src) > 0 {
+		var acc uint32
+		for i := 0; i < 4; i++ {
+			acc <<= 8
+			if i < len(src) {
+				acc |= uint32(src[i])
+			}
+		}
+
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+
+		dst = append(dst, group[:]...)
+		if len(src) < 4 {
+			break
+		}
+
+		src = src[4:]
+	}
+
+	return dst
+}
@@ -0,0 +1,713 @@
+package diff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+var (
+	hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+	hexRegexp        = regexp.MustCompile(`^[0-9a-f]+$`)
+)
+
+const devNull = "/dev/null"
+
+// MalformedPatchError is returned by Decoder when the patch can't be parsed.
+type MalformedPatchError struct {
+	// Line is the number of the line of the input where the error was found,
+	// starting at 1.
+	Line int
+	// Reason describes the error.
+	Reason string
+}
+
+func (e *MalformedPatchError) Error() string {
+	return fmt.Sprintf("malformed patch at line %d: %s", e.Line, e.Reason)
+}
+
+// UnifiedPatch is a Patch decoded from a unified diff.
+type UnifiedPatch struct {
+	// Header is the text before the first file patch, such as the message of
+	// a commit. It is returned by Message.
+	Header string
+	// Files holds the patches of each file.
+	Files []*UnifiedFilePatch
+}
+
+// FilePatches returns the patches of each file.
+func (p *UnifiedPatch) FilePatches() []FilePatch {
+	fps := make([]FilePatch, len(p.Files))
+	for i, fp := range p.Files {
+		fps[i] = fp
+	}
+
+	return fps
+}
+
+// Message returns the text before the first file patch.
+func (p *UnifiedPatch) Message() string {
+	return p.Header
+}
+
+// UnifiedFilePatch is a FilePatch decoded from a unified diff, including the
+// information of the extended header lines of git.
+type UnifiedFilePatch struct {
+	// From and To are the files before and after the patch. From is nil if
+	// the patch creates the file, and To if the patch deletes it.
+	From, To *UnifiedFile
+	// Rename and Copy tell whether To is a rename or a copy of From.
+	Rename, Copy bool
+	// Similarity is the similarity index of a rename or a copy, and
+	// Dissimilarity the one of a complete rewrite, in percent.
+	Similarity, Dissimilarity int
+	// Binary tells whether the files are binary.
+	Binary bool
+	// BinaryFragment is the data of a "GIT binary patch" section, turning
+	// From into To, and ReverseBinaryFragment the data turning To into From.
+	// Both are nil if the patch only tells that the binary files differ.
+	BinaryFragment, ReverseBinaryFragment *BinaryFragment
+	// Hunks holds the hunks of a text patch.
+	Hunks []*Hunk
+}
+
+// IsBinary returns true if the files are binary.
+func (fp *UnifiedFilePatch) IsBinary() bool {
+	return fp.Binary
+}
+
+// Files returns the files before and after the patch.
+func (fp *UnifiedFilePatch) Files() (from, to File) {
+	if fp.From != nil {
+		from = fp.From
+	}
+
+	if fp.To != nil {
+		to = fp.To
+	}
+
+	return
+}
+
+// Chunks returns the chunks of all the hunks. The lines between the hunks are
+// not part of the patch, so they are missing.
+func (fp *UnifiedFilePatch) Chunks() []Chunk {
+	var chunks []Chunk
+	for _, h := range fp.Hunks {
+		chunks = append(chunks, h.Chunks...)
+	}
+
+	return chunks
+}
+
+// UnifiedFile is a File of a UnifiedFilePatch.
+type UnifiedFile struct {
+	path string
+	mode filemode.FileMode
+	hash string
+}
+
+// Hash returns the hash of the file given by the index line of the patch. It
+// returns the zero hash if the line is missing or the hash abbreviated, see
+// AbbreviatedHash.
+func (f *UnifiedFile) Hash() plumbing.Hash {
+	if len(f.hash) != 2*len(plumbing.ZeroHash) {
+		return plumbing.ZeroHash
+	}
+
+	return plumbing.NewHash(f.hash)
+}
+
+// AbbreviatedHash returns the hash of the file as given by the index line of
+// the patch, usually abbreviated unless the patch was generated with the
+// --full-index option of git.
+func (f *UnifiedFile) AbbreviatedHash() string {
+	return f.hash
+}
+
+// Mode returns the mode of the file, or filemode.Empty if the patch doesn't
+// tell it.
+func (f *UnifiedFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+// Path returns the path of the file, without the a/ or b/ prefixes.
+func (f *UnifiedFile) Path() string {
+	return f.path
+}
+
+// Hunk is a group of changed lines of a file and the unchanged lines around
+// them.
+type Hunk struct {
+	// FromLine and FromCount are the first line and the number of lines of
+	// the hunk in the file before the patch, ToLine and ToCount the ones in
+	// the file after it. The first line is 0 if the count is 0.
+	FromLine, FromCount int
+	ToLine, ToCount     int
+	// Section is the text following the line numbers in the header of the
+	// hunk, usually the line of the function the hunk belongs to.
+	Section string
+	// Chunks holds the lines of the hunk, with the consecutive lines of the
+	// same operation grouped in a single chunk.
+	Chunks []Chunk
+}
+
+type hunkChunk struct {
+	content string
+	op      Operation
+}
+
+func (c *hunkChunk) Content() string {
+	return c.content
+}
+
+func (c *hunkChunk) Type() Operation {
+	return c.op
+}
+
+// BinaryMethod is the way the data of a binary patch is encoded.
+type BinaryMethod int8
+
+const (
+	// BinaryLiteral data is the whole content of the file.
+	BinaryLiteral BinaryMethod = iota
+	// BinaryDelta data is a delta, as the ones of the packfiles, to apply to
+	// the previous content of the file.
+	BinaryDelta
+)
+
+// BinaryFragment is a section of a "GIT binary patch".
+type BinaryFragment struct {
+	// Method tells how Data must be applied.
+	Method BinaryMethod
+	// Data is the content of the file or the delta, once inflated.
+	Data []byte
+}
+
+// Decoder reads and decodes unified diffs, as generated by git or
+// UnifiedEncoder, from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the whole input and returns the patch it contains. The text
+// before the first file patch is returned as the header of the patch, and the
+// lines between the file patches that are not part of them, such as the
+// signature of an email, are ignored. Both the diffs of git, with their
+// extended header lines, and traditional unified diffs are supported.
+func (d *Decoder) Decode() (*UnifiedPatch, error) {
+	b, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	p := &patchParser{lines: lines}
+	return p.parse()
+}
+
+type patchParser struct {
+	lines []string
+	i     int
+}
+
+// filePatchHeader holds the information of the header of a file patch, before
+// building its files.
+type filePatchHeader struct {
+	fromPath, toPath string
+	oldMode, newMode filemode.FileMode
+	oldHash, newHash string
+	created, deleted bool
+}
+
+func (p *patchParser) errorf(format string, args ...interface{}) error {
+	return &MalformedPatchError{Line: p.i + 1, Reason: fmt.Sprintf(format, args...)}
+}
+
+// line returns the line i without its terminator, or an empty string if
+// there isn't such a line.
+func (p *patchParser) line(i int) string {
+	if i >= len(p.lines) {
+		return ""
+	}
+
+	return strings.TrimSuffix(p.lines[i], "\n")
+}
+
+func (p *patchParser) parse() (*UnifiedPatch, error) {
+	patch := &UnifiedPatch{}
+
+	var header strings.Builder
+	for ; p.i < len(p.lines) && !p.atFilePatch(); p.i++ {
+		header.WriteString(p.lines[p.i])
+	}
+
+	patch.Header = header.String()
+	for p.i < len(p.lines) {
+		if !p.atFilePatch() {
+			p.i++
+			continue
+		}
+
+		fp, err := p.parseFilePatch()
+		if err != nil {
+			return nil, err
+		}
+
+		patch.Files = append(patch.Files, fp)
+	}
+
+	return patch, nil
+}
+
+// atFilePatch tells whether a file patch starts at the current line.
+func (p *patchParser) atFilePatch() bool {
+	if strings.HasPrefix(p.line(p.i), "diff --git ") {
+		return true
+	}
+
+	return strings.HasPrefix(p.line(p.i), "--- ") &&
+		strings.HasPrefix(p.line(p.i+1), "+++ ") &&
+		strings.HasPrefix(p.line(p.i+2), "@@ ")
+}
+
+func (p *patchParser) parseFilePatch() (*UnifiedFilePatch, error) {
+	start := p.i
+	fp := &UnifiedFilePatch{}
+	h := &filePatchHeader{}
+
+	if l := p.line(p.i); strings.HasPrefix(l, "diff --git ") {
+		h.fromPath, h.toPath = parseGitHeaderPaths(l[len("diff --git "):])
+		p.i++
+		if err := p.parseExtendedHeader(h, fp); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.HasPrefix(p.line(p.i), "--- ") && strings.HasPrefix(p.line(p.i+1), "+++ ") {
+		if err := p.parseFileNames(h); err != nil {
+			return nil, err
+		}
+
+		for strings.HasPrefix(p.line(p.i), "@@ ") {
+			hunk, err := p.parseHunk()
+			if err != nil {
+				return nil, err
+			}
+
+			fp.Hunks = append(fp.Hunks, hunk)
+		}
+	}
+
+	if (!h.created && h.fromPath == "") || (!h.deleted && h.toPath == "") {
+		p.i = start
+		return nil, p.errorf("file patch lacks filename information")
+	}
+
+	if !h.created {
+		fp.From = &UnifiedFile{path: h.fromPath, mode: h.oldMode, hash: h.oldHash}
+	}
+
+	if !h.deleted {
+		mode := h.newMode
+		if mode == filemode.Empty {
+			mode = h.oldMode
+		}
+
+		if mode == filemode.Empty && h.created {
+			mode = filemode.Regular
+		}
+
+		fp.To = &UnifiedFile{path: h.toPath, mode: mode, hash: h.newHash}
+	}
+
+	return fp, nil
+}
+
+// parseExtendedHeader parses the extended header lines following the
+// "diff --git" line, up to the file names or the binary patch.
+func (p *patchParser) parseExtendedHeader(h *filePatchHeader, fp *UnifiedFilePatch) error {
+	for ; p.i < len(p.lines); p.i++ {
+		var err error
+		l := p.line(p.i)
+		switch {
+		case strings.HasPrefix(l, "old mode "):
+			h.oldMode, err = filemode.New(l[len("old mode "):])
+		case strings.HasPrefix(l, "new mode "):
+			h.newMode, err = filemode.New(l[len("new mode "):])
+		case strings.HasPrefix(l, "deleted file mode "):
+			h.deleted = true
+			h.oldMode, err = filemode.New(l[len("deleted file mode "):])
+		case strings.HasPrefix(l, "new file mode "):
+			h.created = true
+			h.newMode, err = filemode.New(l[len("new file mode "):])
+		case strings.HasPrefix(l, "rename from "):
+			fp.Rename = true
+			h.fromPath, err = parsePath(l[len("rename from "):])
+		case strings.HasPrefix(l, "rename old "):
+			fp.Rename = true
+			h.fromPath, err = parsePath(l[len("rename old "):])
+		case strings.HasPrefix(l, "rename to "):
+			fp.Rename = true
+			h.toPath, err = parsePath(l[len("rename to "):])
+		case strings.HasPrefix(l, "rename new "):
+			fp.Rename = true
+			h.toPath, err = parsePath(l[len("rename new "):])
+		case strings.HasPrefix(l, "copy from "):
+			fp.Copy = true
+			h.fromPath, err = parsePath(l[len("copy from "):])
+		case strings.HasPrefix(l, "copy to "):
+			fp.Copy = true
+			h.toPath, err = parsePath(l[len("copy to "):])
+		case strings.HasPrefix(l, "similarity index "):
+			fp.Similarity, err = parsePercent(l[len("similarity index "):])
+		case strings.HasPrefix(l, "dissimilarity index "):
+			fp.Dissimilarity, err = parsePercent(l[len("dissimilarity index "):])
+		case strings.HasPrefix(l, "index "):
+			err = parseIndexLine(h, l[len("index "):])
+		case l == "GIT binary patch":
+			p.i++
+			return p.parseBinaryPatch(fp)
+		case strings.HasPrefix(l, "Binary files ") && strings.HasSuffix(l, " differ"):
+			fp.Binary = true
+			p.i++
+			return nil
+		default:
+			return nil
+		}
+
+		if err != nil {
+			return p.errorf("invalid extended header line %q: %s", l, err)
+		}
+	}
+
+	return nil
+}
+
+// parseFileNames parses the "---" and "+++" lines.
+func (p *patchParser) parseFileNames(h *filePatchHeader) error {
+	from, err := parsePath(p.line(p.i)[len("--- "):])
+	if err != nil {
+		return p.errorf("invalid file name: %s", err)
+	}
+
+	p.i++
+	to, err := parsePath(p.line(p.i)[len("+++ "):])
+	if err != nil {
+		return p.errorf("invalid file name: %s", err)
+	}
+
+	p.i++
+	if from == devNull {
+		h.created = true
+	} else {
+		h.fromPath = stripPathPrefix(from)
+	}
+
+	if to == devNull {
+		h.deleted = true
+	} else {
+		h.toPath = stripPathPrefix(to)
+	}
+
+	return nil
+}
+
+func (p *patchParser) parseHunk() (*Hunk, error) {
+	m := hunkHeaderRegexp.FindStringSubmatch(p.line(p.i))
+	if m == nil {
+		return nil, p.errorf("invalid hunk header")
+	}
+
+	h := &Hunk{FromCount: 1, ToCount: 1, Section: m[5]}
+	h.FromLine, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		h.FromCount, _ = strconv.Atoi(m[2])
+	}
+
+	h.ToLine, _ = strconv.Atoi(m[3])
+	if m[4] != "" {
+		h.ToCount, _ = strconv.Atoi(m[4])
+	}
+
+	add := func(op Operation, text string) {
+		if n := len(h.Chunks); n > 0 && h.Chunks[n-1].Type() == op {
+			h.Chunks[n-1].(*hunkChunk).content += text
+			return
+		}
+
+		h.Chunks = append(h.Chunks, &hunkChunk{content: text, op: op})
+	}
+
+	p.i++
+	from, to := h.FromCount, h.ToCount
+	for ; from > 0 || to > 0 || strings.HasPrefix(p.line(p.i), "\\"); p.i++ {
+		if p.i >= len(p.lines) {
+			return nil, p.errorf("truncated hunk")
+		}
+
+		l := p.lines[p.i]
+		if !strings.HasSuffix(l, "\n") {
+			l += "\n"
+		}
+
+		switch l[0] {
+		case ' ', '\n':
+			if from == 0 || to == 0 {
+				return nil, p.errorf("corrupt hunk")
+			}
+
+			from--
+			to--
+			if l[0] == '\n' {
+				add(Equal, l)
+			} else {
+				add(Equal, l[1:])
+			}
+		case '-':
+			if from == 0 {
+				return nil, p.errorf("corrupt hunk")
+			}
+
+			from--
+			add(Delete, l[1:])
+		case '+':
+			if to == 0 {
+				return nil, p.errorf("corrupt hunk")
+			}
+
+			to--
+			add(Add, l[1:])
+		case '\\':
+			// "\ No newline at end of file" applies to the previous line
+			if len(h.Chunks) == 0 {
+				return nil, p.errorf("corrupt hunk")
+			}
+
+			c := h.Chunks[len(h.Chunks)-1].(*hunkChunk)
+			c.content = strings.TrimSuffix(c.content, "\n")
+		default:
+			return nil, p.errorf("corrupt hunk")
+		}
+	}
+
+	return h, nil
+}
+
+// parseBinaryPatch parses the fragments following the "GIT binary patch"
+// line.
+func (p *patchParser) parseBinaryPatch(fp *UnifiedFilePatch) error {
+	fp.Binary = true
+
+	var err error
+	fp.BinaryFragment, err = p.parseBinaryFragment()
+	if err != nil {
+		return err
+	}
+
+	if fp.BinaryFragment == nil {
+		return p.errorf("missing binary patch data")
+	}
+
+	fp.ReverseBinaryFragment, err = p.parseBinaryFragment()
+	return err
+}
+
+// parseBinaryFragment parses a literal or delta fragment of a binary patch,
+// it returns nil if there isn't any.
+func (p *patchParser) parseBinaryFragment() (*BinaryFragment, error) {
+	f := &BinaryFragment{}
+	l := p.line(p.i)
+	switch {
+	case strings.HasPrefix(l, "literal "):
+		f.Method = BinaryLiteral
+		l = l[len("literal "):]
+	case strings.HasPrefix(l, "delta "):
+		f.Method = BinaryDelta
+		l = l[len("delta "):]
+	default:
+		return nil, nil
+	}
+
+	size, err := strconv.ParseInt(l, 10, 64)
+	if err != nil {
+		return nil, p.errorf("invalid binary patch size: %s", err)
+	}
+
+	var data []byte
+	for p.i++; p.i < len(p.lines) && p.line(p.i) != ""; p.i++ {
+		l := p.line(p.i)
+
+		var n int
+		switch c := l[0]; {
+		case c >= 'A' && c <= 'Z':
+			n = int(c-'A') + 1
+		case c >= 'a' && c <= 'z':
+			n = int(c-'a') + 27
+		default:
+			return nil, p.errorf("corrupt binary patch")
+		}
+
+		decoded, err := decodeBase85([]byte(l[1:]), n)
+		if err != nil {
+			return nil, p.errorf("corrupt binary patch: %s", err)
+		}
+
+		data = append(data, decoded...)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, p.errorf("corrupt binary patch: %s", err)
+	}
+
+	f.Data, err = ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, p.errorf("corrupt binary patch: %s", err)
+	}
+
+	if int64(len(f.Data)) != size {
+		return nil, p.errorf("corrupt binary patch: expected %d bytes, got %d", size, len(f.Data))
+	}
+
+	// skip the empty line ending the fragment
+	p.i++
+	return f, nil
+}
+
+// parseGitHeaderPaths returns the paths of the "diff --git" line. If they
+// can't be told apart, because they contain spaces and differ, it returns
+// empty paths, they are given by the rename or copy lines in that case.
+func parseGitHeaderPaths(s string) (from, to string) {
+	var err error
+	switch {
+	case strings.HasPrefix(s, "\""):
+		end := quotedPathEnd(s)
+		if end < 0 {
+			return "", ""
+		}
+
+		if from, err = strconv.Unquote(s[:end+1]); err != nil {
+			return "", ""
+		}
+
+		if to, err = parsePath(strings.TrimLeft(s[end+1:], " ")); err != nil {
+			return "", ""
+		}
+	case strings.Contains(s, " \""):
+		i := strings.Index(s, " \"")
+		from = s[:i]
+		if to, err = parsePath(s[i+1:]); err != nil {
+			return "", ""
+		}
+	default:
+		// the paths are the same, unless the file is renamed or copied
+		half := len(s) / 2
+		if len(s)%2 == 0 || s[half] != ' ' || stripPathPrefix(s[:half]) != stripPathPrefix(s[half+1:]) {
+			return "", ""
+		}
+
+		from, to = s[:half], s[half+1:]
+	}
+
+	return stripPathPrefix(from), stripPathPrefix(to)
+}
+
+// parsePath parses a path of a patch, which is quoted as a C string when it
+// contains special characters. The timestamp following the paths of the
+// traditional diffs is removed.
+func parsePath(s string) (string, error) {
+	if strings.HasPrefix(s, "\"") {
+		end := quotedPathEnd(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted path %s", s)
+		}
+
+		return strconv.Unquote(s[:end+1])
+	}
+
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+
+	return s, nil
+}
+
+// quotedPathEnd returns the position of the quote ending the quoted path at
+// the start of s, or -1 if it isn't terminated.
+func quotedPathEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// stripPathPrefix removes the first component of the path, the a/ or b/
+// prefixes of git.
+func stripPathPrefix(path string) string {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[i+1:]
+	}
+
+	return path
+}
+
+func parsePercent(s string) (int, error) {
+	return strconv.Atoi(strings.TrimSuffix(s, "%"))
+}
+
+// parseIndexLine parses the hashes and the optional mode of an index line.
+func parseIndexLine(h *filePatchHeader, s string) error {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return fmt.Errorf("missing hashes")
+	}
+
+	hashes := strings.Split(fields[0], "..")
+	if len(hashes) != 2 || !hexRegexp.MatchString(hashes[0]) || !hexRegexp.MatchString(hashes[1]) {
+		return fmt.Errorf("invalid hashes %s", fields[0])
+	}
+
+	h.oldHash, h.newHash = hashes[0], hashes[1]
+	if len(fields) == 1 {
+		return nil
+	}
+
+	mode, err := filemode.New(fields[1])
+	if err != nil {
+		return err
+	}
+
+	if h.oldMode == filemode.Empty {
+		h.oldMode = mode
+	}
+
+	if h.newMode == filemode.Empty {
+		h.newMode = mode
+	}
+
+	return nil
+}
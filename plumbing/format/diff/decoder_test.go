@@ -0,0 +1,278 @@
+package diff
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+
+	. "gopkg.in/check.v1"
+)
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+// gitPatch was generated with git diff --binary -M -C --find-copies-harder.
+var gitPatch = `diff --git a/bin.dat b/bin.dat
+index 0f49c4ae77b43dff338093c78e009676e7e308ba..0d4028e90c42e17b17cb45ec56f977847a05caba 100644
+GIT binary patch
+literal 10
+RcmZQzWKPP=ODw8X1ON+S0;>Q3
+
+literal 9
+QcmZQzWJ=1+ODw7c00^)Gi2wiq
+
+diff --git a/src.txt b/copy.txt
+similarity index 90%
+copy from src.txt
+copy to copy.txt
+index 92dfa21..27df8b9 100644
+--- a/src.txt
++++ b/copy.txt
+@@ -8,3 +8,4 @@ g
+ h
+ i
+ j
++k
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 4202011..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-to be deleted
+diff --git a/main.go b/main.go
+index 4a73987..73d83e6 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ package main
+ 
+ func main() {
+-	println("hello")
++	println("hello, world")
+ }
+diff --git a/old.txt b/new.txt
+similarity index 85%
+rename from old.txt
+rename to new.txt
+index b00a0f1..ac8d4ad 100644
+--- a/old.txt
++++ b/new.txt
+@@ -5,4 +5,4 @@ four
+ five
+ six
+ seven
+-eight
++EIGHT
+diff --git a/nonl.txt b/nonl.txt
+index 20cbb4d..69ddea9 100644
+--- a/nonl.txt
++++ b/nonl.txt
+@@ -1 +1 @@
+-no newline
+\ No newline at end of file
++with newline
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git "a/sp ace \303\251.txt" "b/sp ace \303\251.txt"
+new file mode 100644
+index 0000000..587be6b
+--- /dev/null
++++ "b/sp ace \303\251.txt"	
+@@ -0,0 +1 @@
++x
+`
+
+func (s *DecoderSuite) TestDecode(c *C) {
+	p, err := NewDecoder(strings.NewReader(gitPatch)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(p.Message(), Equals, "")
+	c.Assert(p.Files, HasLen, 8)
+	c.Assert(p.FilePatches(), HasLen, 8)
+
+	bin := p.Files[0]
+	c.Assert(bin.IsBinary(), Equals, true)
+	c.Assert(bin.From.Hash(), Equals, plumbing.NewHash("0f49c4ae77b43dff338093c78e009676e7e308ba"))
+	c.Assert(bin.To.Hash(), Equals, plumbing.NewHash("0d4028e90c42e17b17cb45ec56f977847a05caba"))
+	c.Assert(bin.BinaryFragment, DeepEquals, &BinaryFragment{Method: BinaryLiteral, Data: []byte("\x00\x01\x03binary!")})
+	c.Assert(bin.ReverseBinaryFragment, DeepEquals, &BinaryFragment{Method: BinaryLiteral, Data: []byte("\x00\x01\x02binary")})
+	c.Assert(bin.Chunks(), HasLen, 0)
+
+	cp := p.Files[1]
+	c.Assert(cp.Copy, Equals, true)
+	c.Assert(cp.Rename, Equals, false)
+	c.Assert(cp.Similarity, Equals, 90)
+	c.Assert(cp.From.Path(), Equals, "src.txt")
+	c.Assert(cp.To.Path(), Equals, "copy.txt")
+	c.Assert(cp.From.Hash(), Equals, plumbing.ZeroHash)
+	c.Assert(cp.From.AbbreviatedHash(), Equals, "92dfa21")
+	c.Assert(cp.To.Mode(), Equals, filemode.Regular)
+	c.Assert(cp.Hunks, HasLen, 1)
+	c.Assert(*cp.Hunks[0], DeepEquals, Hunk{
+		FromLine: 8, FromCount: 3, ToLine: 8, ToCount: 4, Section: "g",
+		Chunks: []Chunk{
+			&hunkChunk{"h\ni\nj\n", Equal},
+			&hunkChunk{"k\n", Add},
+		},
+	})
+
+	gone := p.Files[2]
+	from, to := gone.Files()
+	c.Assert(to, IsNil)
+	c.Assert(from.Path(), Equals, "gone.txt")
+	c.Assert(from.Mode(), Equals, filemode.Regular)
+	c.Assert(gone.Chunks(), DeepEquals, []Chunk{&hunkChunk{"to be deleted\n", Delete}})
+
+	main := p.Files[3]
+	c.Assert(main.From.Path(), Equals, "main.go")
+	c.Assert(main.To.Path(), Equals, "main.go")
+	c.Assert(main.Chunks(), DeepEquals, []Chunk{
+		&hunkChunk{"package main\n\nfunc main() {\n", Equal},
+		&hunkChunk{"\tprintln(\"hello\")\n", Delete},
+		&hunkChunk{"\tprintln(\"hello, world\")\n", Add},
+		&hunkChunk{"}\n", Equal},
+	})
+
+	rename := p.Files[4]
+	c.Assert(rename.Rename, Equals, true)
+	c.Assert(rename.Similarity, Equals, 85)
+	c.Assert(rename.From.Path(), Equals, "old.txt")
+	c.Assert(rename.To.Path(), Equals, "new.txt")
+	c.Assert(rename.Hunks[0].Section, Equals, "four")
+
+	nonl := p.Files[5]
+	c.Assert(nonl.Chunks(), DeepEquals, []Chunk{
+		&hunkChunk{"no newline", Delete},
+		&hunkChunk{"with newline\n", Add},
+	})
+
+	mode := p.Files[6]
+	c.Assert(mode.From.Mode(), Equals, filemode.Regular)
+	c.Assert(mode.To.Mode(), Equals, filemode.Executable)
+	c.Assert(mode.Hunks, HasLen, 0)
+
+	added := p.Files[7]
+	from, to = added.Files()
+	c.Assert(from, IsNil)
+	c.Assert(to.Path(), Equals, "sp ace \u00e9.txt")
+	c.Assert(to.Mode(), Equals, filemode.Regular)
+	c.Assert(added.Hunks[0].FromLine, Equals, 0)
+	c.Assert(added.Hunks[0].FromCount, Equals, 0)
+}
+
+func (s *DecoderSuite) TestDecodeMail(c *C) {
+	mail := `From 1a2b3c4d Mon Sep 17 00:00:00 2001
+From: Foo <foo@example.com>
+Subject: [PATCH] Change a
+
+---
+ a | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a b/a
+index 7898192..6178079 100644
+--- a/a
++++ b/a
+@@ -1 +1 @@
+-a
++b
+-- 
+2.30.0
+`
+
+	p, err := NewDecoder(strings.NewReader(mail)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(p.Message(), Equals, mail[:strings.Index(mail, "diff --git")])
+	c.Assert(p.Files, HasLen, 1)
+	c.Assert(p.Files[0].Chunks(), DeepEquals, []Chunk{
+		&hunkChunk{"a\n", Delete},
+		&hunkChunk{"b\n", Add},
+	})
+}
+
+func (s *DecoderSuite) TestDecodeTraditional(c *C) {
+	patch := "--- a/dir/file.txt\t2021-01-01 00:00:00.000000000 +0000\n" +
+		"+++ b/dir/file.txt\t2021-01-02 00:00:00.000000000 +0000\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" a\n" +
+		"-b\n" +
+		"+c\n" +
+		"--- /dev/null\n" +
+		"+++ b/new.txt\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+new\n"
+
+	p, err := NewDecoder(strings.NewReader(patch)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(p.Files, HasLen, 2)
+	c.Assert(p.Files[0].From.Path(), Equals, "dir/file.txt")
+	c.Assert(p.Files[0].To.Path(), Equals, "dir/file.txt")
+	c.Assert(p.Files[0].To.Mode(), Equals, filemode.Empty)
+	c.Assert(p.Files[1].From, IsNil)
+	c.Assert(p.Files[1].To.Path(), Equals, "new.txt")
+	c.Assert(p.Files[1].To.Mode(), Equals, filemode.Regular)
+}
+
+func (s *DecoderSuite) TestDecodeEncoded(c *C) {
+	for _, f := range fixtures {
+		if f.color != nil {
+			continue
+		}
+
+		p, err := NewDecoder(strings.NewReader(f.diff)).Decode()
+		c.Assert(err, IsNil, Commentf(f.desc))
+
+		expected := f.patch.FilePatches()
+		c.Assert(p.Files, HasLen, len(expected), Commentf(f.desc))
+		for i, fp := range p.Files {
+			efrom, eto := expected[i].Files()
+			from, to := fp.Files()
+			c.Assert(from == nil, Equals, efrom == nil, Commentf(f.desc))
+			c.Assert(to == nil, Equals, eto == nil, Commentf(f.desc))
+			if to != nil {
+				c.Assert(to.Path(), Equals, eto.Path(), Commentf(f.desc))
+				if to.Mode() != filemode.Empty {
+					c.Assert(to.Mode(), Equals, eto.Mode(), Commentf(f.desc))
+				}
+			}
+
+			if !fp.IsBinary() {
+				c.Assert(changedLines(fp.Chunks()), DeepEquals, changedLines(expected[i].Chunks()), Commentf(f.desc))
+			}
+		}
+	}
+}
+
+// changedLines returns the content of the added and deleted chunks.
+func changedLines(chunks []Chunk) map[Operation]string {
+	lines := map[Operation]string{Add: "", Delete: ""}
+	for _, ch := range chunks {
+		if ch.Type() != Equal {
+			lines[ch.Type()] += ch.Content()
+		}
+	}
+
+	return lines
+}
+
+func (s *DecoderSuite) TestDecodeErrors(c *C) {
+	for _, t := range []struct {
+		patch string
+		line  int
+	}{
+		{"diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1,2 +1 @@\n-a\n", 6},
+		{"diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-a\n*b\n", 6},
+		{"diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -x +1 @@\n", 4},
+		{"diff --git a/a b/a\nold mode 10x644\n", 2},
+		{"diff --git a/a b/a\nGIT binary patch\nliteral 3\nA~~~~~\n\n", 4},
+		{"diff --git a/a b/a\nGIT binary patch\nliteral 3\nLc$`a2N=^X)1K0tJ\n\n", 5},
+		{"diff --git a/a b/b c\nindex 7898192..6178079 100644\n", 1},
+	} {
+		_, err := NewDecoder(strings.NewReader(t.patch)).Decode()
+		c.Assert(err, FitsTypeOf, &MalformedPatchError{}, Commentf("%q", t.patch))
+		c.Assert(err.(*MalformedPatchError).Line, Equals, t.line, Commentf("%q: %s", t.patch, err))
+	}
+}
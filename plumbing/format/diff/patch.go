@@ -39,6 +39,15 @@ type FilePatch interface {
 	Chunks() []Chunk
 }
 
+// BinaryFilePatch is a FilePatch of a binary file that gives the contents of
+// the files, so the UnifiedEncoder can encode it as a "GIT binary patch".
+type BinaryFilePatch interface {
+	FilePatch
+	// BinaryContents returns the contents of the from and to Files, nil if
+	// the patch creates or deletes the file.
+	BinaryContents() (from, to []byte, err error)
+}
+
 // File contains all the file metadata necessary to print some patch formats.
 type File interface {
 	// Hash returns the File Hash.
@@ -56,3 +65,13 @@ type Chunk interface {
 	// Type contains the Operation to do with this Chunk.
 	Type() Operation
 }
+
+// IgnorableChunk is a Chunk whose changes can be left out of the patch, as
+// the changes of blank lines ignored by git diff --ignore-blank-lines. The
+// UnifiedEncoder only encodes the ignorable changes found in the hunks of
+// other changes.
+type IgnorableChunk interface {
+	Chunk
+	// Ignorable returns true if the changes of the Chunk can be left out.
+	Ignorable() bool
+}
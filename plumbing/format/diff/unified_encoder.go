@@ -1,6 +1,8 @@
 package diff
 
 import (
+	"bytes"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"regexp"
@@ -8,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 )
 
 // DefaultContextLines is the default number of context lines.
@@ -40,6 +43,16 @@ type UnifiedEncoder struct {
 
 	// colorConfig is the color configuration. The default is no color.
 	color ColorConfig
+
+	// binary tells whether the changes of binary files are encoded as "GIT
+	// binary patch" sections.
+	binary bool
+
+	// wordDiff is the mode of the word diffs, NoWordDiff by default.
+	wordDiff WordDiffMode
+
+	// wordRegexp matches the words compared by the word diffs.
+	wordRegexp *regexp.Regexp
 }
 
 // NewUnifiedEncoder returns a new UnifiedEncoder that writes to w.
@@ -56,6 +69,37 @@ func (e *UnifiedEncoder) SetColor(colorConfig ColorConfig) *UnifiedEncoder {
 	return e
 }
 
+// SetBinary sets whether the changes of binary files are encoded as "GIT
+// binary patch" sections, as git diff --binary does, and returns e. Binary
+// patches can only be encoded for the FilePatches that implement
+// BinaryFilePatch or hold the BinaryFragment of a decoded patch.
+func (e *UnifiedEncoder) SetBinary(binary bool) *UnifiedEncoder {
+	e.binary = binary
+	return e
+}
+
+// SetWordDiff sets the mode of the word diffs encoded instead of the changed
+// lines, as git diff --word-diff does, and returns e. The hunks are the same,
+// but the changed words of each group of changed lines are shown within the
+// new lines. WordDiffColor sets the default color configuration if e has none.
+func (e *UnifiedEncoder) SetWordDiff(mode WordDiffMode) *UnifiedEncoder {
+	e.wordDiff = mode
+	if mode == WordDiffColor && len(e.color) == 0 {
+		e.color = NewColorConfig()
+	}
+
+	return e
+}
+
+// SetWordRegexp sets the regexp matching the words compared by the word diffs,
+// as the diff.wordRegex option of git, and returns e. Each line is matched on
+// its own, and the text not matched is not compared. The words are matched by
+// DefaultWordRegexp if wordRegexp is nil.
+func (e *UnifiedEncoder) SetWordRegexp(wordRegexp *regexp.Regexp) *UnifiedEncoder {
+	e.wordRegexp = wordRegexp
+	return e
+}
+
 // Encode encodes patch.
 func (e *UnifiedEncoder) Encode(patch Patch) error {
 	sb := &strings.Builder{}
@@ -68,9 +112,24 @@ func (e *UnifiedEncoder) Encode(patch Patch) error {
 	}
 
 	for _, filePatch := range patch.FilePatches() {
-		e.writeFilePatchHeader(sb, filePatch)
+		binary, err := e.binaryPatch(filePatch)
+		if err != nil {
+			return err
+		}
+
+		e.writeFilePatchHeader(sb, filePatch, binary != nil)
+		if binary != nil {
+			sb.Write(binary)
+			continue
+		}
+
 		g := newHunksGenerator(filePatch.Chunks(), e.contextLines)
 		for _, hunk := range g.Generate() {
+			if e.wordDiff != NoWordDiff {
+				e.writeWordDiff(sb, hunk)
+				continue
+			}
+
 			hunk.writeTo(sb, e.color)
 		}
 	}
@@ -79,7 +138,7 @@ func (e *UnifiedEncoder) Encode(patch Patch) error {
 	return err
 }
 
-func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch FilePatch) {
+func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch FilePatch, binaryPatch bool) {
 	from, to := filePatch.Files()
 	if from == nil && to == nil {
 		return
@@ -115,7 +174,7 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 			)
 		}
 		if !hashEquals {
-			lines = e.appendPathLines(lines, "a/"+from.Path(), "b/"+to.Path(), isBinary)
+			lines = e.appendPathLines(lines, "a/"+from.Path(), "b/"+to.Path(), isBinary, binaryPatch)
 		}
 	case from == nil:
 		lines = append(lines,
@@ -123,14 +182,14 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 			fmt.Sprintf("new file mode %o", to.Mode()),
 			fmt.Sprintf("index %s..%s", plumbing.ZeroHash, to.Hash()),
 		)
-		lines = e.appendPathLines(lines, "/dev/null", "b/"+to.Path(), isBinary)
+		lines = e.appendPathLines(lines, "/dev/null", "b/"+to.Path(), isBinary, binaryPatch)
 	case to == nil:
 		lines = append(lines,
 			fmt.Sprintf("diff --git a/%s b/%s", from.Path(), from.Path()),
 			fmt.Sprintf("deleted file mode %o", from.Mode()),
 			fmt.Sprintf("index %s..%s", from.Hash(), plumbing.ZeroHash),
 		)
-		lines = e.appendPathLines(lines, "a/"+from.Path(), "/dev/null", isBinary)
+		lines = e.appendPathLines(lines, "a/"+from.Path(), "/dev/null", isBinary, binaryPatch)
 	}
 
 	sb.WriteString(e.color[Meta])
@@ -143,7 +202,10 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 	sb.WriteByte('\n')
 }
 
-func (e *UnifiedEncoder) appendPathLines(lines []string, fromPath, toPath string, isBinary bool) []string {
+func (e *UnifiedEncoder) appendPathLines(lines []string, fromPath, toPath string, isBinary, binaryPatch bool) []string {
+	if binaryPatch {
+		return append(lines, "GIT binary patch")
+	}
 	if isBinary {
 		return append(lines,
 			fmt.Sprintf("Binary files %s and %s differ", fromPath, toPath),
@@ -155,10 +217,130 @@ func (e *UnifiedEncoder) appendPathLines(lines []string, fromPath, toPath string
 	)
 }
 
+// binaryPatch returns the "GIT binary patch" section of the filePatch, or nil
+// if its changes are not encoded as a binary patch.
+func (e *UnifiedEncoder) binaryPatch(filePatch FilePatch) ([]byte, error) {
+	if !e.binary || !filePatch.IsBinary() {
+		return nil, nil
+	}
+
+	from, to := filePatch.Files()
+	if from == nil && to == nil || from != nil && to != nil && from.Hash() == to.Hash() {
+		return nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	switch fp := filePatch.(type) {
+	case *UnifiedFilePatch:
+		if fp.BinaryFragment == nil {
+			return nil, nil
+		}
+
+		for _, f := range []*BinaryFragment{fp.BinaryFragment, fp.ReverseBinaryFragment} {
+			if f == nil {
+				continue
+			}
+
+			data, err := deflate(f.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			method := "literal"
+			if f.Method == BinaryDelta {
+				method = "delta"
+			}
+
+			writeBinaryFragment(buf, method, len(f.Data), data)
+		}
+	case BinaryFilePatch:
+		fromContent, toContent, err := fp.BinaryContents()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := encodeBinaryFragment(buf, fromContent, toContent); err != nil {
+			return nil, err
+		}
+
+		if err := encodeBinaryFragment(buf, toContent, fromContent); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeBinaryFragment writes the fragment turning src into dst, as a delta
+// if it is smaller than the literal contents once deflated, as git does.
+func encodeBinaryFragment(buf *bytes.Buffer, src, dst []byte) error {
+	literal, err := deflate(dst)
+	if err != nil {
+		return err
+	}
+
+	if len(src) != 0 && len(dst) != 0 {
+		delta := packfile.DiffDelta(src, dst)
+		data, err := deflate(delta)
+		if err != nil {
+			return err
+		}
+
+		if len(data) < len(literal) {
+			writeBinaryFragment(buf, "delta", len(delta), data)
+			return nil
+		}
+	}
+
+	writeBinaryFragment(buf, "literal", len(dst), literal)
+	return nil
+}
+
+// writeBinaryFragment writes the deflated data of a fragment in lines of up to
+// 52 bytes encoded in base85, each one prefixed by its length.
+func writeBinaryFragment(buf *bytes.Buffer, method string, size int, data []byte) {
+	fmt.Fprintf(buf, "%s %d\n", method, size)
+	for len(data) > 0 {
+		n := len(data)
+		if n > 52 {
+			n = 52
+		}
+
+		if n <= 26 {
+			buf.WriteByte(byte('A' + n - 1))
+		} else {
+			buf.WriteByte(byte('a' + n - 27))
+		}
+
+		buf.Write(encodeBase85(data[:n]))
+		buf.WriteByte('\n')
+		data = data[n:]
+	}
+
+	buf.WriteByte('\n')
+}
+
+func deflate(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 type hunksGenerator struct {
 	fromLine, toLine            int
 	ctxLines                    int
 	chunks                      []Chunk
+	ignored                     []bool
 	current                     *hunk
 	hunks                       []*hunk
 	beforeContext, afterContext []string
@@ -168,6 +350,7 @@ func newHunksGenerator(chunks []Chunk, ctxLines int) *hunksGenerator {
 	return &hunksGenerator{
 		chunks:   chunks,
 		ctxLines: ctxLines,
+		ignored:  IgnoredChunks(chunks, ctxLines),
 	}
 }
 
@@ -176,6 +359,18 @@ func (g *hunksGenerator) Generate() []*hunk {
 		lines := splitLines(chunk.Content())
 		nLines := len(lines)
 
+		if g.isIgnored(i) {
+			// the previous chunk closed the current hunk
+			switch chunk.Type() {
+			case Delete:
+				g.fromLine += nLines
+			case Add:
+				g.toLine += nLines
+			}
+
+			continue
+		}
+
 		switch chunk.Type() {
 		case Equal:
 			g.fromLine += nLines
@@ -265,7 +460,7 @@ func (g *hunksGenerator) processEqualsLines(ls []string, i int) {
 	}
 
 	g.afterContext = append(g.afterContext, ls...)
-	if len(g.afterContext) <= g.ctxLines*2 && i != len(g.chunks)-1 {
+	if len(g.afterContext) <= g.ctxLines*2 && i != len(g.chunks)-1 && !g.isIgnored(i+1) {
 		g.current.AddOp(Equal, g.afterContext...)
 		g.afterContext = nil
 	} else {
@@ -282,6 +477,128 @@ func (g *hunksGenerator) processEqualsLines(ls []string, i int) {
 	}
 }
 
+func (g *hunksGenerator) isIgnored(i int) bool {
+	return g.ignored != nil && g.ignored[i]
+}
+
+// IgnoredChunks returns which chunks are left out of a patch encoded with the
+// given number of context lines, nil if none of them is an IgnorableChunk.
+// The ignorable changes are left out unless they are close enough to other
+// changes to be in their hunks, as git diff --ignore-blank-lines does.
+func IgnoredChunks(chunks []Chunk, contextLines int) []bool {
+	changes := changesOf(chunks)
+	ignorable := false
+	for _, c := range changes {
+		ignorable = ignorable || c.ignorable
+	}
+
+	if !ignorable {
+		return nil
+	}
+
+	ignored := make([]bool, len(chunks))
+	ignore := func(from, to int) {
+		for _, c := range changes[from:to] {
+			for i := c.firstChunk; i < c.lastChunk; i++ {
+				ignored[i] = true
+			}
+		}
+	}
+
+	// the hunks are grouped as in xdl_get_hunk of git
+	maxCommon, maxIgnorable := 2*contextLines, contextLines
+	for start := 0; start < len(changes); {
+		first := start
+		for i := start; i < len(changes) && changes[i].ignorable; i++ {
+			if i == len(changes)-1 || changes[i+1].from-changes[i].fromEnd() >= maxIgnorable {
+				first = i + 1
+			}
+		}
+
+		ignore(start, first)
+		if first == len(changes) {
+			break
+		}
+
+		last, ignoredLines := first, 0
+	hunk:
+		for i := first + 1; i < len(changes); i++ {
+			prev, c := changes[i-1], changes[i]
+			distance := c.from - prev.fromEnd()
+			if distance > maxCommon {
+				break hunk
+			}
+
+			switch {
+			case distance < maxIgnorable && (!c.ignorable || last == i-1):
+				last, ignoredLines = i, 0
+			case distance < maxIgnorable && c.ignorable:
+				ignoredLines += c.toCount
+			case last != i-1 && c.from+ignoredLines-changes[last].fromEnd() > maxCommon:
+				break hunk
+			case !c.ignorable:
+				last, ignoredLines = i, 0
+			default:
+				ignoredLines += c.toCount
+			}
+		}
+
+		start = last + 1
+	}
+
+	return ignored
+}
+
+// change is a group of consecutive chunks adding or deleting lines.
+type change struct {
+	// firstChunk and lastChunk are the range of chunks of the change
+	firstChunk, lastChunk int
+	// from is the index of the first line deleted, or of the line after
+	// the lines added if none is
+	from      int
+	fromCount int
+	toCount   int
+	ignorable bool
+}
+
+func (c *change) fromEnd() int {
+	return c.from + c.fromCount
+}
+
+// changesOf returns the changes made by the chunks, a change is ignorable if
+// all its chunks are.
+func changesOf(chunks []Chunk) []*change {
+	var changes []*change
+	var current *change
+	line := 0
+	for i, chunk := range chunks {
+		n := len(splitLines(chunk.Content()))
+		if chunk.Type() == Equal {
+			line += n
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			current = &change{firstChunk: i, from: line, ignorable: true}
+			changes = append(changes, current)
+		}
+
+		current.lastChunk = i + 1
+		c, ok := chunk.(IgnorableChunk)
+		current.ignorable = current.ignorable && ok && c.Ignorable()
+		switch chunk.Type() {
+		case Delete:
+			current.fromCount += n
+			line += n
+		case Add:
+			current.toCount += n
+		}
+	}
+
+	return changes
+}
+
 func splitLines(s string) []string {
 	out := splitLinesRegexp.FindAllString(s, -1)
 	if out[len(out)-1] == "" {
@@ -302,6 +619,13 @@ type hunk struct {
 }
 
 func (h *hunk) writeTo(sb *strings.Builder, color ColorConfig) {
+	h.writeHeader(sb, color)
+	for _, op := range h.ops {
+		op.writeTo(sb, color)
+	}
+}
+
+func (h *hunk) writeHeader(sb *strings.Builder, color ColorConfig) {
 	sb.WriteString(color[Frag])
 	sb.WriteString("@@ -")
 
@@ -334,10 +658,6 @@ func (h *hunk) writeTo(sb *strings.Builder, color ColorConfig) {
 	}
 
 	sb.WriteByte('\n')
-
-	for _, op := range h.ops {
-		op.writeTo(sb, color)
-	}
 }
 
 func (h *hunk) AddOp(t Operation, ss ...string) {
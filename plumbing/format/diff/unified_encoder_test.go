@@ -2,11 +2,13 @@ package diff
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/color"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 
 	. "gopkg.in/check.v1"
 )
@@ -52,6 +54,118 @@ Binary files a/binary and b/binary differ
 `)
 }
 
+func (s *UnifiedEncoderTestSuite) TestBinaryPatchLiteral(c *C) {
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoder(buffer, 1).SetBinary(true)
+	err := e.Encode(testFilePatches{newTestBinaryFilePatch("foo\x00", "bar\x00")})
+	c.Assert(err, IsNil)
+
+	c.Assert(strings.HasPrefix(buffer.String(), `diff --git a/binary b/binary
+index 5e154ebab7789d4cd418eeaccf08260e6583b8ff..0d89c7df4e373a8791962daec0b3f2b4fd421542 100644
+GIT binary patch
+literal 4
+`), Equals, true)
+
+	fp := decodeBinaryFilePatch(c, buffer.String())
+	c.Assert(fp.BinaryFragment.Method, Equals, BinaryLiteral)
+	c.Assert(string(fp.BinaryFragment.Data), Equals, "bar\x00")
+	c.Assert(fp.ReverseBinaryFragment.Method, Equals, BinaryLiteral)
+	c.Assert(string(fp.ReverseBinaryFragment.Data), Equals, "foo\x00")
+}
+
+func (s *UnifiedEncoderTestSuite) TestBinaryPatchDelta(c *C) {
+	from := strings.Repeat("binary\x00content\n", 100)
+	to := from[:800] + "changed" + from[800:]
+
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoder(buffer, 1).SetBinary(true)
+	err := e.Encode(testFilePatches{newTestBinaryFilePatch(from, to)})
+	c.Assert(err, IsNil)
+
+	fp := decodeBinaryFilePatch(c, buffer.String())
+	c.Assert(fp.BinaryFragment.Method, Equals, BinaryDelta)
+	content, err := packfile.PatchDelta([]byte(from), fp.BinaryFragment.Data)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, to)
+
+	c.Assert(fp.ReverseBinaryFragment.Method, Equals, BinaryDelta)
+	content, err = packfile.PatchDelta([]byte(to), fp.ReverseBinaryFragment.Data)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, from)
+}
+
+func (s *UnifiedEncoderTestSuite) TestBinaryPatchNewFile(c *C) {
+	fp := newTestBinaryFilePatch("", "\x00\x01\x02")
+	fp.from = nil
+
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoder(buffer, 1).SetBinary(true)
+	err := e.Encode(testFilePatches{fp})
+	c.Assert(err, IsNil)
+
+	c.Assert(strings.Contains(buffer.String(), "\nGIT binary patch\nliteral 3\n"), Equals, true)
+	c.Assert(strings.Contains(buffer.String(), "\nliteral 0\n"), Equals, true)
+
+	decoded := decodeBinaryFilePatch(c, buffer.String())
+	c.Assert(string(decoded.BinaryFragment.Data), Equals, "\x00\x01\x02")
+	c.Assert(decoded.ReverseBinaryFragment.Data, HasLen, 0)
+}
+
+func (s *UnifiedEncoderTestSuite) TestBinaryPatchRoundTrip(c *C) {
+	// generated with git diff --binary
+	patch := `diff --git a/foo b/foo
+index 5e154ebab7789d4cd418eeaccf08260e6583b8ff..0d89c7df4e373a8791962daec0b3f2b4fd421542 100644
+GIT binary patch
+literal 4
+LcmYdFEMfov1Cs$Z
+
+literal 4
+LcmYex&u0Jt1IGbH
+
+`
+
+	decoded, err := NewDecoder(strings.NewReader(patch)).Decode()
+	c.Assert(err, IsNil)
+
+	buffer := bytes.NewBuffer(nil)
+	err = NewUnifiedEncoder(buffer, 1).SetBinary(true).Encode(decoded)
+	c.Assert(err, IsNil)
+
+	fp := decodeBinaryFilePatch(c, buffer.String())
+	c.Assert(fp.BinaryFragment, DeepEquals, decoded.Files[0].BinaryFragment)
+	c.Assert(fp.ReverseBinaryFragment, DeepEquals, decoded.Files[0].ReverseBinaryFragment)
+}
+
+func (s *UnifiedEncoderTestSuite) TestBinaryPatchDisabled(c *C) {
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoder(buffer, 1)
+	err := e.Encode(testFilePatches{newTestBinaryFilePatch("foo\x00", "bar\x00")})
+	c.Assert(err, IsNil)
+
+	c.Assert(buffer.String(), Equals, `diff --git a/binary b/binary
+index 5e154ebab7789d4cd418eeaccf08260e6583b8ff..0d89c7df4e373a8791962daec0b3f2b4fd421542 100644
+Binary files a/binary and b/binary differ
+`)
+}
+
+func (s *UnifiedEncoderTestSuite) TestBase85(c *C) {
+	for n := 0; n < 12; n++ {
+		data := []byte(strings.Repeat("\xff\x00\x7f", 4)[:n])
+		decoded, err := decodeBase85(encodeBase85(data), n)
+		c.Assert(err, IsNil)
+		c.Assert(decoded, DeepEquals, data)
+	}
+}
+
+func decodeBinaryFilePatch(c *C, patch string) *UnifiedFilePatch {
+	decoded, err := NewDecoder(strings.NewReader(patch)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Files, HasLen, 1)
+	c.Assert(decoded.Files[0].BinaryFragment, NotNil)
+	c.Assert(decoded.Files[0].ReverseBinaryFragment, NotNil)
+	return decoded.Files[0]
+}
+
 func (s *UnifiedEncoderTestSuite) TestEncode(c *C) {
 	for _, f := range fixtures {
 		c.Log("executing: ", f.desc)
@@ -1014,6 +1128,39 @@ func (t testFilePatch) Chunks() []Chunk {
 	return result
 }
 
+type testFilePatches []FilePatch
+
+func (t testFilePatches) FilePatches() []FilePatch {
+	return t
+}
+
+func (t testFilePatches) Message() string {
+	return ""
+}
+
+type testBinaryFilePatch struct {
+	testFilePatch
+}
+
+func newTestBinaryFilePatch(from, to string) *testBinaryFilePatch {
+	return &testBinaryFilePatch{testFilePatch{
+		from: &testFile{mode: filemode.Regular, path: "binary", seed: from},
+		to:   &testFile{mode: filemode.Regular, path: "binary", seed: to},
+	}}
+}
+
+func (t testBinaryFilePatch) BinaryContents() (from, to []byte, err error) {
+	if t.from != nil {
+		from = []byte(t.from.seed)
+	}
+
+	if t.to != nil {
+		to = []byte(t.to.seed)
+	}
+
+	return from, to, nil
+}
+
 type testFile struct {
 	path string
 	mode filemode.FileMode
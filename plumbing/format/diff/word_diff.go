@@ -0,0 +1,239 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/color"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// WordDiffMode is a format of the word diffs encoded by UnifiedEncoder.
+type WordDiffMode int
+
+const (
+	// NoWordDiff encodes the changed lines, without word diff.
+	NoWordDiff WordDiffMode = iota
+	// WordDiffPlain encodes the deleted words as [-words-] and the added
+	// ones as {+words+}, as git diff --word-diff=plain.
+	WordDiffPlain
+	// WordDiffPorcelain encodes each sequence of deleted, added or unchanged
+	// words on its own line, prefixed by '-', '+' or ' ', and the ends of the
+	// lines as lines holding '~', as git diff --word-diff=porcelain.
+	WordDiffPorcelain
+	// WordDiffColor encodes the deleted and added words with the colors of
+	// the deleted and added lines, as git diff --word-diff=color.
+	WordDiffColor
+)
+
+// DefaultWordRegexp matches the words compared by default by the word diffs:
+// the sequences of non-whitespace characters.
+var DefaultWordRegexp = regexp.MustCompile(`[^[:space:]]+`)
+
+// wordStyle is the format of a sequence of words.
+type wordStyle struct {
+	prefix, suffix, color string
+}
+
+// wordDiffWriter writes the word diffs of the groups of changed lines, as
+// diff_words_show of git.
+type wordDiffWriter struct {
+	sb         *strings.Builder
+	wordRegexp *regexp.Regexp
+
+	old, new, context wordStyle
+	// newline is written for the end of each line
+	newline string
+
+	// minus and plus hold the deleted and added lines not written yet
+	minus, plus strings.Builder
+}
+
+func (e *UnifiedEncoder) newWordDiffWriter(sb *strings.Builder) *wordDiffWriter {
+	w := &wordDiffWriter{
+		sb:         sb,
+		wordRegexp: e.wordRegexp,
+		old:        wordStyle{color: e.color[Old]},
+		new:        wordStyle{color: e.color[New]},
+		context:    wordStyle{color: e.color[Context]},
+		newline:    "\n",
+	}
+
+	if w.wordRegexp == nil {
+		w.wordRegexp = DefaultWordRegexp
+	}
+
+	switch e.wordDiff {
+	case WordDiffPlain:
+		w.old.prefix, w.old.suffix = "[-", "-]"
+		w.new.prefix, w.new.suffix = "{+", "+}"
+	case WordDiffPorcelain:
+		w.old.prefix, w.old.suffix = "-", "\n"
+		w.new.prefix, w.new.suffix = "+", "\n"
+		w.context.prefix, w.context.suffix = " ", "\n"
+		w.newline = "~\n"
+	}
+
+	return w
+}
+
+// writeWordDiff writes the hunk with the word diffs of its changed lines.
+func (e *UnifiedEncoder) writeWordDiff(sb *strings.Builder, h *hunk) {
+	h.writeHeader(sb, e.color)
+
+	w := e.newWordDiffWriter(sb)
+	for _, op := range h.ops {
+		// the lines without line terminator are written as the other ones
+		text := op.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+
+		switch op.t {
+		case Delete:
+			w.minus.WriteString(text)
+		case Add:
+			w.plus.WriteString(text)
+		case Equal:
+			w.flush()
+			if e.wordDiff == WordDiffPorcelain {
+				sb.WriteByte(' ')
+				sb.WriteString(text)
+				sb.WriteString(w.newline)
+				continue
+			}
+
+			sb.WriteString(e.color[Context])
+			sb.WriteString(strings.TrimSuffix(text, "\n"))
+			sb.WriteString(e.color.Reset(Context))
+			sb.WriteByte('\n')
+		}
+	}
+
+	w.flush()
+}
+
+// flush writes the word diff of the deleted and added lines.
+func (w *wordDiffWriter) flush() {
+	minus, plus := w.minus.String(), w.plus.String()
+	w.minus.Reset()
+	w.plus.Reset()
+
+	if plus == "" {
+		w.write(w.old, minus)
+		return
+	}
+
+	minusWords, plusWords := w.words(minus), w.words(plus)
+	diffs := diff.DoWithOptions(wordLines(minus, minusWords), wordLines(plus, plusWords), &diff.Options{})
+
+	var current, m, p int
+	for i := 0; i < len(diffs); i++ {
+		n := strings.Count(diffs[i].Text, "\n")
+		if diffs[i].Type == dmp.DiffEqual {
+			m, p = m+n, p+n
+			continue
+		}
+
+		var minusCount, plusCount int
+		if diffs[i].Type == dmp.DiffDelete {
+			minusCount = n
+			if i+1 < len(diffs) && diffs[i+1].Type == dmp.DiffInsert {
+				i++
+				plusCount = strings.Count(diffs[i].Text, "\n")
+			}
+		} else {
+			plusCount = n
+		}
+
+		minusBegin, minusEnd := wordsRange(minusWords, m, minusCount)
+		plusBegin, plusEnd := wordsRange(plusWords, p, plusCount)
+		w.write(w.context, plus[current:plusBegin])
+		w.write(w.old, minus[minusBegin:minusEnd])
+		w.write(w.new, plus[plusBegin:plusEnd])
+
+		current = plusEnd
+		m, p = m+minusCount, p+plusCount
+	}
+
+	w.write(w.context, plus[current:])
+}
+
+// write writes the text with the style, each of its lines on its own.
+func (w *wordDiffWriter) write(style wordStyle, text string) {
+	for text != "" {
+		line := text
+		i := strings.IndexByte(text, '\n')
+		if i >= 0 {
+			line = text[:i]
+		}
+
+		if line != "" {
+			w.sb.WriteString(style.color)
+			w.sb.WriteString(style.prefix)
+			w.sb.WriteString(line)
+			w.sb.WriteString(style.suffix)
+			if style.color != "" {
+				w.sb.WriteString(color.Reset)
+			}
+		}
+
+		if i < 0 {
+			return
+		}
+
+		w.sb.WriteString(w.newline)
+		text = text[i+1:]
+	}
+}
+
+// words returns the start and the end of each word of the text.
+func (w *wordDiffWriter) words(text string) [][]int {
+	var words [][]int
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+
+		for _, loc := range w.wordRegexp.FindAllStringIndex(text[start:end], -1) {
+			if loc[0] != loc[1] {
+				words = append(words, []int{start + loc[0], start + loc[1]})
+			}
+		}
+
+		start = end + 1
+	}
+
+	return words
+}
+
+// wordLines returns the words of the text, each one on its own line, so they
+// can be compared with a line diff.
+func wordLines(text string, words [][]int) string {
+	b := &strings.Builder{}
+	for _, w := range words {
+		b.WriteString(text[w[0]:w[1]])
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// wordsRange returns the start and the end of the text of count words from
+// the first one. If count is 0, the range is empty and placed at the end of
+// the previous word.
+func wordsRange(words [][]int, first, count int) (begin, end int) {
+	switch {
+	case count != 0:
+		return words[first][0], words[first+count-1][1]
+	case first != 0:
+		return words[first-1][1], words[first-1][1]
+	default:
+		return 0, 0
+	}
+}
@@ -0,0 +1,137 @@
+package diff
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/go-git/go-git/v5/plumbing/color"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+
+	. "gopkg.in/check.v1"
+)
+
+type WordDiffSuite struct{}
+
+var _ = Suite(&WordDiffSuite{})
+
+// wordDiffPatch changes "a\nfoo bar baz\nc\ndel me\n" to
+// "a\nfoo  qux baz\nc\nnew line\n".
+var wordDiffPatch = testPatch{
+	filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "f", seed: "a\nfoo bar baz\nc\ndel me\n"},
+		to:   &testFile{mode: filemode.Regular, path: "f", seed: "a\nfoo  qux baz\nc\nnew line\n"},
+		chunks: []testChunk{
+			{content: "a\n", op: Equal},
+			{content: "foo bar baz\n", op: Delete},
+			{content: "foo  qux baz\n", op: Add},
+			{content: "c\n", op: Equal},
+			{content: "del me\n", op: Delete},
+			{content: "new line\n", op: Add},
+		},
+	}},
+}
+
+// encode returns the hunks of the patch encoded by e.
+func (s *WordDiffSuite) encode(c *C, e *UnifiedEncoder, p Patch) string {
+	buffer := e.Writer.(*bytes.Buffer)
+	buffer.Reset()
+	err := e.Encode(p)
+	c.Assert(err, IsNil)
+
+	i := bytes.Index(buffer.Bytes(), []byte("@@"))
+	i = bytes.LastIndexByte(buffer.Bytes()[:i], '\n')
+	return buffer.String()[i+1:]
+}
+
+// The expected outputs were generated with git diff --word-diff.
+
+func (s *WordDiffSuite) TestPlain(c *C) {
+	e := NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).SetWordDiff(WordDiffPlain)
+	c.Assert(s.encode(c, e, wordDiffPatch), Equals, ""+
+		"@@ -1,4 +1,4 @@\n"+
+		"a\n"+
+		"foo  [-bar-]{+qux+} baz\n"+
+		"c\n"+
+		"[-del me-]{+new line+}\n",
+	)
+}
+
+func (s *WordDiffSuite) TestPorcelain(c *C) {
+	e := NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).SetWordDiff(WordDiffPorcelain)
+	c.Assert(s.encode(c, e, wordDiffPatch), Equals, ""+
+		"@@ -1,4 +1,4 @@\n"+
+		" a\n"+
+		"~\n"+
+		" foo  \n"+
+		"-bar\n"+
+		"+qux\n"+
+		"  baz\n"+
+		"~\n"+
+		" c\n"+
+		"~\n"+
+		"-del me\n"+
+		"+new line\n"+
+		"~\n",
+	)
+}
+
+func (s *WordDiffSuite) TestColor(c *C) {
+	e := NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).SetWordDiff(WordDiffColor)
+	c.Assert(s.encode(c, e, wordDiffPatch), Equals, ""+
+		color.Cyan+"@@ -1,4 +1,4 @@"+color.Reset+"\n"+
+		"a\n"+
+		"foo  "+color.Red+"bar"+color.Reset+color.Green+"qux"+color.Reset+" baz\n"+
+		"c\n"+
+		color.Red+"del me"+color.Reset+color.Green+"new line"+color.Reset+"\n",
+	)
+}
+
+func (s *WordDiffSuite) TestMissingNewline(c *C) {
+	p := testPatch{filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "f", seed: "x\nold1\nold2\ny"},
+		to:   &testFile{mode: filemode.Regular, path: "f", seed: "x\n   foo\ny\nz"},
+		chunks: []testChunk{
+			{content: "x\n", op: Equal},
+			{content: "old1\nold2\ny", op: Delete},
+			{content: "   foo\ny\nz", op: Add},
+		},
+	}}}
+
+	e := NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).SetWordDiff(WordDiffPlain)
+	c.Assert(s.encode(c, e, p), Equals, ""+
+		"@@ -1,4 +1,4 @@\n"+
+		"x\n"+
+		"   [-old1-]\n"+
+		"[-old2-]{+foo+}\n"+
+		"y\n"+
+		"{+z+}\n",
+	)
+
+	p.filePatches[0].chunks = p.filePatches[0].chunks[:2]
+	c.Assert(s.encode(c, e, p), Equals, ""+
+		"@@ -1,4 +1 @@\n"+
+		"x\n"+
+		"[-old1-]\n"+
+		"[-old2-]\n"+
+		"[-y-]\n",
+	)
+}
+
+func (s *WordDiffSuite) TestWordRegexp(c *C) {
+	p := testPatch{filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "f", seed: "foo(bar)\n"},
+		to:   &testFile{mode: filemode.Regular, path: "f", seed: "foo(baz)\n"},
+		chunks: []testChunk{
+			{content: "foo(bar)\n", op: Delete},
+			{content: "foo(baz)\n", op: Add},
+		},
+	}}}
+
+	e := NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).SetWordDiff(WordDiffPlain)
+	c.Assert(s.encode(c, e, p), Equals, "@@ -1 +1 @@\n[-foo(bar)-]{+foo(baz)+}\n")
+
+	e = NewUnifiedEncoder(&bytes.Buffer{}, DefaultContextLines).
+		SetWordDiff(WordDiffPlain).
+		SetWordRegexp(regexp.MustCompile(`[a-z]+|[()]`))
+	c.Assert(s.encode(c, e, p), Equals, "@@ -1 +1 @@\nfoo([-bar-]{+baz+})\n")
+}
@@ -27,6 +27,7 @@ func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile strin
 		return nil, err
 	}
 
+	defer f.Close()
 	return ReadAttributes(f, path, allowMacro)
 }
 
@@ -44,9 +44,17 @@ func (m *matcher) init() {
 func (m *matcher) Match(path []string, attributes []string) (results map[string]Attribute, matched bool) {
 	results = make(map[string]Attribute, len(attributes))
 
+	var requested map[string]bool
+	if len(attributes) > 0 {
+		requested = make(map[string]bool, len(attributes))
+		for _, name := range attributes {
+			requested[name] = true
+		}
+	}
+
 	n := len(m.stack)
 	for i := n - 1; i >= 0; i-- {
-		if len(attributes) > 0 && len(attributes) == len(results) {
+		if requested != nil && len(requested) == len(results) {
 			return
 		}
 
@@ -55,13 +63,30 @@ func (m *matcher) Match(path []string, attributes []string) (results map[string]
 			continue
 		}
 
-		if match := pattern.Match(path); match {
-			matched = true
-			for _, attr := range m.stack[i].Attributes {
-				if attr.IsSet() {
-					m.expandMacro(attr.Name(), results)
-				}
-				results[attr.Name()] = attr
+		if match := pattern.Match(path); !match {
+			continue
+		}
+
+		matched = true
+
+		// within a line the later attributes override the previous ones and
+		// the ones of the macros they expand
+		line := make(map[string]Attribute, len(m.stack[i].Attributes))
+		for _, attr := range m.stack[i].Attributes {
+			if attr.IsSet() {
+				m.expandMacro(attr.Name(), line)
+			}
+			line[attr.Name()] = attr
+		}
+
+		for name, attr := range line {
+			if requested != nil && !requested[name] {
+				continue
+			}
+
+			// the lines with higher priority were already matched
+			if _, ok := results[name]; !ok {
+				results[name] = attr
 			}
 		}
 	}
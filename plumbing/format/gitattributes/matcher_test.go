@@ -27,3 +27,26 @@ func (s *MatcherSuite) TestMatcher_Match(c *C) {
 	c.Assert(results["text"].IsSet(), Equals, true)
 	c.Assert(results["eol"].Value(), Equals, "crlf")
 }
+
+func (s *MatcherSuite) TestMatcher_MatchPriority(c *C) {
+	lines := []string{
+		"[attr]binary -diff -merge -text",
+		"* text=auto eol=crlf",
+		"*.bin binary",
+		"*.txt !eol",
+	}
+
+	ma, err := ReadAttributes(strings.NewReader(strings.Join(lines, "\n")), nil, true)
+	c.Assert(err, IsNil)
+
+	m := NewMatcher(ma)
+	results, matched := m.Match([]string{"foo.bin"}, []string{"text", "eol"})
+	c.Assert(matched, Equals, true)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results["text"].IsUnset(), Equals, true)
+	c.Assert(results["eol"].Value(), Equals, "crlf")
+
+	results, _ = m.Match([]string{"foo.txt"}, []string{"text", "eol"})
+	c.Assert(results["text"].Value(), Equals, "auto")
+	c.Assert(results["eol"].IsUnspecified(), Equals, true)
+}
@@ -274,6 +274,12 @@ func (d *Decoder) readExtension(idx *Index, header []byte) error {
 		if err := d.Decode(idx.EndOfIndexEntry); err != nil {
 			return err
 		}
+	case bytes.Equal(header, sparseDirectoryExtSignature):
+		if _, err := d.getExtensionReader(); err != nil {
+			return err
+		}
+
+		idx.Sparse = true
 	default:
 		return errUnknownExtension
 	}
@@ -317,6 +317,24 @@
 //    - An ewah bitmap, the n-th bit indicates whether the n-th index entry
 //      is not CE_FSMONITOR_VALID.
 //
+//  == Sparse Directory Entries
+//
+//    When using sparse-checkout in cone mode, some entire directories within
+//    the index can be summarized by pointing to a tree object instead of the
+//    entire expanded list of paths within that tree. An index containing such
+//    entries is a "sparse index". Index format versions 4 and less were not
+//    implemented with such entries in mind. Thus, for these versions, an
+//    index containing sparse directory entries will include this extension
+//    with signature { 's', 'd', 'i', 'r' }. Like the split-index extension,
+//    tools should avoid interacting with a sparse index unless they
+//    understand this extension.
+//
+//    The extension has no data, its size is 0.
+//
+//    A sparse directory entry is a tree entry with the skip-worktree bit set:
+//    its mode is 040000, its object name is the hash of the tree and its path
+//    name ends with a directory separator.
+//
 //  == End of Index Entry
 //
 //    The End of Index Entry (EOIE) is used to locate the end of the variable
@@ -13,8 +13,10 @@ import (
 )
 
 var (
-	// EncodeVersionSupported is the range of supported index versions
-	EncodeVersionSupported uint32 = 2
+	// EncodeVersionSupported is the highest supported index version, the
+	// versions from 2 to EncodeVersionSupported being supported. The entries
+	// with extended flags, such as SkipWorktree, require version 3.
+	EncodeVersionSupported uint32 = 3
 
 	// ErrInvalidTimestamp is returned by Encode if a Index with a Entry with
 	// negative timestamp values
@@ -36,9 +38,9 @@ func NewEncoder(w io.Writer) *Encoder {
 
 // Encode writes the Index to the stream of the encoder.
 func (e *Encoder) Encode(idx *Index) error {
-	// TODO: support versions v3 and v4
-	// TODO: support extensions
-	if idx.Version != EncodeVersionSupported {
+	// TODO: support version v4
+	// TODO: support extensions other than the sparse directory one
+	if idx.Version < DecodeVersionSupported.Min || idx.Version > EncodeVersionSupported {
 		return ErrUnsupportedVersion
 	}
 
@@ -50,6 +52,10 @@ func (e *Encoder) Encode(idx *Index) error {
 		return err
 	}
 
+	if err := e.encodeExtensions(idx); err != nil {
+		return err
+	}
+
 	return e.encodeFooter()
 }
 
@@ -65,11 +71,15 @@ func (e *Encoder) encodeEntries(idx *Index) error {
 	sort.Sort(byName(idx.Entries))
 
 	for _, entry := range idx.Entries {
-		if err := e.encodeEntry(entry); err != nil {
+		if err := e.encodeEntry(idx, entry); err != nil {
 			return err
 		}
 
 		wrote := entryHeaderLength + len(entry.Name)
+		if hasExtendedFlags(entry) {
+			wrote += 2
+		}
+
 		if err := e.padEntry(wrote); err != nil {
 			return err
 		}
@@ -78,8 +88,9 @@ func (e *Encoder) encodeEntries(idx *Index) error {
 	return nil
 }
 
-func (e *Encoder) encodeEntry(entry *Entry) error {
-	if entry.IntentToAdd || entry.SkipWorktree {
+func (e *Encoder) encodeEntry(idx *Index, entry *Entry) error {
+	extended := hasExtendedFlags(entry)
+	if extended && idx.Version < 3 {
 		return ErrUnsupportedVersion
 	}
 
@@ -100,6 +111,10 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 		flags |= nameMask
 	}
 
+	if extended {
+		flags |= entryExtended
+	}
+
 	flow := []interface{}{
 		sec, nsec,
 		msec, mnsec,
@@ -113,6 +128,19 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 		flags,
 	}
 
+	if extended {
+		var extendedFlags uint16
+		if entry.IntentToAdd {
+			extendedFlags |= intentToAddMask
+		}
+
+		if entry.SkipWorktree {
+			extendedFlags |= skipWorkTreeMask
+		}
+
+		flow = append(flow, extendedFlags)
+	}
+
 	if err := binary.Write(e.w, flow...); err != nil {
 		return err
 	}
@@ -120,6 +148,20 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 	return binary.Write(e.w, []byte(entry.Name))
 }
 
+// hasExtendedFlags tells whether the entry has flags only supported by the
+// versions 3 and later.
+func hasExtendedFlags(entry *Entry) bool {
+	return entry.IntentToAdd || entry.SkipWorktree
+}
+
+func (e *Encoder) encodeExtensions(idx *Index) error {
+	if !idx.Sparse {
+		return nil
+	}
+
+	return binary.Write(e.w, sparseDirectoryExtSignature, uint32(0))
+}
+
 func (e *Encoder) timeToUint32(t *time.Time) (uint32, uint32, error) {
 	if t.IsZero() {
 		return 0, 0, nil
@@ -145,6 +187,12 @@ func (e *Encoder) encodeFooter() error {
 
 type byName []*Entry
 
-func (l byName) Len() int           { return len(l) }
-func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
-func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l byName) Len() int      { return len(l) }
+func (l byName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byName) Less(i, j int) bool {
+	if l[i].Name == l[j].Name {
+		return l[i].Stage < l[j].Stage
+	}
+
+	return l[i].Name < l[j].Name
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 
 	"github.com/google/go-cmp/cmp"
 	. "gopkg.in/check.v1"
@@ -56,8 +57,97 @@ func (s *IndexSuite) TestEncode(c *C) {
 
 }
 
+func (s *IndexSuite) TestEncodeStagesOrder(c *C) {
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{
+			{Name: "foo", Stage: TheirMode},
+			{Name: "foo", Stage: AncestorMode},
+			{Name: "bar", Stage: Merged},
+			{Name: "foo", Stage: OurMode},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(output.Entries, HasLen, 4)
+	c.Assert(output.Entries[0].Name, Equals, "bar")
+	c.Assert(output.Entries[0].Stage, Equals, Merged)
+	c.Assert(output.Entries[1].Stage, Equals, AncestorMode)
+	c.Assert(output.Entries[2].Stage, Equals, OurMode)
+	c.Assert(output.Entries[3].Stage, Equals, TheirMode)
+}
+
+func (s *IndexSuite) TestEncodeV3(c *C) {
+	idx := &Index{
+		Version: 3,
+		Entries: []*Entry{{
+			Name:         "bar",
+			Size:         82,
+			SkipWorktree: true,
+		}, {
+			Name:        "baz",
+			IntentToAdd: true,
+		}, {
+			CreatedAt:  time.Now(),
+			ModifiedAt: time.Now(),
+			Name:       "foo",
+			Hash:       plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+		}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	err := e.Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	d := NewDecoder(buf)
+	err = d.Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+}
+
+func (s *IndexSuite) TestEncodeSparse(c *C) {
+	idx := &Index{
+		Version: 3,
+		Sparse:  true,
+		Entries: []*Entry{{
+			Name: "foo",
+			Mode: filemode.Regular,
+			Hash: plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+		}, {
+			Name:         "bar/",
+			Mode:         filemode.Dir,
+			Hash:         plumbing.NewHash("aa8e2c5d4e4bde27c9ed3e6bb2e4f7c5a1c2e4f0"),
+			SkipWorktree: true,
+		}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	err := e.Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	d := NewDecoder(buf)
+	err = d.Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+	c.Assert(output.Entries[0].IsSparseDirectory(), Equals, true)
+	c.Assert(output.Entries[1].IsSparseDirectory(), Equals, false)
+}
+
 func (s *IndexSuite) TestEncodeUnsupportedVersion(c *C) {
-	idx := &Index{Version: 3}
+	idx := &Index{Version: 4}
 
 	buf := bytes.NewBuffer(nil)
 	e := NewEncoder(buf)
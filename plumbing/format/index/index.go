@@ -22,6 +22,7 @@ var (
 	treeExtSignature            = []byte{'T', 'R', 'E', 'E'}
 	resolveUndoExtSignature     = []byte{'R', 'E', 'U', 'C'}
 	endOfIndexEntryExtSignature = []byte{'E', 'O', 'I', 'E'}
+	sparseDirectoryExtSignature = []byte{'s', 'd', 'i', 'r'}
 )
 
 // Stage during merge
@@ -29,7 +30,7 @@ type Stage int
 
 const (
 	// Merged is the default stage, fully merged
-	Merged Stage = 1
+	Merged Stage = 0
 	// AncestorMode is the base revision
 	AncestorMode Stage = 1
 	// OurMode is the first tree revision, ours
@@ -53,6 +54,9 @@ type Index struct {
 	ResolveUndo *ResolveUndo
 	// EndOfIndexEntry represents the 'End of Index Entry' extension
 	EndOfIndexEntry *EndOfIndexEntry
+	// Sparse tells whether the index is a sparse index, which can contain
+	// sparse directory entries, represents the 'Sparse directory' extension
+	Sparse bool
 }
 
 // Add creates a new Entry and returns it. The caller should first check that
@@ -150,6 +154,14 @@ type Entry struct {
 	IntentToAdd bool
 }
 
+// IsSparseDirectory tells whether the entry is a sparse directory entry of a
+// sparse index, standing for all the files of a directory outside of the
+// sparse checkout. Its Name ends with a slash and its Hash is the hash of the
+// tree of the directory.
+func (e *Entry) IsSparseDirectory() bool {
+	return e.Mode == filemode.Dir
+}
+
 func (e Entry) String() string {
 	buf := bytes.NewBuffer(nil)
 
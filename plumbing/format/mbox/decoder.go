@@ -0,0 +1,191 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrMalformedMessage is returned by Decode when the header of a message
+// can't be parsed.
+var ErrMalformedMessage = errors.New("malformed message")
+
+// fromLineRegexp matches the lines separating the messages of a mailbox,
+// which hold a time, as git mailsplit requires.
+var fromLineRegexp = regexp.MustCompile(`^From \S+ .*\d:\d\d`)
+
+// A Decoder reads and decodes the messages of a mailbox from an input stream.
+// A single message without "From " line is also accepted.
+type Decoder struct {
+	r *bufio.Reader
+	// next is the "From " line of the next message, once read
+	next string
+	eof  bool
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads and returns the next message of the mailbox, or io.EOF if
+// there are no more messages.
+func (d *Decoder) Decode() (*Message, error) {
+	fromLine, raw, err := d.readMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{}
+	if f := strings.Fields(fromLine); len(f) > 1 && plumbing.IsHash(f[1]) {
+		m.Hash = plumbing.NewHash(f[1])
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	if from := msg.Header.Get("From"); from != "" {
+		m.Author.Name, m.Author.Email = parseAddress(from)
+	}
+
+	if date := msg.Header.Get("Date"); date != "" {
+		if m.Author.When, err = mail.ParseDate(date); err != nil {
+			return nil, ErrMalformedMessage
+		}
+	}
+
+	m.Subject = decodeHeader(msg.Header.Get("Subject"))
+	body, err := decodeBody(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Body = string(body)
+	return m, nil
+}
+
+// readMessage reads the lines of the next message, up to the next "From "
+// line. The line endings are normalized to LF, and the empty line ending the
+// message is removed.
+func (d *Decoder) readMessage() (fromLine string, raw []byte, err error) {
+	buf := &bytes.Buffer{}
+	fromLine, d.next = d.next, ""
+	for !d.eof {
+		line, err := d.r.ReadString('\n')
+		if err == io.EOF {
+			d.eof = true
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		if line == "" {
+			break
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r") + "\n"
+		if fromLineRegexp.MatchString(line) {
+			if buf.Len() == 0 && fromLine == "" {
+				fromLine = line
+				continue
+			}
+
+			d.next = line
+			break
+		}
+
+		if buf.Len() == 0 && fromLine == "" && line == "\n" {
+			// leading empty lines
+			continue
+		}
+
+		buf.WriteString(line)
+	}
+
+	if buf.Len() == 0 && fromLine == "" {
+		return "", nil, io.EOF
+	}
+
+	raw = buf.Bytes()
+	if bytes.HasSuffix(raw, []byte("\n\n")) {
+		raw = raw[:len(raw)-1]
+	}
+
+	return fromLine, raw, nil
+}
+
+// decodeBody returns the body of the message, decoding its transfer encoding
+// and converting it to UTF-8.
+func decodeBody(msg *mail.Message) ([]byte, error) {
+	var r io.Reader = msg.Body
+	switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err == nil && isLatin1(params["charset"]) && !utf8.Valid(body) {
+		runes := make([]rune, len(body))
+		for i, b := range body {
+			runes[i] = rune(b)
+		}
+
+		body = []byte(string(runes))
+	}
+
+	return bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1), nil
+}
+
+func isLatin1(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseAddress returns the name and the email of the address, accepting the
+// addresses that don't follow RFC 5322 as git does.
+func parseAddress(s string) (name, email string) {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Name, a.Address
+	}
+
+	s = decodeHeader(s)
+	start, end := strings.LastIndex(s, "<"), strings.LastIndex(s, ">")
+	if start < 0 || end < start {
+		return "", strings.TrimSpace(s)
+	}
+
+	name = strings.Trim(strings.TrimSpace(s[:start]), `"`)
+	return name, strings.TrimSpace(s[start+1 : end])
+}
+
+func decodeHeader(s string) string {
+	decoded, err := (&mime.WordDecoder{}).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+
+	return decoded
+}
@@ -0,0 +1,21 @@
+// Package mbox implements encoding and decoding of mailboxes of patches, as
+// written by git format-patch and read by git am.
+//
+// A mailbox is a sequence of RFC 2822 messages, each one starting with a
+// "From " line. The messages written by git format-patch have the following
+// format:
+//
+//	From <commit hash> Mon Sep 17 00:00:00 2001
+//	From: <author name> <<author email>>
+//	Date: <author date>
+//	Subject: [PATCH <n>/<total>] <subject>
+//
+//	<body of the commit message>
+//	---
+//	<diffstat>
+//
+//	<patch>
+//
+// Header fields and bodies with non-ASCII characters are encoded as
+// described by RFC 2047 and RFC 2045.
+package mbox
@@ -0,0 +1,87 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const (
+	// fromLineDate is the fixed date git writes in the "From " lines, so
+	// they can be told apart from the ones of other mailboxes.
+	fromLineDate = "Mon Sep 17 00:00:00 2001"
+	// dateFormat is the RFC 2822 format of the Date header field.
+	dateFormat = "Mon, 2 Jan 2006 15:04:05 -0700"
+)
+
+// An Encoder writes messages to an output stream, as git format-patch does.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the given messages to the stream of the encoder, in the given
+// order. Each message is followed by an empty line.
+func (e *Encoder) Encode(messages ...*Message) error {
+	for _, m := range messages {
+		if err := e.encodeMessage(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeMessage(m *Message) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "From %s %s\n", m.Hash, fromLineDate)
+	fmt.Fprintf(b, "From: %s\n", formatAddress(m.Author.Name, m.Author.Email))
+	fmt.Fprintf(b, "Date: %s\n", m.Author.When.Format(dateFormat))
+	fmt.Fprintf(b, "Subject: %s\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	if !isASCII(m.Body) {
+		b.WriteString("MIME-Version: 1.0\n")
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\n")
+		b.WriteString("Content-Transfer-Encoding: 8bit\n")
+	}
+
+	b.WriteByte('\n')
+	b.WriteString(m.Body)
+	if m.Body != "" && !strings.HasSuffix(m.Body, "\n") {
+		b.WriteByte('\n')
+	}
+
+	b.WriteByte('\n')
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+// formatAddress formats the name and the email as the value of an address
+// header field. The name is quoted only if it contains special characters,
+// and encoded if it isn't ASCII.
+func formatAddress(name, email string) string {
+	switch {
+	case name == "":
+		return "<" + email + ">"
+	case !isASCII(name):
+		name = mime.QEncoding.Encode("UTF-8", name)
+	case strings.ContainsAny(name, "()<>[]:;@\\,.\""):
+		name = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+
+	return name + " <" + email + ">"
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
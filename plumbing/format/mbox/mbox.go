@@ -0,0 +1,30 @@
+package mbox
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Message is a message of a mailbox, usually holding a patch.
+type Message struct {
+	// Hash is the hash of the commit the message was generated from, given
+	// by its "From " line, or the zero hash if it is unknown.
+	Hash plumbing.Hash
+	// Author is the sender of the message, and the date it was sent.
+	Author Signature
+	// Subject is the subject of the message, decoded.
+	Subject string
+	// Body is the text of the message, decoded.
+	Body string
+}
+
+// Signature identifies the sender of a message, and when it was sent.
+type Signature struct {
+	// Name represents a person name. It is an arbitrary string.
+	Name string
+	// Email is an email, but it cannot be assumed to be well-formed.
+	Email string
+	// When is the date of the message.
+	When time.Time
+}
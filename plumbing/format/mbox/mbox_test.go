@@ -0,0 +1,212 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MboxSuite struct{}
+
+var _ = Suite(&MboxSuite{})
+
+// fixture was generated with git format-patch --cover-letter --stdout
+const fixture = `From 1054be3761659701ad40bfa2bf487e6a46e1d39d Mon Sep 17 00:00:00 2001
+From: C <c@x.org>
+Date: Thu, 2 Jan 2020 03:04:05 +0100
+Subject: [PATCH 0/2] *** SUBJECT HERE ***
+MIME-Version: 1.0
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: 8bit
+
+*** BLURB HERE ***
+
+René Doe (2):
+  Change b, añadido
+  Add g
+
+ f | 2 +-
+ g | 1 +
+ 2 files changed, 2 insertions(+), 1 deletion(-)
+ create mode 100644 g
+
+-- 
+2.39.5
+
+From e9396a27df8369fe65bf7e8d5ee365809447a624 Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?Ren=C3=A9=20Doe?= <r@x.org>
+Date: Thu, 2 Jan 2020 03:04:05 +0100
+Subject: [PATCH 1/2] =?UTF-8?q?Change=20b,=20a=C3=B1adido?=
+MIME-Version: 1.0
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: 8bit
+
+Longer body.
+---
+ f | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/f b/f
+index 422c2b7..55dce13 100644
+--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
++B
+-- 
+2.39.5
+
+
+From 1054be3761659701ad40bfa2bf487e6a46e1d39d Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?Ren=C3=A9=20Doe?= <r@x.org>
+Date: Thu, 2 Jan 2020 03:04:05 +0100
+Subject: [PATCH 2/2] Add g
+
+---
+ g | 1 +
+ 1 file changed, 1 insertion(+)
+ create mode 100644 g
+
+diff --git a/g b/g
+new file mode 100644
+index 0000000..587be6b
+--- /dev/null
++++ b/g
+@@ -0,0 +1 @@
++x
+-- 
+2.39.5
+
+`
+
+func (s *MboxSuite) TestDecode(c *C) {
+	d := NewDecoder(strings.NewReader(fixture))
+
+	var messages []*Message
+	for {
+		m, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		messages = append(messages, m)
+	}
+
+	c.Assert(messages, HasLen, 3)
+	c.Assert(messages[0].Subject, Equals, "[PATCH 0/2] *** SUBJECT HERE ***")
+	c.Assert(messages[0].Author.Name, Equals, "C")
+	c.Assert(strings.HasPrefix(messages[0].Body, "*** BLURB HERE ***\n\nRené Doe (2):\n"), Equals, true)
+
+	m := messages[1]
+	c.Assert(m.Hash, Equals, plumbing.NewHash("e9396a27df8369fe65bf7e8d5ee365809447a624"))
+	c.Assert(m.Author.Name, Equals, "René Doe")
+	c.Assert(m.Author.Email, Equals, "r@x.org")
+	c.Assert(m.Author.When.Unix(), Equals, int64(1577930645))
+	_, offset := m.Author.When.Zone()
+	c.Assert(offset, Equals, 3600)
+	c.Assert(m.Subject, Equals, "[PATCH 1/2] Change b, añadido")
+	c.Assert(strings.HasPrefix(m.Body, "Longer body.\n---\n"), Equals, true)
+	c.Assert(strings.HasSuffix(m.Body, "+B\n-- \n2.39.5\n\n"), Equals, true)
+
+	c.Assert(messages[2].Subject, Equals, "[PATCH 2/2] Add g")
+	c.Assert(strings.HasSuffix(messages[2].Body, "+x\n-- \n2.39.5\n"), Equals, true)
+}
+
+func (s *MboxSuite) TestDecodeSingleMessage(c *C) {
+	d := NewDecoder(strings.NewReader("\r\n" +
+		"From: \"Doe, John\" <john@example.com>\r\n" +
+		"Subject: Re: [PATCH] Fix\r\n" +
+		" the bug\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9 con le=\r\n" +
+		"che\r\n"))
+
+	m, err := d.Decode()
+	c.Assert(err, IsNil)
+	c.Assert(m.Hash, Equals, plumbing.ZeroHash)
+	c.Assert(m.Author.Name, Equals, "Doe, John")
+	c.Assert(m.Author.Email, Equals, "john@example.com")
+	c.Assert(m.Author.When.IsZero(), Equals, true)
+	c.Assert(m.Subject, Equals, "Re: [PATCH] Fix the bug")
+	c.Assert(m.Body, Equals, "Café con leche\n")
+
+	_, err = d.Decode()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *MboxSuite) TestDecodeMalformed(c *C) {
+	d := NewDecoder(strings.NewReader("From: John <john@example.com>\nDate: yesterday\n\nbody\n"))
+	_, err := d.Decode()
+	c.Assert(err, Equals, ErrMalformedMessage)
+}
+
+func (s *MboxSuite) TestEncode(c *C) {
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))
+	messages := []*Message{{
+		Hash:    plumbing.NewHash("e9396a27df8369fe65bf7e8d5ee365809447a624"),
+		Author:  Signature{Name: "John Doe", Email: "john@example.com", When: when},
+		Subject: "[PATCH 1/2] Fix the bug",
+		Body:    "---\n patch\n",
+	}, {
+		Author:  Signature{Name: "René Doe, Jr.", Email: "rene@example.com", When: when},
+		Subject: "[PATCH 2/2] Añadir",
+		Body:    "Más.\n",
+	}}
+
+	buf := &bytes.Buffer{}
+	err := NewEncoder(buf).Encode(messages...)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"From e9396a27df8369fe65bf7e8d5ee365809447a624 Mon Sep 17 00:00:00 2001\n"+
+		"From: John Doe <john@example.com>\n"+
+		"Date: Thu, 2 Jan 2020 03:04:05 +0100\n"+
+		"Subject: [PATCH 1/2] Fix the bug\n"+
+		"\n"+
+		"---\n"+
+		" patch\n"+
+		"\n"+
+		"From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001\n"+
+		"From: =?UTF-8?q?Ren=C3=A9_Doe,_Jr.?= <rene@example.com>\n"+
+		"Date: Thu, 2 Jan 2020 03:04:05 +0100\n"+
+		"Subject: =?UTF-8?q?[PATCH_2/2]_A=C3=B1adir?=\n"+
+		"MIME-Version: 1.0\n"+
+		"Content-Type: text/plain; charset=UTF-8\n"+
+		"Content-Transfer-Encoding: 8bit\n"+
+		"\n"+
+		"Más.\n"+
+		"\n",
+	)
+
+	d := NewDecoder(buf)
+	for _, expected := range messages {
+		m, err := d.Decode()
+		c.Assert(err, IsNil)
+		c.Assert(m.Hash, Equals, expected.Hash)
+		c.Assert(m.Author.Name, Equals, expected.Author.Name)
+		c.Assert(m.Author.Email, Equals, expected.Author.Email)
+		c.Assert(m.Author.When.Equal(expected.Author.When), Equals, true)
+		c.Assert(m.Subject, Equals, expected.Subject)
+		c.Assert(m.Body, Equals, expected.Body)
+	}
+
+	_, err = d.Decode()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *MboxSuite) TestEncodeQuotedName(c *C) {
+	c.Assert(formatAddress("Doe, John", "john@example.com"), Equals, `"Doe, John" <john@example.com>`)
+	c.Assert(formatAddress(`John "JD" Doe`, "john@example.com"), Equals, `"John \"JD\" Doe" <john@example.com>`)
+	c.Assert(formatAddress("", "john@example.com"), Equals, "<john@example.com>")
+}
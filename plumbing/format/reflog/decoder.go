@@ -0,0 +1,112 @@
+package reflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrMalformedEntry is returned by Decode when a line of the reflog can't be
+// parsed.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+const (
+	hashLength     = 40
+	timezoneLength = 5
+)
+
+// A Decoder reads and decodes reflog files from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the whole reflog from its input and returns its entries, the
+// oldest first.
+func (d *Decoder) Decode() ([]*Entry, error) {
+	var entries []*Entry
+	s := bufio.NewScanner(d.r)
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		e, err := decodeEntry(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+func decodeEntry(line []byte) (*Entry, error) {
+	if len(line) < 2*hashLength+2 || line[hashLength] != ' ' || line[2*hashLength+1] != ' ' {
+		return nil, ErrMalformedEntry
+	}
+
+	e := &Entry{
+		Old: plumbing.NewHash(string(line[:hashLength])),
+		New: plumbing.NewHash(string(line[hashLength+1 : 2*hashLength+1])),
+	}
+
+	sig := line[2*hashLength+2:]
+	if i := bytes.IndexByte(sig, '\t'); i >= 0 {
+		e.Message = string(sig[i+1:])
+		sig = sig[:i]
+	}
+
+	if err := decodeSignature(&e.Committer, sig); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func decodeSignature(s *Signature, b []byte) error {
+	open := bytes.LastIndexByte(b, '<')
+	close := bytes.LastIndexByte(b, '>')
+	if open == -1 || close == -1 || close < open {
+		return ErrMalformedEntry
+	}
+
+	s.Name = string(bytes.Trim(b[:open], " "))
+	s.Email = string(b[open+1 : close])
+
+	fields := bytes.Fields(b[close+1:])
+	if len(fields) != 2 || len(fields[1]) != timezoneLength {
+		return ErrMalformedEntry
+	}
+
+	ts, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil {
+		return ErrMalformedEntry
+	}
+
+	tz := string(fields[1])
+	hours, err1 := strconv.ParseInt(tz[0:3], 10, 64)
+	mins, err2 := strconv.ParseInt(tz[3:], 10, 64)
+	if err1 != nil || err2 != nil {
+		return ErrMalformedEntry
+	}
+
+	if hours < 0 || tz[0] == '-' {
+		mins *= -1
+	}
+
+	offset := int(hours*60*60 + mins*60)
+	s.When = time.Unix(ts, 0).In(time.FixedZone("", offset))
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package reflog implements encoding and decoding of reflog files.
+//
+// The reflog of a reference records the changes of its value, one entry per
+// line with the following format, the oldest entry first:
+//
+//	<old hash> SP <new hash> SP <name> SP "<" <email> ">" SP <timestamp> SP <timezone> [TAB <message>] LF
+//
+// The old hash of the first entry of a reference created by the update is
+// the zero hash, and the new hash of an entry is usually the old hash of the
+// following one. The message is a single line describing the update.
+package reflog
@@ -0,0 +1,59 @@
+package reflog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An Encoder writes reflog entries to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the given entries to the stream of the encoder, in the given
+// order. Line breaks in the messages are replaced by spaces, as git does.
+func (e *Encoder) Encode(entries ...*Entry) error {
+	for _, entry := range entries {
+		if err := e.encodeEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeEntry(entry *Entry) error {
+	ts := entry.Committer.When.Unix()
+	if ts < 0 {
+		ts = 0
+	}
+
+	_, err := fmt.Fprintf(e.w, "%s %s %s <%s> %d %s",
+		entry.Old, entry.New,
+		entry.Committer.Name, entry.Committer.Email,
+		ts, entry.Committer.When.Format("-0700"),
+	)
+	if err != nil {
+		return err
+	}
+
+	if msg := normalizeMessage(entry.Message); msg != "" {
+		if _, err := fmt.Fprintf(e.w, "\t%s", msg); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(e.w, "\n")
+	return err
+}
+
+// normalizeMessage turns the message into a single line.
+func normalizeMessage(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
@@ -0,0 +1,42 @@
+package reflog
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Entry is an entry of a reflog, a change of the value of a reference.
+type Entry struct {
+	// Old is the value of the reference before the change, or the zero hash
+	// if the reference was created.
+	Old plumbing.Hash
+	// New is the value of the reference after the change.
+	New plumbing.Hash
+	// Committer is the identity that performed the change and its time.
+	Committer Signature
+	// Message describes the change.
+	Message string
+}
+
+// Signature identifies who changed a reference, and when.
+type Signature struct {
+	// Name represents a person name. It is an arbitrary string.
+	Name string
+	// Email is an email, but it cannot be assumed to be well-formed.
+	Email string
+	// When is the timestamp of the change.
+	When time.Time
+}
+
+// Relink updates the old hashes of the given entries, the oldest first, so
+// that each one matches the new hash of the previous entry, and the first one
+// is the zero hash. It's used to keep a reflog consistent after removing some
+// of its entries, as git's --rewrite option does.
+func Relink(entries []*Entry) {
+	old := plumbing.ZeroHash
+	for _, e := range entries {
+		e.Old = old
+		old = e.New
+	}
+}
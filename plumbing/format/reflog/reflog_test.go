@@ -0,0 +1,90 @@
+package reflog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ReflogSuite struct{}
+
+var _ = Suite(&ReflogSuite{})
+
+const fixture = "" +
+	"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe <john@example.com> 1257894000 +0100\tcommit (initial): first\n" +
+	"e8d3ffab552895c19b9fcf7aa264d277cde33881 918c48b83bd081e863dbffe5a3d6ca6c8b3e7a6e John Doe <john@example.com> 1257894060 -0230\tcheckout: moving from master to feature\n" +
+	"918c48b83bd081e863dbffe5a3d6ca6c8b3e7a6e 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> 1257894120 +0000\n"
+
+func (s *ReflogSuite) TestDecode(c *C) {
+	entries, err := NewDecoder(strings.NewReader(fixture)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 3)
+
+	c.Assert(entries[0].Old, Equals, plumbing.ZeroHash)
+	c.Assert(entries[0].New, Equals, plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	c.Assert(entries[0].Committer.Name, Equals, "John Doe")
+	c.Assert(entries[0].Committer.Email, Equals, "john@example.com")
+	c.Assert(entries[0].Committer.When.Unix(), Equals, int64(1257894000))
+	c.Assert(entries[0].Message, Equals, "commit (initial): first")
+
+	_, offset := entries[1].Committer.When.Zone()
+	c.Assert(offset, Equals, -(2*60+30)*60)
+	c.Assert(entries[1].Message, Equals, "checkout: moving from master to feature")
+
+	c.Assert(entries[2].Message, Equals, "")
+}
+
+func (s *ReflogSuite) TestDecodeMalformed(c *C) {
+	for _, line := range []string{
+		"foo\n",
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe 1257894000 +0100\n",
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe <john@example.com> foo +0100\n",
+	} {
+		_, err := NewDecoder(strings.NewReader(line)).Decode()
+		c.Assert(err, Equals, ErrMalformedEntry)
+	}
+}
+
+func (s *ReflogSuite) TestEncode(c *C) {
+	entries, err := NewDecoder(strings.NewReader(fixture)).Decode()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf).Encode(entries...), IsNil)
+	c.Assert(buf.String(), Equals, fixture)
+}
+
+func (s *ReflogSuite) TestEncodeMultilineMessage(c *C) {
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(&Entry{
+		New: plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		Committer: Signature{
+			Name:  "John Doe",
+			Email: "john@example.com",
+			When:  time.Unix(1257894000, 0).In(time.UTC),
+		},
+		Message: "commit: first line\n\nsecond line\n",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "0000000000000000000000000000000000000000 "+
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe <john@example.com> "+
+		"1257894000 +0000\tcommit: first line second line\n",
+	)
+}
+
+func (s *ReflogSuite) TestRelink(c *C) {
+	a := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	b := plumbing.NewHash("918c48b83bd081e863dbffe5a3d6ca6c8b3e7a6e")
+	entries := []*Entry{{Old: b, New: a}, {New: b}}
+
+	Relink(entries)
+	c.Assert(entries[0].Old, Equals, plumbing.ZeroHash)
+	c.Assert(entries[1].Old, Equals, a)
+}
@@ -95,6 +95,13 @@ func (c *Change) PatchContext(ctx context.Context) (*Patch, error) {
 	return getPatchContext(ctx, "", c)
 }
 
+// PatchWithOptions returns a Patch with all the file changes in chunks,
+// computed with the given options. If opts is nil, the changes are computed
+// as PatchContext does. Provided context must be non-nil.
+func (c *Change) PatchWithOptions(ctx context.Context, opts *PatchOptions) (*Patch, error) {
+	return getPatchWithOptions(ctx, "", opts, c)
+}
+
 func (c *Change) name() string {
 	if c.From != empty {
 		return c.From.Name
@@ -157,3 +164,10 @@ func (c Changes) Patch() (*Patch, error) {
 func (c Changes) PatchContext(ctx context.Context) (*Patch, error) {
 	return getPatchContext(ctx, "", c...)
 }
+
+// PatchWithOptions returns a Patch with all the changes in chunks, computed
+// with the given options. If opts is nil, the changes are computed as
+// PatchContext does. Provided context must be non-nil.
+func (c Changes) PatchWithOptions(ctx context.Context, opts *PatchOptions) (*Patch, error) {
+	return getPatchWithOptions(ctx, "", opts, c...)
+}
@@ -98,6 +98,27 @@ func (c *Commit) PatchContext(ctx context.Context, to *Commit) (*Patch, error) {
 	return fromTree.PatchContext(ctx, toTree)
 }
 
+// PatchWithOptions returns the Patch between the actual commit and the
+// provided one, with the changes of the files computed with the given options.
+// If opts is nil, the changes are computed as PatchContext does. Error will be
+// return if context expires. Provided context must be non-nil.
+func (c *Commit) PatchWithOptions(ctx context.Context, to *Commit, opts *PatchOptions) (*Patch, error) {
+	fromTree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var toTree *Tree
+	if to != nil {
+		toTree, err = to.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fromTree.PatchWithOptions(ctx, toTree, opts)
+}
+
 // Patch returns the Patch between the actual commit and the provided one.
 //
 // NOTE: Since version 5.1.0 the renames are correctly handled, the settings
@@ -0,0 +1,57 @@
+package object
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+type commitFilterIter struct {
+	sourceIter CommitIter
+	isValid    CommitFilter
+}
+
+// NewCommitFilterIterFromIter returns a commit iterator which returns the
+// commits of the given iterator validating the passed CommitFilter.
+func NewCommitFilterIterFromIter(commitIter CommitIter, isValid CommitFilter) CommitIter {
+	return &commitFilterIter{
+		sourceIter: commitIter,
+		isValid:    isValid,
+	}
+}
+
+func (c *commitFilterIter) Next() (*Commit, error) {
+	for {
+		commit, err := c.sourceIter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if c.isValid(commit) {
+			return commit, nil
+		}
+	}
+}
+
+func (c *commitFilterIter) ForEach(cb func(*Commit) error) error {
+	for {
+		commit, nextErr := c.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nextErr
+		}
+		err := cb(commit)
+		if err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *commitFilterIter) Close() {
+	c.sourceIter.Close()
+}
@@ -0,0 +1,75 @@
+package object
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+type commitFirstParentIterator struct {
+	seen map[plumbing.Hash]bool
+	next *Commit
+}
+
+// NewCommitFirstParentIter returns a CommitIter that walks the commit history,
+// starting at the given commit and following only the first parent of each
+// commit, as `git log --first-parent` does. Ignore allows to stop the walk at
+// some commits, which are not iterated.
+func NewCommitFirstParentIter(c *Commit, ignore []plumbing.Hash) CommitIter {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range ignore {
+		seen[h] = true
+	}
+
+	return &commitFirstParentIterator{
+		seen: seen,
+		next: c,
+	}
+}
+
+func (w *commitFirstParentIterator) Next() (*Commit, error) {
+	c := w.next
+	if c == nil || w.seen[c.Hash] {
+		w.next = nil
+		return nil, io.EOF
+	}
+
+	w.seen[c.Hash] = true
+	w.next = nil
+
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+
+		w.next = parent
+	}
+
+	return c, nil
+}
+
+func (w *commitFirstParentIterator) ForEach(cb func(*Commit) error) error {
+	for {
+		c, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cb(c)
+		if err == storer.ErrStop {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *commitFirstParentIterator) Close() {}
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// CommitFollowIter is a CommitIter returning the commits changing a file,
+// following the file across renames.
+type CommitFollowIter struct {
+	sourceIter CommitIter
+	// path is the path of the file in the commits not returned yet
+	path string
+	// current is the path of the file in the last commit returned
+	current string
+}
+
+// NewCommitFollowIterFromIter returns a commit iterator which returns the
+// commits of the given iterator changing the file at the given path, as
+// `git log --follow` does. When a commit adds the file, the renames between
+// the commit and its first parent are detected and the file is followed under
+// its previous name in the next commits. A merge commit is returned only if
+// the file differs from all its parents.
+func NewCommitFollowIterFromIter(path string, commitIter CommitIter) *CommitFollowIter {
+	return &CommitFollowIter{
+		sourceIter: commitIter,
+		path:       path,
+	}
+}
+
+// Path returns the path of the file in the last commit returned by Next.
+func (c *CommitFollowIter) Path() string {
+	return c.current
+}
+
+func (c *CommitFollowIter) Next() (*Commit, error) {
+	for {
+		commit, err := c.sourceIter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		changed, from, err := c.change(commit)
+		if err != nil {
+			return nil, err
+		}
+
+		if !changed {
+			continue
+		}
+
+		c.current = c.path
+		if from != "" {
+			c.path = from
+		}
+
+		return commit, nil
+	}
+}
+
+// change reports whether the commit changes the followed file and, if it was
+// renamed by the commit, its previous path.
+func (c *CommitFollowIter) change(commit *Commit) (bool, string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, "", err
+	}
+
+	h, err := treeEntryHash(tree, c.path)
+	if err != nil {
+		return false, "", err
+	}
+
+	if commit.NumParents() == 0 {
+		return !h.IsZero(), "", nil
+	}
+
+	var firstTree *Tree
+	var firstHash plumbing.Hash
+	var unchanged bool
+	err = commit.Parents().ForEach(func(p *Commit) error {
+		ptree, err := p.Tree()
+		if err != nil {
+			return err
+		}
+
+		ph, err := treeEntryHash(ptree, c.path)
+		if err != nil {
+			return err
+		}
+
+		if firstTree == nil {
+			firstTree, firstHash = ptree, ph
+		}
+
+		if ph == h {
+			unchanged = true
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil || unchanged {
+		return false, "", err
+	}
+
+	if h.IsZero() || !firstHash.IsZero() {
+		return true, "", nil
+	}
+
+	changes, err := DiffTreeWithOptions(context.Background(), firstTree, tree, DefaultDiffTreeOptions)
+	if err != nil {
+		return false, "", err
+	}
+
+	for _, change := range changes {
+		if change.To.Name == c.path && change.From.Name != "" {
+			return true, change.From.Name, nil
+		}
+	}
+
+	return true, "", nil
+}
+
+// treeEntryHash returns the hash of the entry at the given path of the tree,
+// or the zero hash if there is none.
+func treeEntryHash(t *Tree, path string) (plumbing.Hash, error) {
+	e, err := t.FindEntry(path)
+	switch err {
+	case nil:
+		return e.Hash, nil
+	case ErrEntryNotFound, ErrDirectoryNotFound:
+		return plumbing.ZeroHash, nil
+	default:
+		return plumbing.ZeroHash, err
+	}
+}
+
+func (c *CommitFollowIter) ForEach(cb func(*Commit) error) error {
+	for {
+		commit, nextErr := c.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nextErr
+		}
+		err := cb(commit)
+		if err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CommitFollowIter) Close() {
+	c.sourceIter.Close()
+}
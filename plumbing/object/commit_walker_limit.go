@@ -10,11 +10,19 @@ import (
 type commitLimitIter struct {
 	sourceIter   CommitIter
 	limitOptions LogLimitOptions
+	skipped      int
+	count        int
 }
 
 type LogLimitOptions struct {
 	Since *time.Time
 	Until *time.Time
+	// Skip is the number of matching commits skipped before the first one
+	// returned.
+	Skip int
+	// MaxCount is the maximum number of commits returned, when positive.
+	// Once reached, the source iterator isn't walked anymore.
+	MaxCount int
 }
 
 func NewCommitLimitIterFromIter(commitIter CommitIter, limitOptions LogLimitOptions) CommitIter {
@@ -25,6 +33,10 @@ func NewCommitLimitIterFromIter(commitIter CommitIter, limitOptions LogLimitOpti
 }
 
 func (c *commitLimitIter) Next() (*Commit, error) {
+	if c.limitOptions.MaxCount > 0 && c.count >= c.limitOptions.MaxCount {
+		return nil, io.EOF
+	}
+
 	for {
 		commit, err := c.sourceIter.Next()
 		if err != nil {
@@ -37,6 +49,12 @@ func (c *commitLimitIter) Next() (*Commit, error) {
 		if c.limitOptions.Until != nil && commit.Committer.When.After(*c.limitOptions.Until) {
 			continue
 		}
+		if c.skipped < c.limitOptions.Skip {
+			c.skipped++
+			continue
+		}
+
+		c.count++
 		return commit, nil
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"strings"
 
@@ -21,12 +22,47 @@ var (
 	ErrCanceled = errors.New("operation canceled")
 )
 
+// PatchOptions describes how the changes of the files of a Patch are computed.
+type PatchOptions struct {
+	// Algorithm is the line diff algorithm, as the diff.algorithm option of
+	// git.
+	Algorithm diff.Algorithm
+	// IndentHeuristic moves the groups of changed lines that can slide to the
+	// position that makes them easier to read, as the diff.indentHeuristic
+	// option of git.
+	IndentHeuristic bool
+	// IgnoreSpaceChange ignores the changes in the amount of whitespace, as
+	// git diff --ignore-space-change (-b).
+	IgnoreSpaceChange bool
+	// IgnoreAllSpace ignores the whitespace when comparing lines, as git diff
+	// --ignore-all-space (-w).
+	IgnoreAllSpace bool
+	// IgnoreBlankLines ignores the changes whose lines are all blank, as git
+	// diff --ignore-blank-lines: they are only encoded when they are close
+	// to other changes.
+	IgnoreBlankLines bool
+	// IgnoreCRAtEOL ignores the carriage returns at the end of the lines, as
+	// git diff --ignore-cr-at-eol.
+	IgnoreCRAtEOL bool
+}
+
+// DefaultPatchOptions are the options used by git by default: Myers with the
+// indent heuristic.
+var DefaultPatchOptions = &PatchOptions{
+	Algorithm:       diff.Myers,
+	IndentHeuristic: true,
+}
+
 func getPatch(message string, changes ...*Change) (*Patch, error) {
 	ctx := context.Background()
 	return getPatchContext(ctx, message, changes...)
 }
 
 func getPatchContext(ctx context.Context, message string, changes ...*Change) (*Patch, error) {
+	return getPatchWithOptions(ctx, message, nil, changes...)
+}
+
+func getPatchWithOptions(ctx context.Context, message string, opts *PatchOptions, changes ...*Change) (*Patch, error) {
 	var filePatches []fdiff.FilePatch
 	for _, c := range changes {
 		select {
@@ -35,7 +71,7 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 		default:
 		}
 
-		fp, err := filePatchWithContext(ctx, c)
+		fp, err := filePatchWithOptions(ctx, c, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -47,6 +83,10 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 }
 
 func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, error) {
+	return filePatchWithOptions(ctx, c, nil)
+}
+
+func filePatchWithOptions(ctx context.Context, c *Change, opts *PatchOptions) (fdiff.FilePatch, error) {
 	from, to, err := c.Files()
 	if err != nil {
 		return nil, err
@@ -62,10 +102,25 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 	}
 
 	if fIsBinary || tIsBinary {
-		return &textFilePatch{from: c.From, to: c.To}, nil
+		return &binaryFilePatch{
+			textFilePatch: textFilePatch{from: c.From, to: c.To},
+			fromFile:      from,
+			toFile:        to,
+		}, nil
 	}
 
-	diffs := diff.Do(fromContent, toContent)
+	var diffs []dmp.Diff
+	if opts == nil {
+		diffs = diff.Do(fromContent, toContent)
+	} else {
+		diffs = diff.DoWithOptions(fromContent, toContent, &diff.Options{
+			Algorithm:         opts.Algorithm,
+			IndentHeuristic:   opts.IndentHeuristic,
+			IgnoreSpaceChange: opts.IgnoreSpaceChange,
+			IgnoreAllSpace:    opts.IgnoreAllSpace,
+			IgnoreCRAtEOL:     opts.IgnoreCRAtEOL,
+		})
+	}
 
 	var chunks []fdiff.Chunk
 	for _, d := range diffs {
@@ -85,7 +140,11 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 			op = fdiff.Add
 		}
 
-		chunks = append(chunks, &textChunk{d.Text, op})
+		chunks = append(chunks, &textChunk{content: d.Text, op: op})
+	}
+
+	if opts != nil && opts.IgnoreBlankLines {
+		markBlankChanges(chunks, opts.IgnoreSpaceChange || opts.IgnoreAllSpace || opts.IgnoreCRAtEOL)
 	}
 
 	return &textFilePatch{
@@ -206,10 +265,78 @@ func (tf *textFilePatch) Chunks() []fdiff.Chunk {
 	return tf.chunks
 }
 
-// textChunk is an implementation of fdiff.Chunk interface
+// binaryFilePatch is an implementation of fdiff.BinaryFilePatch interface
+type binaryFilePatch struct {
+	textFilePatch
+	fromFile, toFile *File
+}
+
+func (bf *binaryFilePatch) BinaryContents() (from, to []byte, err error) {
+	if from, err = binaryContent(bf.fromFile); err != nil {
+		return nil, nil, err
+	}
+
+	to, err = binaryContent(bf.toFile)
+	return from, to, err
+}
+
+func binaryContent(f *File) ([]byte, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// markBlankChanges marks as ignorable the groups of consecutive added and
+// deleted chunks whose lines are all blank. A blank line is an empty line, or
+// a line holding only whitespace if the whitespace is ignored, as in git.
+func markBlankChanges(chunks []fdiff.Chunk, ignoreSpace bool) {
+	for i := 0; i < len(chunks); {
+		if chunks[i].Type() == fdiff.Equal {
+			i++
+			continue
+		}
+
+		j, blank := i, true
+		for ; j < len(chunks) && chunks[j].Type() != fdiff.Equal; j++ {
+			blank = blank && isBlank(chunks[j].Content(), ignoreSpace)
+		}
+
+		for ; i < j; i++ {
+			chunks[i].(*textChunk).ignorable = blank
+		}
+	}
+}
+
+func isBlank(content string, ignoreSpace bool) bool {
+	for _, l := range strings.SplitAfter(content, "\n") {
+		if ignoreSpace {
+			l = strings.TrimSpace(l)
+		} else {
+			l = strings.TrimSuffix(l, "\n")
+		}
+
+		if l != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// textChunk is an implementation of fdiff.Chunk and fdiff.IgnorableChunk
+// interfaces
 type textChunk struct {
-	content string
-	op      fdiff.Operation
+	content   string
+	op        fdiff.Operation
+	ignorable bool
 }
 
 func (t *textChunk) Content() string {
@@ -220,6 +347,10 @@ func (t *textChunk) Type() fdiff.Operation {
 	return t.op
 }
 
+func (t *textChunk) Ignorable() bool {
+	return t.ignorable
+}
+
 // FileStat stores the status of changes in content of a file.
 type FileStat struct {
 	Name     string
@@ -313,15 +444,17 @@ func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 			// File is deleted.
 			cs.Name = from.Path()
 		} else if from.Path() != to.Path() {
-			// File is renamed. Not supported.
-			// cs.Name = fmt.Sprintf("%s => %s", from.Path(), to.Path())
+			// File is renamed.
+			cs.Name = fmt.Sprintf("%s => %s", from.Path(), to.Path())
 		} else {
 			cs.Name = from.Path()
 		}
 
-		for _, chunk := range fp.Chunks() {
+		// the changes left out of the patch are not counted, as in git
+		ignored := fdiff.IgnoredChunks(fp.Chunks(), fdiff.DefaultContextLines)
+		for i, chunk := range fp.Chunks() {
 			s := chunk.Content()
-			if len(s) == 0 {
+			if len(s) == 0 || (ignored != nil && ignored[i]) {
 				continue
 			}
 
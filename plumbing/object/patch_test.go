@@ -1,9 +1,16 @@
 package object
 
 import (
+	"context"
+	"strings"
+
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/diff"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
 	. "gopkg.in/check.v1"
@@ -45,3 +52,150 @@ func (s *PatchSuite) TestStatsWithSubmodules(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(p, NotNil)
 }
+
+func (s *PatchSuite) newTree(c *C, sto *memory.Storage, name, content string) *Tree {
+	blob := sto.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h, err := sto.SetEncodedObject(blob)
+	c.Assert(err, IsNil)
+
+	tree := &Tree{Entries: []TreeEntry{{Name: name, Mode: filemode.Regular, Hash: h}}}
+	obj := sto.NewEncodedObject()
+	c.Assert(tree.Encode(obj), IsNil)
+	h, err = sto.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+
+	tree, err = GetTree(sto, h)
+	c.Assert(err, IsNil)
+	return tree
+}
+
+func (s *PatchSuite) TestPatchWithOptions(c *C) {
+	fib := "int fib(int n)\n{\n    return fib(n - 1) + fib(n - 2);\n}\n\n"
+	frob := "int frob(int foo)\n{\n    printf(\"%d\\n\", foo);\n}\n\n"
+	main := "int main()\n{\n    frob(fib(10));\n}\n"
+
+	sto := memory.NewStorage()
+	from := s.newTree(c, sto, "main.c", fib+frob+main)
+	to := s.newTree(c, sto, "main.c", frob+fib+main)
+
+	patch, err := from.PatchWithOptions(context.Background(), to, &PatchOptions{
+		Algorithm: diff.Histogram,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(patch.String(), Equals, `diff --git a/main.c b/main.c
+index e3ab30a5c24d5d13bdb179699b0b24ef44e87142..c0df3404ef90f1b4a5608b23a9a8312f64b166c0 100644
+--- a/main.c
++++ b/main.c
+@@ -1,13 +1,13 @@
+-int fib(int n)
+-{
+-    return fib(n - 1) + fib(n - 2);
+-}
+-
+ int frob(int foo)
+ {
+     printf("%d\n", foo);
+ }
+ 
++int fib(int n)
++{
++    return fib(n - 1) + fib(n - 2);
++}
++
+ int main()
+ {
+     frob(fib(10));
+`)
+
+	patch, err = from.PatchWithOptions(context.Background(), to, nil)
+	c.Assert(err, IsNil)
+	expected, err := from.Patch(to)
+	c.Assert(err, IsNil)
+	c.Assert(patch.String(), Equals, expected.String())
+}
+
+func (s *PatchSuite) TestPatchWithOptionsIgnoreWhitespace(c *C) {
+	sto := memory.NewStorage()
+	from := s.newTree(c, sto, "f", "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n")
+	to := s.newTree(c, sto, "f", "a\n\nb\nc\nd \ne\nF\ng\n\nh\ni\nj\nk\n\nl\n")
+
+	patch, err := from.PatchWithOptions(context.Background(), to, &PatchOptions{
+		IgnoreBlankLines: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(patch.String(), Equals, `diff --git a/f b/f
+index 2f0b8ee0f0647e8387aa3ebbef12dba996535b56..e0b1136cc1aa162f2c0e13a9222e2bb1385dbbf5 100644
+--- a/f
++++ b/f
+@@ -1,10 +1,12 @@
+ a
++
+ b
+ c
+-d
++d 
+ e
+-f
++F
+ g
++
+ h
+ i
+ j
+`)
+	c.Assert(patch.Stats()[0].Addition, Equals, 4)
+	c.Assert(patch.Stats()[0].Deletion, Equals, 2)
+
+	patch, err = from.PatchWithOptions(context.Background(), to, &PatchOptions{
+		IgnoreBlankLines:  true,
+		IgnoreSpaceChange: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(strings.SplitAfterN(patch.String(), "\n", 5)[4], Equals, `@@ -3,8 +4,9 @@ b
+ c
+ d 
+ e
+-f
++F
+ g
++
+ h
+ i
+ j
+`)
+	c.Assert(patch.Stats()[0].Addition, Equals, 2)
+	c.Assert(patch.Stats()[0].Deletion, Equals, 1)
+
+	patch, err = from.PatchWithOptions(context.Background(), to, &PatchOptions{
+		IgnoreAllSpace: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(patch.Stats()[0].Addition, Equals, 4)
+	c.Assert(patch.Stats()[0].Deletion, Equals, 1)
+}
+
+func (s *PatchSuite) TestPatchBinaryContents(c *C) {
+	sto := memory.NewStorage()
+	from := s.newTree(c, sto, "data", "foo\x00")
+	to := s.newTree(c, sto, "data", "bar\x00")
+
+	patch, err := from.Patch(to)
+	c.Assert(err, IsNil)
+	c.Assert(patch.FilePatches(), HasLen, 1)
+
+	fp, ok := patch.FilePatches()[0].(fdiff.BinaryFilePatch)
+	c.Assert(ok, Equals, true)
+	c.Assert(fp.IsBinary(), Equals, true)
+
+	fromContent, toContent, err := fp.BinaryContents()
+	c.Assert(err, IsNil)
+	c.Assert(string(fromContent), Equals, "foo\x00")
+	c.Assert(string(toContent), Equals, "bar\x00")
+}
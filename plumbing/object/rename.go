@@ -353,8 +353,15 @@ func changeMode(c *Change) filemode.FileMode {
 	return c.From.TreeEntry.Mode
 }
 
+// sameMode returns true if the changes are of the same type of file, the
+// regular and executable files being of the same type, as in git.
 func sameMode(a, b *Change) bool {
-	return changeMode(a) == changeMode(b)
+	ma, mb := changeMode(a), changeMode(b)
+	return ma == mb || isRegularFile(ma) && isRegularFile(mb)
+}
+
+func isRegularFile(m filemode.FileMode) bool {
+	return m.IsRegular() || m == filemode.Executable
 }
 
 func groupChangesByHash(changes []*Change) map[plumbing.Hash][]*Change {
@@ -416,7 +423,7 @@ func buildSimilarityMatrix(srcs, dsts []*Change, renameScore int) (similarityMat
 	// later find the best matches.
 outerLoop:
 	for srcIdx, src := range srcs {
-		if changeMode(src) != filemode.Regular {
+		if !isRegularFile(changeMode(src)) {
 			continue
 		}
 
@@ -429,7 +436,7 @@ outerLoop:
 		var s *similarityIndex
 		var err error
 		for dstIdx, dst := range dsts {
-			if changeMode(dst) != filemode.Regular {
+			if !isRegularFile(changeMode(dst)) {
 				continue
 			}
 
@@ -514,6 +521,26 @@ outerLoop:
 	return matrix, nil
 }
 
+// FileSimilarity returns the similarity of the contents of the files, from 0
+// to 100, as the similarity index shown by git for the renamed files.
+func FileSimilarity(from, to *File) (int, error) {
+	if from.Hash == to.Hash {
+		return 100, nil
+	}
+
+	src, err := fileSimilarityIndex(from)
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := fileSimilarityIndex(to)
+	if err != nil {
+		return 0, err
+	}
+
+	return src.score(dst, 100), nil
+}
+
 func compactChanges(changes []*Change) []*Change {
 	var result []*Change
 	for _, c := range changes {
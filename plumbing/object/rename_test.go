@@ -144,6 +144,16 @@ func (s *RenameSuite) TestExactRename_UnstagedFile(c *C) {
 	assertRename(c, changes[0], changes[1], result[0])
 }
 
+func (s *RenameSuite) TestExactRename_ModeChange(c *C) {
+	changes := Changes{
+		makeAdd(c, makeFile(c, pathA, filemode.Executable, "foo")),
+		makeDelete(c, makeFile(c, pathQ, filemode.Regular, "foo")),
+	}
+
+	result := detectRenames(c, changes, nil, 1)
+	assertRename(c, changes[1], changes[0], result[0])
+}
+
 func (s *RenameSuite) TestContentRename_OnePair(c *C) {
 	changes := Changes{
 		makeAdd(c, makeFile(c, pathA, filemode.Regular, "foo\nbar\nbaz\nblarg\n")),
@@ -432,6 +442,19 @@ func (s *SimilarityIndexSuite) TestSimilarity75(c *C) {
 	c.Assert(dst.score(src, 100), Equals, 75)
 }
 
+func (s *SimilarityIndexSuite) TestFileSimilarity(c *C) {
+	a := makeFile(c, pathA, filemode.Regular, "foo\nbar\nbaz\nblarg\n")
+	b := makeFile(c, pathB, filemode.Regular, "foo\nbar\nbaz\nblah\n")
+
+	score, err := FileSimilarity(a, a)
+	c.Assert(err, IsNil)
+	c.Assert(score, Equals, 100)
+
+	score, err = FileSimilarity(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(score, Equals, 66)
+}
+
 func keyFor(c *C, line string) int {
 	idx := newSimilarityIndex()
 	err := idx.hashContent(strings.NewReader(line), int64(len(line)), false)
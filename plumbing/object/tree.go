@@ -339,6 +339,19 @@ func (t *Tree) PatchContext(ctx context.Context, to *Tree) (*Patch, error) {
 	return changes.PatchContext(ctx)
 }
 
+// PatchWithOptions returns a Patch with all the changes between trees in
+// chunks, computed with the given options, as the diff.algorithm and
+// diff.indentHeuristic options of git. If opts is nil, the changes are
+// computed as PatchContext does. Provided context must be non-nil.
+func (t *Tree) PatchWithOptions(ctx context.Context, to *Tree, opts *PatchOptions) (*Patch, error) {
+	changes, err := t.DiffContext(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes.PatchWithOptions(ctx, opts)
+}
+
 // treeEntryIter facilitates iterating through the TreeEntry objects in a Tree.
 type treeEntryIter struct {
 	t   *Tree
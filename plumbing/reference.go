@@ -124,8 +124,13 @@ func (r ReferenceName) Short() string {
 }
 
 const (
-	HEAD   ReferenceName = "HEAD"
-	Master ReferenceName = "refs/heads/master"
+	HEAD           ReferenceName = "HEAD"
+	Master         ReferenceName = "refs/heads/master"
+	MergeHead      ReferenceName = "MERGE_HEAD"
+	OrigHead       ReferenceName = "ORIG_HEAD"
+	CherryPickHead ReferenceName = "CHERRY_PICK_HEAD"
+	RevertHead     ReferenceName = "REVERT_HEAD"
+	RebaseHead     ReferenceName = "REBASE_HEAD"
 )
 
 // Reference is a representation of git reference
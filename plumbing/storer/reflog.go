@@ -0,0 +1,120 @@
+package storer
+
+import (
+	"errors"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+)
+
+// ErrReflogEntryNotFound is returned by DeleteReflogEntry when the reflog
+// has no entry at the given position.
+var ErrReflogEntryNotFound = errors.New("reflog entry not found")
+
+// ReflogStorer is a storage of reflogs, the history of the values taken by
+// each reference. It's an optional interface of the storers implementing
+// ReferenceStorer; the entries are not added by SetReference, but by the
+// callers updating the references.
+type ReflogStorer interface {
+	// AppendReflog adds the given entry to the reflog of the given
+	// reference, creating the reflog if it doesn't exist.
+	AppendReflog(plumbing.ReferenceName, *reflog.Entry) error
+	// IterReflog returns an iterator over the entries of the reflog of the
+	// given reference, the newest first. The iterator is empty if the
+	// reference has no reflog.
+	IterReflog(plumbing.ReferenceName) (ReflogIter, error)
+	// ExpireReflog removes from the reflog of the given reference the entries
+	// for which the given function returns true. The old hashes of the
+	// remaining entries are updated to keep the reflog consistent.
+	ExpireReflog(plumbing.ReferenceName, func(*reflog.Entry) bool) error
+	// DeleteReflogEntry removes the entry at the given position of the reflog
+	// of the given reference, 0 being the newest entry as in git's
+	// <ref>@{<n>} notation. The old hash of the following entry is updated to
+	// keep the reflog consistent. ErrReflogEntryNotFound is returned if
+	// there is no such entry.
+	DeleteReflogEntry(plumbing.ReferenceName, int) error
+	// RemoveReflog removes the whole reflog of the given reference.
+	RemoveReflog(plumbing.ReferenceName) error
+}
+
+// ReflogIter is a generic closable interface for iterating over reflog
+// entries.
+type ReflogIter interface {
+	Next() (*reflog.Entry, error)
+	ForEach(func(*reflog.Entry) error) error
+	Close()
+}
+
+// ReflogSliceIter implements ReflogIter. It iterates over a series of reflog
+// entries stored in a slice and yields each one in turn when Next() is
+// called.
+//
+// The ReflogSliceIter must be closed with a call to Close() when it is no
+// longer needed.
+type ReflogSliceIter struct {
+	series []*reflog.Entry
+	pos    int
+}
+
+// NewReflogSliceIter returns a reflog iterator for the given slice of
+// entries.
+func NewReflogSliceIter(series []*reflog.Entry) ReflogIter {
+	return &ReflogSliceIter{
+		series: series,
+	}
+}
+
+// Next returns the next entry from the iterator. If the iterator has reached
+// the end it will return io.EOF as an error.
+func (iter *ReflogSliceIter) Next() (*reflog.Entry, error) {
+	if iter.pos >= len(iter.series) {
+		return nil, io.EOF
+	}
+
+	e := iter.series[iter.pos]
+	iter.pos++
+	return e, nil
+}
+
+// ForEach call the cb function for each entry contained on this iter until
+// an error happens or the end of the iter is reached. If ErrStop is sent
+// the iteration is stop but no error is returned. The iterator is closed.
+func (iter *ReflogSliceIter) ForEach(cb func(*reflog.Entry) error) error {
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := cb(e); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Close releases any resources used by the iterator.
+func (iter *ReflogSliceIter) Close() {
+	iter.pos = len(iter.series)
+}
+
+// ReverseReflog returns the given reflog entries in reverse order, turning
+// the order of the reflog files, the oldest first, into the order of
+// ReflogIter, the newest first.
+func ReverseReflog(entries []*reflog.Entry) []*reflog.Entry {
+	reversed := make([]*reflog.Entry, len(entries))
+	for i, e := range entries {
+		reversed[len(entries)-1-i] = e
+	}
+
+	return reversed
+}
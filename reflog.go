@@ -0,0 +1,220 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// reflogWriter updates references recording the changes in their reflogs, when
+// the storer implements storer.ReflogStorer. Following git, the reflogs are
+// kept for HEAD, the branches, the remote-tracking branches and the notes,
+// unless core.logAllRefUpdates is false, which is the default for bare
+// repositories, or "always", in which case every reference is logged.
+type reflogWriter struct {
+	s         storage.Storer
+	committer *object.Signature
+	mode      string
+}
+
+// newReflogWriter returns a reflogWriter for the given storer, configured by
+// its config and by the given global and system configs. The entries are
+// recorded using the given committer, or the identity configured for the
+// repository if nil.
+func newReflogWriter(s storage.Storer, scoped []*config.Config, committer *object.Signature) (*reflogWriter, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	scoped = append([]*config.Config{cfg}, scoped...)
+	w := &reflogWriter{s: s, committer: committer, mode: "true"}
+	if cfg.Core.IsBare {
+		w.mode = "false"
+	}
+
+	for i := len(scoped) - 1; i >= 0; i-- {
+		if mode := scoped[i].Raw.Section("core").Option("logallrefupdates"); mode != "" {
+			w.mode = strings.ToLower(mode)
+		}
+	}
+
+	if w.committer == nil {
+		w.committer = reflogIdentity(scoped)
+	}
+
+	return w, nil
+}
+
+// loadScopedConfigs loads the global and system configs, in this order,
+// leaving out the ones that can't be loaded.
+func loadScopedConfigs() []*config.Config {
+	var scoped []*config.Config
+	for _, scope := range []config.Scope{config.GlobalScope, config.SystemScope} {
+		if c, err := config.LoadConfig(scope); err == nil {
+			scoped = append(scoped, c)
+		}
+	}
+
+	return scoped
+}
+
+// reflogIdentity returns the committer identity of the first configuration
+// defining one, falling back to the user identity.
+func reflogIdentity(scoped []*config.Config) *object.Signature {
+	for _, c := range scoped {
+		if c.Committer.Name != "" && c.Committer.Email != "" {
+			return &object.Signature{Name: c.Committer.Name, Email: c.Committer.Email}
+		}
+	}
+
+	for _, c := range scoped {
+		if c.User.Name != "" && c.User.Email != "" {
+			return &object.Signature{Name: c.User.Name, Email: c.User.Email}
+		}
+	}
+
+	return &object.Signature{}
+}
+
+// setReference sets the given reference and records the change in its
+// reflog with the given message. If old is not nil, the reference is only
+// updated if its current value matches it.
+func (w *reflogWriter) setReference(ref, old *plumbing.Reference, msg string) error {
+	from := resolvedHash(w.s, ref.Name())
+	if err := w.s.CheckAndSetReference(ref, old); err != nil {
+		return err
+	}
+
+	return w.log(ref.Name(), from, resolvedHash(w.s, ref.Name()), msg)
+}
+
+// removeReference removes the given reference, along with its reflog.
+func (w *reflogWriter) removeReference(name plumbing.ReferenceName) error {
+	if err := w.s.RemoveReference(name); err != nil {
+		return err
+	}
+
+	if rs, ok := w.s.(storer.ReflogStorer); ok {
+		return rs.RemoveReflog(name)
+	}
+
+	return nil
+}
+
+// log records the change of the given reference in its reflog, and in the one
+// of HEAD when HEAD points to it, as git does.
+func (w *reflogWriter) log(name plumbing.ReferenceName, from, to plumbing.Hash, msg string) error {
+	rs, ok := w.s.(storer.ReflogStorer)
+	if !ok || to.IsZero() {
+		return nil
+	}
+
+	e := &reflog.Entry{
+		Old: from,
+		New: to,
+		Committer: reflog.Signature{
+			Name:  w.committer.Name,
+			Email: w.committer.Email,
+			When:  w.committer.When,
+		},
+		Message: msg,
+	}
+
+	if e.Committer.When.IsZero() {
+		e.Committer.When = time.Now()
+	}
+
+	if w.shouldLog(name) {
+		if err := rs.AppendReflog(name, e); err != nil {
+			return err
+		}
+	}
+
+	if name == plumbing.HEAD || !w.shouldLog(plumbing.HEAD) {
+		return nil
+	}
+
+	head, err := w.s.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference || head.Target() != name {
+		return nil
+	}
+
+	return rs.AppendReflog(plumbing.HEAD, e)
+}
+
+func (w *reflogWriter) shouldLog(name plumbing.ReferenceName) bool {
+	switch w.mode {
+	case "always":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+
+	s := name.String()
+	return name == plumbing.HEAD ||
+		strings.HasPrefix(s, "refs/heads/") ||
+		strings.HasPrefix(s, "refs/remotes/") ||
+		strings.HasPrefix(s, "refs/notes/")
+}
+
+// resolvedHash returns the hash the given reference points to, or the zero
+// hash if it doesn't exist or can't be resolved.
+func resolvedHash(s storer.ReferenceStorer, name plumbing.ReferenceName) plumbing.Hash {
+	ref, err := storer.ResolveReference(s, name)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+
+	return ref.Hash()
+}
+
+// setReference sets the given reference in the repository, recording the
+// change in the reflogs with the given message and committer, or the
+// configured identity if nil.
+func (r *Repository) setReference(ref *plumbing.Reference, committer *object.Signature, msg string) error {
+	w, err := r.newReflogWriter(committer)
+	if err != nil {
+		return err
+	}
+
+	return w.setReference(ref, nil, msg)
+}
+
+// newReflogWriter returns a reflogWriter for the storer of the repository.
+func (r *Repository) newReflogWriter(committer *object.Signature) (*reflogWriter, error) {
+	return newReflogWriter(r.Storer, r.scopedConfigs(), committer)
+}
+
+// scopedConfigs returns the global and system configs, loaded by the first
+// call, so they are not read again for every reference updated.
+func (r *Repository) scopedConfigs() []*config.Config {
+	r.scopedOnce.Do(func() {
+		r.scoped = loadScopedConfigs()
+	})
+
+	return r.scoped
+}
+
+// refDescription describes the given reference in the reflog messages: the
+// short name of a branch or the hash of the commit.
+func refDescription(ref *plumbing.Reference) string {
+	if ref.Type() == plumbing.SymbolicReference {
+		return ref.Target().Short()
+	}
+
+	return ref.Hash().String()
+}
+
+// commitReflogMessage returns the reflog message of a commit with the given
+// message created by the given operation, such as "commit" or "cherry-pick".
+func commitReflogMessage(op, msg string) string {
+	return fmt.Sprintf("%s: %s", op, commitSubject(msg))
+}
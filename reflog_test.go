@@ -0,0 +1,148 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// reflogMessages returns the messages of the reflog of the given reference,
+// the newest first.
+func reflogMessages(c *C, r *Repository, name plumbing.ReferenceName) []string {
+	iter, err := r.Storer.(storer.ReflogStorer).IterReflog(name)
+	c.Assert(err, IsNil)
+
+	var msgs []string
+	err = iter.ForEach(func(e *reflog.Entry) error {
+		msgs = append(msgs, e.Message)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return msgs
+}
+
+func (s *RepositorySuite) TestReflogWorktreeOperations(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	first := commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	second := commitFiles(c, w, map[string]string{"foo": "bar\n"})
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	err = w.Checkout(&CheckoutOptions{Branch: feature, Create: true})
+	c.Assert(err, IsNil)
+
+	err = w.Reset(&ResetOptions{Commit: first, Mode: HardReset})
+	c.Assert(err, IsNil)
+
+	c.Assert(reflogMessages(c, r, plumbing.HEAD), DeepEquals, []string{
+		"reset: moving to " + first.String(),
+		"checkout: moving from master to feature",
+		"commit: changes",
+		"commit (initial): changes",
+	})
+
+	c.Assert(reflogMessages(c, r, plumbing.Master), DeepEquals, []string{
+		"commit: changes",
+		"commit (initial): changes",
+	})
+
+	c.Assert(reflogMessages(c, r, feature), DeepEquals, []string{
+		"reset: moving to " + first.String(),
+		"branch: Created from HEAD",
+	})
+
+	iter, err := r.Storer.(storer.ReflogStorer).IterReflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+
+	e, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(e.Old, Equals, second)
+	c.Assert(e.New, Equals, first)
+
+	err = r.Storer.RemoveReference(feature)
+	c.Assert(err, IsNil)
+	c.Assert(reflogMessages(c, r, feature), HasLen, 0)
+}
+
+func (s *RepositorySuite) TestReflogLogAllRefUpdates(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("core").SetOption("logallrefupdates", "false")
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+	_, err = w.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	c.Assert(reflogMessages(c, r, plumbing.HEAD), HasLen, 0)
+	c.Assert(reflogMessages(c, r, plumbing.Master), HasLen, 0)
+}
+
+func (s *RepositorySuite) TestReflogClone(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{URL: url})
+	c.Assert(err, IsNil)
+
+	c.Assert(reflogMessages(c, r, plumbing.Master), DeepEquals, []string{
+		"clone: from " + url,
+	})
+
+	c.Assert(reflogMessages(c, r, plumbing.NewRemoteReferenceName("origin", "master")), DeepEquals, []string{
+		"fetch: storing head",
+	})
+
+	// tags are not logged by default
+	c.Assert(reflogMessages(c, r, plumbing.NewTagReferenceName("v1.0.0")), HasLen, 0)
+}
+
+func (s *RepositorySuite) TestReflogFetch(c *C) {
+	dir, err := ioutil.TempDir("", "reflog-fetch")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	upstream, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+	uw, err := upstream.Worktree()
+	c.Assert(err, IsNil)
+	first := commitFiles(c, uw, map[string]string{"foo": "foo\n"})
+
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{URL: dir})
+	c.Assert(err, IsNil)
+
+	commitFiles(c, uw, map[string]string{"foo": "bar\n"})
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, IsNil)
+
+	err = uw.Reset(&ResetOptions{Commit: first, Mode: HardReset})
+	c.Assert(err, IsNil)
+	commitFiles(c, uw, map[string]string{"foo": "baz\n"})
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, IsNil)
+
+	c.Assert(reflogMessages(c, r, plumbing.NewRemoteReferenceName("origin", "master")), DeepEquals, []string{
+		"fetch: forced-update",
+		"fetch: fast-forward",
+		"fetch: storing head",
+	})
+}
@@ -44,6 +44,10 @@ const (
 type Remote struct {
 	c *config.RemoteConfig
 	s storage.Storer
+
+	// scopedConfigs returns the global and system configs used by the
+	// reflogs, loaded by each operation if nil.
+	scopedConfigs func() []*config.Config
 }
 
 // NewRemote creates a new Remote.
@@ -236,6 +240,11 @@ func (r *Remote) updateRemoteReferenceStorage(
 	result *packp.ReportStatus,
 ) error {
 
+	w, err := r.newReflogWriter()
+	if err != nil {
+		return err
+	}
+
 	for _, spec := range r.c.Fetch {
 		for _, c := range req.Commands {
 			if !spec.Match(c.Name) {
@@ -246,11 +255,11 @@ func (r *Remote) updateRemoteReferenceStorage(
 			ref := plumbing.NewHashReference(local, c.New)
 			switch c.Action() {
 			case packp.Create, packp.Update:
-				if err := r.s.SetReference(ref); err != nil {
+				if err := w.setReference(ref, nil, "update by push"); err != nil {
 					return err
 				}
 			case packp.Delete:
-				if err := r.s.RemoveReference(local); err != nil {
+				if err := w.removeReference(local); err != nil {
 					return err
 				}
 			}
@@ -833,6 +842,47 @@ func isFastForward(s storer.EncodedObjectStorer, old, new plumbing.Hash) (bool,
 	return found, err
 }
 
+func (r *Remote) newReflogWriter() (*reflogWriter, error) {
+	load := r.scopedConfigs
+	if load == nil {
+		load = loadScopedConfigs
+	}
+
+	return newReflogWriter(r.s, load(), nil)
+}
+
+// isRecentAncestor tells whether old is an ancestor of new, only walking the
+// commits of new committed after old. An ancestor committed with a clock skew
+// can be missed, so it's only used to describe the updates.
+func isRecentAncestor(s storer.EncodedObjectStorer, old, new plumbing.Hash) bool {
+	oc, err := object.GetCommit(s, old)
+	if err != nil {
+		return false
+	}
+
+	nc, err := object.GetCommit(s, new)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	iter := object.NewCommitIterCTime(nc, nil, nil)
+	_ = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash == old {
+			found = true
+			return storer.ErrStop
+		}
+
+		if c.Committer.When.Before(oc.Committer.When) {
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+
+	return found
+}
+
 func (r *Remote) newUploadPackRequest(o *FetchOptions,
 	ar *packp.AdvRefs) (*packp.UploadPackRequest, error) {
 
@@ -915,6 +965,11 @@ func (r *Remote) updateLocalReferenceStorage(
 	isWildcard := true
 	forceNeeded := false
 
+	w, err := r.newReflogWriter()
+	if err != nil {
+		return false, err
+	}
+
 	for _, spec := range specs {
 		if !spec.IsWildcard() {
 			isWildcard = false
@@ -933,21 +988,28 @@ func (r *Remote) updateLocalReferenceStorage(
 			old, _ := storer.ResolveReference(r.s, localName)
 			new := plumbing.NewHashReference(localName, ref.Hash())
 
-			// If the ref exists locally as a branch and force is not specified,
-			// only update if the new ref is an ancestor of the old
-			if old != nil && old.Name().IsBranch() && !force && !spec.IsForceUpdate() {
-				ff, err := isFastForward(r.s, old.Hash(), new.Hash())
-				if err != nil {
-					return updated, err
-				}
-
-				if !ff {
-					forceNeeded = true
-					continue
+			msg := "fetch: storing head"
+			if old != nil && old.Hash() != new.Hash() {
+				// If the ref exists locally as a branch and force is not
+				// specified, only update if the new ref is an ancestor of
+				// the old
+				msg = "fetch: fast-forward"
+				if old.Name().IsBranch() && !force && !spec.IsForceUpdate() {
+					ff, err := isFastForward(r.s, old.Hash(), new.Hash())
+					if err != nil {
+						return updated, err
+					}
+
+					if !ff {
+						forceNeeded = true
+						continue
+					}
+				} else if !isRecentAncestor(r.s, old.Hash(), new.Hash()) {
+					msg = "fetch: forced-update"
 				}
 			}
 
-			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(r.s, new, old)
+			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(w, new, old, msg)
 			if err != nil {
 				return updated, err
 			}
@@ -966,7 +1028,7 @@ func (r *Remote) updateLocalReferenceStorage(
 	if isWildcard {
 		tags = remoteRefs
 	}
-	tagUpdated, err := r.buildFetchedTags(tags)
+	tagUpdated, err := r.buildFetchedTags(w, tags)
 	if err != nil {
 		return updated, err
 	}
@@ -982,7 +1044,7 @@ func (r *Remote) updateLocalReferenceStorage(
 	return
 }
 
-func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, err error) {
+func (r *Remote) buildFetchedTags(w *reflogWriter, refs memory.ReferenceStorage) (updated bool, err error) {
 	for _, ref := range refs {
 		if !ref.Name().IsTag() {
 			continue
@@ -997,7 +1059,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 			return false, err
 		}
 
-		refUpdated, err := updateReferenceStorerIfNeeded(r.s, ref)
+		refUpdated, err := updateReferenceStorerIfNeeded(w, ref, "fetch: storing head")
 		if err != nil {
 			return updated, err
 		}
@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
@@ -30,6 +31,7 @@ import (
 	"golang.org/x/crypto/openpgp"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-billy/v5/osfs"
 )
 
@@ -67,6 +69,13 @@ type Repository struct {
 
 	r  map[string]*Remote
 	wt billy.Filesystem
+	// state holds the state of the operations in progress when the storer
+	// is not filesystem based.
+	state billy.Filesystem
+
+	// scoped holds the global and system configs used by the reflogs.
+	scoped     []*config.Config
+	scopedOnce sync.Once
 }
 
 // Init creates an empty git repository, based on the given Storer and worktree.
@@ -128,6 +137,26 @@ func setWorktreeAndStoragePaths(r *Repository, worktree billy.Filesystem) error
 	return setConfigWorktree(r, worktree, fs.Filesystem())
 }
 
+// stateFilesystem returns the filesystem where the state of long running
+// operations, such as a rebase, is persisted. For filesystem based storers it
+// is the .git directory, otherwise the state is kept in memory for the
+// lifetime of the Repository.
+func (r *Repository) stateFilesystem() billy.Filesystem {
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	if fs, ok := r.Storer.(fsBased); ok {
+		return fs.Filesystem()
+	}
+
+	if r.state == nil {
+		r.state = memfs.New()
+	}
+
+	return r.state
+}
+
 func createDotGitFile(worktree, storage billy.Filesystem) error {
 	path, err := filepath.Rel(worktree.Root(), storage.Root())
 	if err != nil {
@@ -550,7 +579,15 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, ErrRemoteNotFound
 	}
 
-	return NewRemote(r.Storer, c), nil
+	return r.newRemote(c), nil
+}
+
+// newRemote returns a Remote of the repository, sharing its global and
+// system configs.
+func (r *Repository) newRemote(c *config.RemoteConfig) *Remote {
+	remote := NewRemote(r.Storer, c)
+	remote.scopedConfigs = r.scopedConfigs
+	return remote
 }
 
 // Remotes returns a list with all the remotes
@@ -564,7 +601,7 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 
 	var i int
 	for _, c := range cfg.Remotes {
-		remotes[i] = NewRemote(r.Storer, c)
+		remotes[i] = r.newRemote(c)
 		i++
 	}
 
@@ -577,7 +614,7 @@ func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 		return nil, err
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	cfg, err := r.Config()
 	if err != nil {
@@ -603,7 +640,7 @@ func (r *Repository) CreateRemoteAnonymous(c *config.RemoteConfig) (*Remote, err
 		return nil, ErrAnonymousRemoteName
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	return remote, nil
 }
@@ -987,7 +1024,8 @@ func (r *Repository) fetchAndUpdateReferences(
 		return nil, err
 	}
 
-	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef)
+	msg := "clone: from " + remote.c.URLs[0]
+	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -1000,7 +1038,12 @@ func (r *Repository) fetchAndUpdateReferences(
 }
 
 func (r *Repository) updateReferences(spec []config.RefSpec,
-	resolvedRef *plumbing.Reference) (updated bool, err error) {
+	resolvedRef *plumbing.Reference, msg string) (updated bool, err error) {
+
+	w, err := r.newReflogWriter(nil)
+	if err != nil {
+		return false, err
+	}
 
 	if !resolvedRef.Name().IsBranch() {
 		// Detached HEAD mode
@@ -1009,7 +1052,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 			return false, err
 		}
 		head := plumbing.NewHashReference(plumbing.HEAD, h)
-		return updateReferenceStorerIfNeeded(r.Storer, head)
+		return updateReferenceStorerIfNeeded(w, head, msg)
 	}
 
 	refs := []*plumbing.Reference{
@@ -1022,7 +1065,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 	refs = append(refs, r.calculateRemoteHeadReference(spec, resolvedRef)...)
 
 	for _, ref := range refs {
-		u, err := updateReferenceStorerIfNeeded(r.Storer, ref)
+		u, err := updateReferenceStorerIfNeeded(w, ref, msg)
 		if err != nil {
 			return updated, err
 		}
@@ -1059,16 +1102,16 @@ func (r *Repository) calculateRemoteHeadReference(spec []config.RefSpec,
 }
 
 func checkAndUpdateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r, old *plumbing.Reference) (
+	w *reflogWriter, r, old *plumbing.Reference, msg string) (
 	updated bool, err error) {
-	p, err := s.Reference(r.Name())
+	p, err := w.s.Reference(r.Name())
 	if err != nil && err != plumbing.ErrReferenceNotFound {
 		return false, err
 	}
 
 	// we use the string method to compare references, is the easiest way
 	if err == plumbing.ErrReferenceNotFound || r.String() != p.String() {
-		if err := s.CheckAndSetReference(r, old); err != nil {
+		if err := w.setReference(r, old, msg); err != nil {
 			return false, err
 		}
 
@@ -1079,8 +1122,8 @@ func checkAndUpdateReferenceStorerIfNeeded(
 }
 
 func updateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r *plumbing.Reference) (updated bool, err error) {
-	return checkAndUpdateReferenceStorerIfNeeded(s, r, nil)
+	w *reflogWriter, r *plumbing.Reference, msg string) (updated bool, err error) {
+	return checkAndUpdateReferenceStorerIfNeeded(w, r, nil, msg)
 }
 
 // Fetch fetches references along with the objects necessary to complete
@@ -1143,39 +1186,76 @@ func (r *Repository) PushContext(ctx context.Context, o *PushOptions) error {
 
 // Log returns the commit history from the given LogOptions.
 func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
-	fn := commitIterFunc(o.Order)
+	it, _, err := r.logIter(o)
+	return it, err
+}
+
+// logIter returns the commits listed by Log with the given options, along
+// with their description.
+func (r *Repository) logIter(o *LogOptions) (object.CommitIter, *logWalk, error) {
+	fn := commitIterFunc(o.Order, o.FirstParent, nil)
 	if fn == nil {
-		return nil, fmt.Errorf("invalid Order=%v", o.Order)
+		return nil, nil, fmt.Errorf("invalid Order=%v", o.Order)
+	}
+
+	if o.Follow && o.FileName == nil {
+		return nil, nil, ErrFollowWithoutFileName
 	}
 
 	var (
 		it  object.CommitIter
+		lr  *logRange
 		err error
 	)
-	if o.All {
+	switch {
+	case o.isRange():
+		lr, err = r.logRange(o)
+		if err == nil {
+			it = lr.iter(r.Storer, o)
+		}
+	case o.All:
 		it, err = r.logAll(fn)
-	} else {
+	default:
 		it, err = r.log(o.From, fn)
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if o.FileName != nil {
-		// for `git log --all` also check parent (if the next commit comes from the real parent)
-		it = r.logWithFile(*o.FileName, it, o.All)
+	// when walking several histories, also check the parent of each commit
+	// (if the next commit comes from the real parent)
+	checkParent := o.All || lr != nil && len(lr.include) > 1
+	w := &logWalk{lr: lr}
+	if o.Follow {
+		it = w.follow(*o.FileName, it)
+	} else if o.FileName != nil {
+		it = r.logWithFile(*o.FileName, it, checkParent)
 	}
 	if o.PathFilter != nil {
-		it = r.logWithPathFilter(o.PathFilter, it, o.All)
+		it = r.logWithPathFilter(o.PathFilter, it, checkParent)
+	}
+
+	filter, err := r.logCommitFilter(o, lr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if filter != nil {
+		it = object.NewCommitFilterIterFromIter(it, filter)
 	}
 
-	if o.Since != nil || o.Until != nil {
-		limitOptions := object.LogLimitOptions{Since: o.Since, Until: o.Until}
+	if o.Since != nil || o.Until != nil || o.Skip > 0 || o.MaxCount > 0 {
+		limitOptions := object.LogLimitOptions{
+			Since:    o.Since,
+			Until:    o.Until,
+			Skip:     o.Skip,
+			MaxCount: o.MaxCount,
+		}
 		it = r.logWithLimit(it, limitOptions)
 	}
 
-	return it, nil
+	return it, w, nil
 }
 
 func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
@@ -1222,27 +1302,36 @@ func (*Repository) logWithLimit(commitIter object.CommitIter, limitOptions objec
 	return object.NewCommitLimitIterFromIter(commitIter, limitOptions)
 }
 
-func commitIterFunc(order LogOrder) func(c *object.Commit) object.CommitIter {
+// commitIterFunc returns a function walking the history of a commit in the
+// given order, or following only the first parents, skipping the ignored
+// commits and their history.
+func commitIterFunc(order LogOrder, firstParent bool, ignore []plumbing.Hash) func(c *object.Commit) object.CommitIter {
+	if firstParent && order >= LogOrderDefault && order <= LogOrderCommitterTime {
+		return func(c *object.Commit) object.CommitIter {
+			return object.NewCommitFirstParentIter(c, ignore)
+		}
+	}
+
 	switch order {
 	case LogOrderDefault:
 		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPreorderIter(c, nil, nil)
+			return object.NewCommitPreorderIter(c, nil, ignore)
 		}
 	case LogOrderDFS:
 		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPreorderIter(c, nil, nil)
+			return object.NewCommitPreorderIter(c, nil, ignore)
 		}
 	case LogOrderDFSPost:
 		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPostorderIter(c, nil)
+			return object.NewCommitPostorderIter(c, ignore)
 		}
 	case LogOrderBSF:
 		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitIterBSF(c, nil, nil)
+			return object.NewCommitIterBSF(c, nil, ignore)
 		}
 	case LogOrderCommitterTime:
 		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitIterCTime(c, nil, nil)
+			return object.NewCommitIterCTime(c, nil, ignore)
 		}
 	}
 	return nil
@@ -1431,11 +1520,21 @@ func (r *Repository) Worktree() (*Worktree, error) {
 	return &Worktree{r: r, Filesystem: r.wt}, nil
 }
 
-// ResolveRevision resolves revision to corresponding hash. It will always
-// resolve to a commit hash, not a tree or annotated tag.
+// ResolveRevision resolves revision to corresponding hash. Following git, the
+// revision is resolved to the object it names, but a revision naming an
+// annotated tag resolves to the object the tag points to, unless peeled with
+// ^{tag} or ^{object}.
 //
 // Implemented resolvers : HEAD, branch, tag, heads/branch, refs/heads/branch,
-// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}), hash (prefix and full)
+// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, hash
+// (prefix and full, ErrAmbiguousRevision being returned when a short hash
+// matches several objects), tilde and caret (HEAD~1, master~^, tag~2,
+// ref/heads/master~1, ...), peeling (v1.0^{tree}, HEAD^{blob}, v1.0^{tag},
+// v1.0^{}), selection by text (HEAD^{/fix nasty bug}, :/fix nasty bug),
+// reflog (master@{1}, @{1}, HEAD@{2016-12-16T21:42:47Z}), previous checkouts
+// (@{-1}), upstream and push branches (master@{upstream}, @{u}, @{push}),
+// paths in a tree (HEAD:README, master~1:dir) and in the index (:README,
+// :2:README)
 func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, error) {
 	p := revision.NewParserFromString(string(rev))
 
@@ -1445,131 +1544,12 @@ func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, err
 		return nil, err
 	}
 
-	var commit *object.Commit
-
-	for _, item := range items {
-		switch item := item.(type) {
-		case revision.Ref:
-			revisionRef := item
-
-			var tryHashes []plumbing.Hash
-
-			tryHashes = append(tryHashes, r.resolveHashPrefix(string(revisionRef))...)
-
-			for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
-				ref, err := storer.ResolveReference(r.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, revisionRef)))
-
-				if err == nil {
-					tryHashes = append(tryHashes, ref.Hash())
-					break
-				}
-			}
-
-			// in ambiguous cases, `git rev-parse` will emit a warning, but
-			// will always return the oid in preference to a ref; we don't have
-			// the ability to emit a warning here, so (for speed purposes)
-			// don't bother to detect the ambiguity either, just return in the
-			// priority that git would.
-			gotOne := false
-			for _, hash := range tryHashes {
-				commitObj, err := r.CommitObject(hash)
-				if err == nil {
-					commit = commitObj
-					gotOne = true
-					break
-				}
-
-				tagObj, err := r.TagObject(hash)
-				if err == nil {
-					// If the tag target lookup fails here, this most likely
-					// represents some sort of repo corruption, so let the
-					// error bubble up.
-					tagCommit, err := tagObj.Commit()
-					if err != nil {
-						return &plumbing.ZeroHash, err
-					}
-					commit = tagCommit
-					gotOne = true
-					break
-				}
-			}
-
-			if !gotOne {
-				return &plumbing.ZeroHash, plumbing.ErrReferenceNotFound
-			}
-
-		case revision.CaretPath:
-			depth := item.Depth
-
-			if depth == 0 {
-				break
-			}
-
-			iter := commit.Parents()
-
-			c, err := iter.Next()
-
-			if err != nil {
-				return &plumbing.ZeroHash, err
-			}
-
-			if depth == 1 {
-				commit = c
-
-				break
-			}
-
-			c, err = iter.Next()
-
-			if err != nil {
-				return &plumbing.ZeroHash, err
-			}
-
-			commit = c
-		case revision.TildePath:
-			for i := 0; i < item.Depth; i++ {
-				c, err := commit.Parents().Next()
-
-				if err != nil {
-					return &plumbing.ZeroHash, err
-				}
-
-				commit = c
-			}
-		case revision.CaretReg:
-			history := object.NewCommitPreorderIter(commit, nil, nil)
-
-			re := item.Regexp
-			negate := item.Negate
-
-			var c *object.Commit
-
-			err := history.ForEach(func(hc *object.Commit) error {
-				if !negate && re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
-
-				if negate && !re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
-
-				return nil
-			})
-			if err != nil {
-				return &plumbing.ZeroHash, err
-			}
-
-			if c == nil {
-				return &plumbing.ZeroHash, fmt.Errorf(`No commit message match regexp : "%s"`, re.String())
-			}
-
-			commit = c
-		}
+	h, err := r.resolveRevision(items)
+	if err != nil {
+		return &plumbing.ZeroHash, err
 	}
 
-	return &commit.Hash, nil
+	return &h, nil
 }
 
 // resolveHashPrefix returns a list of potential hashes that the given string
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +26,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -1888,6 +1890,262 @@ func (s *RepositorySuite) TestLogLimitWithOtherParamsPass(c *C) {
 	c.Assert(iterErr, Equals, io.EOF)
 }
 
+// logHashes returns the short hashes of the commits listed by Log.
+func logHashes(c *C, r *Repository, o *LogOptions) []string {
+	iter, err := r.Log(o)
+	c.Assert(err, IsNil)
+
+	var hashes []string
+	err = iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash.String()[:7])
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return hashes
+}
+
+func (s *RepositorySuite) TestLogRevisions(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	datas := []struct {
+		revisions []string
+		order     LogOrder
+		expected  []string
+	}{
+		{[]string{"branch..master"}, LogOrderDefault, []string{"6ecf0ef"}},
+		{[]string{"master..branch"}, LogOrderDefault, []string{"e8d3ffa"}},
+		{[]string{"..branch"}, LogOrderDefault, []string{"e8d3ffa"}},
+		{[]string{"master...branch"}, LogOrderCommitterTime, []string{"6ecf0ef", "e8d3ffa"}},
+		{[]string{"HEAD", "^af2d6a6"}, LogOrderDefault, []string{"6ecf0ef", "918c48b"}},
+		{[]string{"HEAD", "--not", "af2d6a6"}, LogOrderDefault, []string{"6ecf0ef", "918c48b"}},
+		{[]string{"--not", "^HEAD", "af2d6a6"}, LogOrderDefault, []string{"6ecf0ef", "918c48b"}},
+		{[]string{"master", "branch", "^HEAD~2"}, LogOrderCommitterTime, []string{"6ecf0ef", "e8d3ffa", "918c48b"}},
+		{[]string{"master", "branch", "^HEAD~2"}, LogOrderDFS, []string{"6ecf0ef", "918c48b", "e8d3ffa"}},
+		{[]string{"HEAD~4..HEAD"}, LogOrderCommitterTime, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "a5b8b09", "b8e471f",
+		}},
+		{[]string{"HEAD..HEAD~1"}, LogOrderDefault, nil},
+	}
+
+	for _, d := range datas {
+		hashes := logHashes(c, r, &LogOptions{Revisions: d.revisions, Order: d.order})
+		c.Assert(hashes, DeepEquals, d.expected, Commentf("while checking %v", d.revisions))
+	}
+
+	hashes := logHashes(c, r, &LogOptions{
+		Include: []plumbing.Hash{plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")},
+		Exclude: []plumbing.Hash{plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")},
+		Order:   LogOrderCommitterTime,
+	})
+	c.Assert(hashes, DeepEquals, []string{"e8d3ffa", "918c48b"})
+
+	hashes = logHashes(c, r, &LogOptions{
+		Exclude: []plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")},
+	})
+	c.Assert(hashes, DeepEquals, []string{"6ecf0ef"})
+
+	hashes = logHashes(c, r, &LogOptions{
+		All:       true,
+		Revisions: []string{"^HEAD~1"},
+		Order:     LogOrderCommitterTime,
+	})
+	c.Assert(hashes, DeepEquals, []string{"6ecf0ef", "e8d3ffa"})
+
+	_, err = r.Log(&LogOptions{Revisions: []string{"master..missing"}})
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestLogRangeLimit(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	when := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		err := util.WriteFile(w.Filesystem, "foo", []byte(strconv.Itoa(i)), 0644)
+		c.Assert(err, IsNil)
+		_, err = w.Add("foo")
+		c.Assert(err, IsNil)
+
+		sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: when.Add(time.Duration(i) * time.Hour)}
+		_, err = w.Commit("foo\n", &CommitOptions{Author: sig, Committer: sig})
+		c.Assert(err, IsNil)
+	}
+
+	o := &LogOptions{Revisions: []string{"HEAD~2..HEAD"}}
+	lr, err := r.logRange(o)
+	c.Assert(err, IsNil)
+	// the excluded history is only walked for the slop
+	c.Assert(len(lr.exclude) < 10, Equals, true)
+
+	iter, err := r.Log(o)
+	c.Assert(err, IsNil)
+	var n int
+	err = iter.ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+}
+
+func (s *RepositorySuite) TestLogBoundary(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	hashes := logHashes(c, r, &LogOptions{
+		Revisions: []string{"HEAD~4..HEAD"},
+		Boundary:  true,
+		Order:     LogOrderCommitterTime,
+	})
+	c.Assert(hashes, DeepEquals, []string{
+		"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "a5b8b09", "b8e471f",
+		"35e8510", "b029517",
+	})
+}
+
+func (s *RepositorySuite) TestLogMarked(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	marks := make(map[string]LogMark)
+	err = r.LogMarked(&LogOptions{
+		Revisions: []string{"master...branch"},
+		Boundary:  true,
+	}, func(commit *object.Commit, m LogMark) error {
+		marks[commit.Hash.String()[:7]] = m
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(marks, DeepEquals, map[string]LogMark{
+		"6ecf0ef": LogMarkLeft,
+		"e8d3ffa": LogMarkRight,
+		"918c48b": LogMarkBoundary,
+	})
+
+	marks = make(map[string]LogMark)
+	err = r.LogMarked(&LogOptions{
+		Revisions: []string{"branch..master"},
+	}, func(commit *object.Commit, m LogMark) error {
+		marks[commit.Hash.String()[:7]] = m
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(marks, DeepEquals, map[string]LogMark{"6ecf0ef": LogMarkNone})
+}
+
+func (s *RepositorySuite) TestLogFilters(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	one := 1
+	datas := []struct {
+		options  LogOptions
+		expected []string
+	}{
+		{LogOptions{Author: regexp.MustCompile("Ripolles")}, []string{"b8e471f"}},
+		{LogOptions{Committer: regexp.MustCompile("Cuadros <")}, []string{"b029517", "a5b8b09"}},
+		{LogOptions{Grep: []*regexp.Regexp{regexp.MustCompile("some")}}, []string{"918c48b", "af2d6a6"}},
+		{LogOptions{
+			Grep:     []*regexp.Regexp{regexp.MustCompile("some"), regexp.MustCompile("json")},
+			AllMatch: true,
+		}, []string{"af2d6a6"}},
+		{LogOptions{
+			Grep:       []*regexp.Regexp{regexp.MustCompile("some"), regexp.MustCompile("(?i)merge")},
+			InvertGrep: true,
+		}, []string{"6ecf0ef", "35e8510", "b029517", "b8e471f"}},
+		{LogOptions{MinParents: 2}, []string{"1669dce", "a5b8b09"}},
+		{LogOptions{MaxParents: &one}, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "35e8510", "b029517", "b8e471f",
+		}},
+		{LogOptions{FirstParent: true}, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "35e8510", "b029517",
+		}},
+		{LogOptions{FirstParent: true, Revisions: []string{"HEAD~3..HEAD"}, Boundary: true}, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "1669dce",
+		}},
+		{LogOptions{Revisions: []string{"b8e471f..HEAD"}}, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "35e8510", "a5b8b09",
+		}},
+		{LogOptions{Revisions: []string{"b8e471f..HEAD"}, AncestryPath: true}, []string{
+			"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "a5b8b09",
+		}},
+		{LogOptions{Skip: 2, MaxCount: 3}, []string{"af2d6a6", "1669dce", "35e8510"}},
+		{LogOptions{Grep: []*regexp.Regexp{regexp.MustCompile("some")}, MaxCount: 1}, []string{"918c48b"}},
+	}
+
+	for i, d := range datas {
+		hashes := logHashes(c, r, &d.options)
+		c.Assert(hashes, DeepEquals, d.expected, Commentf("while checking #%d", i))
+	}
+}
+
+func (s *RepositorySuite) TestLogFollow(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	content := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n"
+	first := commitFiles(c, w, map[string]string{"a.txt": content, "other.txt": "other\n"})
+	second := commitFiles(c, w, map[string]string{"a.txt": content + "nine\n"})
+
+	_, err = w.Remove("a.txt")
+	c.Assert(err, IsNil)
+	renamed := commitFiles(c, w, map[string]string{"b.txt": content + "nine\nten\n"})
+
+	commitFiles(c, w, map[string]string{"other.txt": "modified\n"})
+	last := commitFiles(c, w, map[string]string{"b.txt": content})
+
+	fileName := "b.txt"
+	iter, err := r.Log(&LogOptions{FileName: &fileName})
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	err = iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []plumbing.Hash{last, renamed})
+
+	var paths []string
+	hashes = nil
+	err = r.LogFollow(&LogOptions{FileName: &fileName}, func(commit *object.Commit, path string) error {
+		hashes = append(hashes, commit.Hash)
+		paths = append(paths, path)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []plumbing.Hash{last, renamed, second, first})
+	c.Assert(paths, DeepEquals, []string{"b.txt", "b.txt", "a.txt", "a.txt"})
+
+	iter, err = r.Log(&LogOptions{FileName: &fileName, Follow: true, MaxCount: 3})
+	c.Assert(err, IsNil)
+
+	hashes = nil
+	err = iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []plumbing.Hash{last, renamed, second})
+
+	_, err = r.Log(&LogOptions{Follow: true})
+	c.Assert(err, Equals, ErrFollowWithoutFileName)
+}
+
 func (s *RepositorySuite) TestConfigScoped(c *C) {
 	r, _ := Init(memory.NewStorage(), nil)
 	err := r.clone(context.Background(), &CloneOptions{
@@ -2720,6 +2978,272 @@ func (s *RepositorySuite) TestResolveRevisionWithErrors(c *C) {
 	}
 }
 
+func (s *RepositorySuite) TestResolveRevisionObjects(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	head, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := head.Tree()
+	c.Assert(err, IsNil)
+	changelog, err := tree.FindEntry("CHANGELOG")
+	c.Assert(err, IsNil)
+	vendor, err := tree.FindEntry("vendor")
+	c.Assert(err, IsNil)
+	foo, err := tree.FindEntry("vendor/foo.go")
+	c.Assert(err, IsNil)
+
+	datas := map[string]plumbing.Hash{
+		"HEAD^{commit}":      head.Hash,
+		"HEAD^{object}":      head.Hash,
+		"HEAD^{tree}":        tree.Hash,
+		"v1.0.0^{tree}":      tree.Hash,
+		"HEAD:":              tree.Hash,
+		"HEAD:CHANGELOG":     changelog.Hash,
+		"master:./vendor":    vendor.Hash,
+		"HEAD:vendor/":       vendor.Hash,
+		"HEAD:vendor/foo.go": foo.Hash,
+		":/binary file":      plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9"),
+		":/!-some":           plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	_, err = r.ResolveRevision("HEAD^{blob}")
+	c.Assert(err, ErrorMatches, "expected blob type, but the object dereferences to tree type")
+	_, err = r.ResolveRevision("HEAD^{tag}")
+	c.Assert(err, ErrorMatches, "expected tag type, but the object dereferences to commit type")
+	_, err = r.ResolveRevision("HEAD:missing")
+	c.Assert(err, Equals, object.ErrEntryNotFound)
+}
+
+func (s *RepositorySuite) TestResolveRevisionAnnotatedPeeling(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/tags.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f"))
+	c.Assert(err, IsNil)
+
+	datas := map[string]plumbing.Hash{
+		"annotated-tag":          commit.Hash,
+		"annotated-tag^{}":       commit.Hash,
+		"annotated-tag^{tag}":    plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69"),
+		"annotated-tag^{object}": plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69"),
+		"annotated-tag^{tree}":   commit.TreeHash,
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+}
+
+func (s *RepositorySuite) TestResolveRevisionAmbiguous(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commit := commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	prefix := commit.String()[:minAbbrevLength]
+
+	// look for a blob sharing the prefix of the commit
+	var content []byte
+	for i := 0; ; i++ {
+		content = []byte(fmt.Sprintf("blob %d\n", i))
+		if strings.HasPrefix(plumbing.ComputeHash(plumbing.BlobObject, content).String(), prefix) {
+			break
+		}
+	}
+
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	writer, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = writer.Write(content)
+	c.Assert(err, IsNil)
+	c.Assert(writer.Close(), IsNil)
+	blob, err := r.Storer.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+
+	_, err = r.ResolveRevision(plumbing.Revision(prefix))
+	c.Assert(err, Equals, ErrAmbiguousRevision)
+
+	datas := map[string]plumbing.Hash{
+		prefix + "~0":        commit,
+		prefix + "^{commit}": commit,
+		prefix + "^{blob}":   blob,
+		prefix + ":foo":      plumbing.ComputeHash(plumbing.BlobObject, []byte("foo\n")),
+		commit.String()[:7]:  commit,
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+}
+
+func (s *RepositorySuite) TestResolveRevisionReflog(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	first := commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	second := commitFiles(c, w, map[string]string{"foo": "bar\n"})
+
+	err = w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+	third := commitFiles(c, w, map[string]string{"foo": "qux\n"})
+
+	datas := map[string]plumbing.Hash{
+		"master@{0}":  second,
+		"master@{1}":  first,
+		"@{0}":        third,
+		"@{1}":        second,
+		"feature@{1}": second,
+		"HEAD@{1}":    second,
+		"HEAD@{2}":    second,
+		"HEAD@{3}":    first,
+		"@{-1}":       second,
+		"master@{" + time.Now().Add(time.Hour).Format(time.RFC3339) + "}": second,
+		"master@{2001-01-01T00:00:00Z}":                                   first,
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	_, err = r.ResolveRevision("master@{2}")
+	c.Assert(err, ErrorMatches, "log for 'master' only has 2 entries")
+	_, err = r.ResolveRevision("@{-2}")
+	c.Assert(err, NotNil)
+}
+
+func (s *RepositorySuite) TestResolveRevisionUpstream(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	first := commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	second := commitFiles(c, w, map[string]string{"foo": "bar\n"})
+
+	_, err = r.ResolveRevision("@{u}")
+	c.Assert(err, Equals, ErrNoUpstream)
+	_, err = r.ResolveRevision("@{push}")
+	c.Assert(err, Equals, ErrNoPushRemote)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{"https://example.com/foo.git"},
+	})
+	c.Assert(err, IsNil)
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:  "fork",
+		URLs:  []string{"https://example.com/fork.git"},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/fork/*"},
+	})
+	c.Assert(err, IsNil)
+
+	err = r.CreateBranch(&config.Branch{
+		Name:   "master",
+		Remote: "origin",
+		Merge:  "refs/heads/main",
+	})
+	c.Assert(err, IsNil)
+
+	refs := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/remotes/origin/main":   first,
+		"refs/remotes/origin/master": second,
+		"refs/remotes/fork/master":   first,
+	}
+
+	for name, h := range refs {
+		err := r.Storer.SetReference(plumbing.NewHashReference(name, h))
+		c.Assert(err, IsNil)
+	}
+
+	datas := map[string]plumbing.Hash{
+		"@{u}":              first,
+		"master@{upstream}": first,
+		"@{push}":           second,
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("remote").SetOption("pushDefault", "fork")
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	h, err := r.ResolveRevision("master@{push}")
+	c.Assert(err, IsNil)
+	c.Assert(*h, Equals, first)
+}
+
+func (s *RepositorySuite) TestResolveRevisionIndex(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, map[string]string{"foo": "foo\n"})
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("bar\n"), 0644)
+	c.Assert(err, IsNil)
+	staged, err := w.Add("foo")
+	c.Assert(err, IsNil)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	idx.Entries = append(idx.Entries, &index.Entry{
+		Name:  "bar",
+		Hash:  plumbing.ComputeHash(plumbing.BlobObject, []byte("theirs\n")),
+		Stage: index.TheirMode,
+	})
+	c.Assert(r.Storer.SetIndex(idx), IsNil)
+
+	datas := map[string]plumbing.Hash{
+		":foo":   staged,
+		":./foo": staged,
+		":0:foo": staged,
+		":3:bar": plumbing.ComputeHash(plumbing.BlobObject, []byte("theirs\n")),
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	_, err = r.ResolveRevision(":bar")
+	c.Assert(err, Equals, index.ErrEntryNotFound)
+}
+
 func (s *RepositorySuite) testRepackObjects(
 	c *C, deleteTime time.Time, expectedPacks int) {
 	srcFs := fixtures.ByTag("unpacked").One().DotGit()
@@ -0,0 +1,639 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/internal/revision"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// minAbbrevLength is the minimum length of a short hash, as in git.
+const minAbbrevLength = 4
+
+var (
+	// ErrAmbiguousRevision is returned by ResolveRevision when a short hash
+	// matches more than one object.
+	ErrAmbiguousRevision = errors.New("short object ID is ambiguous")
+	// ErrNoUpstream is returned by ResolveRevision when resolving the
+	// upstream of a branch without upstream configured.
+	ErrNoUpstream = errors.New("no upstream configured for branch")
+	// ErrNoPushRemote is returned by ResolveRevision when resolving the push
+	// destination of a branch without a remote to push to.
+	ErrNoPushRemote = errors.New("branch has no remote for pushing")
+	// ErrNotOnBranch is returned by ResolveRevision when resolving the
+	// upstream or the push destination of a detached HEAD.
+	ErrNotOnBranch = errors.New("HEAD does not point to a branch")
+)
+
+const checkoutReflogPrefix = "checkout: moving from "
+
+// resolveRevision resolves the items of a parsed revision to the hash of the
+// object they name.
+func (r *Repository) resolveRevision(items []revision.Revisioner) (plumbing.Hash, error) {
+	var h plumbing.Hash
+	var err error
+
+	peel := true
+	for i, item := range items {
+		var next revision.Revisioner
+		if i+1 < len(items) {
+			next = items[i+1]
+		}
+
+		// the reference preceding a "@" item names a reflog or a branch, it
+		// is resolved along with the item
+		var name revision.Ref
+		if i > 0 {
+			name, _ = items[0].(revision.Ref)
+		}
+
+		switch item := item.(type) {
+		case revision.Ref:
+			if isAtRevisioner(next) {
+				continue
+			}
+
+			h, err = r.resolveRevisionRef(string(item), revisionHint(next))
+		case revision.AtReflog:
+			h, err = r.resolveReflogEntry(string(name), func(entries []*reflog.Entry) (int, bool) {
+				return item.Depth, item.Depth < len(entries)
+			})
+		case revision.AtDate:
+			h, err = r.resolveReflogEntry(string(name), func(entries []*reflog.Entry) (int, bool) {
+				return reflogEntryAt(entries, item.Date)
+			})
+		case revision.AtCheckout:
+			h, err = r.resolveCheckout(item.Depth)
+		case revision.AtUpstream:
+			h, err = r.resolveTrackingBranch(string(name), r.upstreamReferenceName)
+		case revision.AtPush:
+			h, err = r.resolveTrackingBranch(string(name), r.pushReferenceName)
+		case revision.TildePath:
+			h, err = r.resolveAncestor(h, item.Depth)
+		case revision.CaretPath:
+			h, err = r.resolveParent(h, item.Depth)
+		case revision.CaretReg:
+			h, err = r.resolveCommitMessage(h, item.Regexp, item.Negate)
+		case revision.CaretType:
+			h, err = r.peelRevision(h, caretObjectType(item))
+			peel = false
+		case revision.ColonReg:
+			h, err = r.resolveAnyCommitMessage(item.Regexp, item.Negate)
+		case revision.ColonPath:
+			if i == 0 {
+				h, err = r.resolveIndexPath(item.Path, index.Merged)
+			} else {
+				h, err = r.resolveTreePath(h, item.Path)
+			}
+
+			peel = false
+		case revision.ColonStagePath:
+			h, err = r.resolveIndexPath(item.Path, index.Stage(item.Stage))
+			peel = false
+		}
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if !peel {
+		return h, nil
+	}
+
+	return r.peelRevision(h, plumbing.AnyObject)
+}
+
+func isAtRevisioner(item revision.Revisioner) bool {
+	switch item.(type) {
+	case revision.AtReflog, revision.AtDate, revision.AtCheckout,
+		revision.AtUpstream, revision.AtPush:
+		return true
+	}
+
+	return false
+}
+
+// revisionHint returns the type of object the given item expects, used to
+// disambiguate short hashes.
+func revisionHint(next revision.Revisioner) plumbing.ObjectType {
+	switch next := next.(type) {
+	case revision.TildePath, revision.CaretPath, revision.CaretReg:
+		return plumbing.CommitObject
+	case revision.CaretType:
+		return caretObjectType(next)
+	case revision.ColonPath:
+		return plumbing.TreeObject
+	}
+
+	return plumbing.AnyObject
+}
+
+// caretObjectType returns the type of object the given ^{<type>} item peels
+// to, AnyObject meaning the first object not being a tag.
+func caretObjectType(item revision.CaretType) plumbing.ObjectType {
+	switch item.ObjectType {
+	case "object":
+		return plumbing.InvalidObject
+	case "":
+		return plumbing.AnyObject
+	}
+
+	t, _ := plumbing.ParseObjectType(item.ObjectType)
+	return t
+}
+
+// resolveRevisionRef resolves a full hash, a reference name or a short hash,
+// in the same order as git. When a short hash is ambiguous, only the objects
+// that can be peeled to the given type are considered.
+func (r *Repository) resolveRevisionRef(name string, hint plumbing.ObjectType) (plumbing.Hash, error) {
+	if plumbing.IsHash(name) {
+		h := plumbing.NewHash(name)
+		if _, err := r.Storer.EncodedObject(plumbing.AnyObject, h); err == nil {
+			return h, nil
+		}
+	}
+
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		ref, err := storer.ResolveReference(r.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, name)))
+		if err == nil {
+			return ref.Hash(), nil
+		}
+	}
+
+	if len(name) < minAbbrevLength || plumbing.IsHash(name) {
+		return plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+	}
+
+	hashes := r.resolveHashPrefix(name)
+	if len(hashes) > 1 && hint != plumbing.AnyObject {
+		var peelable []plumbing.Hash
+		for _, h := range hashes {
+			if _, err := r.peelRevision(h, hint); err == nil {
+				peelable = append(peelable, h)
+			}
+		}
+
+		hashes = peelable
+	}
+
+	switch len(hashes) {
+	case 0:
+		return plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+	case 1:
+		return hashes[0], nil
+	default:
+		return plumbing.ZeroHash, ErrAmbiguousRevision
+	}
+}
+
+// peelRevision peels the given object until reaching an object of the given
+// type: tags are dereferenced and, when looking for a tree or a blob, commits
+// resolve to their tree. AnyObject peels the tags only and InvalidObject just
+// checks the object exists.
+func (r *Repository) peelRevision(h plumbing.Hash, t plumbing.ObjectType) (plumbing.Hash, error) {
+	for {
+		obj, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		switch {
+		case obj.Type() == t || t == plumbing.InvalidObject:
+			return h, nil
+		case obj.Type() == plumbing.TagObject:
+			tag, err := object.DecodeTag(r.Storer, obj)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			h = tag.Target
+		case obj.Type() == plumbing.CommitObject && (t == plumbing.TreeObject || t == plumbing.BlobObject):
+			commit, err := object.DecodeCommit(r.Storer, obj)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			h = commit.TreeHash
+		case t == plumbing.AnyObject:
+			return h, nil
+		default:
+			return plumbing.ZeroHash, fmt.Errorf("expected %s type, but the object dereferences to %s type", t, obj.Type())
+		}
+	}
+}
+
+// revisionCommit returns the commit the given object peels to.
+func (r *Repository) revisionCommit(h plumbing.Hash) (*object.Commit, error) {
+	h, err := r.peelRevision(h, plumbing.CommitObject)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CommitObject(h)
+}
+
+func (r *Repository) resolveAncestor(h plumbing.Hash, depth int) (plumbing.Hash, error) {
+	commit, err := r.revisionCommit(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for i := 0; i < depth; i++ {
+		if commit, err = commit.Parent(0); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return commit.Hash, nil
+}
+
+func (r *Repository) resolveParent(h plumbing.Hash, n int) (plumbing.Hash, error) {
+	commit, err := r.revisionCommit(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if n == 0 {
+		return commit.Hash, nil
+	}
+
+	parent, err := commit.Parent(n - 1)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return parent.Hash, nil
+}
+
+func matchCommitMessage(c *object.Commit, re *regexp.Regexp, negate bool) bool {
+	return re.MatchString(c.Message) != negate
+}
+
+// resolveCommitMessage returns the first commit reachable from the given
+// object whose message matches the regexp.
+func (r *Repository) resolveCommitMessage(h plumbing.Hash, re *regexp.Regexp, negate bool) (plumbing.Hash, error) {
+	commit, err := r.revisionCommit(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var found *object.Commit
+	err = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		if matchCommitMessage(c, re, negate) {
+			found = c
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if found == nil {
+		return plumbing.ZeroHash, fmt.Errorf(`No commit message match regexp : "%s"`, re.String())
+	}
+
+	return found.Hash, nil
+}
+
+// resolveAnyCommitMessage returns the youngest commit reachable from any
+// reference whose message matches the regexp.
+func (r *Repository) resolveAnyCommitMessage(re *regexp.Regexp, negate bool) (plumbing.Hash, error) {
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var found *object.Commit
+	seen := make(map[plumbing.Hash]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		ref, err := storer.ResolveReference(r.Storer, ref.Name())
+		if err != nil {
+			return nil
+		}
+
+		commit, err := r.revisionCommit(ref.Hash())
+		if err != nil || seen[commit.Hash] {
+			return nil
+		}
+
+		seen[commit.Hash] = true
+
+		// the commits are walked from the youngest, so the walk stops as soon
+		// as the commits are older than the one already found
+		return object.NewCommitIterCTime(commit, nil, nil).ForEach(func(c *object.Commit) error {
+			if found != nil && !c.Committer.When.After(found.Committer.When) {
+				return storer.ErrStop
+			}
+
+			if matchCommitMessage(c, re, negate) {
+				found = c
+				return storer.ErrStop
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if found == nil {
+		return plumbing.ZeroHash, fmt.Errorf(`No commit message match regexp : "%s"`, re.String())
+	}
+
+	return found.Hash, nil
+}
+
+// resolveTreePath returns the object at the given path of the tree the given
+// object peels to.
+func (r *Repository) resolveTreePath(h plumbing.Hash, path string) (plumbing.Hash, error) {
+	h, err := r.peelRevision(h, plumbing.TreeObject)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	path = strings.Trim(strings.TrimPrefix(path, "./"), "/")
+	if path == "" {
+		return h, nil
+	}
+
+	tree, err := r.TreeObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	e, err := tree.FindEntry(path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return e.Hash, nil
+}
+
+// resolveIndexPath returns the object of the index entry at the given path
+// and stage.
+func (r *Repository) resolveIndexPath(path string, stage index.Stage) (plumbing.Hash, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	path = strings.TrimPrefix(path, "./")
+	for _, e := range idx.Entries {
+		if e.Name == path && e.Stage == stage {
+			return e.Hash, nil
+		}
+	}
+
+	return plumbing.ZeroHash, index.ErrEntryNotFound
+}
+
+// reflogReferenceName returns the reference whose reflog is named by the
+// given name, the current branch when empty.
+func (r *Repository) reflogReferenceName(name string) (plumbing.ReferenceName, error) {
+	if name == "" {
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return "", err
+		}
+
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), nil
+		}
+
+		return plumbing.HEAD, nil
+	}
+
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		n := plumbing.ReferenceName(fmt.Sprintf(rule, name))
+		if _, err := r.Storer.Reference(n); err == nil {
+			return n, nil
+		}
+	}
+
+	return "", plumbing.ErrReferenceNotFound
+}
+
+// reflogEntries returns the reflog of the given reference, the newest entry
+// first.
+func (r *Repository) reflogEntries(name plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	rs, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	iter, err := rs.IterReflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*reflog.Entry
+	err = iter.ForEach(func(e *reflog.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+
+	return entries, err
+}
+
+// resolveReflogEntry returns the value of the reference at the reflog entry
+// selected by the given function, which reports false if there is no such
+// entry. Selecting the entry past the oldest one returns the value the
+// reference had before it.
+func (r *Repository) resolveReflogEntry(
+	name string,
+	selectEntry func([]*reflog.Entry) (int, bool),
+) (plumbing.Hash, error) {
+	refName, err := r.reflogReferenceName(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	entries, err := r.reflogEntries(refName)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	i, ok := selectEntry(entries)
+	switch {
+	case ok:
+		return entries[i].New, nil
+	case i == len(entries) && i > 0 && !entries[i-1].Old.IsZero():
+		return entries[i-1].Old, nil
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("log for '%s' only has %d entries", refName.Short(), len(entries))
+}
+
+// reflogEntryAt returns the index of the newest entry not newer than the
+// given date. If all of them are newer, the index past the oldest entry is
+// returned, or the oldest one if it records the creation of the reference.
+func reflogEntryAt(entries []*reflog.Entry, date time.Time) (int, bool) {
+	for i, e := range entries {
+		if !e.Committer.When.After(date) {
+			return i, true
+		}
+	}
+
+	if n := len(entries); n > 0 && entries[n-1].Old.IsZero() {
+		return n - 1, true
+	}
+
+	return len(entries), false
+}
+
+// resolveCheckout resolves the branch or commit checked out before the nth
+// last checkout, as recorded in the HEAD reflog.
+func (r *Repository) resolveCheckout(n int) (plumbing.Hash, error) {
+	entries, err := r.reflogEntries(plumbing.HEAD)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var found int
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Message, checkoutReflogPrefix) {
+			continue
+		}
+
+		if found++; found < n {
+			continue
+		}
+
+		from := strings.TrimPrefix(e.Message, checkoutReflogPrefix)
+		if i := strings.Index(from, " to "); i >= 0 {
+			from = from[:i]
+		}
+
+		return r.resolveRevisionRef(from, plumbing.AnyObject)
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("only %d checkouts found in the HEAD reflog", found)
+}
+
+// resolveTrackingBranch resolves the remote-tracking branch returned by the
+// given function for the named branch, the current one when empty.
+func (r *Repository) resolveTrackingBranch(
+	name string,
+	trackingName func(cfg *config.Config, branch string) (plumbing.ReferenceName, error),
+) (plumbing.Hash, error) {
+	branch, err := r.branchName(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	refName, err := trackingName(cfg, branch)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	ref, err := storer.ResolveReference(r.Storer, refName)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+// branchName returns the short name of the given branch, the current one
+// when empty or HEAD.
+func (r *Repository) branchName(name string) (string, error) {
+	if name != "" && name != string(plumbing.HEAD) {
+		return strings.TrimPrefix(strings.TrimPrefix(name, "refs/"), "heads/"), nil
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", ErrNotOnBranch
+	}
+
+	return head.Target().Short(), nil
+}
+
+// upstreamReferenceName returns the remote-tracking branch the given branch
+// merges from, as configured by branch.<name>.remote and branch.<name>.merge.
+func (r *Repository) upstreamReferenceName(cfg *config.Config, branch string) (plumbing.ReferenceName, error) {
+	b, ok := cfg.Branches[branch]
+	if !ok || b.Remote == "" || b.Merge == "" {
+		return "", ErrNoUpstream
+	}
+
+	return trackingReferenceName(cfg, b.Remote, b.Merge)
+}
+
+// pushReferenceName returns the remote-tracking branch matching the branch
+// the given one would be pushed to, following branch.<name>.pushRemote,
+// remote.pushDefault, branch.<name>.remote and push.default.
+func (r *Repository) pushReferenceName(cfg *config.Config, branch string) (plumbing.ReferenceName, error) {
+	b := cfg.Branches[branch]
+
+	remote := cfg.Raw.Section("branch").Subsection(branch).Option("pushRemote")
+	if remote == "" {
+		remote = cfg.Raw.Section("remote").Option("pushDefault")
+	}
+
+	if remote == "" && b != nil {
+		remote = b.Remote
+	}
+
+	if remote == "" {
+		return "", ErrNoPushRemote
+	}
+
+	dst := plumbing.NewBranchReferenceName(branch)
+	switch strings.ToLower(cfg.Raw.Section("push").Option("default")) {
+	case "nothing":
+		return "", fmt.Errorf("push has no destination (push.default is 'nothing')")
+	case "upstream", "tracking":
+		if b == nil || b.Merge == "" || b.Remote != remote {
+			return "", ErrNoUpstream
+		}
+
+		dst = b.Merge
+	}
+
+	return trackingReferenceName(cfg, remote, dst)
+}
+
+// trackingReferenceName maps the given branch of the remote to the local
+// reference tracking it, using the fetch refspecs of the remote. The "."
+// remote stands for the repository itself.
+func trackingReferenceName(cfg *config.Config, remote string, name plumbing.ReferenceName) (plumbing.ReferenceName, error) {
+	if remote == "." {
+		return name, nil
+	}
+
+	rc, ok := cfg.Remotes[remote]
+	if !ok {
+		return "", ErrRemoteNotFound
+	}
+
+	for _, spec := range rc.Fetch {
+		if spec.Match(name) {
+			return spec.Dst(name), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s of remote %s is not stored as a remote-tracking branch", name, remote)
+}
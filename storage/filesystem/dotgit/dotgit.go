@@ -774,6 +774,10 @@ func (d *DotGit) RemoveRef(name plumbing.ReferenceName) error {
 		return err
 	}
 
+	if err := d.RemoveReflog(name); err != nil {
+		return err
+	}
+
 	return d.rewritePackedRefsWithoutRef(name)
 }
 
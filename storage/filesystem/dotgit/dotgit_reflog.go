@@ -0,0 +1,74 @@
+package dotgit
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+func (d *DotGit) reflogPath(name plumbing.ReferenceName) string {
+	return d.fs.Join(logsPath, name.String())
+}
+
+// Reflog returns the entries of the reflog of the given reference, the oldest
+// first. No entries are returned if the reference has no reflog.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) (entries []*reflog.Entry, err error) {
+	f, err := d.fs.Open(d.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewDecoder(f).Decode()
+}
+
+// AppendReflog adds the given entry at the end of the reflog of the given
+// reference, creating the reflog if needed.
+func (d *DotGit) AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) (err error) {
+	f, err := d.fs.OpenFile(d.reflogPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewEncoder(f).Encode(e)
+}
+
+// SetReflog replaces the reflog of the given reference with the given
+// entries, the oldest first. The reflog is removed if there are no entries.
+func (d *DotGit) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) (err error) {
+	if len(entries) == 0 {
+		return d.RemoveReflog(name)
+	}
+
+	var buf bytes.Buffer
+	if err := reflog.NewEncoder(&buf).Encode(entries...); err != nil {
+		return err
+	}
+
+	f, err := d.fs.Create(d.reflogPath(name))
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+// RemoveReflog removes the reflog of the given reference, if any.
+func (d *DotGit) RemoveReflog(name plumbing.ReferenceName) error {
+	err := d.fs.Remove(d.reflogPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -23,6 +23,17 @@ func NewRepositoryFilesystem(dotGitFs, commonDotGitFs billy.Filesystem) *Reposit
 	}
 }
 
+// CommonDir returns the filesystem of the common dot-git directory, shared by
+// all the worktrees of the repository, or the dot-git filesystem if commondir
+// is not defined.
+func (fs *RepositoryFilesystem) CommonDir() billy.Filesystem {
+	if fs.commonDotGitFs == nil {
+		return fs.dotGitFs
+	}
+
+	return fs.commonDotGitFs
+}
+
 func (fs *RepositoryFilesystem) mapToRepositoryFsByPath(path string) billy.Filesystem {
 	// Nothing to decide if commondir not defined
 	if fs.commonDotGitFs == nil {
@@ -37,6 +48,8 @@ func (fs *RepositoryFilesystem) mapToRepositoryFsByPath(path string) billy.Files
 		return fs.dotGitFs
 	case fs.dotGitFs.Join(refsPath, "bisect"), fs.dotGitFs.Join(refsPath, "rewritten"), fs.dotGitFs.Join(refsPath, "worktree"):
 		return fs.dotGitFs
+	case fs.dotGitFs.Join(infoPath, "sparse-checkout"):
+		return fs.dotGitFs
 	}
 
 	// Determine dot-git root by first path element.
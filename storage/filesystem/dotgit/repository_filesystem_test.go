@@ -91,7 +91,7 @@ func (s *SuiteDotGit) TestRepositoryFilesystem(c *C) {
 		c.Assert(os.IsNotExist(err), Equals, true)
 	}
 
-	exceptionsPaths := []string{repositoryFs.Join(logsPath, "HEAD"), repositoryFs.Join(refsPath, "bisect"), repositoryFs.Join(refsPath, "rewritten"), repositoryFs.Join(refsPath, "worktree")}
+	exceptionsPaths := []string{repositoryFs.Join(logsPath, "HEAD"), repositoryFs.Join(refsPath, "bisect"), repositoryFs.Join(refsPath, "rewritten"), repositoryFs.Join(refsPath, "worktree"), repositoryFs.Join(infoPath, "sparse-checkout")}
 	for _, path := range exceptionsPaths {
 		_, err := repositoryFs.Create(path)
 		c.Assert(err, IsNil)
@@ -0,0 +1,68 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+)
+
+// ReflogStorage implements storer.ReflogStorer, storing the reflogs in the
+// logs folder of the .git directory.
+type ReflogStorage struct {
+	dir *dotgit.DotGit
+}
+
+func (r *ReflogStorage) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	return r.dir.AppendReflog(n, e)
+}
+
+func (r *ReflogStorage) IterReflog(n plumbing.ReferenceName) (storer.ReflogIter, error) {
+	entries, err := r.dir.Reflog(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return storer.NewReflogSliceIter(storer.ReverseReflog(entries)), nil
+}
+
+func (r *ReflogStorage) ExpireReflog(n plumbing.ReferenceName, expire func(*reflog.Entry) bool) error {
+	entries, err := r.dir.Reflog(n)
+	if err != nil {
+		return err
+	}
+
+	var kept []*reflog.Entry
+	for _, e := range entries {
+		if !expire(e) {
+			kept = append(kept, e)
+		}
+	}
+
+	if len(kept) == len(entries) {
+		return nil
+	}
+
+	reflog.Relink(kept)
+	return r.dir.SetReflog(n, kept)
+}
+
+func (r *ReflogStorage) DeleteReflogEntry(n plumbing.ReferenceName, i int) error {
+	entries, err := r.dir.Reflog(n)
+	if err != nil {
+		return err
+	}
+
+	pos := len(entries) - 1 - i
+	if i < 0 || pos < 0 {
+		return storer.ErrReflogEntryNotFound
+	}
+
+	entries = append(entries[:pos], entries[pos+1:]...)
+	reflog.Relink(entries)
+	return r.dir.SetReflog(n, entries)
+}
+
+func (r *ReflogStorage) RemoveReflog(n plumbing.ReferenceName) error {
+	return r.dir.RemoveReflog(n)
+}
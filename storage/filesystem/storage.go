@@ -17,6 +17,7 @@ type Storage struct {
 
 	ObjectStorage
 	ReferenceStorage
+	ReflogStorage
 	IndexStorage
 	ShallowStorage
 	ConfigStorage
@@ -55,6 +56,7 @@ func NewStorageWithOptions(fs billy.Filesystem, cache cache.Object, ops Options)
 
 		ObjectStorage:    *NewObjectStorageWithOptions(dir, cache, ops),
 		ReferenceStorage: ReferenceStorage{dir: dir},
+		ReflogStorage:    ReflogStorage{dir: dir},
 		IndexStorage:     IndexStorage{dir: dir},
 		ShallowStorage:   ShallowStorage{dir: dir},
 		ConfigStorage:    ConfigStorage{dir: dir},
@@ -8,6 +8,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 )
@@ -24,6 +25,7 @@ type Storage struct {
 	ShallowStorage
 	IndexStorage
 	ReferenceStorage
+	ReflogStorage
 	ModuleStorage
 }
 
@@ -31,6 +33,7 @@ type Storage struct {
 func NewStorage() *Storage {
 	return &Storage{
 		ReferenceStorage: make(ReferenceStorage),
+		ReflogStorage:    make(ReflogStorage),
 		ConfigStorage:    ConfigStorage{},
 		ShallowStorage:   ShallowStorage{},
 		ObjectStorage: ObjectStorage{
@@ -295,6 +298,68 @@ func (r ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
 	return nil
 }
 
+// RemoveReference removes the given reference and its reflog.
+func (s *Storage) RemoveReference(n plumbing.ReferenceName) error {
+	if err := s.ReferenceStorage.RemoveReference(n); err != nil {
+		return err
+	}
+
+	return s.ReflogStorage.RemoveReflog(n)
+}
+
+// ReflogStorage stores the reflog entries of each reference, the oldest
+// first.
+type ReflogStorage map[plumbing.ReferenceName][]*reflog.Entry
+
+func (r ReflogStorage) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	copied := *e
+	r[n] = append(r[n], &copied)
+	return nil
+}
+
+func (r ReflogStorage) IterReflog(n plumbing.ReferenceName) (storer.ReflogIter, error) {
+	return storer.NewReflogSliceIter(storer.ReverseReflog(r[n])), nil
+}
+
+func (r ReflogStorage) ExpireReflog(n plumbing.ReferenceName, expire func(*reflog.Entry) bool) error {
+	var kept []*reflog.Entry
+	for _, e := range r[n] {
+		if !expire(e) {
+			kept = append(kept, e)
+		}
+	}
+
+	reflog.Relink(kept)
+	return r.setReflog(n, kept)
+}
+
+func (r ReflogStorage) DeleteReflogEntry(n plumbing.ReferenceName, i int) error {
+	entries := r[n]
+	pos := len(entries) - 1 - i
+	if i < 0 || pos < 0 {
+		return storer.ErrReflogEntryNotFound
+	}
+
+	kept := append(entries[:pos:pos], entries[pos+1:]...)
+	reflog.Relink(kept)
+	return r.setReflog(n, kept)
+}
+
+func (r ReflogStorage) RemoveReflog(n plumbing.ReferenceName) error {
+	delete(r, n)
+	return nil
+}
+
+func (r ReflogStorage) setReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if len(entries) == 0 {
+		delete(r, n)
+		return nil
+	}
+
+	r[n] = entries
+	return nil
+}
+
 type ShallowStorage []plumbing.Hash
 
 func (s *ShallowStorage) SetShallow(commits []plumbing.Hash) error {
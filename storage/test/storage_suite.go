@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 
@@ -378,6 +380,141 @@ func (s *BaseStorageSuite) TestIterReferences(c *C) {
 	c.Assert(err, Equals, io.EOF)
 }
 
+func (s *BaseStorageSuite) reflogStorer(c *C) storer.ReflogStorer {
+	rs, ok := s.Storer.(storer.ReflogStorer)
+	if !ok {
+		c.Skip("storer doesn't implement ReflogStorer")
+	}
+
+	return rs
+}
+
+func (s *BaseStorageSuite) appendReflog(c *C, rs storer.ReflogStorer, name plumbing.ReferenceName, hashes ...string) {
+	when := time.Unix(1257894000, 0).UTC()
+	old := plumbing.ZeroHash
+	for i, h := range hashes {
+		err := rs.AppendReflog(name, &reflog.Entry{
+			Old: old,
+			New: plumbing.NewHash(h),
+			Committer: reflog.Signature{
+				Name:  "foo",
+				Email: "foo@foo.foo",
+				When:  when.Add(time.Duration(i) * time.Hour),
+			},
+			Message: fmt.Sprintf("update %d", i),
+		})
+		c.Assert(err, IsNil)
+		old = plumbing.NewHash(h)
+	}
+}
+
+func reflogHashes(c *C, rs storer.ReflogStorer, name plumbing.ReferenceName) []string {
+	iter, err := rs.IterReflog(name)
+	c.Assert(err, IsNil)
+
+	var hashes []string
+	err = iter.ForEach(func(e *reflog.Entry) error {
+		hashes = append(hashes, e.Old.String()[:7]+".."+e.New.String()[:7])
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return hashes
+}
+
+func (s *BaseStorageSuite) TestAppendReflogAndIterReflog(c *C) {
+	rs := s.reflogStorer(c)
+	name := plumbing.ReferenceName("refs/heads/foo")
+	s.appendReflog(c, rs, name,
+		"bc9968d75e48de59f0870ffb71f5e160bbbdcf52",
+		"482e0eada5de4039e6f216b45b3c9b683b83bfa0",
+	)
+
+	iter, err := rs.IterReflog(name)
+	c.Assert(err, IsNil)
+
+	e, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(e.Old.String(), Equals, "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(e.New.String(), Equals, "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	c.Assert(e.Committer.Name, Equals, "foo")
+	c.Assert(e.Committer.Email, Equals, "foo@foo.foo")
+	c.Assert(e.Committer.When.Unix(), Equals, int64(1257897600))
+	c.Assert(e.Message, Equals, "update 1")
+
+	e, err = iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(e.Old, Equals, plumbing.ZeroHash)
+	c.Assert(e.Message, Equals, "update 0")
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+
+	c.Assert(reflogHashes(c, rs, "refs/heads/bar"), HasLen, 0)
+}
+
+func (s *BaseStorageSuite) TestExpireReflog(c *C) {
+	rs := s.reflogStorer(c)
+	name := plumbing.ReferenceName("refs/heads/foo")
+	s.appendReflog(c, rs, name,
+		"bc9968d75e48de59f0870ffb71f5e160bbbdcf52",
+		"482e0eada5de4039e6f216b45b3c9b683b83bfa0",
+		"c3f4688a08fd86f1bf8e055724c84b7a40a09733",
+	)
+
+	err := rs.ExpireReflog(name, func(e *reflog.Entry) bool {
+		return e.Message == "update 1"
+	})
+	c.Assert(err, IsNil)
+	c.Assert(reflogHashes(c, rs, name), DeepEquals, []string{
+		"bc9968d..c3f4688",
+		"0000000..bc9968d",
+	})
+
+	err = rs.ExpireReflog(name, func(*reflog.Entry) bool { return true })
+	c.Assert(err, IsNil)
+	c.Assert(reflogHashes(c, rs, name), HasLen, 0)
+}
+
+func (s *BaseStorageSuite) TestDeleteReflogEntry(c *C) {
+	rs := s.reflogStorer(c)
+	name := plumbing.ReferenceName("refs/heads/foo")
+	s.appendReflog(c, rs, name,
+		"bc9968d75e48de59f0870ffb71f5e160bbbdcf52",
+		"482e0eada5de4039e6f216b45b3c9b683b83bfa0",
+		"c3f4688a08fd86f1bf8e055724c84b7a40a09733",
+	)
+
+	c.Assert(rs.DeleteReflogEntry(name, 3), Equals, storer.ErrReflogEntryNotFound)
+	c.Assert(rs.DeleteReflogEntry(name, 2), IsNil)
+	c.Assert(reflogHashes(c, rs, name), DeepEquals, []string{
+		"482e0ea..c3f4688",
+		"0000000..482e0ea",
+	})
+
+	c.Assert(rs.DeleteReflogEntry(name, 0), IsNil)
+	c.Assert(reflogHashes(c, rs, name), DeepEquals, []string{
+		"0000000..482e0ea",
+	})
+}
+
+func (s *BaseStorageSuite) TestRemoveReflog(c *C) {
+	rs := s.reflogStorer(c)
+	name := plumbing.ReferenceName("refs/heads/foo")
+	s.appendReflog(c, rs, name, "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+
+	c.Assert(rs.RemoveReflog(name), IsNil)
+	c.Assert(reflogHashes(c, rs, name), HasLen, 0)
+
+	s.appendReflog(c, rs, name, "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	err := s.Storer.SetReference(
+		plumbing.NewReferenceFromStrings(name.String(), "bc9968d75e48de59f0870ffb71f5e160bbbdcf52"),
+	)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.Storer.RemoveReference(name), IsNil)
+	c.Assert(reflogHashes(c, rs, name), HasLen, 0)
+}
+
 func (s *BaseStorageSuite) TestSetShallowAndShallow(c *C) {
 	expected := []plumbing.Hash{
 		plumbing.NewHash("b66c08ba28aa1f81eb06a1127aa3936ff77e5e2c"),
@@ -0,0 +1,221 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Algorithm is a line diff algorithm.
+type Algorithm int8
+
+const (
+	// Myers is the basic greedy diff algorithm.
+	Myers Algorithm = iota
+	// Minimal is Myers without the heuristics that make it faster on large
+	// files. As in git, the lines appearing too many times are still left
+	// out of the search, so the diff may not be the smallest possible one.
+	Minimal
+	// Patience matches first the lines appearing only once in both files,
+	// and diffs the lines between them recursively. It produces better hunks
+	// than Myers when blocks of code are reordered.
+	Patience
+	// Histogram extends Patience to support the lines appearing several
+	// times, matching first the lines appearing the fewest times. It is
+	// usually faster than Patience and Myers on large files.
+	Histogram
+)
+
+// ErrUnknownAlgorithm is returned by ParseAlgorithm when the name of the
+// algorithm is not known.
+var ErrUnknownAlgorithm = errors.New("unknown diff algorithm")
+
+// ParseAlgorithm returns the algorithm with the given name, as accepted by the
+// diff.algorithm option of git.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "", "default", "myers":
+		return Myers, nil
+	case "minimal":
+		return Minimal, nil
+	case "patience":
+		return Patience, nil
+	case "histogram":
+		return Histogram, nil
+	default:
+		return Myers, ErrUnknownAlgorithm
+	}
+}
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	switch a {
+	case Minimal:
+		return "minimal"
+	case Patience:
+		return "patience"
+	case Histogram:
+		return "histogram"
+	default:
+		return "myers"
+	}
+}
+
+// Options describes how a line diff should be computed.
+type Options struct {
+	// Algorithm is the diff algorithm, Myers by default.
+	Algorithm Algorithm
+	// IndentHeuristic shifts the groups of added or deleted lines that can be
+	// moved up or down without changing the result ("sliders") to the
+	// position that makes them easier to read, based on the indentation of
+	// the lines around them. It is equivalent to the indent heuristic of git,
+	// enabled by default with the diff.indentHeuristic option.
+	IndentHeuristic bool
+	// IgnoreSpaceChange ignores the changes in the amount of whitespace: the
+	// sequences of whitespace characters are compared as a single space, and
+	// the whitespace at the end of the lines is ignored, as git diff
+	// --ignore-space-change (-b) does.
+	IgnoreSpaceChange bool
+	// IgnoreAllSpace ignores the whitespace characters when comparing lines,
+	// as git diff --ignore-all-space (-w) does.
+	IgnoreAllSpace bool
+	// IgnoreCRAtEOL ignores the carriage returns at the end of the lines, as
+	// git diff --ignore-cr-at-eol does.
+	IgnoreCRAtEOL bool
+}
+
+// DoWithOptions computes the (line oriented) modifications needed to turn the
+// src string into the dst string, using the given options.
+//
+// The algorithms are implemented as in git, and their results compacted as
+// git does: the groups of changes that can slide are aligned with the changes
+// of the other file when possible, and moved as far down as possible
+// otherwise, so the diffs show the same hunks as git. DoWithOptions with nil
+// options is equivalent to Do.
+//
+// When the options ignore some whitespace changes, the lines that only differ
+// in the whitespace ignored are equal, and the text of the equal diffs is
+// taken from dst, as git shows the context lines of the new file.
+func DoWithOptions(src, dst string, opts *Options) []diffmatchpatch.Diff {
+	if opts == nil {
+		return Do(src, dst)
+	}
+
+	d := newDiffer(src, dst, opts.lineKey)
+	n1, n2 := len(d.a.lines), len(d.b.lines)
+	switch opts.Algorithm {
+	case Patience:
+		d.patience(0, n1, 0, n2)
+	case Histogram:
+		d.histogram(0, n1, 0, n2)
+	default:
+		d.myers(0, n1, 0, n2, opts.Algorithm == Minimal)
+	}
+
+	d.a.compact(d.b, opts.IndentHeuristic)
+	d.b.compact(d.a, opts.IndentHeuristic)
+	return d.diffs()
+}
+
+// differ holds the lines of the two files being compared and the lines
+// changed in each of them.
+type differ struct {
+	a, b *diffFile
+}
+
+// diffFile is a file being compared.
+type diffFile struct {
+	// lines holds an identifier for each line, the same for equal lines
+	lines []int
+	// text holds the lines, including the line terminators
+	text []string
+	// changed tells whether each line was added or deleted
+	changed []bool
+}
+
+// newDiffer returns a differ comparing the lines of src and dst, the lines
+// with the same key being equal.
+func newDiffer(src, dst string, key func(string) string) *differ {
+	ids := make(map[string]int)
+	return &differ{
+		a: newDiffFile(src, ids, key),
+		b: newDiffFile(dst, ids, key),
+	}
+}
+
+func newDiffFile(s string, ids map[string]int, key func(string) string) *diffFile {
+	text := splitLines(s)
+	f := &diffFile{
+		lines:   make([]int, len(text)),
+		text:    text,
+		changed: make([]bool, len(text)),
+	}
+
+	for i, l := range text {
+		if key != nil {
+			l = key(l)
+		}
+
+		id, ok := ids[l]
+		if !ok {
+			id = len(ids)
+			ids[l] = id
+		}
+
+		f.lines[i] = id
+	}
+
+	return f
+}
+
+// isChanged tells whether the line i was changed, the lines out of the file
+// are not.
+func (f *diffFile) isChanged(i int) bool {
+	return i >= 0 && i < len(f.changed) && f.changed[i]
+}
+
+// change marks the lines [start, end) as changed.
+func (f *diffFile) change(start, end int) {
+	for i := start; i < end; i++ {
+		f.changed[i] = true
+	}
+}
+
+// diffs returns the diffs turning the first file into the second one, the
+// deletions of each group of changes before its insertions.
+func (d *differ) diffs() []diffmatchpatch.Diff {
+	var diffs []diffmatchpatch.Diff
+	add := func(t diffmatchpatch.Operation, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+
+		diffs = append(diffs, diffmatchpatch.Diff{Type: t, Text: strings.Join(lines, "")})
+	}
+
+	a, b := 0, 0
+	for a < len(d.a.lines) || b < len(d.b.lines) {
+		a0, b0 := a, b
+		for a < len(d.a.lines) && b < len(d.b.lines) && !d.a.changed[a] && !d.b.changed[b] {
+			a++
+			b++
+		}
+
+		add(diffmatchpatch.DiffEqual, d.b.text[b0:b])
+
+		a0, b0 = a, b
+		for a < len(d.a.lines) && d.a.changed[a] {
+			a++
+		}
+
+		for b < len(d.b.lines) && d.b.changed[b] {
+			b++
+		}
+
+		add(diffmatchpatch.DiffDelete, d.a.text[a0:a])
+		add(diffmatchpatch.DiffInsert, d.b.text[b0:b])
+	}
+
+	return diffs
+}
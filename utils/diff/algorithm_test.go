@@ -0,0 +1,154 @@
+package diff_test
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	. "gopkg.in/check.v1"
+)
+
+type AlgorithmSuite struct{}
+
+var _ = Suite(&AlgorithmSuite{})
+
+// render returns the diffs with a prefix for each line as in a unified diff.
+func render(diffs []diffmatchpatch.Diff) string {
+	var b strings.Builder
+	for _, d := range diffs {
+		prefix := " "
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		}
+
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l != "" {
+				b.WriteString(prefix + l)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func (s *AlgorithmSuite) TestParseAlgorithm(c *C) {
+	for name, expected := range map[string]diff.Algorithm{
+		"":          diff.Myers,
+		"default":   diff.Myers,
+		"myers":     diff.Myers,
+		"minimal":   diff.Minimal,
+		"Patience":  diff.Patience,
+		"histogram": diff.Histogram,
+	} {
+		a, err := diff.ParseAlgorithm(name)
+		c.Assert(err, IsNil)
+		c.Assert(a, Equals, expected)
+	}
+
+	_, err := diff.ParseAlgorithm("foo")
+	c.Assert(err, Equals, diff.ErrUnknownAlgorithm)
+	c.Assert(diff.Histogram.String(), Equals, "histogram")
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsNil(c *C) {
+	for i, t := range diffTests {
+		c.Assert(diff.DoWithOptions(t.src, t.dst, nil), DeepEquals, diff.Do(t.src, t.dst), Commentf("subtest %d", i))
+	}
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsRoundTrip(c *C) {
+	for _, a := range []diff.Algorithm{diff.Myers, diff.Minimal, diff.Patience, diff.Histogram} {
+		for i, t := range diffTests {
+			diffs := diff.DoWithOptions(t.src, t.dst, &diff.Options{Algorithm: a, IndentHeuristic: true})
+			var src, dst string
+			for _, d := range diffs {
+				if d.Type != diffmatchpatch.DiffInsert {
+					src += d.Text
+				}
+
+				if d.Type != diffmatchpatch.DiffDelete {
+					dst += d.Text
+				}
+			}
+
+			c.Assert(src, Equals, t.src, Commentf("%s subtest %d", a, i))
+			c.Assert(dst, Equals, t.dst, Commentf("%s subtest %d", a, i))
+		}
+	}
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsAlgorithm(c *C) {
+	src := "a\nb\nc\na\nb\nc\nd\n"
+	dst := "c\nb\na\nd\nx\nb\nc\n"
+
+	myers := "-a\n-b\n c\n+b\n a\n+d\n+x\n b\n c\n-d\n"
+	patience := "-a\n-b\n c\n-a\n b\n-c\n+a\n d\n+x\n+b\n+c\n"
+	for a, expected := range map[diff.Algorithm]string{
+		diff.Myers:     myers,
+		diff.Minimal:   myers,
+		diff.Patience:  patience,
+		diff.Histogram: patience,
+	} {
+		diffs := diff.DoWithOptions(src, dst, &diff.Options{Algorithm: a})
+		c.Assert(render(diffs), Equals, expected, Commentf("%s", a))
+	}
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsMinimalDiscardsRepeatedLines(c *C) {
+	src := "a\nc\nc\na\na\na\n"
+	dst := "d\nb\na\nb\nd\nb\nb\nb\n"
+
+	// as git diff --minimal, the lines appearing too many times are discarded
+	// even if the diff isn't the shortest one.
+	diffs := diff.DoWithOptions(src, dst, &diff.Options{Algorithm: diff.Minimal})
+	c.Assert(render(diffs), Equals, ""+
+		"-a\n-c\n-c\n-a\n-a\n-a\n"+
+		"+d\n+b\n+a\n+b\n+d\n+b\n+b\n+b\n",
+	)
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsReorderedCode(c *C) {
+	fib := "int fib(int n)\n{\n    return fib(n - 1) + fib(n - 2);\n}\n\n"
+	frob := "int frob(int foo)\n{\n    printf(\"%d\\n\", foo);\n}\n\n"
+	main := "int main()\n{\n    frob(fib(10));\n}\n"
+
+	diffs := diff.DoWithOptions(fib+frob+main, frob+fib+main, &diff.Options{Algorithm: diff.Histogram})
+	c.Assert(render(diffs), Equals, ""+
+		"-int fib(int n)\n-{\n-    return fib(n - 1) + fib(n - 2);\n-}\n-\n"+
+		" int frob(int foo)\n {\n     printf(\"%d\\n\", foo);\n }\n \n"+
+		"+int fib(int n)\n+{\n+    return fib(n - 1) + fib(n - 2);\n+}\n+\n"+
+		" int main()\n {\n     frob(fib(10));\n }\n",
+	)
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsIndentHeuristic(c *C) {
+	src := "1\n2\na\n\nb\n3\n4\n"
+	dst := "1\n2\na\n\nb\na\n\nb\n3\n4\n"
+
+	diffs := diff.DoWithOptions(src, dst, &diff.Options{})
+	c.Assert(render(diffs), Equals, " 1\n 2\n a\n \n b\n+a\n+\n+b\n 3\n 4\n")
+
+	diffs = diff.DoWithOptions(src, dst, &diff.Options{IndentHeuristic: true})
+	c.Assert(render(diffs), Equals, " 1\n 2\n a\n \n+b\n+a\n+\n b\n 3\n 4\n")
+}
+
+func (s *AlgorithmSuite) TestDoWithOptionsIgnoreWhitespace(c *C) {
+	src := "a b\n  c\nd\r\ne\n"
+	dst := "a  b \nc\nd\ne\n"
+
+	diffs := diff.DoWithOptions(src, dst, &diff.Options{})
+	c.Assert(render(diffs), Equals, "-a b\n-  c\n-d\r\n+a  b \n+c\n+d\n e\n")
+
+	diffs = diff.DoWithOptions(src, dst, &diff.Options{IgnoreCRAtEOL: true})
+	c.Assert(render(diffs), Equals, "-a b\n-  c\n+a  b \n+c\n d\n e\n")
+
+	diffs = diff.DoWithOptions(src, dst, &diff.Options{IgnoreSpaceChange: true})
+	c.Assert(render(diffs), Equals, " a  b \n-  c\n+c\n d\n e\n")
+
+	diffs = diff.DoWithOptions(src, dst, &diff.Options{IgnoreAllSpace: true})
+	c.Assert(render(diffs), Equals, " a  b \n c\n d\n e\n")
+}
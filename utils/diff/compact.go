@@ -0,0 +1,326 @@
+package diff
+
+// The compaction of the changes and the indent heuristic follow the ones of
+// xdiff, the diff library of git, so the diffs show the same hunks.
+
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+// diffGroup is a group of consecutive changed lines [start, end), it is empty
+// if start equals end.
+type diffGroup struct {
+	start, end int
+}
+
+// firstGroup returns the group of changed lines at the start of the file.
+func (f *diffFile) firstGroup() *diffGroup {
+	g := &diffGroup{}
+	for f.isChanged(g.end) {
+		g.end++
+	}
+
+	return g
+}
+
+// nextGroup moves g to the next group of changed lines, it returns false if g
+// is the last group.
+func (f *diffFile) nextGroup(g *diffGroup) bool {
+	if g.end == len(f.lines) {
+		return false
+	}
+
+	g.start = g.end + 1
+	for g.end = g.start; f.isChanged(g.end); g.end++ {
+	}
+
+	return true
+}
+
+// previousGroup moves g to the previous group of changed lines, it returns
+// false if g is the first group.
+func (f *diffFile) previousGroup(g *diffGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	for g.start = g.end; f.isChanged(g.start - 1); g.start-- {
+	}
+
+	return true
+}
+
+// slideDown moves g one line down if the line after it equals its first line,
+// merging it with the next group if they become adjacent.
+func (f *diffFile) slideDown(g *diffGroup) bool {
+	if g.end >= len(f.lines) || f.lines[g.start] != f.lines[g.end] {
+		return false
+	}
+
+	f.changed[g.start] = false
+	f.changed[g.end] = true
+	g.start++
+	g.end++
+	for f.isChanged(g.end) {
+		g.end++
+	}
+
+	return true
+}
+
+// slideUp moves g one line up if the line before it equals its last line,
+// merging it with the previous group if they become adjacent.
+func (f *diffFile) slideUp(g *diffGroup) bool {
+	if g.start <= 0 || f.lines[g.start-1] != f.lines[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+	f.changed[g.start] = true
+	f.changed[g.end] = false
+	for f.isChanged(g.start - 1) {
+		g.start--
+	}
+
+	return true
+}
+
+// compact moves the groups of changed lines of f, keeping o, the other file,
+// in sync. Each group that can slide is aligned with a group of changes of o
+// if possible, otherwise it is moved as far down as possible, or to the best
+// position according to the indent heuristic if enabled.
+func (f *diffFile) compact(o *diffFile, indentHeuristic bool) {
+	g := f.firstGroup()
+	og := o.firstGroup()
+
+	for {
+		if g.end != g.start {
+			var size, earliestEnd, endMatchingOther int
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+
+				for f.slideUp(g) {
+					o.previousGroup(og)
+				}
+
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for f.slideDown(g) {
+					o.nextGroup(og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// the group can't slide
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					f.slideUp(g)
+					o.previousGroup(og)
+				}
+			case indentHeuristic:
+				shift := earliestEnd
+				if g.end-size-1 > shift {
+					shift = g.end - size - 1
+				}
+
+				if g.end-indentHeuristicMaxSliding > shift {
+					shift = g.end - indentHeuristicMaxSliding
+				}
+
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					var score splitScore
+					score.add(f.measureSplit(shift))
+					score.add(f.measureSplit(shift - size))
+					if bestShift == -1 || score.compare(best) <= 0 {
+						best = score
+						bestShift = shift
+					}
+				}
+
+				for g.end > bestShift {
+					f.slideUp(g)
+					o.previousGroup(og)
+				}
+			}
+		}
+
+		if !f.nextGroup(g) {
+			return
+		}
+
+		o.nextGroup(og)
+	}
+}
+
+// splitMeasurement describes the lines around a split of the file, a point
+// between two lines.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+// measureSplit measures the split before the line i.
+func (f *diffFile) measureSplit(i int) splitMeasurement {
+	var m splitMeasurement
+	if i >= len(f.lines) {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = lineIndent(f.text[i])
+	}
+
+	m.preIndent = -1
+	for j := i - 1; j >= 0; j-- {
+		m.preIndent = lineIndent(f.text[j])
+		if m.preIndent != -1 {
+			break
+		}
+
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for j := i + 1; j < len(f.lines); j++ {
+		m.postIndent = lineIndent(f.text[j])
+		if m.postIndent != -1 {
+			break
+		}
+
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+
+	return m
+}
+
+// lineIndent returns the indentation width of the line, or -1 if it is blank.
+func lineIndent(line string) int {
+	var indent int
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return indent
+		}
+
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+
+	return -1
+}
+
+// splitScore is the badness of the splits around a group of changed lines.
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+// compare returns a negative number if s is better than o, a positive one if
+// it is worse, or zero if they are equal.
+func (s splitScore) compare(o splitScore) int {
+	var cmpIndents int
+	switch {
+	case s.effectiveIndent > o.effectiveIndent:
+		cmpIndents = 1
+	case s.effectiveIndent < o.effectiveIndent:
+		cmpIndents = -1
+	}
+
+	return indentWeight*cmpIndents + (s.penalty - o.penalty)
+}
@@ -0,0 +1,164 @@
+package diff
+
+// histogramMaxChainLength is the maximum number of times a line can appear to
+// be used as the start of a common region by histogram, as in git.
+const histogramMaxChainLength = 64
+
+// histogramRecord holds the occurrences of a line in the first range.
+type histogramRecord struct {
+	// first is the position of the first occurrence
+	first int
+	// count is the number of occurrences
+	count int
+}
+
+// histogramIndex indexes the lines of the first range compared by histogram.
+type histogramIndex struct {
+	records map[int]*histogramRecord
+	// next holds the position of the next occurrence of each line, or -1
+	next map[int]int
+	// record holds the record of each line
+	record map[int]*histogramRecord
+	// count is the lowest count of the lines of the best region so far
+	count     int
+	hasCommon bool
+}
+
+// histogramRegion is a region of equal lines in both ranges, including both
+// its ends.
+type histogramRegion struct {
+	begin1, end1 int
+	begin2, end2 int
+}
+
+// histogram marks the changed lines of the ranges [a0, a1) and [b0, b1) with
+// the histogram algorithm, as git does: the longest region of equal lines
+// that contains the line appearing the fewest times in the first range is
+// found, and the lines before and after it are compared recursively. The
+// ranges whose common lines appear too many times are compared with Myers.
+func (d *differ) histogram(a0, a1, b0, b1 int) {
+	for {
+		switch {
+		case a0 == a1:
+			d.b.change(b0, b1)
+			return
+		case b0 == b1:
+			d.a.change(a0, a1)
+			return
+		}
+
+		lcs, ok := d.histogramLCS(a0, a1, b0, b1)
+		if !ok {
+			d.myers(a0, a1, b0, b1, false)
+			return
+		}
+
+		if lcs == nil {
+			d.a.change(a0, a1)
+			d.b.change(b0, b1)
+			return
+		}
+
+		d.histogram(a0, lcs.begin1, b0, lcs.begin2)
+		a0, b0 = lcs.end1+1, lcs.end2+1
+	}
+}
+
+// histogramLCS returns the best common region of the ranges, or nil if there
+// isn't any. It returns false if the ranges must be compared with Myers.
+func (d *differ) histogramLCS(a0, a1, b0, b1 int) (*histogramRegion, bool) {
+	index := &histogramIndex{
+		records: make(map[int]*histogramRecord),
+		next:    make(map[int]int),
+		record:  make(map[int]*histogramRecord),
+		count:   histogramMaxChainLength + 1,
+	}
+
+	for i := a1 - 1; i >= a0; i-- {
+		r, ok := index.records[d.a.lines[i]]
+		if !ok {
+			r = &histogramRecord{first: i}
+			index.records[d.a.lines[i]] = r
+			index.next[i] = -1
+		} else {
+			index.next[i] = r.first
+			r.first = i
+		}
+
+		r.count++
+		index.record[i] = r
+	}
+
+	var lcs *histogramRegion
+	for i := b0; i < b1; {
+		i = d.histogramTryLCS(index, &lcs, i, a0, a1, b0, b1)
+	}
+
+	if index.hasCommon && histogramMaxChainLength < index.count {
+		return nil, false
+	}
+
+	return lcs, true
+}
+
+// histogramTryLCS looks for a better common region starting at the line
+// bi of the second range. It returns the next line of the second range to
+// look at.
+func (d *differ) histogramTryLCS(index *histogramIndex, lcs **histogramRegion, bi, a0, a1, b0, b1 int) int {
+	bNext := bi + 1
+	r, ok := index.records[d.b.lines[bi]]
+	if !ok {
+		return bNext
+	}
+
+	index.hasCommon = true
+	if r.count > index.count {
+		return bNext
+	}
+
+	as := r.first
+	for {
+		np := index.next[as]
+		bs := bi
+		ae, be := as, bs
+		rc := r.count
+
+		for a0 < as && b0 < bs && d.a.lines[as-1] == d.b.lines[bs-1] {
+			as--
+			bs--
+			if 1 < rc {
+				rc = min(rc, index.record[as].count)
+			}
+		}
+
+		for ae < a1-1 && be < b1-1 && d.a.lines[ae+1] == d.b.lines[be+1] {
+			ae++
+			be++
+			if 1 < rc {
+				rc = min(rc, index.record[ae].count)
+			}
+		}
+
+		if bNext <= be {
+			bNext = be + 1
+		}
+
+		if *lcs == nil || (*lcs).end1-(*lcs).begin1 < ae-as || rc < index.count {
+			*lcs = &histogramRegion{begin1: as, end1: ae, begin2: bs, end2: be}
+			index.count = rc
+		}
+
+		if np == -1 {
+			return bNext
+		}
+
+		for np <= ae {
+			np = index.next[np]
+			if np == -1 {
+				return bNext
+			}
+		}
+
+		as = np
+	}
+}
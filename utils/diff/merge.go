@@ -0,0 +1,533 @@
+package diff
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/binary"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ConflictStyle defines how the conflicting regions of a merge are written.
+type ConflictStyle int8
+
+const (
+	// MergeStyle writes the lines of both sides of a conflict, separated by
+	// conflict markers. Lines common to both sides are kept out of the
+	// conflicts, unless they are three lines or less, or have no letter or
+	// digit, between two conflicts. This is the default style.
+	MergeStyle ConflictStyle = iota
+	// Diff3Style writes the lines of the base between the lines of both
+	// sides, after a "|||||||" marker.
+	Diff3Style
+	// ZealousDiff3Style is like Diff3Style, but lines common to the start or
+	// the end of both sides are kept out of the conflict, as MergeStyle does.
+	ZealousDiff3Style
+)
+
+// MergeFavor defines how the conflicting regions of a merge are resolved.
+type MergeFavor int8
+
+const (
+	// FavorNone leaves the conflicting regions marked as conflicts.
+	FavorNone MergeFavor = iota
+	// FavorOurs resolves the conflicting regions using our side.
+	FavorOurs
+	// FavorTheirs resolves the conflicting regions using their side.
+	FavorTheirs
+	// FavorUnion resolves the conflicting regions using the lines of both
+	// sides, ours first.
+	FavorUnion
+)
+
+// DefaultMarkerSize is the length of the conflict markers.
+const DefaultMarkerSize = 7
+
+// MergeOptions describes how a three-way merge should be performed.
+type MergeOptions struct {
+	// Style of the conflict markers, by default MergeStyle.
+	Style ConflictStyle
+	// Favor defines how the conflicts are resolved, by default they are left
+	// marked in the text.
+	Favor MergeFavor
+	// OursLabel, BaseLabel and TheirsLabel are written next to the conflict
+	// markers of each side.
+	OursLabel, BaseLabel, TheirsLabel string
+	// MarkerSize is the length of the conflict markers, by default
+	// DefaultMarkerSize.
+	MarkerSize int
+}
+
+// MergeResult is the result of a three-way merge.
+type MergeResult struct {
+	// Text is the merged text, including conflict markers if there are
+	// conflicts. If any input is binary, Text is our side.
+	Text string
+	// Binary is true if any input was detected as binary, in that case the
+	// whole file is a conflict unless it's trivially merged or a side is
+	// favored.
+	Binary bool
+	// Conflicts are the regions that could not be merged.
+	Conflicts []Conflict
+}
+
+// Conflict describes a region of a three-way merge modified in different
+// ways by both sides.
+type Conflict struct {
+	// Line is the line number, starting at 1, of the first conflict marker
+	// in the merged text.
+	Line int
+	// Base, Ours and Theirs are the lines of each side of the region.
+	Base, Ours, Theirs string
+}
+
+// Merge performs a three-way merge of the lines of ours and theirs, using
+// base as their common ancestor, mimicking `git merge-file`.
+func Merge(base, ours, theirs string, opts *MergeOptions) *MergeResult {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+
+	switch {
+	case ours == theirs, base == theirs:
+		return &MergeResult{Text: ours}
+	case base == ours:
+		return &MergeResult{Text: theirs}
+	}
+
+	if isBinary(base) || isBinary(ours) || isBinary(theirs) {
+		return mergeBinary(base, ours, theirs, opts)
+	}
+
+	m := &merger{
+		opts:   opts,
+		base:   splitLines(base),
+		marker: opts.MarkerSize,
+	}
+
+	if m.marker <= 0 {
+		m.marker = DefaultMarkerSize
+	}
+
+	m.merge(lineHunks(base, ours), lineHunks(base, theirs))
+	return &MergeResult{
+		Text:      m.out.String(),
+		Conflicts: m.conflicts,
+	}
+}
+
+func mergeBinary(base, ours, theirs string, opts *MergeOptions) *MergeResult {
+	res := &MergeResult{Text: ours, Binary: true}
+	switch opts.Favor {
+	case FavorOurs:
+	case FavorTheirs:
+		res.Text = theirs
+	default:
+		res.Conflicts = []Conflict{{Line: 1, Base: base, Ours: ours, Theirs: theirs}}
+	}
+
+	return res
+}
+
+func isBinary(s string) bool {
+	ok, _ := binary.IsBinary(strings.NewReader(s))
+	return ok
+}
+
+// hunk is a change of a side, replacing the base lines [start, end) by lines.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// lineHunks returns the changes needed to turn src into dst.
+func lineHunks(src, dst string) []hunk {
+	var hunks []hunk
+	var current *hunk
+
+	pos := 0
+	for _, d := range DoWithOptions(src, dst, &Options{}) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+
+			pos += len(lines)
+			continue
+		}
+
+		if current == nil {
+			current = &hunk{start: pos, end: pos}
+		}
+
+		if d.Type == diffmatchpatch.DiffDelete {
+			pos += len(lines)
+			current.end = pos
+		} else {
+			current.lines = append(current.lines, lines...)
+		}
+	}
+
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+
+	return hunks
+}
+
+type merger struct {
+	opts   *MergeOptions
+	base   []string
+	marker int
+
+	chunks []chunk
+
+	out       strings.Builder
+	line      int
+	conflicts []Conflict
+}
+
+// chunk is a region of the merged text, either resolved or in conflict.
+type chunk struct {
+	// lines are the lines of a resolved chunk.
+	lines []string
+	// changed is true if a resolved chunk was changed by any side.
+	changed bool
+
+	conflict bool
+	// start and end are the range of base lines of a conflict.
+	start, end   int
+	ours, theirs []string
+}
+
+func (m *merger) merge(ours, theirs []hunk) {
+	pos := 0
+	for len(ours) != 0 || len(theirs) != 0 {
+		var start int
+		switch {
+		case len(ours) == 0:
+			start = theirs[0].start
+		case len(theirs) == 0:
+			start = ours[0].start
+		default:
+			start = min(ours[0].start, theirs[0].start)
+		}
+
+		m.add(chunk{lines: m.base[pos:start]})
+
+		// collect all the hunks of both sides overlapping or touching the
+		// region, growing it until no more hunks overlap
+		end := start
+		var o, t []hunk
+		for {
+			grown := false
+			for len(ours) != 0 && ours[0].start <= end {
+				end = max(end, ours[0].end)
+				o, ours = append(o, ours[0]), ours[1:]
+				grown = true
+			}
+
+			for len(theirs) != 0 && theirs[0].start <= end {
+				end = max(end, theirs[0].end)
+				t, theirs = append(t, theirs[0]), theirs[1:]
+				grown = true
+			}
+
+			if !grown {
+				break
+			}
+		}
+
+		m.mergeRegion(start, end, o, t)
+		pos = end
+	}
+
+	m.add(chunk{lines: m.base[pos:]})
+	if m.opts.Style == MergeStyle {
+		m.simplifyConflicts()
+	}
+
+	for _, ch := range m.chunks {
+		m.writeChunk(ch)
+	}
+}
+
+func (m *merger) mergeRegion(start, end int, o, t []hunk) {
+	oursLines := applyHunks(m.base, start, end, o)
+	theirsLines := applyHunks(m.base, start, end, t)
+
+	switch {
+	case len(t) == 0:
+		m.add(chunk{lines: oursLines, changed: true})
+		return
+	case len(o) == 0:
+		m.add(chunk{lines: theirsLines, changed: true})
+		return
+	case len(o) == 1 && len(t) == 1 && equalHunks(o[0], t[0]):
+		// as git does, the same change on both sides isn't taken as a
+		// change, so it never keeps the conflicts around it apart
+		m.add(chunk{lines: theirsLines})
+		return
+	}
+
+	conflict := chunk{conflict: true, start: start, end: end}
+	switch m.opts.Style {
+	case MergeStyle:
+		m.refineConflict(conflict, oursLines, theirsLines)
+	case ZealousDiff3Style:
+		prefix := commonPrefix(oursLines, theirsLines)
+		m.add(chunk{lines: oursLines[:prefix]})
+		oursLines, theirsLines = oursLines[prefix:], theirsLines[prefix:]
+
+		suffix := commonSuffix(oursLines, theirsLines)
+		conflict.ours = oursLines[:len(oursLines)-suffix]
+		conflict.theirs = theirsLines[:len(theirsLines)-suffix]
+		m.add(conflict)
+		m.add(chunk{lines: oursLines[len(oursLines)-suffix:]})
+	default:
+		conflict.ours, conflict.theirs = oursLines, theirsLines
+		m.add(conflict)
+	}
+}
+
+// refineConflict adds the conflict splitting it in the parts where ours and
+// theirs differ, leaving the lines common to both sides out of them, as git
+// does.
+func (m *merger) refineConflict(conflict chunk, ours, theirs []string) {
+	if len(ours) == 0 || len(theirs) == 0 {
+		conflict.ours, conflict.theirs = ours, theirs
+		m.add(conflict)
+		return
+	}
+
+	hunks := lineHunks(strings.Join(ours, ""), strings.Join(theirs, ""))
+	if len(hunks) == 0 {
+		m.add(chunk{lines: ours, changed: true})
+		return
+	}
+
+	pos := 0
+	for _, h := range hunks {
+		m.add(chunk{lines: ours[pos:h.start]})
+		conflict.ours, conflict.theirs = ours[h.start:h.end], h.lines
+		m.add(conflict)
+		pos = h.end
+	}
+
+	m.add(chunk{lines: ours[pos:]})
+}
+
+// simplifyConflicts joins the conflicts separated by three lines or less, or
+// by lines without any letter or digit, with the lines between them, as git
+// merge-file does.
+func (m *merger) simplifyConflicts() {
+	var chunks []chunk
+	for i := 0; i < len(m.chunks); i++ {
+		ch := m.chunks[i]
+		for ch.conflict {
+			j := i + 1
+			var between []string
+			for j < len(m.chunks) && !m.chunks[j].conflict && !m.chunks[j].changed {
+				between = append(between, m.chunks[j].lines...)
+				j++
+			}
+
+			if j == len(m.chunks) || !m.chunks[j].conflict ||
+				len(between) > 3 && hasAlnum(between) {
+				break
+			}
+
+			next := m.chunks[j]
+			ch.end = next.end
+			ch.ours = joinLines(ch.ours, between, next.ours)
+			ch.theirs = joinLines(ch.theirs, between, next.theirs)
+			i = j
+		}
+
+		chunks = append(chunks, ch)
+	}
+
+	m.chunks = chunks
+}
+
+func (m *merger) add(ch chunk) {
+	// the empty changed chunks are kept, as the conflicts around a change
+	// are never joined
+	if !ch.conflict && !ch.changed && len(ch.lines) == 0 {
+		return
+	}
+
+	m.chunks = append(m.chunks, ch)
+}
+
+func (m *merger) writeChunk(ch chunk) {
+	if !ch.conflict {
+		m.write(ch.lines)
+		return
+	}
+
+	switch m.opts.Favor {
+	case FavorOurs:
+		m.write(ch.ours)
+		return
+	case FavorTheirs:
+		m.write(ch.theirs)
+		return
+	case FavorUnion:
+		m.writeSide(ch.ours)
+		m.write(ch.theirs)
+		return
+	}
+
+	baseLines := m.base[ch.start:ch.end]
+	m.conflicts = append(m.conflicts, Conflict{
+		Line:   m.line + 1,
+		Base:   strings.Join(baseLines, ""),
+		Ours:   strings.Join(ch.ours, ""),
+		Theirs: strings.Join(ch.theirs, ""),
+	})
+
+	m.writeMarker('<', m.opts.OursLabel)
+	m.writeSide(ch.ours)
+	if m.opts.Style != MergeStyle {
+		m.writeMarker('|', m.opts.BaseLabel)
+		m.writeSide(baseLines)
+	}
+
+	m.writeMarker('=', "")
+	m.writeSide(ch.theirs)
+	m.writeMarker('>', m.opts.TheirsLabel)
+}
+
+func (m *merger) write(lines []string) {
+	for _, l := range lines {
+		m.out.WriteString(l)
+	}
+
+	m.line += len(lines)
+}
+
+// writeSide writes the lines of a side of a conflict, ensuring that the last
+// one ends with a newline so the following marker starts on its own line.
+func (m *merger) writeSide(lines []string) {
+	m.write(lines)
+	if len(lines) != 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		m.out.WriteByte('\n')
+	}
+}
+
+func (m *merger) writeMarker(c byte, label string) {
+	m.out.WriteString(strings.Repeat(string(c), m.marker))
+	if label != "" {
+		m.out.WriteString(" " + label)
+	}
+
+	m.out.WriteByte('\n')
+	m.line++
+}
+
+// applyHunks returns the base lines [start, end) with the given hunks
+// applied.
+func applyHunks(base []string, start, end int, hunks []hunk) []string {
+	var lines []string
+	pos := start
+	for _, h := range hunks {
+		lines = append(lines, base[pos:h.start]...)
+		lines = append(lines, h.lines...)
+		pos = h.end
+	}
+
+	return append(lines, base[pos:end]...)
+}
+
+// splitLines splits s in lines, keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// joinLines returns a new slice with the lines of all the given slices.
+func joinLines(lines ...[]string) []string {
+	var joined []string
+	for _, l := range lines {
+		joined = append(joined, l...)
+	}
+
+	return joined
+}
+
+// hasAlnum returns true if any of the lines has an ASCII letter or digit.
+func hasAlnum(lines []string) bool {
+	for _, l := range lines {
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			if '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func equalHunks(a, b hunk) bool {
+	return a.start == b.start && a.end == b.end && equalLines(a.lines, b.lines)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func commonPrefix(a, b []string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+func commonSuffix(a, b []string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+
+	return i
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
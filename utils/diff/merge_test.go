@@ -0,0 +1,275 @@
+package diff_test
+
+import (
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	. "gopkg.in/check.v1"
+)
+
+type MergeSuite struct{}
+
+var _ = Suite(&MergeSuite{})
+
+var mergeTests = [...]struct {
+	base, ours, theirs string
+	expected           string
+	conflicts          int
+}{
+	// trivial merges
+	{"a\n", "a\n", "a\n", "a\n", 0},
+	{"a\n", "b\n", "a\n", "b\n", 0},
+	{"a\n", "a\n", "b\n", "b\n", 0},
+	{"a\n", "b\n", "b\n", "b\n", 0},
+	// non overlapping changes
+	{"a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", 0},
+	{"a\nb\nc\nd\ne\n", "a\nb\nc\nd\ne\nf\n", "z\na\nb\nc\nd\ne\n", "z\na\nb\nc\nd\ne\nf\n", 0},
+	{"a\nb\nc\nd\ne\n", "a\nc\nd\ne\n", "a\nb\nc\nd\n", "a\nc\nd\n", 0},
+	// same change on both sides
+	{"a\nb\nc\nd\ne\n", "a\nB\nc\nd\nE\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\nE\n", 0},
+	// conflicts
+	{"a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n", "a\n<<<<<<<\nB\n=======\nX\n>>>>>>>\nc\n", 1},
+	{
+		"a\nb\nc\nd\ne\nh\nf\ng\n",
+		"a\nB\nc\nd\ne\nh\nF\ng\n",
+		"a\nX\nc\nd\ne\nh\nY\ng\n",
+		"a\n<<<<<<<\nB\n=======\nX\n>>>>>>>\nc\nd\ne\nh\n<<<<<<<\nF\n=======\nY\n>>>>>>>\ng\n",
+		2,
+	},
+	// conflicts separated by three lines or less, or without alphanumeric
+	// characters, are joined
+	{
+		"a\nb\nc\nd\ne\nf\ng\n",
+		"a\nB\nc\nd\ne\nF\ng\n",
+		"a\nX\nc\nd\ne\nY\ng\n",
+		"a\n<<<<<<<\nB\nc\nd\ne\nF\n=======\nX\nc\nd\ne\nY\n>>>>>>>\ng\n",
+		1,
+	},
+	{
+		"a\nb\n}\n\n}\n\nf\ng\n",
+		"a\nB\n}\n\n}\n\nF\ng\n",
+		"a\nX\n}\n\n}\n\nY\ng\n",
+		"a\n<<<<<<<\nB\n}\n\n}\n\nF\n=======\nX\n}\n\n}\n\nY\n>>>>>>>\ng\n",
+		1,
+	},
+	{
+		"x\na\n}\n\nc\n",
+		"a\ny\n}\nc\n",
+		"c\na\ny\n}\nb\n\nc\n",
+		"<<<<<<<\na\ny\n}\n=======\nc\na\ny\n}\nb\n\n>>>>>>>\nc\n",
+		1,
+	},
+	// conflicts separated by a change of a side are never joined
+	{
+		"a\nb\nc\nd\ne\n",
+		"A\nb\nc\nd\nE\n",
+		"X\nb\nd\nY\n",
+		"<<<<<<<\nA\n=======\nX\n>>>>>>>\nb\nd\n<<<<<<<\nE\n=======\nY\n>>>>>>>\n",
+		2,
+	},
+	// the lines common to both sides are left out of the conflicts
+	{
+		"a\nb\nc\n",
+		"a\nB\nc\nd\ne\nf\ng\nB\n",
+		"a\nX\nc\nd\ne\nf\ng\nX\n",
+		"a\n<<<<<<<\nB\n=======\nX\n>>>>>>>\nc\nd\ne\nf\ng\n<<<<<<<\nB\n=======\nX\n>>>>>>>\n",
+		2,
+	},
+	// the sides are diffed with the same algorithm as git
+	{"b\nb\n\nb\nb\nb\n", "b\na\n\nb\nb\n", "b\nb\n\nb\nb\n", "b\na\n\nb\nb\n", 0},
+	// add/add
+	{"", "a\nb\n", "a\nc\n", "a\n<<<<<<<\nb\n=======\nc\n>>>>>>>\n", 1},
+	// missing newline at the end of file
+	{"a\n", "b", "c", "<<<<<<<\nb\n=======\nc\n>>>>>>>\n", 1},
+}
+
+func (s *MergeSuite) TestMerge(c *C) {
+	for i, t := range mergeTests {
+		res := diff.Merge(t.base, t.ours, t.theirs, nil)
+		c.Assert(res.Text, Equals, t.expected, Commentf("subtest %d", i))
+		c.Assert(res.Conflicts, HasLen, t.conflicts, Commentf("subtest %d", i))
+		c.Assert(res.Binary, Equals, false)
+	}
+}
+
+// TestMergeSource checks the merge of some code against the result of
+// git merge-file.
+func (s *MergeSuite) TestMergeSource(c *C) {
+	base := `// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD.
+	Commit plumbing.Hash
+	// Author is the author's signature of the merge commit.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate(r *Repository) error {
+	return nil
+}
+`
+	ours := `// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD.
+	Commit plumbing.Hash
+	// NoCommit stops before creating the merge commit.
+	NoCommit bool
+	// Author is the author's signature of the merge commit.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate(r *Repository) error {
+	if o.NoCommit && o.FastForward == FastForwardOnly {
+		return ErrNoCommitFastForward
+	}
+
+	if o.Commit.IsZero() {
+		return ErrMissingCommit
+	}
+
+	return nil
+}
+`
+	theirs := `// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD.
+	Commit plumbing.Hash
+	// ConflictStyle defines how the conflicts are written.
+	ConflictStyle diff.ConflictStyle
+	// Author is the author's signature of the merge commit.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate(r *Repository) error {
+	if o.Commit.IsZero() {
+		return ErrMissingCommit
+	}
+
+	if o.ConflictStyle < 0 {
+		return ErrInvalidConflictStyle
+	}
+
+	return nil
+}
+`
+
+	res := diff.Merge(base, ours, theirs, &diff.MergeOptions{
+		OursLabel:   "HEAD",
+		TheirsLabel: "feature",
+	})
+
+	c.Assert(res.Conflicts, HasLen, 3)
+	c.Assert(res.Text, Equals, `// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD.
+	Commit plumbing.Hash
+<<<<<<< HEAD
+	// NoCommit stops before creating the merge commit.
+	NoCommit bool
+=======
+	// ConflictStyle defines how the conflicts are written.
+	ConflictStyle diff.ConflictStyle
+>>>>>>> feature
+	// Author is the author's signature of the merge commit.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate(r *Repository) error {
+<<<<<<< HEAD
+	if o.NoCommit && o.FastForward == FastForwardOnly {
+		return ErrNoCommitFastForward
+	}
+
+=======
+>>>>>>> feature
+	if o.Commit.IsZero() {
+		return ErrMissingCommit
+	}
+
+<<<<<<< HEAD
+=======
+	if o.ConflictStyle < 0 {
+		return ErrInvalidConflictStyle
+	}
+
+>>>>>>> feature
+	return nil
+}
+`)
+}
+
+func (s *MergeSuite) TestMergeConflict(c *C) {
+	res := diff.Merge("a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n", nil)
+	c.Assert(res.Conflicts, DeepEquals, []diff.Conflict{
+		{Line: 2, Base: "b\n", Ours: "B\n", Theirs: "X\n"},
+	})
+}
+
+func (s *MergeSuite) TestMergeLabels(c *C) {
+	res := diff.Merge("a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n", &diff.MergeOptions{
+		Style:       diff.Diff3Style,
+		OursLabel:   "HEAD",
+		BaseLabel:   "base",
+		TheirsLabel: "feature",
+		MarkerSize:  3,
+	})
+
+	c.Assert(res.Text, Equals, "a\n<<< HEAD\nB\n||| base\nb\n===\nX\n>>> feature\nc\n")
+}
+
+func (s *MergeSuite) TestMergeStyles(c *C) {
+	base := "a\nb\nc\n"
+	ours := "a\nx\nB\ny\nc\n"
+	theirs := "a\nx\nX\ny\nc\n"
+
+	res := diff.Merge(base, ours, theirs, &diff.MergeOptions{Style: diff.MergeStyle})
+	c.Assert(res.Text, Equals, "a\nx\n<<<<<<<\nB\n=======\nX\n>>>>>>>\ny\nc\n")
+
+	res = diff.Merge(base, ours, theirs, &diff.MergeOptions{Style: diff.Diff3Style})
+	c.Assert(res.Text, Equals, "a\n<<<<<<<\nx\nB\ny\n|||||||\nb\n=======\nx\nX\ny\n>>>>>>>\nc\n")
+
+	res = diff.Merge(base, ours, theirs, &diff.MergeOptions{Style: diff.ZealousDiff3Style})
+	c.Assert(res.Text, Equals, "a\nx\n<<<<<<<\nB\n|||||||\nb\n=======\nX\n>>>>>>>\ny\nc\n")
+}
+
+func (s *MergeSuite) TestMergeFavor(c *C) {
+	base := "a\nb\nc\nd\ne\n"
+	ours := "a\nB\nc\nd\ne\nf\n"
+	theirs := "a\nX\nc\nd\ne\n"
+
+	res := diff.Merge(base, ours, theirs, &diff.MergeOptions{Favor: diff.FavorOurs})
+	c.Assert(res.Text, Equals, "a\nB\nc\nd\ne\nf\n")
+	c.Assert(res.Conflicts, HasLen, 0)
+
+	res = diff.Merge(base, ours, theirs, &diff.MergeOptions{Favor: diff.FavorTheirs})
+	c.Assert(res.Text, Equals, "a\nX\nc\nd\ne\nf\n")
+	c.Assert(res.Conflicts, HasLen, 0)
+
+	res = diff.Merge(base, ours, theirs, &diff.MergeOptions{Favor: diff.FavorUnion})
+	c.Assert(res.Text, Equals, "a\nB\nX\nc\nd\ne\nf\n")
+	c.Assert(res.Conflicts, HasLen, 0)
+}
+
+func (s *MergeSuite) TestMergeBinary(c *C) {
+	base := "a\x00b\n"
+	ours := "a\x00B\n"
+	theirs := "a\x00X\n"
+
+	res := diff.Merge(base, ours, theirs, nil)
+	c.Assert(res.Binary, Equals, true)
+	c.Assert(res.Text, Equals, ours)
+	c.Assert(res.Conflicts, DeepEquals, []diff.Conflict{
+		{Line: 1, Base: base, Ours: ours, Theirs: theirs},
+	})
+
+	res = diff.Merge(base, ours, theirs, &diff.MergeOptions{Favor: diff.FavorTheirs})
+	c.Assert(res.Binary, Equals, true)
+	c.Assert(res.Text, Equals, theirs)
+	c.Assert(res.Conflicts, HasLen, 0)
+
+	res = diff.Merge(base, base, theirs, nil)
+	c.Assert(res.Text, Equals, theirs)
+	c.Assert(res.Conflicts, HasLen, 0)
+}
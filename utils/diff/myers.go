@@ -0,0 +1,444 @@
+package diff
+
+import "math"
+
+// The Myers implementation follows the one of xdiff, the diff library of git,
+// including its heuristics, so the diffs show the same hunks.
+
+const (
+	// maxEqLimit is the maximum number of matches of a line before it is
+	// considered too common to be relevant.
+	maxEqLimit = 1024
+	// simScanWindow is the number of lines looked at around a common line
+	// to decide whether it must be discarded.
+	simScanWindow = 100
+	// kpdisRun is the ratio of common and unique lines of a run above which
+	// the common lines are discarded.
+	kpdisRun = 4
+	// maxCostMin is the minimum edit cost above which the search for the
+	// middle snake is stopped.
+	maxCostMin = 256
+	// heurMinCost is the edit cost above which the interesting snakes are
+	// looked for.
+	heurMinCost = 256
+	// snakeCount is the length of a snake to be considered interesting.
+	snakeCount = 20
+	// kHeur is the factor of the edit cost for a snake to be interesting.
+	kHeur = 4
+)
+
+// myersFile holds the lines of a file compared by Myers, once the lines
+// without matches in the other file are discarded.
+type myersFile struct {
+	f *diffFile
+	// lines holds the identifiers of the lines not discarded
+	lines []int
+	// index holds the position in the file of the lines not discarded
+	index []int
+}
+
+// myers marks the changed lines of the ranges [a0, a1) and [b0, b1) with the
+// Myers algorithm. If minimal is false, the heuristics that make the diff
+// faster at the cost of a suboptimal result are enabled.
+func (d *differ) myers(a0, a1, b0, b1 int, minimal bool) {
+	n1, n2 := a1-a0, b1-b0
+
+	// the common prefix and suffix are left unchanged
+	prefix := 0
+	for prefix < n1 && prefix < n2 && d.a.lines[a0+prefix] == d.b.lines[b0+prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < n1-prefix && suffix < n2-prefix && d.a.lines[a1-1-suffix] == d.b.lines[b1-1-suffix] {
+		suffix++
+	}
+
+	count1 := countLines(d.a.lines[a0:a1])
+	count2 := countLines(d.b.lines[b0:b1])
+	m1 := newMyersFile(d.a, a0+prefix, a1-suffix, n1, count2)
+	m2 := newMyersFile(d.b, b0+prefix, b1-suffix, n2, count1)
+
+	ndiags := len(m1.lines) + len(m2.lines) + 3
+	s := &myersSearch{
+		m1:      m1,
+		m2:      m2,
+		forward: make([]int, ndiags),
+		back:    make([]int, ndiags),
+		offset:  len(m2.lines) + 1,
+		maxCost: bogoSqrt(ndiags),
+	}
+
+	if s.maxCost < maxCostMin {
+		s.maxCost = maxCostMin
+	}
+
+	s.compare(0, len(m1.lines), 0, len(m2.lines), minimal)
+}
+
+func countLines(lines []int) map[int]int {
+	count := make(map[int]int)
+	for _, l := range lines {
+		count[l]++
+	}
+
+	return count
+}
+
+// newMyersFile discards the lines of [start, end) of the file that don't
+// appear in the other one, marking them as changed, as well as the lines
+// appearing too many times in the middle of discarded lines. n is the length
+// of the compared range and other holds the number of times each line appears
+// in the other file.
+func newMyersFile(f *diffFile, start, end, n int, other map[int]int) *myersFile {
+	limit := bogoSqrt(n)
+	if limit > maxEqLimit {
+		limit = maxEqLimit
+	}
+
+	dis := make([]int, end-start)
+	for i := range dis {
+		matches := other[f.lines[start+i]]
+		switch {
+		case matches == 0:
+			dis[i] = 0
+		case matches >= limit:
+			dis[i] = 2
+		default:
+			dis[i] = 1
+		}
+	}
+
+	m := &myersFile{f: f}
+	for i := range dis {
+		if dis[i] == 1 || dis[i] == 2 && !cleanMultimatch(dis, i, 0, len(dis)-1) {
+			m.lines = append(m.lines, f.lines[start+i])
+			m.index = append(m.index, start+i)
+		} else {
+			f.changed[start+i] = true
+		}
+	}
+
+	return m
+}
+
+// cleanMultimatch tells whether the line i, appearing many times in the other
+// file, must be discarded because it is surrounded by lines without matches.
+func cleanMultimatch(dis []int, i, s, e int) bool {
+	if i-s > simScanWindow {
+		s = i - simScanWindow
+	}
+
+	if e-i > simScanWindow {
+		e = i + simScanWindow
+	}
+
+	rdis0, rpdis0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+
+	if rdis0 == 0 {
+		return false
+	}
+
+	rdis1, rpdis1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+
+	if rdis1 == 0 {
+		return false
+	}
+
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+	return rpdis1*kpdisRun < rpdis1+rdis1
+}
+
+// bogoSqrt returns an approximation of the square root of n.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+// myersSearch holds the state of the search of the shortest edit script.
+type myersSearch struct {
+	m1, m2 *myersFile
+	// forward and back hold the furthest reaching paths of each diagonal,
+	// shifted by offset
+	forward, back []int
+	offset        int
+	maxCost       int
+}
+
+// myersSplit is the point splitting the ranges being compared, and whether
+// each side must be compared minimally.
+type myersSplit struct {
+	i1, i2       int
+	minLo, minHi bool
+}
+
+// compare marks the changed lines of the ranges [off1, lim1) and [off2, lim2)
+// of the lines not discarded, dividing them recursively.
+func (s *myersSearch) compare(off1, lim1, off2, lim2 int, minimal bool) {
+	ha1, ha2 := s.m1.lines, s.m2.lines
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			s.m2.f.changed[s.m2.index[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			s.m1.f.changed[s.m1.index[off1]] = true
+		}
+	default:
+		spl := s.split(off1, lim1, off2, lim2, minimal)
+		s.compare(off1, spl.i1, off2, spl.i2, spl.minLo)
+		s.compare(spl.i1, lim1, spl.i2, lim2, spl.minHi)
+	}
+}
+
+func (s *myersSearch) kf(d int) int   { return s.forward[s.offset+d] }
+func (s *myersSearch) setKf(d, v int) { s.forward[s.offset+d] = v }
+func (s *myersSearch) kb(d int) int   { return s.back[s.offset+d] }
+func (s *myersSearch) setKb(d, v int) { s.back[s.offset+d] = v }
+
+// split finds the point where the ranges must be divided, usually the middle
+// snake of the shortest edit script, walking the diagonals forwards from the
+// start of the ranges and backwards from their end at the same time.
+func (s *myersSearch) split(off1, lim1, off2, lim2 int, minimal bool) myersSplit {
+	ha1, ha2 := s.m1.lines, s.m2.lines
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	s.setKf(fmid, off1)
+	s.setKb(bmid, lim1)
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			s.setKf(fmin-1, -1)
+		} else {
+			fmin++
+		}
+
+		if fmax < dmax {
+			fmax++
+			s.setKf(fmax+1, -1)
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if s.kf(d-1) >= s.kf(d+1) {
+				i1 = s.kf(d-1) + 1
+			} else {
+				i1 = s.kf(d + 1)
+			}
+
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+
+			if i1-prev1 > snakeCount {
+				gotSnake = true
+			}
+
+			s.setKf(d, i1)
+			if odd && bmin <= d && d <= bmax && s.kb(d) <= i1 {
+				return myersSplit{i1, i2, true, true}
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			s.setKb(bmin-1, math.MaxInt32)
+		} else {
+			bmin++
+		}
+
+		if bmax < dmax {
+			bmax++
+			s.setKb(bmax+1, math.MaxInt32)
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if s.kb(d-1) < s.kb(d+1) {
+				i1 = s.kb(d - 1)
+			} else {
+				i1 = s.kb(d+1) - 1
+			}
+
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+
+			if prev1-i1 > snakeCount {
+				gotSnake = true
+			}
+
+			s.setKb(d, i1)
+			if !odd && fmin <= d && d <= fmax && i1 <= s.kf(d) {
+				return myersSplit{i1, i2, true, true}
+			}
+		}
+
+		if minimal {
+			continue
+		}
+
+		// if the edit cost is high, look for a diagonal that reached an
+		// interesting path, far from the corners and close to the middle
+		if gotSnake && ec > heurMinCost {
+			if spl, ok := s.interestingForward(off1, lim1, off2, lim2, fmin, fmax, fmid, ec); ok {
+				return spl
+			}
+
+			if spl, ok := s.interestingBackward(off1, lim1, off2, lim2, bmin, bmax, bmid, ec); ok {
+				return spl
+			}
+		}
+
+		if ec >= s.maxCost {
+			return s.furthest(off1, lim1, off2, lim2, fmin, fmax, bmin, bmax)
+		}
+	}
+}
+
+func (s *myersSearch) interestingForward(off1, lim1, off2, lim2, fmin, fmax, fmid, ec int) (myersSplit, bool) {
+	ha1, ha2 := s.m1.lines, s.m2.lines
+	var spl myersSplit
+	best := 0
+	for d := fmax; d >= fmin; d -= 2 {
+		dd := fmid - d
+		if d > fmid {
+			dd = d - fmid
+		}
+
+		i1 := s.kf(d)
+		i2 := i1 - d
+		v := (i1 - off1) + (i2 - off2) - dd
+		if v > kHeur*ec && v > best &&
+			off1+snakeCount <= i1 && i1 < lim1 &&
+			off2+snakeCount <= i2 && i2 < lim2 {
+			for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+				if k == snakeCount {
+					best = v
+					spl.i1, spl.i2 = i1, i2
+					break
+				}
+			}
+		}
+	}
+
+	spl.minLo, spl.minHi = true, false
+	return spl, best > 0
+}
+
+func (s *myersSearch) interestingBackward(off1, lim1, off2, lim2, bmin, bmax, bmid, ec int) (myersSplit, bool) {
+	ha1, ha2 := s.m1.lines, s.m2.lines
+	var spl myersSplit
+	best := 0
+	for d := bmax; d >= bmin; d -= 2 {
+		dd := bmid - d
+		if d > bmid {
+			dd = d - bmid
+		}
+
+		i1 := s.kb(d)
+		i2 := i1 - d
+		v := (lim1 - i1) + (lim2 - i2) - dd
+		if v > kHeur*ec && v > best &&
+			off1 < i1 && i1 <= lim1-snakeCount &&
+			off2 < i2 && i2 <= lim2-snakeCount {
+			for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+				if k == snakeCount-1 {
+					best = v
+					spl.i1, spl.i2 = i1, i2
+					break
+				}
+			}
+		}
+	}
+
+	spl.minLo, spl.minHi = false, true
+	return spl, best > 0
+}
+
+// furthest returns the split at the furthest reaching path, when the search
+// took too long.
+func (s *myersSearch) furthest(off1, lim1, off2, lim2, fmin, fmax, bmin, bmax int) myersSplit {
+	fbest, fbest1 := -1, -1
+	for d := fmax; d >= fmin; d -= 2 {
+		i1 := min(s.kf(d), lim1)
+		i2 := i1 - d
+		if lim2 < i2 {
+			i1, i2 = lim2+d, lim2
+		}
+
+		if fbest < i1+i2 {
+			fbest, fbest1 = i1+i2, i1
+		}
+	}
+
+	bbest, bbest1 := math.MaxInt32, math.MaxInt32
+	for d := bmax; d >= bmin; d -= 2 {
+		i1 := max(off1, s.kb(d))
+		i2 := i1 - d
+		if i2 < off2 {
+			i1, i2 = off2+d, off2
+		}
+
+		if i1+i2 < bbest {
+			bbest, bbest1 = i1+i2, i1
+		}
+	}
+
+	if (lim1+lim2)-bbest < fbest-(off1+off2) {
+		return myersSplit{fbest1, fbest - fbest1, true, false}
+	}
+
+	return myersSplit{bbest1, bbest - bbest1, false, true}
+}
@@ -0,0 +1,151 @@
+package diff
+
+// patienceEntry is a line appearing in the ranges being compared by patience.
+type patienceEntry struct {
+	// line1 and line2 are the positions of the line in each file, if unique
+	line1, line2 int
+	// count1 and count2 are the times the line appears in each file
+	count1, count2 int
+	// previous is the previous entry in the longest common sequence
+	previous *patienceEntry
+}
+
+// patience marks the changed lines of the ranges [a0, a1) and [b0, b1) with
+// the patience algorithm, as git does: the longest common sequence of the
+// lines appearing exactly once in both ranges is found, and the lines between
+// them are compared recursively. The ranges without unique common lines are
+// compared with Myers.
+func (d *differ) patience(a0, a1, b0, b1 int) {
+	switch {
+	case a0 == a1:
+		d.b.change(b0, b1)
+		return
+	case b0 == b1:
+		d.a.change(a0, a1)
+		return
+	}
+
+	entries := make(map[int]*patienceEntry)
+	var order []*patienceEntry
+	for i := a0; i < a1; i++ {
+		e, ok := entries[d.a.lines[i]]
+		if !ok {
+			e = &patienceEntry{}
+			entries[d.a.lines[i]] = e
+			order = append(order, e)
+		}
+
+		e.count1++
+		e.line1 = i
+	}
+
+	var hasMatches bool
+	for i := b0; i < b1; i++ {
+		if e, ok := entries[d.b.lines[i]]; ok {
+			hasMatches = true
+			e.count2++
+			e.line2 = i
+		}
+	}
+
+	if !hasMatches {
+		d.a.change(a0, a1)
+		d.b.change(b0, b1)
+		return
+	}
+
+	first := longestCommonSequence(order)
+	if len(first) == 0 {
+		d.myers(a0, a1, b0, b1, false)
+		return
+	}
+
+	d.walkCommonSequence(first, a0, a1, b0, b1)
+}
+
+// longestCommonSequence returns the longest sequence of unique lines that
+// appear in the same order in both files, using patience sorting. The entries
+// must be sorted by their position in the first file.
+func longestCommonSequence(entries []*patienceEntry) []*patienceEntry {
+	var sequence []*patienceEntry
+	for _, e := range entries {
+		if e.count1 != 1 || e.count2 != 1 {
+			continue
+		}
+
+		// binary search of the last entry of sequence before e in the second
+		// file
+		left, right := -1, len(sequence)
+		for left+1 < right {
+			middle := left + (right-left)/2
+			if sequence[middle].line2 > e.line2 {
+				right = middle
+			} else {
+				left = middle
+			}
+		}
+
+		e.previous = nil
+		if left >= 0 {
+			e.previous = sequence[left]
+		}
+
+		if left+1 == len(sequence) {
+			sequence = append(sequence, e)
+		} else {
+			sequence[left+1] = e
+		}
+	}
+
+	if len(sequence) == 0 {
+		return nil
+	}
+
+	result := make([]*patienceEntry, len(sequence))
+	e := sequence[len(sequence)-1]
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = e
+		e = e.previous
+	}
+
+	return result
+}
+
+// walkCommonSequence compares recursively the lines between the matched unique
+// lines of the ranges, extending first the matches with the equal lines
+// around them.
+func (d *differ) walkCommonSequence(seq []*patienceEntry, a0, a1, b0, b1 int) {
+	line1, line2 := a0, b0
+	for {
+		var next1, next2 int
+		if len(seq) > 0 {
+			next1, next2 = seq[0].line1, seq[0].line2
+			for next1 > line1 && next2 > line2 && d.a.lines[next1-1] == d.b.lines[next2-1] {
+				next1--
+				next2--
+			}
+		} else {
+			next1, next2 = a1, b1
+		}
+
+		for line1 < next1 && line2 < next2 && d.a.lines[line1] == d.b.lines[line2] {
+			line1++
+			line2++
+		}
+
+		if next1 > line1 || next2 > line2 {
+			d.patience(line1, next1, line2, next2)
+		}
+
+		if len(seq) == 0 {
+			return
+		}
+
+		for len(seq) > 1 && seq[1].line1 == seq[0].line1+1 && seq[1].line2 == seq[0].line2+1 {
+			seq = seq[1:]
+		}
+
+		line1, line2 = seq[0].line1+1, seq[0].line2+1
+		seq = seq[1:]
+	}
+}
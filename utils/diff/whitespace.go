@@ -0,0 +1,72 @@
+package diff
+
+import "strings"
+
+// lineKey returns the key used to compare the line, with the whitespace
+// ignored by the options removed or normalized.
+func (o *Options) lineKey(line string) string {
+	switch {
+	case o.IgnoreAllSpace:
+		return removeSpace(line)
+	case o.IgnoreSpaceChange:
+		return collapseSpace(line)
+	case o.IgnoreCRAtEOL:
+		return trimCRAtEOL(line)
+	default:
+		return line
+	}
+}
+
+// isSpace tells whether c is a whitespace character, as isspace in git.
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+// removeSpace returns the line without its whitespace characters.
+func removeSpace(line string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			b.WriteByte(line[i])
+		}
+	}
+
+	return b.String()
+}
+
+// collapseSpace returns the line with its sequences of whitespace characters
+// replaced by a single space, and its trailing whitespace removed.
+func collapseSpace(line string) string {
+	b := &strings.Builder{}
+	space := false
+	for i := 0; i < len(line); i++ {
+		if isSpace(line[i]) {
+			space = true
+			continue
+		}
+
+		if space {
+			b.WriteByte(' ')
+		}
+
+		space = false
+		b.WriteByte(line[i])
+	}
+
+	return b.String()
+}
+
+// trimCRAtEOL returns the line without the carriage return before its line
+// terminator.
+func trimCRAtEOL(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2] + "\n"
+	}
+
+	return strings.TrimSuffix(line, "\r")
+}
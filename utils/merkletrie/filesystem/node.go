@@ -24,6 +24,7 @@ var ignore = map[string]bool{
 type node struct {
 	fs         billy.Filesystem
 	submodules map[string]plumbing.Hash
+	options    *Options
 
 	path     string
 	hash     []byte
@@ -40,7 +41,26 @@ func NewRootNode(
 	fs billy.Filesystem,
 	submodules map[string]plumbing.Hash,
 ) noder.Noder {
-	return &node{fs: fs, submodules: submodules, isDir: true}
+	return NewRootNodeWithOptions(fs, submodules, Options{})
+}
+
+// Options contains the options of the nodes of a billy.Filesystem.
+type Options struct {
+	// Convert, if not nil, is called with the content of each regular file,
+	// read from r, and its size. It returns the content to hash in place of
+	// it, and its size, e.g. to convert the line endings of the file as git
+	// does when adding it.
+	Convert func(path string, r io.Reader, size int64) (io.Reader, int64, error)
+}
+
+// NewRootNodeWithOptions returns the root node based on a given
+// billy.Filesystem, like NewRootNode, using the given options.
+func NewRootNodeWithOptions(
+	fs billy.Filesystem,
+	submodules map[string]plumbing.Hash,
+	options Options,
+) noder.Noder {
+	return &node{fs: fs, submodules: submodules, options: &options, isDir: true}
 }
 
 // Hash the hash of a filesystem is the result of concatenating the computed
@@ -121,6 +141,7 @@ func (n *node) newChildNode(file os.FileInfo) (*node, error) {
 	node := &node{
 		fs:         n.fs,
 		submodules: n.submodules,
+		options:    n.options,
 
 		path:  path,
 		hash:  hash,
@@ -168,8 +189,16 @@ func (n *node) doCalculateHashForRegular(path string, file os.FileInfo) (plumbin
 
 	defer f.Close()
 
-	h := plumbing.NewHasher(plumbing.BlobObject, file.Size())
-	if _, err := io.Copy(h, f); err != nil {
+	var r io.Reader = f
+	size := file.Size()
+	if n.options.Convert != nil {
+		if r, size, err = n.options.Convert(path, f, size); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	h := plumbing.NewHasher(plumbing.BlobObject, size)
+	if _, err := io.Copy(h, r); err != nil {
 		return plumbing.ZeroHash, err
 	}
 
@@ -196,6 +196,39 @@ func (s *NoderSuite) TestDiffDirectory(c *C) {
 	c.Assert(a, Equals, merkletrie.Modify)
 }
 
+func (s *NoderSuite) TestDiffConvert(c *C) {
+	fsA := memfs.New()
+	WriteFile(fsA, "foo", []byte("foo\r\n"), 0644)
+	WriteFile(fsA, "bar", []byte("bar\r\n"), 0644)
+
+	fsB := memfs.New()
+	WriteFile(fsB, "foo", []byte("foo\n"), 0644)
+	WriteFile(fsB, "bar", []byte("bar\r\n"), 0644)
+
+	convert := func(p string, r io.Reader, size int64) (io.Reader, int64, error) {
+		if p != "foo" {
+			return r, size, nil
+		}
+
+		buf := &bytes.Buffer{}
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, 0, err
+		}
+
+		content := bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte("\n"), -1)
+		return bytes.NewReader(content), int64(len(content)), nil
+	}
+
+	ch, err := merkletrie.DiffTree(
+		NewRootNodeWithOptions(fsA, nil, Options{Convert: convert}),
+		NewRootNode(fsB, nil),
+		IsEquals,
+	)
+
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+}
+
 func WriteFile(fs billy.Filesystem, filename string, data []byte, perm os.FileMode) error {
 	f, err := fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
@@ -22,13 +22,26 @@ type node struct {
 }
 
 // NewRootNode returns the root node of a computed tree from a index.Index,
+// only the merged entries are taken into account, the entries representing
+// the stages of an unmerged path are ignored. The sparse directory entries of
+// a sparse index are directories without children, having the hash of their
+// tree.
 func NewRootNode(idx *index.Index) noder.Noder {
 	const rootNode = ""
 
 	m := map[string]*node{rootNode: {isDir: true}}
 
 	for _, e := range idx.Entries {
-		parts := strings.Split(e.Name, string("/"))
+		if e.Stage != index.Merged {
+			continue
+		}
+
+		name := e.Name
+		if e.IsSparseDirectory() {
+			name = strings.TrimSuffix(name, "/")
+		}
+
+		parts := strings.Split(name, string("/"))
 
 		var fullpath string
 		for _, part := range parts {
@@ -40,8 +53,9 @@ func NewRootNode(idx *index.Index) noder.Noder {
 			}
 
 			n := &node{path: fullpath}
-			if fullpath == e.Name {
+			if fullpath == name {
 				n.entry = e
+				n.isDir = e.IsSparseDirectory()
 			} else {
 				n.isDir = true
 			}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/utils/merkletrie"
 	"github.com/go-git/go-git/v5/utils/merkletrie/noder"
@@ -43,6 +44,26 @@ func (s *NoderSuite) TestDiff(c *C) {
 	c.Assert(ch, HasLen, 0)
 }
 
+func (s *NoderSuite) TestDiffIgnoresUnmergedStages(c *C) {
+	indexA := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+		},
+	}
+
+	indexB := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar", Stage: index.OurMode, Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar", Stage: index.TheirMode, Hash: plumbing.NewHash("05f583ace3a9a078d8150905a53a4d82567f125f")},
+		},
+	}
+
+	ch, err := merkletrie.DiffTree(NewRootNode(indexA), NewRootNode(indexB), isEquals)
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+}
+
 func (s *NoderSuite) TestDiffChange(c *C) {
 	indexA := &index.Index{
 		Entries: []*index.Entry{{
@@ -103,6 +124,33 @@ func (s *NoderSuite) TestDiffSameRoot(c *C) {
 	c.Assert(ch, HasLen, 1)
 }
 
+func (s *NoderSuite) TestDiffSparseDirectory(c *C) {
+	indexA := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar/", Mode: filemode.Dir, Hash: plumbing.NewHash("aab686eafeb1f44702738c8b0f24f2567c36da6d"), SkipWorktree: true},
+		},
+	}
+
+	indexB := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar/", Mode: filemode.Dir, Hash: plumbing.NewHash("aab686eafeb1f44702738c8b0f24f2567c36da6d"), SkipWorktree: true},
+		},
+	}
+
+	ch, err := merkletrie.DiffTree(NewRootNode(indexA), NewRootNode(indexB), isEquals)
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+
+	children, err := NewRootNode(indexA).Children()
+	c.Assert(err, IsNil)
+	c.Assert(children, HasLen, 2)
+	c.Assert(children[1].Name(), Equals, "bar")
+	c.Assert(children[1].IsDir(), Equals, true)
+	c.Assert(children[1].Hash(), DeepEquals, append(indexA.Entries[1].Hash[:], filemode.Dir.Bytes()...))
+}
+
 var empty = make([]byte, 24)
 
 func isEquals(a, b noder.Hasher) bool {
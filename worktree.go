@@ -7,13 +7,16 @@ import (
 	"io"
 	stdioutil "io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/filter"
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -39,6 +42,10 @@ type Worktree struct {
 	Filesystem billy.Filesystem
 	// External excludes not found in the repository .gitignore
 	Excludes []gitignore.Pattern
+	// Filters holds in-process filter drivers, by name, applied to the files
+	// with a filter attribute naming them in place of the commands of the
+	// filter drivers of the config.
+	Filters map[string]filter.Filter
 
 	r *Repository
 }
@@ -47,7 +54,9 @@ type Worktree struct {
 // Returns nil if the operation is successful, NoErrAlreadyUpToDate if there are
 // no changes to be fetched, or an error.
 //
-// Pull only supports merges where the can be resolved as a fast-forward.
+// By default Pull only supports merges where the can be resolved as a
+// fast-forward, PullOptions.Mode allows to create a merge commit or to rebase
+// the local commits instead.
 func (w *Worktree) Pull(o *PullOptions) error {
 	return w.PullContext(context.Background(), o)
 }
@@ -56,7 +65,9 @@ func (w *Worktree) Pull(o *PullOptions) error {
 // branch. Returns nil if the operation is successful, NoErrAlreadyUpToDate if
 // there are no changes to be fetched, or an error.
 //
-// Pull only supports merges where the can be resolved as a fast-forward.
+// By default Pull only supports merges where the can be resolved as a
+// fast-forward, PullOptions.Mode allows to create a merge commit or to rebase
+// the local commits instead.
 //
 // The provided Context must be non-nil. If the context expires before the
 // operation is complete, an error is returned. The context only affects to the
@@ -108,6 +119,13 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		}
 
 		if !ff {
+			switch o.Mode {
+			case PullMerge:
+				return w.pullMerge(remote, ref, o)
+			case PullRebase:
+				return w.pullRebase(ref, o)
+			}
+
 			return ErrNonFastForwardUpdate
 		}
 	}
@@ -116,7 +134,7 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
-	if err := w.updateHEAD(ref.Hash()); err != nil {
+	if err := w.updateHEAD(ref.Hash(), nil, "pull: Fast-forward"); err != nil {
 		return err
 	}
 
@@ -137,6 +155,62 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 	return nil
 }
 
+// pullMerge merges the fetched reference into the current branch, as
+// `git pull --no-rebase` does.
+func (w *Worktree) pullMerge(remote *Remote, ref *plumbing.Reference, o *PullOptions) error {
+	msg := fmt.Sprintf("Merge commit '%s'", ref.Hash())
+	if ref.Name().IsBranch() {
+		msg = fmt.Sprintf("Merge branch '%s'", ref.Name().Short())
+	}
+
+	if urls := remote.Config().URLs; len(urls) != 0 {
+		msg = fmt.Sprintf("%s of %s", msg, urls[0])
+	}
+
+	if _, err := w.Merge(&MergeOptions{
+		Commit:    ref.Hash(),
+		Message:   msg + "\n",
+		Author:    o.Author,
+		Committer: o.Committer,
+	}); err != nil {
+		return err
+	}
+
+	if o.RecurseSubmodules != NoRecurseSubmodules {
+		return w.updateSubmodules(&SubmoduleUpdateOptions{
+			RecurseSubmodules: o.RecurseSubmodules,
+			Auth:              o.Auth,
+		})
+	}
+
+	return nil
+}
+
+// pullRebase replays the local commits of the current branch on top of the
+// fetched reference, as `git pull --rebase` does.
+func (w *Worktree) pullRebase(ref *plumbing.Reference, o *PullOptions) error {
+	committer := o.Committer
+	if committer == nil {
+		committer = o.Author
+	}
+
+	if err := w.Rebase(&RebaseOptions{
+		Upstream:  ref.Hash(),
+		Committer: committer,
+	}); err != nil {
+		return err
+	}
+
+	if o.RecurseSubmodules != NoRecurseSubmodules {
+		return w.updateSubmodules(&SubmoduleUpdateOptions{
+			RecurseSubmodules: o.RecurseSubmodules,
+			Auth:              o.Auth,
+		})
+	}
+
+	return nil
+}
+
 func (w *Worktree) updateSubmodules(o *SubmoduleUpdateOptions) error {
 	s, err := w.Submodules()
 	if err != nil {
@@ -152,6 +226,17 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 		return err
 	}
 
+	if !opts.Create && opts.Hash.IsZero() && !opts.Force {
+		if err := w.r.checkCheckoutBranch(opts.Branch); err != nil {
+			return err
+		}
+	}
+
+	from := ""
+	if head, err := w.r.Storer.Reference(plumbing.HEAD); err == nil {
+		from = refDescription(head)
+	}
+
 	if opts.Create {
 		if err := w.createBranch(opts); err != nil {
 			return err
@@ -171,9 +256,11 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 	}
 
 	if !opts.Hash.IsZero() && !opts.Create {
-		err = w.setHEADToCommit(opts.Hash)
+		msg := fmt.Sprintf("checkout: moving from %s to %s", from, opts.Hash)
+		err = w.setHEADToCommit(opts.Hash, msg)
 	} else {
-		err = w.setHEADToBranch(opts.Branch, c)
+		msg := fmt.Sprintf("checkout: moving from %s to %s", from, opts.Branch.Short())
+		err = w.setHEADToBranch(opts.Branch, c, msg)
 	}
 
 	if err != nil {
@@ -192,6 +279,7 @@ func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 		return err
 	}
 
+	msg := fmt.Sprintf("branch: Created from %s", opts.Hash)
 	if opts.Hash.IsZero() {
 		ref, err := w.r.Head()
 		if err != nil {
@@ -199,10 +287,11 @@ func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 		}
 
 		opts.Hash = ref.Hash()
+		msg = "branch: Created from HEAD"
 	}
 
-	return w.r.Storer.SetReference(
-		plumbing.NewHashReference(opts.Branch, opts.Hash),
+	return w.r.setReference(
+		plumbing.NewHashReference(opts.Branch, opts.Hash), nil, msg,
 	)
 }
 
@@ -239,12 +328,12 @@ func (w *Worktree) getCommitFromCheckoutOptions(opts *CheckoutOptions) (plumbing
 	return plumbing.ZeroHash, fmt.Errorf("unsupported tag target %q", o.Type())
 }
 
-func (w *Worktree) setHEADToCommit(commit plumbing.Hash) error {
+func (w *Worktree) setHEADToCommit(commit plumbing.Hash, msg string) error {
 	head := plumbing.NewHashReference(plumbing.HEAD, commit)
-	return w.r.Storer.SetReference(head)
+	return w.r.setReference(head, nil, msg)
 }
 
-func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash) error {
+func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash, msg string) error {
 	target, err := w.r.Storer.Reference(branch)
 	if err != nil {
 		return err
@@ -257,7 +346,7 @@ func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbin
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
 	}
 
-	return w.r.Storer.SetReference(head)
+	return w.r.setReference(head, nil, msg)
 }
 
 // Reset the worktree to a specified state.
@@ -277,7 +366,7 @@ func (w *Worktree) Reset(opts *ResetOptions) error {
 		}
 	}
 
-	if err := w.setHEADCommit(opts.Commit); err != nil {
+	if err := w.setHEADCommit(opts.Commit, fmt.Sprintf("reset: moving to %s", opts.Commit)); err != nil {
 		return err
 	}
 
@@ -302,7 +391,7 @@ func (w *Worktree) Reset(opts *ResetOptions) error {
 		}
 	}
 
-	return nil
+	return w.clearMergeState()
 }
 
 func (w *Worktree) resetIndex(t *object.Tree) error {
@@ -310,6 +399,11 @@ func (w *Worktree) resetIndex(t *object.Tree) error {
 	if err != nil {
 		return err
 	}
+
+	if err := w.expandChangedSparseDirectories(idx, t); err != nil {
+		return err
+	}
+
 	b := newIndexBuilder(idx)
 
 	changes, err := w.diffTreeWithStaging(t, true)
@@ -351,6 +445,15 @@ func (w *Worktree) resetIndex(t *object.Tree) error {
 	}
 
 	b.Write(idx)
+	if err := w.applySparseCheckout(idx); err != nil {
+		return err
+	}
+
+	if err := w.updateSparseIndex(idx, t); err != nil {
+		return err
+	}
+
+	setIndexVersion(idx)
 	return w.r.Storer.SetIndex(idx)
 }
 
@@ -366,17 +469,38 @@ func (w *Worktree) resetWorktree(t *object.Tree) error {
 	}
 	b := newIndexBuilder(idx)
 
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	// the .gitattributes files are checked out first, as they drive the
+	// line ending conversions of the other files
+	sort.SliceStable(changes, func(i, j int) bool {
+		return isGitattributesChange(changes[i]) && !isGitattributesChange(changes[j])
+	})
+
 	for _, ch := range changes {
-		if err := w.checkoutChange(ch, t, b); err != nil {
+		if err := w.checkoutChange(ch, t, b, c); err != nil {
 			return err
 		}
 	}
 
 	b.Write(idx)
+	if err := w.removeSkipWorktreeFiles(idx); err != nil {
+		return err
+	}
+
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder) error {
+func isGitattributesChange(ch merkletrie.Change) bool {
+	return path.Base(nameFromAction(&ch)) == gitattributesFile
+}
+
+func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder, c *converter) error {
 	a, err := ch.Action()
 	if err != nil {
 		return err
@@ -403,7 +527,7 @@ func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *ind
 		return w.checkoutChangeSubmodule(name, a, e, idx)
 	}
 
-	return w.checkoutChangeRegularFile(name, a, t, e, idx)
+	return w.checkoutChangeRegularFile(name, a, t, e, idx, c)
 }
 
 func (w *Worktree) containsUnstagedChanges() (bool, error) {
@@ -428,15 +552,22 @@ func (w *Worktree) containsUnstagedChanges() (bool, error) {
 	return false, nil
 }
 
-func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
+// setHEADCommit points HEAD, or the branch it points to, to the given commit,
+// recording the change in the reflogs with the given message. Nothing is
+// done if HEAD already points to the commit.
+func (w *Worktree) setHEADCommit(commit plumbing.Hash, msg string) error {
 	head, err := w.r.Reference(plumbing.HEAD, false)
 	if err != nil {
 		return err
 	}
 
+	if resolvedHash(w.r.Storer, plumbing.HEAD) == commit {
+		return nil
+	}
+
 	if head.Type() == plumbing.HashReference {
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
-		return w.r.Storer.SetReference(head)
+		return w.r.setReference(head, nil, msg)
 	}
 
 	branch, err := w.r.Reference(head.Target(), false)
@@ -449,7 +580,7 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 	}
 
 	branch = plumbing.NewHashReference(branch.Name(), commit)
-	return w.r.Storer.SetReference(branch)
+	return w.r.setReference(branch, nil, msg)
 }
 
 func (w *Worktree) checkoutChangeSubmodule(name string,
@@ -490,6 +621,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	t *object.Tree,
 	e *object.TreeEntry,
 	idx *indexBuilder,
+	c *converter,
 ) error {
 	switch a {
 	case merkletrie.Modify:
@@ -508,7 +640,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 			return err
 		}
 
-		if err := w.checkoutFile(f); err != nil {
+		if err := w.checkoutFile(f, c); err != nil {
 			return err
 		}
 
@@ -524,7 +656,9 @@ var copyBufferPool = sync.Pool{
 	},
 }
 
-func (w *Worktree) checkoutFile(f *object.File) (err error) {
+// checkoutFile writes the file to the worktree, applying the line ending
+// conversions of c.
+func (w *Worktree) checkoutFile(f *object.File, c *converter) (err error) {
 	mode, err := f.Mode.ToOSFileMode()
 	if err != nil {
 		return
@@ -541,14 +675,20 @@ func (w *Worktree) checkoutFile(f *object.File) (err error) {
 
 	defer ioutil.CheckClose(from, &err)
 
+	r, err := c.toWorktree(f.Name, from)
+	if err != nil {
+		return
+	}
+
 	to, err := w.Filesystem.OpenFile(f.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
 	if err != nil {
 		return
 	}
 
+	defer c.invalidate(f.Name)
 	defer ioutil.CheckClose(to, &err)
 	buf := copyBufferPool.Get().([]byte)
-	_, err = io.CopyBuffer(to, from, buf)
+	_, err = io.CopyBuffer(to, r, buf)
 	copyBufferPool.Put(buf)
 	return
 }
@@ -933,9 +1073,15 @@ type indexBuilder struct {
 	entries map[string]*index.Entry
 }
 
+// newIndexBuilder returns a indexBuilder containing the merged entries of the
+// given index, the stages of the unmerged paths are discarded.
 func newIndexBuilder(idx *index.Index) *indexBuilder {
 	entries := make(map[string]*index.Entry, len(idx.Entries))
 	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			continue
+		}
+
 		entries[e.Name] = e
 	}
 	return &indexBuilder{
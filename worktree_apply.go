@@ -0,0 +1,987 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+var (
+	// ErrInvalidFuzz is returned when ApplyOptions.Fuzz is negative.
+	ErrInvalidFuzz = errors.New("fuzz must not be negative")
+	// ErrInvalidPatchPath is returned by Worktree.Apply when a path of the
+	// patch is absolute, has a "." or ".." component or is inside a .git
+	// directory.
+	ErrInvalidPatchPath = errors.New("invalid path in patch")
+)
+
+// ApplyError is returned by Worktree.Apply when the patch doesn't apply
+// cleanly, it tells precisely which hunks failed.
+type ApplyError struct {
+	// Rejects holds the hunks that could not be applied.
+	Rejects []*RejectedHunk
+	// Conflicts holds the paths merged with conflicts when
+	// ApplyOptions.ThreeWay is set.
+	Conflicts []string
+}
+
+func (e *ApplyError) Error() string {
+	if len(e.Rejects) == 0 {
+		return fmt.Sprintf("patch applied with conflicts: %s", strings.Join(e.Conflicts, ", "))
+	}
+
+	msg := fmt.Sprintf("patch does not apply: %s", e.Rejects[0])
+	if len(e.Rejects) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Rejects)-1)
+	}
+
+	return msg
+}
+
+// RejectedHunk is a hunk of a patch that could not be applied.
+type RejectedHunk struct {
+	// Path is the path of the file the hunk belongs to.
+	Path string
+	// Hunk is the number of the hunk in the patch of the file, starting at 1,
+	// or 0 if the whole patch of the file was rejected.
+	Hunk int
+	// Line is the line the hunk was expected at in the file, starting at 1.
+	Line int
+	// Reason describes why the hunk was rejected.
+	Reason string
+}
+
+func (r *RejectedHunk) String() string {
+	if r.Hunk == 0 {
+		return fmt.Sprintf("%s: %s", r.Path, r.Reason)
+	}
+
+	return fmt.Sprintf("%s: hunk #%d at line %d: %s", r.Path, r.Hunk, r.Line, r.Reason)
+}
+
+// Apply applies the given patch to the worktree, as git apply does. The patch
+// can be decoded from a unified diff with diff.Decoder, or generated with
+// object.Patch.
+//
+// The hunks are applied at the lines the patch gives, or at the nearest lines
+// their context matches, ignoring up to ApplyOptions.Fuzz lines of context
+// if they don't match otherwise. Unless ApplyOptions.Reject is set, nothing
+// is changed if any hunk fails. An *ApplyError describing the failed hunks
+// is returned if the patch doesn't apply cleanly.
+func (w *Worktree) Apply(patch fdiff.Patch, opts *ApplyOptions) error {
+	if opts == nil {
+		opts = &ApplyOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return err
+	}
+
+	if err := checkPatchPaths(patch); err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	a := &patchApplier{
+		w:       w,
+		idx:     idx,
+		opts:    opts,
+		files:   make(map[string]*appliedFile),
+		changed: make(map[string]bool),
+		rejects: make(map[string][]*applyHunk),
+	}
+
+	for _, fp := range patch.FilePatches() {
+		if err := a.applyFilePatch(fp); err != nil {
+			return err
+		}
+	}
+
+	var applyErr *ApplyError
+	if len(a.err.Rejects) != 0 || len(a.err.Conflicts) != 0 {
+		applyErr = &a.err
+	}
+
+	if opts.Check || (len(a.err.Rejects) != 0 && !opts.Reject) {
+		if applyErr != nil {
+			return applyErr
+		}
+
+		return nil
+	}
+
+	if err := a.write(); err != nil {
+		return err
+	}
+
+	if applyErr != nil {
+		return applyErr
+	}
+
+	return nil
+}
+
+// checkPatchPaths returns ErrInvalidPatchPath if any path of the patch could
+// be written out of the worktree or into the repository, as git apply does
+// before changing anything.
+func checkPatchPaths(patch fdiff.Patch) error {
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		for _, f := range []fdiff.File{from, to} {
+			if f != nil && !isValidPatchPath(f.Path()) {
+				return ErrInvalidPatchPath
+			}
+		}
+	}
+
+	return nil
+}
+
+func isValidPatchPath(p string) bool {
+	if p == "" || p[0] == '/' || p[0] == '\\' || filepath.VolumeName(p) != "" {
+		return false
+	}
+
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == "." || part == ".." || strings.EqualFold(part, GitDirName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// appliedFile is the content of a file, before or after applying a patch.
+type appliedFile struct {
+	exists  bool
+	content []byte
+	mode    filemode.FileMode
+	// hash is the hash of the index entry the file was read from
+	hash plumbing.Hash
+	// conflict holds the stages of a three-way merge with conflicts
+	conflict *mergeConflict
+}
+
+// patchApplier applies the patches of each file, keeping the results in
+// memory until all of them are known to apply.
+type patchApplier struct {
+	w    *Worktree
+	idx  *index.Index
+	opts *ApplyOptions
+	// files holds the content of the files read or patched
+	files map[string]*appliedFile
+	// changed holds the paths of the files patched
+	changed map[string]bool
+	// rejects holds the rejected hunks of each file
+	rejects map[string][]*applyHunk
+	err     ApplyError
+}
+
+func (a *patchApplier) reject(path string, hunk, line int, format string, args ...interface{}) {
+	a.err.Rejects = append(a.err.Rejects, &RejectedHunk{
+		Path:   path,
+		Hunk:   hunk,
+		Line:   line,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+func (a *patchApplier) applyFilePatch(fp fdiff.FilePatch) error {
+	from, to := fp.Files()
+	if from == nil && to == nil {
+		return nil
+	}
+
+	ufp, _ := fp.(*fdiff.UnifiedFilePatch)
+	isCopy := ufp != nil && ufp.Copy
+	if a.opts.Reverse {
+		from, to = to, from
+	}
+
+	path := filePath(from, to)
+	src := &appliedFile{}
+	if from != nil {
+		var err error
+		src, err = a.read(from.Path())
+		if err != nil {
+			return err
+		}
+
+		if !src.exists {
+			a.reject(from.Path(), 0, 0, "does not exist")
+			return nil
+		}
+	}
+
+	if to != nil && (from == nil || from.Path() != to.Path()) && !(isCopy && a.opts.Reverse) {
+		dst, err := a.read(to.Path())
+		if err != nil {
+			return err
+		}
+
+		if dst.exists {
+			a.reject(to.Path(), 0, 0, "already exists")
+			return nil
+		}
+	}
+
+	var content []byte
+	var conflict *mergeConflict
+	if fp.IsBinary() {
+		var ok bool
+		if content, ok = a.patchBinary(ufp, path, from, to, src.content); !ok {
+			return nil
+		}
+	} else {
+		var failed []*applyHunk
+		hunks := patchHunks(fp, a.opts.Reverse)
+		content, failed = applyHunks(src.content, hunks, a.opts.Fuzz)
+		if len(failed) != 0 && a.opts.ThreeWay && from != nil && to != nil {
+			var err error
+			var merged bool
+			content, conflict, merged, err = a.threeWay(path, from, to, src, hunks)
+			if err != nil {
+				return err
+			}
+
+			if merged {
+				failed = nil
+			}
+		}
+
+		if len(failed) != 0 {
+			for _, h := range failed {
+				a.reject(path, h.number, h.pos+1, "patch does not apply")
+			}
+
+			if !a.opts.Reject {
+				return nil
+			}
+
+			a.rejects[path] = failed
+		}
+	}
+
+	if to == nil {
+		if len(content) != 0 {
+			a.reject(path, 0, 0, "removal patch leaves file contents")
+			return nil
+		}
+
+		a.files[from.Path()] = &appliedFile{}
+		a.changed[from.Path()] = true
+		return nil
+	}
+
+	if isCopy && a.opts.Reverse {
+		// the inverse of a copy removes the copy
+		a.files[from.Path()] = &appliedFile{}
+		a.changed[from.Path()] = true
+		return nil
+	}
+
+	mode := to.Mode()
+	if mode == filemode.Empty {
+		mode = src.mode
+	}
+
+	if mode == filemode.Empty {
+		mode = filemode.Regular
+	}
+
+	if from != nil && from.Path() != to.Path() && !isCopy {
+		a.files[from.Path()] = &appliedFile{}
+		a.changed[from.Path()] = true
+	}
+
+	a.files[to.Path()] = &appliedFile{
+		exists:   true,
+		content:  content,
+		mode:     mode,
+		conflict: conflict,
+	}
+
+	a.changed[to.Path()] = true
+	if conflict != nil {
+		conflict.Path = to.Path()
+		a.err.Conflicts = append(a.err.Conflicts, to.Path())
+	}
+
+	return nil
+}
+
+// read returns the file at the given path, from the index if Cached is set or
+// from the worktree otherwise, unless it was already patched.
+func (a *patchApplier) read(path string) (*appliedFile, error) {
+	if f, ok := a.files[path]; ok {
+		return f, nil
+	}
+
+	f := &appliedFile{}
+	a.files[path] = f
+
+	e, err := a.idx.Entry(path)
+	if err != nil && err != index.ErrEntryNotFound {
+		return nil, err
+	}
+
+	if e != nil {
+		f.hash = e.Hash
+	}
+
+	if a.opts.Cached {
+		if e == nil {
+			return f, nil
+		}
+
+		f.exists = true
+		f.mode = e.Mode
+		f.content, err = blobContent(a.w.r.Storer, e.Hash)
+		return f, err
+	}
+
+	fi, err := a.w.Filesystem.Lstat(path)
+	if os.IsNotExist(err) {
+		if a.opts.Index && e != nil {
+			a.reject(path, 0, 0, "does not match index")
+			f.exists = true
+		}
+
+		return f, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.exists = true
+	f.mode, err = filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := a.w.Filesystem.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+
+		f.content = []byte(target)
+	} else {
+		f.content, err = readFile(a.w.Filesystem, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.opts.Index && (e == nil || e.Hash != plumbing.ComputeHash(plumbing.BlobObject, f.content)) {
+		a.reject(path, 0, 0, "does not match index")
+	}
+
+	return f, nil
+}
+
+// patchBinary applies a binary patch. Without the data of a "GIT binary
+// patch", the blob the patch results in must be in the repository.
+func (a *patchApplier) patchBinary(fp *fdiff.UnifiedFilePatch, path string, from, to fdiff.File, src []byte) ([]byte, bool) {
+	if from != nil && !blobMatches(from, src) {
+		a.reject(path, 0, 0, "the patch applies to a different version of the file")
+		return nil, false
+	}
+
+	var content []byte
+	switch {
+	case fp != nil && fp.BinaryFragment != nil:
+		frag := fp.BinaryFragment
+		if a.opts.Reverse {
+			frag = fp.ReverseBinaryFragment
+		}
+
+		if frag == nil {
+			a.reject(path, 0, 0, "cannot reverse-apply a binary patch without the reverse hunk")
+			return nil, false
+		}
+
+		content = frag.Data
+		if frag.Method == fdiff.BinaryDelta {
+			var err error
+			if content, err = packfile.PatchDelta(src, frag.Data); err != nil {
+				a.reject(path, 0, 0, "binary patch does not apply: %s", err)
+				return nil, false
+			}
+		}
+	case to == nil:
+		return nil, true
+	default:
+		h, ok := a.resolveBlob(to)
+		if !ok {
+			a.reject(path, 0, 0, "cannot apply binary patch without full index line")
+			return nil, false
+		}
+
+		var err error
+		if content, err = blobContent(a.w.r.Storer, h); err != nil {
+			a.reject(path, 0, 0, "cannot apply binary patch: %s", err)
+			return nil, false
+		}
+	}
+
+	if to != nil && !blobMatches(to, content) {
+		a.reject(path, 0, 0, "binary patch does not result in the expected file")
+		return nil, false
+	}
+
+	return content, true
+}
+
+// threeWay merges the changes of the hunks into the file, applying them to the
+// blob the patch was generated from. It returns false if that blob is not
+// available or the patch doesn't apply to it.
+func (a *patchApplier) threeWay(path string, from, to fdiff.File, src *appliedFile, hunks []*applyHunk) ([]byte, *mergeConflict, bool, error) {
+	baseHash, ok := a.resolveBlob(from)
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	base, err := blobContent(a.w.r.Storer, baseHash)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	theirs, failed := applyHunks(base, hunks, 0)
+	if len(failed) != 0 {
+		return nil, nil, false, nil
+	}
+
+	res := diff.Merge(string(base), string(src.content), string(theirs), &diff.MergeOptions{
+		OursLabel:   "ours",
+		TheirsLabel: "theirs",
+	})
+
+	if len(res.Conflicts) == 0 {
+		return []byte(res.Text), nil, true, nil
+	}
+
+	if res.Binary {
+		return nil, nil, false, nil
+	}
+
+	theirsHash, err := writeBlob(a.w.r.Storer, theirs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	mode := to.Mode()
+	if mode == filemode.Empty {
+		mode = src.mode
+	}
+
+	oursHash := src.hash
+	if !a.opts.Cached {
+		if oursHash, err = writeBlob(a.w.r.Storer, src.content); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	conflict := &mergeConflict{
+		Base:   &object.TreeEntry{Name: from.Path(), Mode: src.mode, Hash: baseHash},
+		Ours:   &object.TreeEntry{Name: path, Mode: src.mode, Hash: oursHash},
+		Theirs: &object.TreeEntry{Name: to.Path(), Mode: mode, Hash: theirsHash},
+		Merged: []byte(res.Text),
+	}
+
+	return []byte(res.Text), conflict, true, nil
+}
+
+// resolveBlob returns the hash of the blob of the given file, if it is in the
+// repository. The abbreviated hashes of the patches are expanded.
+func (a *patchApplier) resolveBlob(f fdiff.File) (plumbing.Hash, bool) {
+	h := f.Hash()
+	if uf, ok := f.(*fdiff.UnifiedFile); ok && h.IsZero() {
+		hashes := a.w.r.resolveHashPrefix(uf.AbbreviatedHash())
+		if len(hashes) != 1 {
+			return plumbing.ZeroHash, false
+		}
+
+		h = hashes[0]
+	}
+
+	if h.IsZero() || a.w.r.Storer.HasEncodedObject(h) != nil {
+		return plumbing.ZeroHash, false
+	}
+
+	return h, true
+}
+
+// write writes the patched files and the rejected hunks.
+func (a *patchApplier) write() error {
+	paths := make([]string, 0, len(a.changed))
+	for path := range a.changed {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		f := a.files[path]
+		if !a.opts.Cached {
+			if err := a.writeWorktreeFile(path, f); err != nil {
+				return err
+			}
+		}
+
+		if a.opts.Cached || a.opts.Index {
+			if err := a.writeIndexEntry(path, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	for path, hunks := range a.rejects {
+		if err := util.WriteFile(a.w.Filesystem, path+".rej", encodeRejects(path, hunks), 0644); err != nil {
+			return err
+		}
+	}
+
+	if a.opts.Cached || a.opts.Index {
+		return a.w.r.Storer.SetIndex(a.idx)
+	}
+
+	return nil
+}
+
+func (a *patchApplier) writeWorktreeFile(path string, f *appliedFile) error {
+	if err := a.w.deleteFromFilesystem(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !f.exists {
+		return nil
+	}
+
+	if f.mode == filemode.Symlink {
+		return a.w.Filesystem.Symlink(string(f.content), path)
+	}
+
+	mode, err := f.mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFile(a.w.Filesystem, path, f.content, mode.Perm())
+}
+
+func (a *patchApplier) writeIndexEntry(path string, f *appliedFile) error {
+	removeUnmergedStages(a.idx, path)
+	if !f.exists {
+		if _, err := a.idx.Remove(path); err != nil && err != index.ErrEntryNotFound {
+			return err
+		}
+
+		return nil
+	}
+
+	if f.conflict != nil {
+		if _, err := a.idx.Remove(path); err != nil && err != index.ErrEntryNotFound {
+			return err
+		}
+
+		for _, st := range []struct {
+			stage index.Stage
+			entry *object.TreeEntry
+		}{
+			{index.AncestorMode, f.conflict.Base},
+			{index.OurMode, f.conflict.Ours},
+			{index.TheirMode, f.conflict.Theirs},
+		} {
+			a.idx.Entries = append(a.idx.Entries, &index.Entry{
+				Name:  path,
+				Hash:  st.entry.Hash,
+				Mode:  st.entry.Mode,
+				Stage: st.stage,
+			})
+		}
+
+		return nil
+	}
+
+	h, err := writeBlob(a.w.r.Storer, f.content)
+	if err != nil {
+		return err
+	}
+
+	if !a.opts.Cached {
+		return a.w.addOrUpdateFileToIndex(a.idx, path, h)
+	}
+
+	e, err := a.idx.Entry(path)
+	if err == index.ErrEntryNotFound {
+		e, err = a.idx.Add(path), nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	e.Hash = h
+	e.Mode = f.mode
+	e.Size = uint32(len(f.content))
+	return nil
+}
+
+// applyLine is a line of a hunk.
+type applyLine struct {
+	op   fdiff.Operation
+	text string
+}
+
+// applyHunk is a hunk of the patch of a file, as it is applied.
+type applyHunk struct {
+	// number is the position of the hunk in the patch, starting at 1
+	number int
+	// pos is the position of the first line of the preimage in the file
+	pos int
+	// fromLine and toLine are the lines given by the header of the hunk
+	fromLine, toLine int
+	lines            []applyLine
+}
+
+// image returns the lines of the hunk before or after applying it.
+func (h *applyHunk) image(after bool) []string {
+	skip := fdiff.Add
+	if after {
+		skip = fdiff.Delete
+	}
+
+	var lines []string
+	for _, l := range h.lines {
+		if l.op != skip {
+			lines = append(lines, l.text)
+		}
+	}
+
+	return lines
+}
+
+// context returns the number of unchanged lines at the start and at the end
+// of the hunk.
+func (h *applyHunk) context() (leading, trailing int) {
+	for leading < len(h.lines) && h.lines[leading].op == fdiff.Equal {
+		leading++
+	}
+
+	for trailing < len(h.lines)-leading && h.lines[len(h.lines)-1-trailing].op == fdiff.Equal {
+		trailing++
+	}
+
+	return leading, trailing
+}
+
+// patchHunks returns the hunks of the patch of a file. The hunks of the
+// decoded patches are used as they are, while the chunks of the other
+// patches, which hold the whole files, are split in hunks as git diff does.
+func patchHunks(fp fdiff.FilePatch, reverse bool) []*applyHunk {
+	invert := func(op fdiff.Operation) fdiff.Operation {
+		switch {
+		case !reverse || op == fdiff.Equal:
+			return op
+		case op == fdiff.Add:
+			return fdiff.Delete
+		default:
+			return fdiff.Add
+		}
+	}
+
+	ufp, ok := fp.(*fdiff.UnifiedFilePatch)
+	if !ok {
+		var lines []applyLine
+		for _, c := range fp.Chunks() {
+			for _, l := range splitPatchLines(c.Content()) {
+				lines = append(lines, applyLine{op: invert(c.Type()), text: l})
+			}
+		}
+
+		return splitHunks(lines, fdiff.DefaultContextLines)
+	}
+
+	hunks := make([]*applyHunk, len(ufp.Hunks))
+	for i, h := range ufp.Hunks {
+		fromLine, fromCount, toLine := h.FromLine, h.FromCount, h.ToLine
+		if reverse {
+			fromLine, fromCount, toLine = h.ToLine, h.ToCount, h.FromLine
+		}
+
+		ah := &applyHunk{number: i + 1, pos: fromLine - 1, fromLine: fromLine, toLine: toLine}
+		if fromCount == 0 {
+			// the lines are added after fromLine
+			ah.pos = fromLine
+		}
+
+		for _, c := range h.Chunks {
+			for _, l := range splitPatchLines(c.Content()) {
+				ah.lines = append(ah.lines, applyLine{op: invert(c.Type()), text: l})
+			}
+		}
+
+		hunks[i] = ah
+	}
+
+	return hunks
+}
+
+// splitHunks splits the lines of a whole file in hunks with the given number
+// of context lines.
+func splitHunks(lines []applyLine, context int) []*applyHunk {
+	// pos and posAfter hold the position of each line in the file before and
+	// after the patch
+	pos := make([]int, len(lines)+1)
+	posAfter := make([]int, len(lines)+1)
+	for i, l := range lines {
+		pos[i+1], posAfter[i+1] = pos[i], posAfter[i]
+		if l.op != fdiff.Add {
+			pos[i+1]++
+		}
+
+		if l.op != fdiff.Delete {
+			posAfter[i+1]++
+		}
+	}
+
+	var hunks []*applyHunk
+	end := 0
+	for i := 0; i < len(lines); i++ {
+		if lines[i].op == fdiff.Equal {
+			continue
+		}
+
+		start := i - context
+		if start < end {
+			start = end
+		}
+
+		last, equals := i, 0
+		for j := i; j < len(lines) && equals <= 2*context; j++ {
+			if lines[j].op == fdiff.Equal {
+				equals++
+			} else {
+				last, equals = j, 0
+			}
+		}
+
+		end = last + 1 + context
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		h := &applyHunk{
+			number:   len(hunks) + 1,
+			pos:      pos[start],
+			fromLine: pos[start] + 1,
+			toLine:   posAfter[start] + 1,
+			lines:    lines[start:end],
+		}
+
+		if pos[start] == pos[end] {
+			h.fromLine--
+		}
+
+		if posAfter[start] == posAfter[end] {
+			h.toLine--
+		}
+
+		hunks = append(hunks, h)
+		i = end - 1
+	}
+
+	return hunks
+}
+
+// applyHunks applies the hunks to the content, it returns the result and the
+// hunks that could not be applied.
+func applyHunks(content []byte, hunks []*applyHunk, fuzz int) ([]byte, []*applyHunk) {
+	lines := splitPatchLines(string(content))
+
+	var failed []*applyHunk
+	// offset is the difference between the positions in the patch and the
+	// positions in lines, minPos the end of the last hunk applied
+	offset, minPos := 0, 0
+	for _, h := range hunks {
+		pre, post := h.image(false), h.image(true)
+		leading, trailing := h.context()
+
+		applied := false
+		for f := 0; f <= fuzz && !applied; f++ {
+			skipStart, skipEnd := min(f, leading), min(f, trailing)
+			if f > 0 && skipStart < f && skipEnd < f {
+				// there isn't more context to ignore
+				break
+			}
+
+			// without context at the start or at the end the hunk must match
+			// the start or the end of the file
+			matchStart := f == 0 && leading == 0 && h.pos == 0 && trailing != 0
+			matchEnd := f == 0 && trailing == 0 && leading != 0
+
+			expected := h.pos + offset + skipStart
+			p := pre[skipStart : len(pre)-skipEnd]
+			at, ok := findLines(lines, p, expected, minPos, matchStart, matchEnd)
+			if !ok {
+				continue
+			}
+
+			q := post[skipStart : len(post)-skipEnd]
+			lines = append(lines[:at], append(append([]string{}, q...), lines[at+len(p):]...)...)
+			offset += at - expected + len(q) - len(p)
+			minPos = at + len(q)
+			applied = true
+		}
+
+		if !applied {
+			failed = append(failed, h)
+		}
+	}
+
+	return []byte(strings.Join(lines, "")), failed
+}
+
+// findLines looks for the given lines in the file, starting at the expected
+// position and moving away from it in both directions, never before minPos.
+func findLines(lines, find []string, expected, minPos int, matchStart, matchEnd bool) (int, bool) {
+	matches := func(at int) bool {
+		if at < minPos || at+len(find) > len(lines) {
+			return false
+		}
+
+		for i, l := range find {
+			if lines[at+i] != l {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	switch {
+	case matchStart:
+		return 0, matches(0)
+	case matchEnd:
+		at := len(lines) - len(find)
+		return at, matches(at)
+	}
+
+	for d := 0; expected-d >= minPos || expected+d+len(find) <= len(lines); d++ {
+		if matches(expected - d) {
+			return expected - d, true
+		}
+
+		if matches(expected + d) {
+			return expected + d, true
+		}
+	}
+
+	return 0, false
+}
+
+// encodeRejects returns the content of the reject file of the given hunks.
+func encodeRejects(path string, hunks []*applyHunk) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff a/%s b/%s\t(rejected hunks)\n", path, path)
+	for _, h := range hunks {
+		pre, post := h.image(false), h.image(true)
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.fromLine, len(pre)), hunkRange(h.toLine, len(post)))
+		for _, l := range h.lines {
+			switch l.op {
+			case fdiff.Add:
+				b.WriteByte('+')
+			case fdiff.Delete:
+				b.WriteByte('-')
+			default:
+				b.WriteByte(' ')
+			}
+
+			b.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return []byte(b.String())
+}
+
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func readFile(fs billy.Filesystem, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// splitPatchLines splits the text in lines, keeping their terminators.
+func splitPatchLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// blobMatches tells whether the content matches the hash of the file, which
+// may be abbreviated or missing.
+func blobMatches(f fdiff.File, content []byte) bool {
+	h := plumbing.ComputeHash(plumbing.BlobObject, content)
+	if uf, ok := f.(*fdiff.UnifiedFile); ok {
+		return strings.HasPrefix(h.String(), uf.AbbreviatedHash())
+	}
+
+	return f.Hash().IsZero() || f.Hash() == h
+}
+
+func filePath(from, to fdiff.File) string {
+	if to != nil {
+		return to.Path()
+	}
+
+	return from.Path()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
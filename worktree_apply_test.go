@@ -0,0 +1,401 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+const applyTestContent = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+
+func decodePatch(c *C, patch string) fdiff.Patch {
+	p, err := fdiff.NewDecoder(strings.NewReader(patch)).Decode()
+	c.Assert(err, IsNil)
+	return p
+}
+
+const applyTestPatch = `diff --git a/foo b/foo
+--- a/foo
++++ b/foo
+@@ -2,3 +2,3 @@
+ 2
+-3
++three
+ 4
+@@ -8,3 +8,4 @@
+ 8
+ 9
+ 10
++11
+`
+
+func (s *WorktreeSuite) TestApply(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := w.Apply(decodePatch(c, applyTestPatch), nil)
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Unmodified)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+}
+
+func (s *WorktreeSuite) TestApplyOffset(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("0\n"+applyTestContent), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(decodePatch(c, applyTestPatch), nil)
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "0\n1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+}
+
+func (s *WorktreeSuite) TestApplyFuzz(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte(strings.Replace(applyTestContent, "2\n", "two\n", 1)), 0644)
+	c.Assert(err, IsNil)
+
+	patch := decodePatch(c, applyTestPatch)
+	err = w.Apply(patch, nil)
+	c.Assert(err, NotNil)
+
+	applyErr, ok := err.(*ApplyError)
+	c.Assert(ok, Equals, true)
+	c.Assert(applyErr.Rejects, HasLen, 1)
+	c.Assert(*applyErr.Rejects[0], Equals, RejectedHunk{Path: "foo", Hunk: 1, Line: 2, Reason: "patch does not apply"})
+
+	// nothing is changed if a hunk fails
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n")
+
+	err = w.Apply(patch, &ApplyOptions{Fuzz: 1})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "1\ntwo\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+}
+
+func (s *WorktreeSuite) TestApplyInvalidFuzz(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Fuzz: -1})
+	c.Assert(err, Equals, ErrInvalidFuzz)
+}
+
+func (s *WorktreeSuite) TestApplyReverse(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	patch := decodePatch(c, applyTestPatch)
+	err := w.Apply(patch, nil)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(patch, &ApplyOptions{Reverse: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, applyTestContent)
+}
+
+func (s *WorktreeSuite) TestApplyCheck(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Check: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, applyTestContent)
+}
+
+func (s *WorktreeSuite) TestApplyCached(c *C) {
+	r, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("unrelated\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "unrelated\n")
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+
+	e, err := idx.Entry("foo")
+	c.Assert(err, IsNil)
+
+	content, err := blobContent(r.Storer, e.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+}
+
+func (s *WorktreeSuite) TestApplyIndex(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+
+	// the worktree must match the index
+	err = util.WriteFile(w.Filesystem, "foo", []byte(applyTestContent), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Index: true, Reverse: true})
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ApplyError).Rejects[0].Reason, Equals, "does not match index")
+}
+
+func (s *WorktreeSuite) TestApplyCreateDeleteRename(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := w.Apply(decodePatch(c, `diff --git a/foo b/bar
+similarity index 90%
+rename from foo
+rename to bar
+--- a/foo
++++ b/bar
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+diff --git a/qux b/qux
+new file mode 100755
+--- /dev/null
++++ b/qux
+@@ -0,0 +1 @@
++qux
+`), &ApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+
+	_, err = w.Filesystem.Lstat("foo")
+	c.Assert(err, NotNil)
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, strings.Replace(applyTestContent, "1\n", "one\n", 1))
+	c.Assert(readWorktreeFile(c, w, "qux"), Equals, "qux\n")
+
+	fi, err := w.Filesystem.Lstat("qux")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm()&0100, Not(Equals), 0)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Deleted)
+	c.Assert(status.File("bar").Staging, Equals, Added)
+	c.Assert(status.File("qux").Staging, Equals, Added)
+
+	// the new file already exists
+	err = w.Apply(decodePatch(c, `diff --git a/qux b/qux
+new file mode 100644
+--- /dev/null
++++ b/qux
+@@ -0,0 +1 @@
++qux
+`), nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ApplyError).Rejects[0].Reason, Equals, "already exists")
+
+	err = w.Apply(decodePatch(c, `diff --git a/qux b/qux
+deleted file mode 100755
+--- a/qux
++++ /dev/null
+@@ -1 +0,0 @@
+-qux
+`), nil)
+	c.Assert(err, IsNil)
+
+	_, err = w.Filesystem.Lstat("qux")
+	c.Assert(err, NotNil)
+}
+
+func (s *WorktreeSuite) TestApplyReject(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte(strings.Replace(applyTestContent, "3\n", "three\n", 1)), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(decodePatch(c, applyTestPatch), &ApplyOptions{Reject: true})
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ApplyError).Rejects, HasLen, 1)
+
+	// the hunks that apply are applied
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+	c.Assert(readWorktreeFile(c, w, "foo.rej"), Equals, ""+
+		"diff a/foo b/foo\t(rejected hunks)\n"+
+		"@@ -2,3 +2,3 @@\n"+
+		" 2\n"+
+		"-3\n"+
+		"+three\n"+
+		" 4\n",
+	)
+}
+
+func (s *WorktreeSuite) TestApplyThreeWay(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	base := plumbing.ComputeHash(plumbing.BlobObject, []byte(applyTestContent))
+	patch := fmt.Sprintf(`diff --git a/foo b/foo
+index %s..0000000 100644
+--- a/foo
++++ b/foo
+@@ -1,4 +1,4 @@
+ 1
+-2
++two
+ 3
+ 4
+`, base.String()[:7])
+
+	commitFiles(c, w, map[string]string{"foo": "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n"})
+
+	err := w.Apply(decodePatch(c, patch), nil)
+	c.Assert(err, NotNil)
+
+	err = w.Apply(decodePatch(c, patch), &ApplyOptions{ThreeWay: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "1\ntwo\n3\nfour\n5\n6\n7\n8\n9\n10\n")
+}
+
+func (s *WorktreeSuite) TestApplyThreeWayConflict(c *C) {
+	r, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	base := plumbing.ComputeHash(plumbing.BlobObject, []byte(applyTestContent))
+	patch := fmt.Sprintf(`diff --git a/foo b/foo
+index %s..0000000 100644
+--- a/foo
++++ b/foo
+@@ -1,4 +1,4 @@
+ 1
+-2
++two
+ 3
+ 4
+`, base.String()[:7])
+
+	commitFiles(c, w, map[string]string{"foo": "1\nTWO\n3\n4\n5\n6\n7\n8\n9\n10\n"})
+
+	err := w.Apply(decodePatch(c, patch), &ApplyOptions{ThreeWay: true})
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ApplyError).Conflicts, DeepEquals, []string{"foo"})
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, ""+
+		"1\n"+
+		"<<<<<<< ours\n"+
+		"TWO\n"+
+		"=======\n"+
+		"two\n"+
+		">>>>>>> theirs\n"+
+		"3\n4\n5\n6\n7\n8\n9\n10\n",
+	)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+
+	var stages []index.Stage
+	for _, e := range idx.Entries {
+		if e.Name == "foo" {
+			stages = append(stages, e.Stage)
+		}
+	}
+
+	c.Assert(stages, DeepEquals, []index.Stage{index.AncestorMode, index.OurMode, index.TheirMode})
+}
+
+func (s *WorktreeSuite) TestApplyBinary(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\x00"), 0644)
+	c.Assert(err, IsNil)
+
+	// generated with git diff --binary
+	patch := decodePatch(c, `diff --git a/foo b/foo
+index 5e154ebab7789d4cd418eeaccf08260e6583b8ff..0d89c7df4e373a8791962daec0b3f2b4fd421542 100644
+GIT binary patch
+literal 4
+LcmYdFEMfov1Cs$Z
+
+literal 4
+LcmYex&u0Jt1IGbH
+
+`)
+
+	err = w.Apply(patch, nil)
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "bar\x00")
+
+	// the patch doesn't apply to a different version of the file
+	err = w.Apply(patch, nil)
+	c.Assert(err, NotNil)
+
+	err = w.Apply(patch, &ApplyOptions{Reverse: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo\x00")
+}
+
+func (s *WorktreeSuite) TestApplyObjectPatch(c *C) {
+	r, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	from, err := r.Head()
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(strings.Repeat("x\n", 20), "\n")
+	lines[2], lines[15] = "a", "b"
+	commitFiles(c, w, map[string]string{"foo": strings.Join(lines, "\n")})
+
+	to, err := r.Head()
+	c.Assert(err, IsNil)
+
+	fromCommit, err := r.CommitObject(from.Hash())
+	c.Assert(err, IsNil)
+	toCommit, err := r.CommitObject(to.Hash())
+	c.Assert(err, IsNil)
+
+	patch, err := toCommit.Patch(fromCommit)
+	c.Assert(err, IsNil)
+
+	err = w.Apply(patch, nil)
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, applyTestContent)
+}
+
+func (s *WorktreeSuite) TestApplyInvalidPath(c *C) {
+	_, w := newTestRepository(c, map[string]string{"foo": applyTestContent})
+
+	for _, path := range []string{
+		".git/hooks/post-commit",
+		".GIT/config",
+		"sub/.git/config",
+		"../outside",
+		"sub/../../outside",
+		"./foo",
+		"/tmp/outside",
+	} {
+		patch := fmt.Sprintf(""+
+			"diff --git a/a b/a\n"+
+			"new file mode 100644\n"+
+			"--- /dev/null\n"+
+			"+++ b/a\n"+
+			"@@ -0,0 +1 @@\n"+
+			"+a\n"+
+			"diff --git a/%[1]s b/%[1]s\n"+
+			"new file mode 100755\n"+
+			"--- /dev/null\n"+
+			"+++ b/%[1]s\n"+
+			"@@ -0,0 +1 @@\n"+
+			"+echo pwned\n", path)
+
+		err := w.Apply(decodePatch(c, patch), &ApplyOptions{Reject: true})
+		c.Assert(err, Equals, ErrInvalidPatchPath, Commentf("%s", path))
+
+		_, err = w.Filesystem.Stat("a")
+		c.Assert(os.IsNotExist(err), Equals, true, Commentf("%s", path))
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
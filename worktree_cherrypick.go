@@ -0,0 +1,406 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+)
+
+var (
+	// ErrCherryPickInProgress is returned when an operation is attempted
+	// while a cherry-pick, stopped because of conflicts, has not been
+	// concluded.
+	ErrCherryPickInProgress = errors.New("a cherry-pick is already in progress")
+	// ErrRevertInProgress is returned when an operation is attempted while a
+	// revert, stopped because of conflicts, has not been concluded.
+	ErrRevertInProgress = errors.New("a revert is already in progress")
+	// ErrMainlineRequired is returned when a merge commit is cherry-picked or
+	// reverted without giving a mainline parent.
+	ErrMainlineRequired = errors.New("commit is a merge but no mainline was given")
+	// ErrInvalidMainline is returned when the given mainline parent doesn't
+	// exist in the commit.
+	ErrInvalidMainline = errors.New("commit does not have the given mainline parent")
+	// ErrEmptyChanges is returned when the changes to be committed are
+	// already present in HEAD.
+	ErrEmptyChanges = errors.New("changes are already present in HEAD")
+)
+
+// CherryPick applies the changes introduced by the given commit on top of
+// HEAD, creating a new commit with the same message and author. The changes
+// are computed against the parent of the commit, or the parent selected with
+// CherryPickOptions.Mainline for merge commits, and applied with a three-way
+// merge.
+//
+// The hash of the new commit is returned, or the zero hash if NoCommit was
+// requested. If the changes are already present in HEAD, ErrEmptyChanges is
+// returned.
+//
+// If some paths can not be merged the cherry-pick stops before committing,
+// ErrMergeConflicts is returned and the conflicts are recorded in the index
+// and the worktree, as Worktree.Merge does. Unless NoCommit was requested,
+// CHERRY_PICK_HEAD is set to the picked commit until the cherry-pick is
+// concluded with Worktree.Commit, or aborted with Worktree.Reset.
+func (w *Worktree) CherryPick(commit plumbing.Hash, opts *CherryPickOptions) (plumbing.Hash, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	c, err := w.r.CommitObject(commit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	label := commitLabel(c)
+	p := &commitPick{
+		head:        plumbing.CherryPickHead,
+		commit:      c,
+		parent:      parent,
+		noCommit:    opts.NoCommit,
+		style:       opts.ConflictStyle,
+		baseLabel:   "parent of " + label,
+		theirsLabel: label,
+	}
+
+	head, err := w.applyPick(p)
+	if err != nil || opts.NoCommit {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := c.Message
+	if opts.RecordOrigin {
+		msg = appendCherryPickOrigin(msg, c.Hash)
+	}
+
+	co, err := w.commitOptionsFor(&c.Author, opts.Committer)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	co.Parents = []plumbing.Hash{head.Hash}
+	co.SignKey = opts.SignKey
+	return w.commitPick(p, msg, co)
+}
+
+// Revert applies the inverse of the changes introduced by the given commit
+// on top of HEAD, creating a new commit. The changes are computed against the
+// parent of the commit, or the parent selected with RevertOptions.Mainline
+// for merge commits, and applied with a three-way merge.
+//
+// The hash of the new commit is returned, or the zero hash if NoCommit was
+// requested. If the changes are already reverted in HEAD, ErrEmptyChanges is
+// returned.
+//
+// If some paths can not be merged the revert stops before committing,
+// ErrMergeConflicts is returned and the conflicts are recorded in the index
+// and the worktree, as Worktree.Merge does. Unless NoCommit was requested,
+// REVERT_HEAD is set to the reverted commit until the revert is concluded
+// with Worktree.Commit, or aborted with Worktree.Reset.
+func (w *Worktree) Revert(commit plumbing.Hash, opts *RevertOptions) (plumbing.Hash, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	c, err := w.r.CommitObject(commit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	label := commitLabel(c)
+	p := &commitPick{
+		head:        plumbing.RevertHead,
+		commit:      c,
+		parent:      parent,
+		revert:      true,
+		noCommit:    opts.NoCommit,
+		style:       opts.ConflictStyle,
+		baseLabel:   label,
+		theirsLabel: "parent of " + label,
+	}
+
+	head, err := w.applyPick(p)
+	if err != nil || opts.NoCommit {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := opts.Message
+	if msg == "" {
+		msg = revertMessage(c, parent)
+	}
+
+	co := &CommitOptions{
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Parents:   []plumbing.Hash{head.Hash},
+		SignKey:   opts.SignKey,
+	}
+
+	if err := co.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return w.commitPick(p, msg, co)
+}
+
+// commitPick describes the changes of a commit to be applied on top of HEAD
+// by a cherry-pick or a revert.
+type commitPick struct {
+	// head is the pseudo-ref set to the commit when the operation stops
+	// because of conflicts.
+	head   plumbing.ReferenceName
+	commit *object.Commit
+	// parent is the parent the changes are computed against, nil for root
+	// commits.
+	parent *object.Commit
+	// revert applies the inverse of the changes.
+	revert   bool
+	noCommit bool
+
+	style                  diff.ConflictStyle
+	baseLabel, theirsLabel string
+
+	// tree is the hash of the tree resulting of applying the changes.
+	tree plumbing.Hash
+}
+
+// applyPick merges the changes described by p into HEAD, updating the index
+// and the worktree when they can't be committed straight away. HEAD's commit
+// is returned.
+func (w *Worktree) applyPick(p *commitPick) (*object.Commit, error) {
+	if err := w.checkMergeInProgress(); err != nil {
+		return nil, err
+	}
+
+	ref, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.checkMergeable(head.Hash); err != nil {
+		return nil, err
+	}
+
+	base, theirs, err := p.trees()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.revert {
+		base, theirs = theirs, base
+	}
+
+	ours, err := head.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &treeMerger{
+		s:           w.r.Storer,
+		style:       p.style,
+		oursLabel:   "HEAD",
+		baseLabel:   p.baseLabel,
+		theirsLabel: p.theirsLabel,
+	}
+
+	res, err := m.mergeTrees(base, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	p.tree, err = m.writeTree(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Conflicts) == 0 && !p.noCommit {
+		if p.tree == head.TreeHash {
+			return nil, ErrEmptyChanges
+		}
+
+		return head, nil
+	}
+
+	if err := w.resetIndexAndWorktree(p.tree); err != nil {
+		return nil, err
+	}
+
+	if len(res.Conflicts) == 0 {
+		return head, nil
+	}
+
+	if !p.noCommit {
+		if err := w.r.Storer.SetReference(
+			plumbing.NewHashReference(p.head, p.commit.Hash),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.writeConflicts(res.Conflicts); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrMergeConflicts
+}
+
+// commitPick creates the commit with the applied changes and moves HEAD to
+// it, updating the index and the worktree.
+func (w *Worktree) commitPick(p *commitPick, msg string, opts *CommitOptions) (plumbing.Hash, error) {
+	commit, err := w.buildCommitObject(msg, opts, p.tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	op := "cherry-pick"
+	if p.revert {
+		op = "revert"
+	}
+
+	if err := w.updateHEAD(commit, opts.Committer, commitReflogMessage(op, msg)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return commit, w.Reset(&ResetOptions{
+		Mode:   MergeReset,
+		Commit: commit,
+	})
+}
+
+// trees returns the trees of the parent and the commit, the parent tree is
+// nil for root commits.
+func (p *commitPick) trees() (parent, commit *object.Tree, err error) {
+	if p.parent != nil {
+		parent, err = p.parent.Tree()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	commit, err = p.commit.Tree()
+	return parent, commit, err
+}
+
+// mainlineParent returns the parent of c selected by mainline, nil if c is a
+// root commit.
+func mainlineParent(c *object.Commit, mainline int) (*object.Commit, error) {
+	switch {
+	case c.NumParents() > 1 && mainline == 0:
+		return nil, ErrMainlineRequired
+	case c.NumParents() <= 1 && mainline != 0,
+		mainline > c.NumParents():
+		return nil, ErrInvalidMainline
+	case c.NumParents() == 0:
+		return nil, nil
+	case mainline == 0:
+		mainline = 1
+	}
+
+	return c.Parent(mainline - 1)
+}
+
+// commitLabel returns the hash and the subject of the commit, used to label
+// its side of the conflict markers.
+func commitLabel(c *object.Commit) string {
+	return fmt.Sprintf("%s (%s)", c.Hash, commitSubject(c.Message))
+}
+
+func commitSubject(msg string) string {
+	msg = strings.TrimLeft(msg, "\n")
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+
+	return msg
+}
+
+const cherryPickOriginPrefix = "(cherry picked from commit "
+
+func appendCherryPickOrigin(msg string, h plumbing.Hash) string {
+	msg = strings.TrimRight(msg, "\n") + "\n"
+	if !hasTrailerBlock(msg) {
+		msg += "\n"
+	}
+
+	return fmt.Sprintf("%s%s%s)\n", msg, cherryPickOriginPrefix, h)
+}
+
+// hasTrailerBlock reports whether the last paragraph of msg, other than its
+// title, is a block of trailers. As git does, the block is accepted when all
+// its lines are trailers, or when at least a quarter of them are and one is
+// generated by git.
+func hasTrailerBlock(msg string) bool {
+	paragraphs := strings.Split(strings.Trim(msg, "\n"), "\n\n")
+	if len(paragraphs) < 2 {
+		return false
+	}
+
+	var trailers, others int
+	var generated, inTrailer bool
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		switch {
+		case inTrailer && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			continue
+		case strings.HasPrefix(line, cherryPickOriginPrefix),
+			strings.HasPrefix(line, "Signed-off-by: "):
+			generated = true
+			fallthrough
+		case isTrailerLine(line):
+			trailers++
+			inTrailer = true
+		default:
+			others++
+			inTrailer = false
+		}
+	}
+
+	return trailers > 0 && (others == 0 || generated && trailers*3 >= others)
+}
+
+// isTrailerLine reports whether line starts with a trailer token, made of
+// alphanumeric characters and hyphens, followed by a colon.
+func isTrailerLine(line string) bool {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return false
+	}
+
+	token := strings.TrimRight(line[:i], " \t")
+	if token == "" {
+		return false
+	}
+
+	for _, r := range token {
+		if r != '-' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func revertMessage(c, parent *object.Commit) string {
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", commitSubject(c.Message), c.Hash)
+	if c.NumParents() > 1 {
+		msg += fmt.Sprintf(", reversing\nchanges made to %s", parent.Hash)
+	}
+
+	return msg + ".\n"
+}
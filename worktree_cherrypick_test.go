@@ -0,0 +1,277 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+func (s *WorktreeSuite) TestCherryPick(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	commitFiles(c, w, map[string]string{"qux": "qux\n"})
+	picked := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"foo": "foo modified\n"})
+
+	committer := defaultSignature()
+	committer.Name = "bar"
+	h, err := w.CherryPick(picked, &CherryPickOptions{
+		RecordOrigin: true,
+		Committer:    committer,
+	})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, h)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours})
+	c.Assert(commit.Message, Equals, "changes\n\n(cherry picked from commit "+picked.String()+")\n")
+	c.Assert(commit.Author.Name, Equals, "foo")
+	c.Assert(commit.Committer.Name, Equals, "bar")
+
+	for name, content := range map[string]string{
+		"foo": "foo modified\n",
+		"bar": "bar modified\n",
+	} {
+		f, err := commit.File(name)
+		c.Assert(err, IsNil)
+		got, err := f.Contents()
+		c.Assert(err, IsNil)
+		c.Assert(got, Equals, content)
+		c.Assert(readWorktreeFile(c, w, name), Equals, content)
+	}
+
+	_, err = commit.File("qux")
+	c.Assert(err, NotNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *WorktreeSuite) TestCherryPickNoCommit(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	picked := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"foo": "foo modified\n"})
+
+	h, err := w.CherryPick(picked, &CherryPickOptions{NoCommit: true})
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, plumbing.ZeroHash)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, ours)
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, Modified)
+	c.Assert(status.File("bar").Worktree, Equals, Unmodified)
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+}
+
+func (s *WorktreeSuite) TestCherryPickEmpty(c *C) {
+	_, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	picked := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	_, err := w.CherryPick(picked, &CherryPickOptions{})
+	c.Assert(err, Equals, ErrEmptyChanges)
+}
+
+func (s *WorktreeSuite) TestCherryPickConflict(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	picked := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+	_, err := w.CherryPick(picked, &CherryPickOptions{})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	ref, err := r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, picked)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(unmergedStages(idx, "bar"), HasLen, 3)
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals,
+		"<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> "+picked.String()+" (changes)\n",
+	)
+
+	_, err = w.CherryPick(picked, &CherryPickOptions{})
+	c.Assert(err, Equals, ErrCherryPickInProgress)
+
+	err = util.WriteFile(w.Filesystem, "bar", []byte("resolved\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("bar")
+	c.Assert(err, IsNil)
+
+	h, err := w.Commit("picked\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours})
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *WorktreeSuite) TestCherryPickConflictReset(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	picked := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+	_, err := w.CherryPick(picked, &CherryPickOptions{})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	err = w.Reset(&ResetOptions{Commit: ours, Mode: HardReset})
+	c.Assert(err, IsNil)
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	for _, e := range idx.Entries {
+		c.Assert(e.Stage, Equals, index.Merged)
+	}
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "ours\n")
+}
+
+func (s *WorktreeSuite) TestCherryPickMainline(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	merge, err := w.Merge(&MergeOptions{Commit: theirs, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+
+	_, err = w.CherryPick(merge, &CherryPickOptions{})
+	c.Assert(err, Equals, ErrMainlineRequired)
+
+	_, err = w.CherryPick(merge, &CherryPickOptions{Mainline: 3})
+	c.Assert(err, Equals, ErrInvalidMainline)
+
+	_, err = w.CherryPick(theirs, &CherryPickOptions{Mainline: 1})
+	c.Assert(err, Equals, ErrInvalidMainline)
+
+	h, err := w.CherryPick(merge, &CherryPickOptions{
+		Mainline:  2,
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{theirs})
+	c.Assert(readWorktreeFile(c, w, "qux"), Equals, "qux\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+}
+
+func (s *WorktreeSuite) TestRevert(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	reverted := commitFiles(c, w, map[string]string{"bar": "bar modified\n", "qux": "qux\n"})
+	ours := commitFiles(c, w, map[string]string{"foo": "foo modified\n"})
+
+	h, err := w.Revert(reverted, &RevertOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours})
+	c.Assert(commit.Message, Equals,
+		"Revert \"changes\"\n\nThis reverts commit "+reverted.String()+".\n",
+	)
+
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo modified\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar\n")
+	_, err = w.Filesystem.Stat("qux")
+	c.Assert(err, NotNil)
+
+	_, err = w.Revert(reverted, &RevertOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrEmptyChanges)
+}
+
+func (s *WorktreeSuite) TestRevertConflict(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	reverted := commitFiles(c, w, map[string]string{"bar": "modified\n"})
+	commitFiles(c, w, map[string]string{"bar": "modified again\n"})
+
+	_, err := w.Revert(reverted, &RevertOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	ref, err := r.Reference(plumbing.RevertHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, reverted)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, UpdatedButUnmerged)
+}
+
+func (s *WorktreeSuite) TestAppendCherryPickOrigin(c *C) {
+	h := plumbing.NewHash("cafdfe013b59818893967e98fd3b34bef2a9990b")
+	origin := "(cherry picked from commit " + h.String() + ")\n"
+
+	for _, t := range []struct{ msg, expected string }{
+		{"subject\n", "subject\n\n"},
+		{"subject\n\nbody\n", "subject\n\nbody\n\n"},
+		{"subject\n\nSigned-off-by: a <a@a>\n\n", "subject\n\nSigned-off-by: a <a@a>\n"},
+		{"subject\n\nbody\n\nFixes: 123\nAcked-by: x\n", "subject\n\nbody\n\nFixes: 123\nAcked-by: x\n"},
+		{"subject\n\nReviewed-by: a\n  continued\n", "subject\n\nReviewed-by: a\n  continued\n"},
+		{
+			"subject\n\nSigned-off-by: a <a@a>\nsome text\nmore text\nand more\n",
+			"subject\n\nSigned-off-by: a <a@a>\nsome text\nmore text\nand more\n",
+		},
+		{
+			"subject\n\nnot a trailer\nmore\nand more\nReviewed-by: x\n",
+			"subject\n\nnot a trailer\nmore\nand more\nReviewed-by: x\n\n",
+		},
+		{"Signed-off-by: a <a@a>\n", "Signed-off-by: a <a@a>\n\n"},
+	} {
+		c.Assert(appendCherryPickOrigin(t.msg, h), Equals, t.expected+origin, Commentf("%q", t.msg))
+	}
+}
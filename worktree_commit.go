@@ -23,15 +23,24 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// as git does, the conflicts are never resolved by adding the files
+	if hasUnmergedEntries(idx) {
+		return plumbing.ZeroHash, ErrUnmergedEntries
+	}
+
 	if opts.All {
 		if err := w.autoAddModifiedAndDeleted(); err != nil {
 			return plumbing.ZeroHash, err
 		}
-	}
 
-	idx, err := w.r.Storer.Index()
-	if err != nil {
-		return plumbing.ZeroHash, err
+		if idx, err = w.r.Storer.Index(); err != nil {
+			return plumbing.ZeroHash, err
+		}
 	}
 
 	h := &buildTreeHelper{
@@ -49,7 +58,37 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
-	return commit, w.updateHEAD(commit)
+	if err := w.updateHEAD(commit, opts.Committer, commitReflogMessage(commitReflogOperation(opts), msg)); err != nil {
+		return commit, err
+	}
+
+	return commit, w.clearMergeState()
+}
+
+// commitOptionsFor returns the options to commit a change written by the given
+// author. The committer is resolved as the author of a new commit would be,
+// from the given one or the config, and the parents from HEAD.
+func (w *Worktree) commitOptionsFor(author, committer *object.Signature) (*CommitOptions, error) {
+	opts := &CommitOptions{Author: committer}
+	if err := opts.Validate(w.r); err != nil {
+		return nil, err
+	}
+
+	opts.Author = author
+	return opts, nil
+}
+
+// commitReflogOperation returns the operation recorded in the reflog for a
+// commit created with the given options.
+func commitReflogOperation(opts *CommitOptions) string {
+	switch len(opts.Parents) {
+	case 0:
+		return "commit (initial)"
+	case 1:
+		return "commit"
+	default:
+		return "commit (merge)"
+	}
 }
 
 func (w *Worktree) autoAddModifiedAndDeleted() error {
@@ -63,12 +102,21 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 		return err
 	}
 
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
 	for path, fs := range s {
-		if fs.Worktree != Modified && fs.Worktree != Deleted {
+		switch fs.Worktree {
+		case Modified, Deleted, UpdatedButUnmerged, Added:
+		default:
 			continue
 		}
 
-		if _, _, err := w.doAddFile(idx, s, path, nil); err != nil {
+		if _, _, err := w.doAddFile(idx, s, c, path, nil); err != nil {
 			return err
 		}
 
@@ -77,7 +125,9 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
+// updateHEAD points HEAD, or the branch it points to, to the given commit,
+// recording the change in the reflogs with the given committer and message.
+func (w *Worktree) updateHEAD(commit plumbing.Hash, committer *object.Signature, msg string) error {
 	head, err := w.r.Storer.Reference(plumbing.HEAD)
 	if err != nil {
 		return err
@@ -89,7 +139,7 @@ func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
 	}
 
 	ref := plumbing.NewHashReference(name, commit)
-	return w.r.Storer.SetReference(ref)
+	return w.r.setReference(ref, committer, msg)
 }
 
 func (w *Worktree) buildCommitObject(msg string, opts *CommitOptions, tree plumbing.Hash) (plumbing.Hash, error) {
@@ -160,20 +210,22 @@ func (h *buildTreeHelper) BuildTree(idx *index.Index) (plumbing.Hash, error) {
 }
 
 func (h *buildTreeHelper) commitIndexEntry(e *index.Entry) error {
-	parts := strings.Split(e.Name, "/")
+	// the sparse directories are kept as the tree they stand for
+	name := strings.TrimSuffix(e.Name, "/")
+	parts := strings.Split(name, "/")
 
 	var fullpath string
 	for _, part := range parts {
 		parent := fullpath
 		fullpath = path.Join(fullpath, part)
 
-		h.doBuildTree(e, parent, fullpath)
+		h.doBuildTree(e, name, parent, fullpath)
 	}
 
 	return nil
 }
 
-func (h *buildTreeHelper) doBuildTree(e *index.Entry, parent, fullpath string) {
+func (h *buildTreeHelper) doBuildTree(e *index.Entry, name, parent, fullpath string) {
 	if _, ok := h.trees[fullpath]; ok {
 		return
 	}
@@ -184,7 +236,7 @@ func (h *buildTreeHelper) doBuildTree(e *index.Entry, parent, fullpath string) {
 
 	te := object.TreeEntry{Name: path.Base(fullpath)}
 
-	if fullpath == e.Name {
+	if fullpath == name {
 		te.Mode = e.Mode
 		te.Hash = e.Hash
 	} else {
@@ -215,6 +267,9 @@ func (h *buildTreeHelper) copyTreeToStorageRecursive(parent string, t *object.Tr
 		}
 
 		path := path.Join(parent, e.Name)
+		if _, ok := h.trees[path]; !ok {
+			continue
+		}
 
 		var err error
 		e.Hash, err = h.copyTreeToStorageRecursive(path, h.trees[path])
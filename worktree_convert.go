@@ -0,0 +1,732 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	stdioutil "io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/filter"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/utils/merkletrie/filesystem"
+)
+
+const (
+	gitattributesFile  = ".gitattributes"
+	infoAttributesPath = "info/attributes"
+	// binaryMacro is the builtin binary macro of git.
+	binaryMacro = "[attr]binary -diff -merge -text"
+)
+
+// convertAttributes are the attributes driving the conversions of the files.
+var convertAttributes = []string{"text", "crlf", "eol", "filter"}
+
+// SafeCRLFError is returned when adding a file whose line endings wouldn't be
+// restored on checkout, if core.safecrlf is true.
+type SafeCRLFError struct {
+	// Path is the path of the file.
+	Path string
+	// From is the line ending of the file, replaced by To on checkout.
+	From, To string
+}
+
+func (e *SafeCRLFError) Error() string {
+	return fmt.Sprintf("%s would be replaced by %s in %s", e.From, e.To, e.Path)
+}
+
+// FilterError is returned when a required filter driver fails to convert a
+// file.
+type FilterError struct {
+	// Path is the path of the file.
+	Path string
+	// Driver is the name of the filter driver.
+	Driver string
+	// Command is the conversion, either "clean" or "smudge".
+	Command string
+	// Err is the error of the filter driver.
+	Err error
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s: %s filter '%s' failed: %s", e.Path, e.Command, e.Driver, e.Err)
+}
+
+// crlfAction is the line ending conversion of a file, following the values of
+// the text, crlf and eol attributes, and core.autocrlf.
+type crlfAction int
+
+const (
+	crlfUndefined crlfAction = iota
+	crlfBinary
+	crlfText
+	crlfTextInput
+	crlfTextCRLF
+	crlfAuto
+	crlfAutoInput
+	crlfAutoCRLF
+)
+
+func (a crlfAction) isAuto() bool {
+	return a == crlfAuto || a == crlfAutoInput || a == crlfAutoCRLF
+}
+
+// textStats holds the counts of the characters of a file used to tell whether
+// it's a text file and which line endings it has.
+type textStats struct {
+	nul, lonecr, lonelf, crlf int
+	printable, nonprintable   int
+}
+
+func gatherTextStats(buf []byte) textStats {
+	var s textStats
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case c == '\r':
+			if i+1 < len(buf) && buf[i+1] == '\n' {
+				s.crlf++
+				i++
+			} else {
+				s.lonecr++
+			}
+		case c == '\n':
+			s.lonelf++
+		case c == 127:
+			s.nonprintable++
+		case c < 32:
+			switch c {
+			case '\b', '\t', '\033', '\014':
+				s.printable++
+			case 0:
+				s.nul++
+				s.nonprintable++
+			default:
+				s.nonprintable++
+			}
+		default:
+			s.printable++
+		}
+	}
+
+	// a trailing EOF character doesn't count as non-printable
+	if len(buf) > 0 && buf[len(buf)-1] == '\032' {
+		s.nonprintable--
+	}
+
+	return s
+}
+
+func (s textStats) isBinary() bool {
+	return s.lonecr > 0 || s.nul > 0 || (s.printable>>7) < s.nonprintable
+}
+
+// converter applies the filter drivers and the line ending conversions to
+// the files of a worktree, as git does when checking them out and when adding
+// them.
+type converter struct {
+	w *Worktree
+
+	// filters holds the filter drivers of the config, by name
+	filters map[string]*config.Filter
+	// drivers holds the filters of the drivers used so far, by name
+	drivers   map[string]filter.Filter
+	processes []*filter.Process
+
+	autoCRLF string
+	eol      string
+	// safeCRLF rejects the conversions of the files to the repository that
+	// wouldn't be reverted on checkout.
+	safeCRLF bool
+	// renormalize converts the files even if their blobs in the index have
+	// CRLF line endings.
+	renormalize bool
+
+	// attributes holds the attributes of each directory, by path
+	attributes map[string][]gitattributes.MatchAttribute
+	global     []gitattributes.MatchAttribute
+	// indexHashes holds the hashes of the merged entries of the index
+	indexHashes map[string]plumbing.Hash
+	// err is the first error converting the files of the filesystem nodes
+	err error
+}
+
+// newConverter returns a converter for the files of w, following the config
+// of the repository.
+func (w *Worktree) newConverter() (*converter, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &converter{
+		w:       w,
+		eol:     strings.ToLower(cfg.Core.EOL),
+		filters: cfg.Filters,
+		drivers: make(map[string]filter.Filter),
+	}
+
+	switch autoCRLF := strings.ToLower(cfg.Core.AutoCRLF); {
+	case autoCRLF == "input":
+		c.autoCRLF = "input"
+	case isTrue(autoCRLF):
+		c.autoCRLF = "true"
+	}
+
+	c.safeCRLF = isTrue(strings.ToLower(cfg.Core.SafeCRLF))
+	return c, nil
+}
+
+// close stops the filter processes started by c.
+func (c *converter) close() {
+	for _, p := range c.processes {
+		// as git, the errors stopping the processes are ignored
+		_ = p.Close()
+	}
+
+	c.processes = nil
+}
+
+// newHashConverter returns a converter to compute the hashes of the files of
+// w, without the safecrlf checks, only done when adding them.
+func (w *Worktree) newHashConverter() (*converter, error) {
+	c, err := w.newConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	c.safeCRLF = false
+	return c, nil
+}
+
+// nodeOptions returns the options of the filesystem nodes of the worktree,
+// hashing the content of the files as stored in the repository.
+func (c *converter) nodeOptions() filesystem.Options {
+	return filesystem.Options{
+		Convert: func(path string, r io.Reader, size int64) (io.Reader, int64, error) {
+			r, size, err := c.toRepository(path, r, size)
+			if err != nil && c.err == nil {
+				c.err = err
+			}
+
+			return r, size, err
+		},
+	}
+}
+
+// nodeError returns the error converting the files of the filesystem nodes,
+// if err comes from it, or err.
+func (c *converter) nodeError(err error) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return err
+}
+
+func isTrue(v string) bool {
+	return v == "true" || v == "yes" || v == "on" || v == "1"
+}
+
+// matchAttributes returns the attributes driving the conversions of the file
+// at name. The info/attributes file has the highest priority,
+// followed by the .gitattributes files from the deepest directory up.
+func (c *converter) matchAttributes(name string) (map[string]gitattributes.Attribute, error) {
+	if c.attributes == nil {
+		c.attributes = make(map[string][]gitattributes.MatchAttribute)
+
+		macro, err := gitattributes.ParseAttributesLine(binaryMacro, nil, true)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := gitattributes.ReadAttributesFile(c.w.r.stateFilesystem(), nil, infoAttributesPath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		c.global = append([]gitattributes.MatchAttribute{macro}, info...)
+	}
+
+	parts := strings.Split(name, "/")
+	var stack []gitattributes.MatchAttribute
+	for i := 0; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		attrs, ok := c.attributes[dir]
+		if !ok {
+			var err error
+			attrs, err = c.readAttributes(parts[:i:i])
+			if err != nil {
+				return nil, err
+			}
+
+			c.attributes[dir] = attrs
+		}
+
+		stack = append(stack, attrs...)
+	}
+
+	stack = append(stack, c.global...)
+	results, _ := gitattributes.NewMatcher(stack).Match(parts, convertAttributes)
+	return results, nil
+}
+
+// readAttributes reads the .gitattributes file of the given directory. As git
+// does, the macros are only allowed in the top-level file, and ignored in the
+// other ones.
+func (c *converter) readAttributes(dir []string) ([]gitattributes.MatchAttribute, error) {
+	attrs, err := gitattributes.ReadAttributesFile(c.w.Filesystem, dir, gitattributesFile, true)
+	if err != nil || len(dir) == 0 {
+		return attrs, err
+	}
+
+	var res []gitattributes.MatchAttribute
+	for _, a := range attrs {
+		if a.Pattern != nil {
+			res = append(res, a)
+		}
+	}
+
+	return res, nil
+}
+
+// invalidate discards the attributes read so far if the file at name is a
+// .gitattributes file.
+func (c *converter) invalidate(name string) {
+	if path.Base(name) == gitattributesFile {
+		c.attributes = nil
+	}
+}
+
+// crlfAction returns the line ending conversion of a file with the given
+// attributes.
+func (c *converter) crlfAction(attrs map[string]gitattributes.Attribute) crlfAction {
+	action := crlfAttributeAction(attrs["text"])
+	if action == crlfUndefined {
+		action = crlfAttributeAction(attrs["crlf"])
+	}
+
+	if action != crlfBinary {
+		var eol string
+		if a, ok := attrs["eol"]; ok && a.IsValueSet() {
+			eol = a.Value()
+		}
+
+		switch {
+		case action == crlfAuto && eol == "lf":
+			action = crlfAutoInput
+		case action == crlfAuto && eol == "crlf":
+			action = crlfAutoCRLF
+		case eol == "lf":
+			action = crlfTextInput
+		case eol == "crlf":
+			action = crlfTextCRLF
+		}
+	}
+
+	switch {
+	case action == crlfText && c.textEOLIsCRLF():
+		action = crlfTextCRLF
+	case action == crlfText:
+		action = crlfTextInput
+	case action == crlfUndefined && c.autoCRLF == "true":
+		action = crlfAutoCRLF
+	case action == crlfUndefined && c.autoCRLF == "input":
+		action = crlfAutoInput
+	case action == crlfUndefined:
+		action = crlfBinary
+	}
+
+	return action
+}
+
+// crlfAttributeAction returns the line ending conversion set by the text or
+// the crlf attribute.
+func crlfAttributeAction(a gitattributes.Attribute) crlfAction {
+	switch {
+	case a == nil:
+		return crlfUndefined
+	case a.IsSet():
+		return crlfText
+	case a.IsUnset():
+		return crlfBinary
+	case a.IsValueSet() && a.Value() == "input":
+		return crlfTextInput
+	case a.IsValueSet() && a.Value() == "auto":
+		return crlfAuto
+	}
+
+	return crlfUndefined
+}
+
+// textEOLIsCRLF tells whether the line endings of the text files without an
+// eol attribute are CRLF in the worktree.
+func (c *converter) textEOLIsCRLF() bool {
+	switch {
+	case c.autoCRLF == "true":
+		return true
+	case c.autoCRLF == "input":
+		return false
+	case c.eol == "crlf":
+		return true
+	case c.eol == "" || c.eol == "native":
+		return runtime.GOOS == "windows"
+	}
+
+	return false
+}
+
+// outputCRLF tells whether the line endings of the file are CRLF in the
+// worktree.
+func (c *converter) outputCRLF(action crlfAction) bool {
+	switch action {
+	case crlfTextCRLF, crlfAutoCRLF:
+		return true
+	case crlfText, crlfAuto:
+		return c.textEOLIsCRLF()
+	}
+
+	return false
+}
+
+// willConvertLFToCRLF tells whether the LF line endings of a file with the
+// given stats are converted to CRLF on checkout.
+func (c *converter) willConvertLFToCRLF(s textStats, action crlfAction) bool {
+	if !c.outputCRLF(action) || s.lonelf == 0 {
+		return false
+	}
+
+	if action.isAuto() && (s.lonecr > 0 || s.crlf > 0 || s.isBinary()) {
+		return false
+	}
+
+	return true
+}
+
+// toWorktree returns the content of the file at name to write in the
+// worktree, from its content in the repository read from r. The line endings
+// are converted before applying the smudge filter.
+func (c *converter) toWorktree(name string, r io.Reader) (io.Reader, error) {
+	attrs, err := c.matchAttributes(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if action := c.crlfAction(attrs); c.outputCRLF(action) {
+		if r, err = c.crlfToWorktree(r, action); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.applyFilter(name, attrs, false, r)
+}
+
+func (c *converter) crlfToWorktree(r io.Reader, action crlfAction) (io.Reader, error) {
+	buf, err := stdioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.willConvertLFToCRLF(gatherTextStats(buf), action) {
+		return bytes.NewReader(buf), nil
+	}
+
+	out := make([]byte, 0, len(buf)+bytes.Count(buf, []byte{'\n'}))
+	for i, b := range buf {
+		if b == '\n' && (i == 0 || buf[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+
+		out = append(out, b)
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+// toRepository returns the content of the file at name to store in the
+// repository, and its size, from its content in the worktree read from r.
+// The clean filter is applied before converting the line endings. A
+// SafeCRLFError is returned if safeCRLF is set and the conversion wouldn't be
+// reverted on checkout.
+func (c *converter) toRepository(name string, r io.Reader, size int64) (io.Reader, int64, error) {
+	attrs, err := c.matchAttributes(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r, size, err = c.clean(name, attrs, r, size); err != nil {
+		return nil, 0, err
+	}
+
+	action := c.crlfAction(attrs)
+	if action == crlfBinary || size == 0 {
+		return r, size, nil
+	}
+
+	buf, err := stdioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s := gatherTextStats(buf)
+	convert := s.crlf > 0
+	checkSafe := c.safeCRLF
+	if action.isAuto() {
+		if s.isBinary() {
+			return bytes.NewReader(buf), int64(len(buf)), nil
+		}
+
+		if c.renormalize {
+			checkSafe = false
+		} else if convert {
+			if convert, err = c.hasCRLFInIndex(name); err != nil {
+				return nil, 0, err
+			}
+
+			convert = !convert
+		}
+	}
+
+	if checkSafe {
+		if err := c.checkSafeCRLF(name, s, action, convert); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if !convert {
+		return bytes.NewReader(buf), int64(len(buf)), nil
+	}
+
+	out := make([]byte, 0, len(buf)-s.crlf)
+	for i, b := range buf {
+		if b == '\r' && i+1 < len(buf) && buf[i+1] == '\n' {
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	return bytes.NewReader(out), int64(len(out)), nil
+}
+
+// clean applies the clean filter to the content of the file at name read from
+// r, returning the cleaned content and its size.
+func (c *converter) clean(name string, attrs map[string]gitattributes.Attribute, r io.Reader, size int64) (io.Reader, int64, error) {
+	r, err := c.applyFilter(name, attrs, true, r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if buf, ok := r.(*bytes.Reader); ok {
+		return buf, buf.Size(), nil
+	}
+
+	return r, size, nil
+}
+
+// driver returns the filter driver of a file with the given attributes, its
+// name, and whether it's required, or a nil filter if there is none. The
+// filters of the worktree take precedence over the commands of the config.
+func (c *converter) driver(attrs map[string]gitattributes.Attribute) (filter.Filter, string, bool) {
+	a, ok := attrs["filter"]
+	if !ok || !a.IsValueSet() {
+		return nil, "", false
+	}
+
+	name := a.Value()
+	cfg := c.filters[name]
+	required := cfg != nil && cfg.Required
+	if f, ok := c.w.Filters[name]; ok {
+		return f, name, required
+	}
+
+	if cfg == nil {
+		return nil, "", false
+	}
+
+	f, ok := c.drivers[name]
+	if !ok {
+		if cfg.Process != "" {
+			p := filter.NewProcess(cfg.Process, c.w.Filesystem.Root())
+			c.processes = append(c.processes, p)
+			f = p
+		} else {
+			f = filter.NewCommand(cfg.Clean, cfg.Smudge, c.w.Filesystem.Root())
+		}
+
+		c.drivers[name] = f
+	}
+
+	return f, name, required
+}
+
+// applyFilter applies the clean or the smudge filter to the content of the
+// file at name read from r. The content is left untouched if there is no
+// filter or it fails, unless the filter is required.
+func (c *converter) applyFilter(name string, attrs map[string]gitattributes.Attribute, clean bool, r io.Reader) (io.Reader, error) {
+	f, driver, required := c.driver(attrs)
+	if f == nil {
+		return r, nil
+	}
+
+	src, err := stdioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := &bytes.Buffer{}
+	command := "smudge"
+	if clean {
+		command = "clean"
+		err = f.Clean(name, dst, bytes.NewReader(src))
+	} else {
+		err = f.Smudge(name, dst, bytes.NewReader(src))
+	}
+
+	switch {
+	case err == nil:
+		return bytes.NewReader(dst.Bytes()), nil
+	case required:
+		return nil, &FilterError{Path: name, Driver: driver, Command: command, Err: err}
+	}
+
+	return bytes.NewReader(src), nil
+}
+
+// checkSafeCRLF checks that checking out the file with the given stats, once
+// added, restores its line endings.
+func (c *converter) checkSafeCRLF(name string, s textStats, action crlfAction, convert bool) error {
+	added := s
+	if convert {
+		added.lonelf += added.crlf
+		added.crlf = 0
+	}
+
+	if c.willConvertLFToCRLF(added, action) {
+		added.crlf += added.lonelf
+		added.lonelf = 0
+	}
+
+	switch {
+	case s.crlf > 0 && added.crlf == 0:
+		return &SafeCRLFError{Path: name, From: "CRLF", To: "LF"}
+	case s.lonelf > 0 && added.lonelf == 0:
+		return &SafeCRLFError{Path: name, From: "LF", To: "CRLF"}
+	}
+
+	return nil
+}
+
+// hasCRLFInIndex tells whether the blob of the file at name in the index is
+// a text with CRLF line endings, which the automatic conversions leave
+// untouched.
+func (c *converter) hasCRLFInIndex(name string) (bool, error) {
+	if c.indexHashes == nil {
+		idx, err := c.w.r.Storer.Index()
+		if err != nil {
+			return false, err
+		}
+
+		c.indexHashes = make(map[string]plumbing.Hash, len(idx.Entries))
+		for _, e := range idx.Entries {
+			if e.Stage == index.Merged && e.Mode.IsFile() {
+				c.indexHashes[e.Name] = e.Hash
+			}
+		}
+	}
+
+	h, ok := c.indexHashes[name]
+	if !ok {
+		return false, nil
+	}
+
+	blob, err := c.w.r.BlobObject(h)
+	if err != nil {
+		return false, err
+	}
+
+	r, err := blob.Reader()
+	if err != nil {
+		return false, err
+	}
+
+	defer r.Close()
+	buf, err := stdioutil.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.IndexByte(buf, '\r') == -1 {
+		return false, nil
+	}
+
+	s := gatherTextStats(buf)
+	return !s.isBinary() && s.crlf > 0, nil
+}
+
+// renormalize adds again the tracked files under the given path, applying the
+// line ending conversions even to the files with CRLF line endings in the
+// index.
+func (w *Worktree) renormalize(dir string) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	c.renormalize = true
+	dir = strings.Trim(filepath.ToSlash(dir), "/")
+	if dir == "." {
+		dir = ""
+	}
+
+	var changed bool
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged || e.SkipWorktree || !e.Mode.IsFile() || e.Mode == filemode.Symlink {
+			continue
+		}
+
+		if dir != "" && e.Name != dir && !strings.HasPrefix(e.Name, dir+"/") {
+			continue
+		}
+
+		h, err := w.copyFileToStorage(c, e.Name)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if h == e.Hash {
+			continue
+		}
+
+		if err := w.doUpdateFileToIndex(e, e.Name, h); err != nil {
+			return err
+		}
+
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
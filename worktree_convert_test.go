@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filter"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newConvertTestRepository returns a repository with the given core.autocrlf
+// and core.safecrlf config.
+func newConvertTestRepository(c *C, autoCRLF, safeCRLF string) (*Repository, *Worktree) {
+	r, w := newTestRepository(c, nil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.AutoCRLF = autoCRLF
+	cfg.Core.SafeCRLF = safeCRLF
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+	return r, w
+}
+
+// readIndexBlob returns the contents of the blob of the given file in the
+// index.
+func readIndexBlob(c *C, r *Repository, name string) string {
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	e, err := idx.Entry(name)
+	c.Assert(err, IsNil)
+
+	blob, err := r.BlobObject(e.Hash)
+	c.Assert(err, IsNil)
+	reader, err := blob.Reader()
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	b, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	return string(b)
+}
+
+func (s *WorktreeSuite) TestCheckoutTextAutoEOLCRLF(c *C) {
+	_, w := newConvertTestRepository(c, "", "")
+
+	commitFiles(c, w, map[string]string{".gitattributes": "* text=auto eol=crlf\n"})
+	h := commitFiles(c, w, map[string]string{
+		"foo":     "foo\nbar\n",
+		"bin":     "foo\x00\nbar\n",
+		"A/mixed": "foo\r\nbar\n",
+	})
+
+	for _, name := range []string{".gitattributes", "foo", "bin", "A/mixed"} {
+		c.Assert(util.RemoveAll(w.Filesystem, name), IsNil)
+	}
+
+	err := w.Checkout(&CheckoutOptions{Hash: h, Force: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo\r\nbar\r\n")
+	c.Assert(readWorktreeFile(c, w, "bin"), Equals, "foo\x00\nbar\n")
+	c.Assert(readWorktreeFile(c, w, "A/mixed"), Equals, "foo\r\nbar\r\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+}
+
+func (s *WorktreeSuite) TestAddAutoCRLF(c *C) {
+	r, w := newConvertTestRepository(c, "true", "")
+
+	commitFiles(c, w, map[string]string{
+		"foo": "foo\r\nbar\r\n",
+		"bar": "bar\n",
+	})
+	c.Assert(readIndexBlob(c, r, "foo"), Equals, "foo\nbar\n")
+	c.Assert(readIndexBlob(c, r, "bar"), Equals, "bar\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+
+	c.Assert(w.Filesystem.Remove("bar"), IsNil)
+	c.Assert(w.Reset(&ResetOptions{Mode: HardReset}), IsNil)
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar\r\n")
+}
+
+func (s *WorktreeSuite) TestAddTextAttributes(c *C) {
+	r, w := newConvertTestRepository(c, "", "")
+
+	commitFiles(c, w, map[string]string{".gitattributes": "*.txt text\n*.bin -text\n"})
+	commitFiles(c, w, map[string]string{
+		"foo.txt": "foo\r\nbar\r\n",
+		"foo.bin": "foo\r\nbar\r\n",
+		"foo":     "foo\r\nbar\r\n",
+	})
+
+	c.Assert(readIndexBlob(c, r, "foo.txt"), Equals, "foo\nbar\n")
+	c.Assert(readIndexBlob(c, r, "foo.bin"), Equals, "foo\r\nbar\r\n")
+	c.Assert(readIndexBlob(c, r, "foo"), Equals, "foo\r\nbar\r\n")
+}
+
+func (s *WorktreeSuite) TestAddSafeCRLF(c *C) {
+	_, w := newConvertTestRepository(c, "input", "true")
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\r\n"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Worktree, Equals, Untracked)
+
+	_, err = w.Add("foo")
+	c.Assert(err, DeepEquals, &SafeCRLFError{Path: "foo", From: "CRLF", To: "LF"})
+}
+
+func (s *WorktreeSuite) TestAddRenormalize(c *C) {
+	r, w := newConvertTestRepository(c, "", "")
+
+	commitFiles(c, w, map[string]string{
+		"foo":     "foo\r\nbar\r\n",
+		"A/bar":   "bar\r\n",
+		"A/B/qux": "qux\n",
+	})
+	commitFiles(c, w, map[string]string{".gitattributes": "* text=auto\n"})
+
+	// the files with CRLF line endings in the index are left untouched
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+
+	err = w.AddWithOptions(&AddOptions{Path: "A", Renormalize: true})
+	c.Assert(err, IsNil)
+	c.Assert(readIndexBlob(c, r, "foo"), Equals, "foo\r\nbar\r\n")
+	c.Assert(readIndexBlob(c, r, "A/bar"), Equals, "bar\n")
+
+	c.Assert(w.AddWithOptions(&AddOptions{Renormalize: true}), IsNil)
+	c.Assert(readIndexBlob(c, r, "foo"), Equals, "foo\nbar\n")
+
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 2)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	c.Assert(status.File("A/bar").Staging, Equals, Modified)
+
+	err = w.AddWithOptions(&AddOptions{Glob: "*", Renormalize: true})
+	c.Assert(err, NotNil)
+}
+
+// upperFilter is a filter driver converting the content of the files to upper
+// case when adding them, and to lower case when checking them out.
+type upperFilter struct {
+	err error
+}
+
+func (f *upperFilter) Clean(path string, dst io.Writer, src io.Reader) error {
+	return f.convert(dst, src, bytes.ToUpper)
+}
+
+func (f *upperFilter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return f.convert(dst, src, bytes.ToLower)
+}
+
+func (f *upperFilter) convert(dst io.Writer, src io.Reader, fn func([]byte) []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(fn(b))
+	return err
+}
+
+// assertFilteredFiles checks that the content of "foo.up" is stored in upper
+// case, and checked out in lower case, unlike the one of "foo".
+func assertFilteredFiles(c *C, r *Repository, w *Worktree) {
+	commitFiles(c, w, map[string]string{".gitattributes": "*.up filter=upper\n"})
+	commitFiles(c, w, map[string]string{
+		"foo.up": "foo\n",
+		"foo":    "foo\n",
+	})
+
+	c.Assert(readIndexBlob(c, r, "foo.up"), Equals, "FOO\n")
+	c.Assert(readIndexBlob(c, r, "foo"), Equals, "foo\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+
+	c.Assert(w.Filesystem.Remove("foo.up"), IsNil)
+	c.Assert(w.Reset(&ResetOptions{Mode: HardReset}), IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo.up"), Equals, "foo\n")
+}
+
+func (s *WorktreeSuite) TestFilter(c *C) {
+	r, w := newConvertTestRepository(c, "", "")
+	w.Filters = map[string]filter.Filter{"upper": &upperFilter{}}
+
+	assertFilteredFiles(c, r, w)
+}
+
+func (s *WorktreeSuite) TestFilterCommand(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("the commands are run by sh")
+	}
+
+	r, w := newConvertTestRepository(c, "", "")
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Filters["upper"] = &config.Filter{
+		Name:   "upper",
+		Clean:  "tr a-z A-Z",
+		Smudge: "tr A-Z a-z",
+	}
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	assertFilteredFiles(c, r, w)
+}
+
+func (s *WorktreeSuite) TestFilterFailure(c *C) {
+	r, w := newConvertTestRepository(c, "", "")
+	failure := errors.New("failure")
+	w.Filters = map[string]filter.Filter{"upper": &upperFilter{err: failure}}
+
+	// the content is left untouched
+	commitFiles(c, w, map[string]string{".gitattributes": "*.up filter=upper\n"})
+	commitFiles(c, w, map[string]string{"foo.up": "foo\n"})
+	c.Assert(readIndexBlob(c, r, "foo.up"), Equals, "foo\n")
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Filters["upper"] = &config.Filter{Name: "upper", Required: true}
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo.up", []byte("bar\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo.up")
+	c.Assert(err, DeepEquals, &FilterError{
+		Path:    "foo.up",
+		Driver:  "upper",
+		Command: "clean",
+		Err:     failure,
+	})
+
+	c.Assert(w.Filesystem.Remove("foo.up"), IsNil)
+	err = w.Reset(&ResetOptions{Mode: HardReset})
+	c.Assert(err, ErrorMatches, "foo.up: smudge filter 'upper' failed: failure")
+}
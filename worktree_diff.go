@@ -0,0 +1,194 @@
+package git
+
+import (
+	"context"
+	"encoding/binary"
+	"regexp"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/storage/transactional"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/go-git/go-git/v5/utils/merkletrie/noder"
+)
+
+// Diff returns the patch of the changes between the worktree, the index and
+// a commit, as git diff does. By default the index is compared with the
+// worktree; DiffOptions.Cached compares a commit with the index, and
+// DiffOptions.Commit a commit with the worktree.
+//
+// Only the files tracked in the index are compared with the worktree, the
+// untracked files are left out. The contents of the files of the worktree
+// are not written to the object storage.
+func (w *Worktree) Diff(opts *DiffOptions) (*object.Patch, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return nil, err
+	}
+
+	var changes merkletrie.Changes
+	var err error
+	worktree := !opts.Cached
+	switch {
+	case opts.Cached:
+		changes, err = w.diffCommitWithStaging(opts.Commit, false)
+	case opts.Commit.IsZero():
+		changes, err = w.diffStagingWithWorktree(false)
+	default:
+		changes, err = w.diffCommitWithWorktree(opts.Commit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if worktree {
+		if changes, err = w.excludeUntrackedChanges(changes); err != nil {
+			return nil, err
+		}
+	}
+
+	// the files of the worktree are written to a temporal storage, so the
+	// patch can read them as blobs
+	s := transactional.NewObjectStorage(w.r.Storer, memory.NewStorage())
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.TreeObject)
+	tree, err := object.DecodeTree(s, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := w.newHashConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.close()
+
+	d := &worktreeDiff{w: w, c: c, s: s, tree: tree}
+	var result object.Changes
+	for _, ch := range changes {
+		if !matchesPathSpecs(opts.PathSpecs, ch) {
+			continue
+		}
+
+		change := &object.Change{}
+		if change.From, err = d.changeEntry(ch.From, false); err != nil {
+			return nil, err
+		}
+
+		if change.To, err = d.changeEntry(ch.To, worktree); err != nil {
+			return nil, err
+		}
+
+		result = append(result, change)
+	}
+
+	if opts.DiffTreeOptions != nil && opts.DiffTreeOptions.DetectRenames {
+		if result, err = object.DetectRenames(result, opts.DiffTreeOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	return result.PatchWithOptions(context.Background(), opts.PatchOptions)
+}
+
+// excludeUntrackedChanges removes the changes of the files of the worktree
+// that are not in the index, the files tracked but not in the index anymore
+// being deleted.
+func (w *Worktree) excludeUntrackedChanges(changes merkletrie.Changes) (merkletrie.Changes, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+
+	var res merkletrie.Changes
+	for _, ch := range changes {
+		if ch.To != nil && !tracked[ch.To.String()] {
+			if ch.From == nil {
+				continue
+			}
+
+			ch.To = nil
+		}
+
+		res = append(res, ch)
+	}
+
+	return res, nil
+}
+
+// matchesPathSpecs tells whether any of the paths of the change matches the
+// pathspecs, all of them matching if there are no pathspecs.
+func matchesPathSpecs(pathSpecs []*regexp.Regexp, ch merkletrie.Change) bool {
+	if len(pathSpecs) == 0 {
+		return true
+	}
+
+	for _, p := range []noder.Path{ch.From, ch.To} {
+		if p == nil {
+			continue
+		}
+
+		for _, pathSpec := range pathSpecs {
+			if pathSpec != nil && pathSpec.MatchString(p.String()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// worktreeDiff builds the object.Changes of a diff involving the worktree.
+type worktreeDiff struct {
+	w *Worktree
+	// c converts the line endings of the files of the worktree
+	c *converter
+	// s holds the objects of the repository and the blobs of the worktree
+	s storer.EncodedObjectStorer
+	// tree is an empty tree of s, used to read the blobs of the changes
+	tree *object.Tree
+}
+
+// changeEntry returns the ChangeEntry of the file at p, writing its content
+// to the temporal storage if it is a file of the worktree.
+func (d *worktreeDiff) changeEntry(p noder.Path, worktree bool) (object.ChangeEntry, error) {
+	if p == nil {
+		return object.ChangeEntry{}, nil
+	}
+
+	// the hashes of the noders hold the hash and the mode of the files
+	h := p.Last().Hash()
+	var hash plumbing.Hash
+	copy(hash[:], h[:len(hash)])
+	mode := filemode.FileMode(binary.LittleEndian.Uint32(h[len(hash):]))
+
+	if worktree && mode.IsFile() && d.s.HasEncodedObject(hash) != nil {
+		var err error
+		if hash, err = d.w.copyFileToStorer(d.s, d.c, p.String()); err != nil {
+			return object.ChangeEntry{}, err
+		}
+	}
+
+	return object.ChangeEntry{
+		Name: p.String(),
+		Tree: d.tree,
+		TreeEntry: object.TreeEntry{
+			Name: p.Last().Name(),
+			Mode: mode,
+			Hash: hash,
+		},
+	}, nil
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"regexp"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newDiffTestRepository returns a repository with a commit adding the files
+// "foo" and "bar", "foo" being then changed in the index and in the worktree.
+func newDiffTestRepository(c *C) (*Repository, *Worktree, plumbing.Hash) {
+	r, w := newTestRepository(c, nil)
+	h := commitFiles(c, w, map[string]string{
+		"foo": "1\n2\n3\n",
+		"bar": "bar\n",
+	})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("1\ntwo\n3\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("1\ntwo\nthree\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0644)
+	c.Assert(err, IsNil)
+
+	return r, w, h
+}
+
+func (s *WorktreeSuite) TestDiff(c *C) {
+	_, w, _ := newDiffTestRepository(c)
+
+	p, err := w.Diff(nil)
+	c.Assert(err, IsNil)
+	c.Assert(p.String(), Equals, ""+
+		"diff --git a/foo b/foo\n"+
+		"index d8eb09865eea17463394416e1be16d5bc553da88..0e2eccdebabbf1b6982d0725787220a23c048ae0 100644\n"+
+		"--- a/foo\n"+
+		"+++ b/foo\n"+
+		"@@ -1,3 +1,3 @@\n"+
+		" 1\n"+
+		" two\n"+
+		"-3\n"+
+		"+three\n",
+	)
+}
+
+func (s *WorktreeSuite) TestDiffCached(c *C) {
+	_, w, _ := newDiffTestRepository(c)
+
+	p, err := w.Diff(&DiffOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.String(), Equals, ""+
+		"diff --git a/foo b/foo\n"+
+		"index 01e79c32a8c99c557f0757da7cb6d65b3414466d..d8eb09865eea17463394416e1be16d5bc553da88 100644\n"+
+		"--- a/foo\n"+
+		"+++ b/foo\n"+
+		"@@ -1,3 +1,3 @@\n"+
+		" 1\n"+
+		"-2\n"+
+		"+two\n"+
+		" 3\n",
+	)
+}
+
+func (s *WorktreeSuite) TestDiffCommit(c *C) {
+	_, w, h := newDiffTestRepository(c)
+
+	err := w.Filesystem.Remove("bar")
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(&DiffOptions{Commit: h})
+	c.Assert(err, IsNil)
+	c.Assert(p.String(), Equals, ""+
+		"diff --git a/bar b/bar\n"+
+		"deleted file mode 100644\n"+
+		"index 5716ca5987cbf97d6bb54920bea6adde242d87e6..0000000000000000000000000000000000000000\n"+
+		"--- a/bar\n"+
+		"+++ /dev/null\n"+
+		"@@ -1 +0,0 @@\n"+
+		"-bar\n"+
+		"diff --git a/foo b/foo\n"+
+		"index 01e79c32a8c99c557f0757da7cb6d65b3414466d..0e2eccdebabbf1b6982d0725787220a23c048ae0 100644\n"+
+		"--- a/foo\n"+
+		"+++ b/foo\n"+
+		"@@ -1,3 +1,3 @@\n"+
+		" 1\n"+
+		"-2\n"+
+		"-3\n"+
+		"+two\n"+
+		"+three\n",
+	)
+}
+
+func (s *WorktreeSuite) TestDiffPathSpecs(c *C) {
+	_, w, h := newDiffTestRepository(c)
+
+	err := util.WriteFile(w.Filesystem, "bar", []byte("baz\n"), 0644)
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(&DiffOptions{
+		Commit:    h,
+		PathSpecs: []*regexp.Regexp{regexp.MustCompile("^ba")},
+	})
+	c.Assert(err, IsNil)
+
+	patches := p.FilePatches()
+	c.Assert(patches, HasLen, 1)
+	from, to := patches[0].Files()
+	c.Assert(from.Path(), Equals, "bar")
+	c.Assert(to.Path(), Equals, "bar")
+}
+
+func (s *WorktreeSuite) TestDiffRenames(c *C) {
+	_, w, _ := newDiffTestRepository(c)
+
+	_, err := w.Move("bar", "baz")
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(&DiffOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 3)
+
+	p, err = w.Diff(&DiffOptions{
+		Cached:          true,
+		DiffTreeOptions: object.DefaultDiffTreeOptions,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 2)
+
+	from, to := p.FilePatches()[0].Files()
+	c.Assert(from.Path(), Equals, "bar")
+	c.Assert(to.Path(), Equals, "baz")
+}
+
+func (s *WorktreeSuite) TestDiffEmptyRepository(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(nil)
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 0)
+
+	p, err = w.Diff(&DiffOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+
+	from, to := p.FilePatches()[0].Files()
+	c.Assert(from, IsNil)
+	c.Assert(to.Path(), Equals, "foo")
+}
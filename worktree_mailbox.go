@@ -0,0 +1,238 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/mbox"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrEmptyPatch is returned by Worktree.ApplyMailbox when a message holds no
+// patch.
+var ErrEmptyPatch = errors.New("patch is empty")
+
+// subjectPrefixRegexp matches the prefixes removed from the subjects of the
+// messages, as git mailinfo does: "Re:" and bracketed text as "[PATCH 1/2]".
+var subjectPrefixRegexp = regexp.MustCompile(`^(?i)(\s+|re:|\[[^\]]*\])`)
+
+// ApplyMailbox applies the patches of the messages read from r, a mailbox
+// as written by git format-patch, committing each one with the author, the
+// date and the message given by the email, as git am does. The hashes of the
+// new commits are returned.
+//
+// The patches are applied to the index and the worktree, which must match
+// HEAD for the files changed. If a patch doesn't apply, the error of
+// Worktree.Apply is returned along with the commits created so far, and the
+// remaining messages are not applied.
+func (w *Worktree) ApplyMailbox(r io.Reader, opts *ApplyMailboxOptions) ([]plumbing.Hash, error) {
+	if opts == nil {
+		opts = &ApplyMailboxOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return nil, err
+	}
+
+	var commits []plumbing.Hash
+	d := mbox.NewDecoder(r)
+	for {
+		m, err := d.Decode()
+		if err == io.EOF {
+			return commits, nil
+		}
+
+		if err != nil {
+			return commits, err
+		}
+
+		h, err := w.applyMessage(m, opts)
+		if err != nil {
+			return commits, err
+		}
+
+		commits = append(commits, h)
+	}
+}
+
+func (w *Worktree) applyMessage(m *mbox.Message, opts *ApplyMailboxOptions) (plumbing.Hash, error) {
+	if err := w.checkMergeInProgress(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, err
+	}
+
+	if head != nil {
+		staged, err := w.diffCommitWithStaging(head.Hash(), false)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if len(staged) != 0 {
+			return plumbing.ZeroHash, ErrWorktreeNotClean
+		}
+	}
+
+	info := parseMailInfo(m, opts.KeepSubject)
+	patch, err := fdiff.NewDecoder(strings.NewReader(info.patch)).Decode()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(patch.FilePatches()) == 0 {
+		return plumbing.ZeroHash, ErrEmptyPatch
+	}
+
+	// the committer is resolved before changing anything, as git am does
+	co, err := w.commitOptionsFor(&info.author, opts.Committer)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	co.SignKey = opts.SignKey
+	err = w.Apply(patch, &ApplyOptions{Index: true, ThreeWay: opts.ThreeWay})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return w.Commit(info.message, co)
+}
+
+// mailInfo is the commit described by a message.
+type mailInfo struct {
+	author  object.Signature
+	message string
+	patch   string
+}
+
+// parseMailInfo splits the message in the commit message and the patch, as
+// git mailinfo does. The author, the date and the subject given by the
+// header can be replaced by "From:", "Date:" and "Subject:" lines at the
+// start of the body.
+func parseMailInfo(m *mbox.Message, keepSubject bool) *mailInfo {
+	info := &mailInfo{author: object.Signature{
+		Name:  m.Author.Name,
+		Email: m.Author.Email,
+		When:  m.Author.When,
+	}}
+
+	subject := m.Subject
+	body := m.Body
+	for {
+		i := strings.IndexByte(body, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := body[:i]
+		key, value, ok := splitInBodyHeader(line)
+		if !ok {
+			break
+		}
+
+		switch key {
+		case "From":
+			if a, err := mail.ParseAddress(value); err == nil {
+				info.author.Name, info.author.Email = a.Name, a.Address
+			}
+		case "Date":
+			if when, err := mail.ParseDate(value); err == nil {
+				info.author.When = when
+			}
+		case "Subject":
+			subject = value
+		}
+
+		body = strings.TrimLeft(body[i+1:], "\n")
+	}
+
+	if info.author.When.IsZero() {
+		info.author.When = time.Now()
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	msg := body
+	for i, l := range lines {
+		if isPatchStart(l) {
+			msg = strings.Join(lines[:i], "")
+			info.patch = strings.Join(lines[i:], "")
+			break
+		}
+	}
+
+	if !keepSubject {
+		subject = cleanupSubject(subject)
+	}
+
+	info.message = strings.TrimSpace(subject) + "\n"
+	if msg = stripSpace(msg); msg != "" {
+		info.message += "\n" + msg
+	}
+
+	return info
+}
+
+// stripSpace removes the trailing whitespace of the lines, the leading and
+// trailing blank lines and the consecutive blank lines of the message, as
+// git stripspace does, keeping the indentation of the lines.
+func stripSpace(msg string) string {
+	b := &strings.Builder{}
+	blank := false
+	for _, l := range strings.Split(msg, "\n") {
+		l = strings.TrimRight(l, " \t\r\v\f")
+		if l == "" {
+			blank = b.Len() != 0
+			continue
+		}
+
+		if blank {
+			b.WriteByte('\n')
+			blank = false
+		}
+
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// splitInBodyHeader returns the key and the value of a header line written
+// at the start of the body of a message.
+func splitInBodyHeader(line string) (key, value string, ok bool) {
+	for _, k := range []string{"From", "Date", "Subject"} {
+		if strings.HasPrefix(line, k+": ") {
+			return k, strings.TrimSpace(line[len(k)+2:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// isPatchStart tells whether the line starts the patch of a message.
+func isPatchStart(line string) bool {
+	return strings.TrimRight(line, " \t\n") == "---" ||
+		strings.HasPrefix(line, "diff -") ||
+		strings.HasPrefix(line, "Index: ")
+}
+
+// cleanupSubject removes the "Re:" and bracketed prefixes of the subject.
+func cleanupSubject(subject string) string {
+	for {
+		loc := subjectPrefixRegexp.FindStringIndex(subject)
+		if loc == nil {
+			return strings.Join(strings.Fields(subject), " ")
+		}
+
+		subject = subject[loc[1]:]
+	}
+}
@@ -0,0 +1,250 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/mbox"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// mailboxFixture was generated with git format-patch --stdout, from the
+// commits of newFormatPatchTestRepository with another author.
+const mailboxFixture = `From e9396a27df8369fe65bf7e8d5ee365809447a624 Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?Ren=C3=A9=20Doe?= <r@x.org>
+Date: Thu, 2 Jan 2020 03:04:05 +0100
+Subject: [PATCH 1/2] =?UTF-8?q?Change=20b,=20a=C3=B1adido?=
+MIME-Version: 1.0
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: 8bit
+
+Longer body.
+---
+ f | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/f b/f
+index 422c2b7..55dce13 100644
+--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
++B
+-- 
+2.39.5
+
+
+From 1054be3761659701ad40bfa2bf487e6a46e1d39d Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?Ren=C3=A9=20Doe?= <r@x.org>
+Date: Thu, 2 Jan 2020 03:04:05 +0100
+Subject: [PATCH 2/2] Add g
+
+---
+ g | 1 +
+ 1 file changed, 1 insertion(+)
+ create mode 100644 g
+
+diff --git a/g b/g
+new file mode 100644
+index 0000000..587be6b
+--- /dev/null
++++ b/g
+@@ -0,0 +1 @@
++x
+-- 
+2.39.5
+
+`
+
+func (s *WorktreeSuite) TestApplyMailbox(c *C) {
+	r, w := newTestRepository(c, map[string]string{"f": "a\nb\n"})
+
+	committer := defaultSignature()
+	commits, err := w.ApplyMailbox(strings.NewReader(mailboxFixture), &ApplyMailboxOptions{
+		Committer: committer,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(commits, HasLen, 2)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, commits[1])
+
+	first, err := r.CommitObject(commits[0])
+	c.Assert(err, IsNil)
+	c.Assert(first.Message, Equals, "Change b, añadido\n\nLonger body.\n")
+	c.Assert(first.Author.Name, Equals, "René Doe")
+	c.Assert(first.Author.Email, Equals, "r@x.org")
+	c.Assert(first.Author.When.Unix(), Equals, int64(1577930645))
+	c.Assert(first.Committer.Name, Equals, committer.Name)
+
+	second, err := r.CommitObject(commits[1])
+	c.Assert(err, IsNil)
+	c.Assert(second.Message, Equals, "Add g\n")
+	c.Assert(second.ParentHashes, DeepEquals, []plumbing.Hash{first.Hash})
+
+	c.Assert(readWorktreeFile(c, w, "f"), Equals, "a\nB\n")
+	c.Assert(readWorktreeFile(c, w, "g"), Equals, "x\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *WorktreeSuite) TestApplyMailboxFormatPatch(c *C) {
+	from, _ := newFormatPatchTestRepository(c)
+
+	messages, err := from.FormatPatch(&FormatPatchOptions{Revisions: []string{"HEAD~2"}})
+	c.Assert(err, IsNil)
+
+	buf := &bytes.Buffer{}
+	err = mbox.NewEncoder(buf).Encode(messages...)
+	c.Assert(err, IsNil)
+
+	r, w := newFormatPatchTestRepository(c)
+	root, err := r.ResolveRevision("HEAD~2")
+	c.Assert(err, IsNil)
+	c.Assert(w.Reset(&ResetOptions{Mode: HardReset, Commit: *root}), IsNil)
+
+	commits, err := w.ApplyMailbox(buf, &ApplyMailboxOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+	c.Assert(commits, HasLen, 2)
+
+	// the commits are identical, as their authors and committers are the same
+	head, err := from.Head()
+	c.Assert(err, IsNil)
+	c.Assert(commits[1], Equals, head.Hash())
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, head.Hash())
+}
+
+func (s *WorktreeSuite) TestApplyMailboxFailure(c *C) {
+	r, w := newTestRepository(c, map[string]string{"f": "a\nb\n"})
+
+	err := util.WriteFile(w.Filesystem, "f", []byte("a\nc\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Add("f")
+	c.Assert(err, IsNil)
+
+	_, err = w.ApplyMailbox(strings.NewReader(mailboxFixture), nil)
+	c.Assert(err, Equals, ErrWorktreeNotClean)
+
+	_, err = w.Commit("c\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commits, err := w.ApplyMailbox(strings.NewReader(mailboxFixture), &ApplyMailboxOptions{
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, FitsTypeOf, &ApplyError{})
+	c.Assert(commits, HasLen, 0)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, head.Hash())
+}
+
+func (s *WorktreeSuite) TestApplyMailboxEmptyPatch(c *C) {
+	_, w := newTestRepository(c, map[string]string{"f": "a\nb\n"})
+
+	commits, err := w.ApplyMailbox(strings.NewReader("From: foo <foo@foo.foo>\nSubject: Hello\n\nNo patch.\n"), nil)
+	c.Assert(err, Equals, ErrEmptyPatch)
+	c.Assert(commits, HasLen, 0)
+}
+
+func (s *WorktreeSuite) TestParseMailInfo(c *C) {
+	m := &mbox.Message{
+		Author:  mbox.Signature{Name: "Sender", Email: "sender@example.com"},
+		Subject: "Re: [PATCH v2 3/7] [net]  Fix   the bug",
+		Body: "From: John Doe <john@example.com>\n" +
+			"Date: Thu, 2 Jan 2020 03:04:05 +0100\n" +
+			"\n" +
+			"Explain the fix.\n" +
+			"\n" +
+			"diff --git a/f b/f\n",
+	}
+
+	info := parseMailInfo(m, false)
+	c.Assert(info.author.Name, Equals, "John Doe")
+	c.Assert(info.author.Email, Equals, "john@example.com")
+	c.Assert(info.author.When.Unix(), Equals, int64(1577930645))
+	c.Assert(info.message, Equals, "Fix the bug\n\nExplain the fix.\n")
+	c.Assert(info.patch, Equals, "diff --git a/f b/f\n")
+
+	info = parseMailInfo(m, true)
+	c.Assert(info.message, Equals, "Re: [PATCH v2 3/7] [net]  Fix   the bug\n\nExplain the fix.\n")
+
+	m.Body = "\n    Indented line.  \n\n\n\nLast line.\n\n---\n"
+	info = parseMailInfo(m, false)
+	c.Assert(info.message, Equals, "Fix the bug\n\n    Indented line.\n\nLast line.\n")
+
+	m.Body = "Subject: Another subject\n\n---\n"
+	info = parseMailInfo(m, false)
+	c.Assert(info.author.Name, Equals, "Sender")
+	c.Assert(info.message, Equals, "Another subject\n")
+}
+
+func (s *WorktreeSuite) TestApplyMailboxInvalidPath(c *C) {
+	r, w := newTestRepository(c, map[string]string{"f": "a\nb\n"})
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	mailbox := strings.Replace(mailboxFixture, " g", " .git/hooks/post-commit", -1)
+	mailbox = strings.Replace(mailbox, "/g", "/.git/hooks/post-commit", -1)
+	commits, err := w.ApplyMailbox(strings.NewReader(mailbox), &ApplyMailboxOptions{
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, Equals, ErrInvalidPatchPath)
+	c.Assert(commits, HasLen, 1)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, commits[0])
+	c.Assert(ref.Hash(), Not(Equals), head.Hash())
+
+	_, err = w.Filesystem.Stat(".git")
+	c.Assert(err, NotNil)
+}
+
+func (s *WorktreeSuite) TestApplyMailboxMissingCommitter(c *C) {
+	// a global config without identity
+	tmp, err := ioutil.TempDir("", "mailbox-config")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+	c.Assert(os.Mkdir(filepath.Join(tmp, "git"), 0777), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(tmp, "git", "config"), nil, 0644), IsNil)
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", xdg)
+	os.Setenv("XDG_CONFIG_HOME", tmp)
+
+	r, w := newTestRepository(c, map[string]string{"f": "a\nb\n"})
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commits, err := w.ApplyMailbox(strings.NewReader(mailboxFixture), nil)
+	c.Assert(err, Equals, ErrMissingAuthor)
+	c.Assert(commits, HasLen, 0)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, head.Hash())
+	c.Assert(readWorktreeFile(c, w, "f"), Equals, "a\nb\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
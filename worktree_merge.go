@@ -0,0 +1,979 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	stdioutil "io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/go-git/go-billy/v5/util"
+)
+
+var (
+	// ErrMergeConflicts is returned when a merge can not be completed because
+	// some paths were modified in incompatible ways by both sides.
+	ErrMergeConflicts = errors.New("merge conflicts")
+	// ErrMergeInProgress is returned when a merge is attempted while a
+	// previous one, stopped before committing, has not been concluded.
+	ErrMergeInProgress = errors.New("a merge is already in progress")
+	// ErrUnrelatedHistories is returned when the merged commits do not share
+	// any common ancestor and MergeOptions.AllowUnrelatedHistories is false.
+	ErrUnrelatedHistories = errors.New("refusing to merge unrelated histories")
+	// ErrUnmergedEntries is returned when an operation requires the index to
+	// be free of conflicts.
+	ErrUnmergedEntries = errors.New("index contains unmerged entries")
+	// ErrNotConflicted is returned by ResolveConflict when the given path has
+	// no conflicts recorded in the index.
+	ErrNotConflicted = errors.New("path has no conflicts")
+)
+
+// Merge joins the history of the commit given in the MergeOptions with the
+// current branch. If the given commit descends from HEAD the branch is just
+// fast-forwarded, otherwise the merge base of both commits is used to perform
+// a three-way merge of their trees, and the result is written to the index,
+// the worktree and, unless NoCommit is set, to a new merge commit.
+//
+// The hash of the commit HEAD points to after the merge is returned, or the
+// zero hash if NoCommit was requested and a merge was needed. If HEAD already
+// contains the given commit NoErrAlreadyUpToDate is returned.
+//
+// If some paths can not be merged, the merge stops before committing and
+// ErrMergeConflicts is returned. The base, ours and theirs versions of each
+// conflicting path are recorded in the index as the stages 1, 2 and 3, and
+// the worktree file is written with conflict markers. The conflicts can be
+// resolved with Worktree.ResolveConflict or Worktree.Add, and the merge
+// concluded with Worktree.Commit.
+func (w *Worktree) Merge(opts *MergeOptions) (plumbing.Hash, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.checkMergeInProgress(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	theirs, err := w.r.CommitObject(opts.Commit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := w.r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return theirs.Hash, w.fastForward(theirs.Hash, mergeReflogMessage(theirs.Hash, "Fast-forward"))
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	ours, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	upToDate, err := theirs.IsAncestor(ours)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if upToDate {
+		return ours.Hash, NoErrAlreadyUpToDate
+	}
+
+	ff, err := ours.IsAncestor(theirs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if ff && opts.FastForward != NoFastForward {
+		return theirs.Hash, w.fastForward(theirs.Hash, mergeReflogMessage(theirs.Hash, "Fast-forward"))
+	}
+
+	if !ff && opts.FastForward == FastForwardOnly {
+		return plumbing.ZeroHash, ErrNonFastForwardUpdate
+	}
+
+	if err := w.checkMergeable(ours.Hash); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	m := &treeMerger{
+		s:              w.r.Storer,
+		allowUnrelated: opts.AllowUnrelatedHistories,
+		style:          opts.ConflictStyle,
+		oursLabel:      "HEAD",
+		theirsLabel:    theirs.Hash.String(),
+	}
+
+	res, err := m.mergeCommits(ours, theirs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := m.writeTree(res)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.r.Storer.SetReference(
+		plumbing.NewHashReference(plumbing.OrigHead, ours.Hash),
+	); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if opts.NoCommit || len(res.Conflicts) != 0 {
+		if err := w.resetIndexAndWorktree(tree); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if err := w.r.Storer.SetReference(
+			plumbing.NewHashReference(plumbing.MergeHead, theirs.Hash),
+		); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if len(res.Conflicts) == 0 {
+			return plumbing.ZeroHash, nil
+		}
+
+		if err := w.writeConflicts(res.Conflicts); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return plumbing.ZeroHash, ErrMergeConflicts
+	}
+
+	co := &CommitOptions{
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Parents:   []plumbing.Hash{ours.Hash, theirs.Hash},
+		SignKey:   opts.SignKey,
+	}
+
+	if err := co.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := w.buildCommitObject(opts.Message, co, tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := mergeReflogMessage(theirs.Hash, "Merge made by the 'ort' strategy.")
+	if err := w.updateHEAD(commit, co.Committer, msg); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return commit, w.Reset(&ResetOptions{
+		Mode:   MergeReset,
+		Commit: commit,
+	})
+}
+
+// fastForward moves the current branch to the given commit, updating the
+// index and the worktree, and recording the given reflog message.
+func (w *Worktree) fastForward(commit plumbing.Hash, msg string) error {
+	if err := w.updateHEAD(commit, nil, msg); err != nil {
+		return err
+	}
+
+	return w.Reset(&ResetOptions{
+		Mode:   MergeReset,
+		Commit: commit,
+	})
+}
+
+// mergeReflogMessage returns the reflog message of a merge of the given
+// commit.
+func mergeReflogMessage(commit plumbing.Hash, result string) string {
+	return fmt.Sprintf("merge %s: %s", commit, result)
+}
+
+// inProgressStates are the pseudo-refs recording an operation stopped before
+// committing, with the error returned when another one is attempted.
+var inProgressStates = []struct {
+	ref plumbing.ReferenceName
+	err error
+}{
+	{plumbing.MergeHead, ErrMergeInProgress},
+	{plumbing.CherryPickHead, ErrCherryPickInProgress},
+	{plumbing.RevertHead, ErrRevertInProgress},
+}
+
+// checkMergeInProgress returns an error if a merge, cherry-pick or revert was
+// stopped before committing and has not been concluded.
+func (w *Worktree) checkMergeInProgress() error {
+	for _, st := range inProgressStates {
+		_, err := w.r.Storer.Reference(st.ref)
+		if err == nil {
+			return st.err
+		}
+
+		if err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMergeable returns an error if the index or the worktree contain
+// changes that would be lost when they are updated with the merge result.
+func (w *Worktree) checkMergeable(head plumbing.Hash) error {
+	staged, err := w.diffCommitWithStaging(head, false)
+	if err != nil {
+		return err
+	}
+
+	if len(staged) != 0 {
+		return ErrWorktreeNotClean
+	}
+
+	unstaged, err := w.containsUnstagedChanges()
+	if err != nil {
+		return err
+	}
+
+	if unstaged {
+		return ErrUnstagedChanges
+	}
+
+	return nil
+}
+
+// clearMergeState removes MERGE_HEAD, CHERRY_PICK_HEAD and REVERT_HEAD, if
+// any, aborting the operation in progress.
+func (w *Worktree) clearMergeState() error {
+	for _, st := range inProgressStates {
+		_, err := w.r.Storer.Reference(st.ref)
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := w.r.Storer.RemoveReference(st.ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResolveConflict marks an unmerged path as resolved, removing its stages
+// from the index and staging the content chosen by the given resolution. If
+// the chosen version doesn't contain the path, the path is resolved as
+// deleted.
+func (w *Worktree) ResolveConflict(path string, resolution ConflictResolution) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	stages := unmergedStages(idx, path)
+	if len(stages) == 0 {
+		return ErrNotConflicted
+	}
+
+	removeUnmergedStages(idx, path)
+
+	var e *index.Entry
+	switch resolution {
+	case ResolveWithWorktree:
+		c, err := w.newConverter()
+		if err != nil {
+			return err
+		}
+
+		defer c.close()
+
+		h, err := w.copyFileToStorage(c, path)
+		if os.IsNotExist(err) {
+			return w.r.Storer.SetIndex(idx)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := w.addOrUpdateFileToIndex(idx, path, h); err != nil {
+			return err
+		}
+
+		return w.r.Storer.SetIndex(idx)
+	case ResolveWithOurs:
+		e = stages[index.OurMode]
+	case ResolveWithTheirs:
+		e = stages[index.TheirMode]
+	default:
+		return fmt.Errorf("invalid conflict resolution %d", resolution)
+	}
+
+	if err := w.deleteFromFilesystem(path); err != nil {
+		return err
+	}
+
+	if e != nil {
+		if err := w.checkoutBlob(path, e.Mode, e.Hash); err != nil {
+			return err
+		}
+
+		if err := w.addOrUpdateFileToIndex(idx, path, e.Hash); err != nil {
+			return err
+		}
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutBlob writes the blob with the given hash to the worktree.
+func (w *Worktree) checkoutBlob(path string, mode filemode.FileMode, h plumbing.Hash) error {
+	blob, err := w.r.BlobObject(h)
+	if err != nil {
+		return err
+	}
+
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	return w.checkoutFile(object.NewFile(filepath.ToSlash(path), mode, blob), c)
+}
+
+// writeConflicts records the base, ours and theirs versions of the given
+// conflicts in the index, and writes the conflicting files to the worktree.
+func (w *Worktree) writeConflicts(conflicts []*mergeConflict) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		paths = append(paths, c.Path)
+	}
+
+	if err := w.expandSparseDirectoriesOf(idx, paths...); err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		for _, st := range []struct {
+			stage index.Stage
+			entry *object.TreeEntry
+		}{
+			{index.AncestorMode, c.Base},
+			{index.OurMode, c.Ours},
+			{index.TheirMode, c.Theirs},
+		} {
+			if st.entry == nil {
+				continue
+			}
+
+			idx.Entries = append(idx.Entries, &index.Entry{
+				Name:  c.Path,
+				Hash:  st.entry.Hash,
+				Mode:  st.entry.Mode,
+				Stage: st.stage,
+			})
+		}
+
+		if err := w.checkoutConflict(c); err != nil {
+			return err
+		}
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutConflict writes a conflicting path to the worktree. When the
+// contents of both sides were merged line by line, the result with conflict
+// markers is written, otherwise the existing version is written, preferring
+// ours.
+func (w *Worktree) checkoutConflict(c *mergeConflict) error {
+	if fi, err := w.Filesystem.Lstat(c.Path); err == nil && fi.IsDir() {
+		// the path is taken by a directory, the conflict is only recorded in
+		// the index
+		return nil
+	}
+
+	if c.Merged == nil {
+		e := c.Ours
+		if e == nil {
+			e = c.Theirs
+		}
+
+		if err := w.deleteFromFilesystem(c.Path); err != nil {
+			return err
+		}
+
+		return w.checkoutBlob(c.Path, e.Mode, e.Hash)
+	}
+
+	mode, err := c.Ours.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFile(w.Filesystem, c.Path, c.Merged, mode.Perm())
+}
+
+// isMergeableFile returns true if the entry contents can be merged line by
+// line.
+func isMergeableFile(e *object.TreeEntry) bool {
+	return e.Mode == filemode.Regular ||
+		e.Mode == filemode.Deprecated ||
+		e.Mode == filemode.Executable
+}
+
+func blobContent(s storer.EncodedObjectStorer, h plumbing.Hash) ([]byte, error) {
+	blob, err := object.GetBlob(s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return stdioutil.ReadAll(r)
+}
+
+// unmergedStages returns the entries of the higher stages of the given path.
+func unmergedStages(idx *index.Index, path string) map[index.Stage]*index.Entry {
+	path = filepath.ToSlash(path)
+	stages := make(map[index.Stage]*index.Entry)
+	for _, e := range idx.Entries {
+		if e.Name == path && e.Stage != index.Merged {
+			stages[e.Stage] = e
+		}
+	}
+
+	return stages
+}
+
+// removeUnmergedStages removes the entries of the higher stages of the given
+// path from the index.
+func removeUnmergedStages(idx *index.Index, path string) {
+	path = filepath.ToSlash(path)
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Name == path && e.Stage != index.Merged {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	idx.Entries = entries
+}
+
+// hasUnmergedEntries returns true if any path of the index has conflicts.
+func hasUnmergedEntries(idx *index.Index) bool {
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resetIndexAndWorktree updates the index and the worktree to match the tree
+// with the given hash, without moving HEAD.
+func (w *Worktree) resetIndexAndWorktree(h plumbing.Hash) error {
+	t, err := w.r.TreeObject(h)
+	if err != nil {
+		return err
+	}
+
+	if err := w.resetIndex(t); err != nil {
+		return err
+	}
+
+	return w.resetWorktree(t)
+}
+
+// treeMergeResult is the outcome of a three-way merge of trees.
+type treeMergeResult struct {
+	// Entries contains the cleanly merged files, keyed by their full path.
+	Entries map[string]*object.TreeEntry
+	// Conflicts contains the paths that could not be merged.
+	Conflicts []*mergeConflict
+}
+
+// mergeConflict describes a path modified in incompatible ways, each entry is
+// nil when the path does not exist in that version.
+type mergeConflict struct {
+	Path               string
+	Base, Ours, Theirs *object.TreeEntry
+	// Merged is the result of the line level merge of the contents, including
+	// conflict markers, or nil if the contents could not be merged.
+	Merged []byte
+}
+
+// treeMerger performs recursive three-way merges of trees.
+type treeMerger struct {
+	s              storage.Storer
+	allowUnrelated bool
+
+	// style and the labels are used to write the conflict markers of the
+	// files merged line by line.
+	style                             diff.ConflictStyle
+	oursLabel, baseLabel, theirsLabel string
+}
+
+// mergeCommits merges the trees of the given commits using their merge base.
+// When the commits have more than one merge base, the bases are merged
+// recursively into a virtual one, as git's recursive strategy does.
+func (m *treeMerger) mergeCommits(ours, theirs *object.Commit) (*treeMergeResult, error) {
+	base, err := m.baseTree(ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	oursTree, err := ours.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	theirsTree, err := theirs.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.mergeTrees(base, oursTree, theirsTree)
+}
+
+func (m *treeMerger) baseTree(ours, theirs *object.Commit) (*object.Tree, error) {
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 {
+		if !m.allowUnrelated {
+			return nil, ErrUnrelatedHistories
+		}
+
+		return nil, nil
+	}
+
+	m.baseLabel = bases[0].Hash.String()
+	if len(bases) > 1 {
+		m.baseLabel = "merged common ancestors"
+	}
+
+	base := bases[0]
+	for _, other := range bases[1:] {
+		base, err = m.virtualCommit(base, other)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return base.Tree()
+}
+
+// virtualCommit merges two merge bases into a commit used only as the base of
+// another merge. Conflicting contents are kept with their conflict markers,
+// other conflicting paths take the version from the first commit.
+func (m *treeMerger) virtualCommit(a, b *object.Commit) (*object.Commit, error) {
+	outer := *m
+	defer func() { *m = outer }()
+
+	m.allowUnrelated = true
+	m.oursLabel = "Temporary merge branch 1"
+	m.theirsLabel = "Temporary merge branch 2"
+
+	res, err := m.mergeCommits(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range res.Conflicts {
+		if c.Merged != nil {
+			h, err := m.writeBlob(c.Merged)
+			if err != nil {
+				return nil, err
+			}
+
+			res.Entries[c.Path] = &object.TreeEntry{
+				Name: path.Base(c.Path), Mode: c.Ours.Mode, Hash: h,
+			}
+
+			continue
+		}
+
+		if c.Ours != nil {
+			res.Entries[c.Path] = c.Ours
+		}
+	}
+
+	tree, err := m.writeTree(res)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := &object.Commit{
+		Author:       a.Committer,
+		Committer:    a.Committer,
+		Message:      "merged common ancestors",
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{a.Hash, b.Hash},
+	}
+
+	obj := m.s.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return nil, err
+	}
+
+	h, err := m.s.SetEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.GetCommit(m.s, h)
+}
+
+// mergeTrees performs a three-way merge of the given trees, any of them may
+// be nil, meaning an empty tree.
+func (m *treeMerger) mergeTrees(base, ours, theirs *object.Tree) (*treeMergeResult, error) {
+	res := &treeMergeResult{Entries: make(map[string]*object.TreeEntry)}
+	if err := m.mergeDir(res, "", base, ours, theirs); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res.Conflicts, func(i, j int) bool {
+		return res.Conflicts[i].Path < res.Conflicts[j].Path
+	})
+
+	return res, nil
+}
+
+func (m *treeMerger) mergeDir(res *treeMergeResult, dir string, base, ours, theirs *object.Tree) error {
+	entries := []map[string]*object.TreeEntry{
+		indexEntries(base), indexEntries(ours), indexEntries(theirs),
+	}
+
+	for _, name := range entryNames(entries...) {
+		b, o, t := entries[0][name], entries[1][name], entries[2][name]
+		if err := m.mergeEntry(res, path.Join(dir, name), b, o, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *treeMerger) mergeEntry(res *treeMergeResult, name string, b, o, t *object.TreeEntry) error {
+	switch {
+	case sameEntry(o, t):
+		return m.take(res, name, o)
+	case sameEntry(b, o):
+		return m.take(res, name, t)
+	case sameEntry(b, t):
+		return m.take(res, name, o)
+	}
+
+	if isDirEntry(o) || isDirEntry(t) {
+		return m.mergeDirEntry(res, name, b, o, t)
+	}
+
+	if isDirEntry(b) {
+		b = nil
+	}
+
+	if o == nil || t == nil {
+		res.Conflicts = append(res.Conflicts, &mergeConflict{
+			Path: name, Base: b, Ours: o, Theirs: t,
+		})
+		return nil
+	}
+
+	return m.mergeFile(res, name, b, o, t)
+}
+
+// mergeDirEntry handles a path that is a directory in at least one side. If
+// the other side has a file at the same path, the file is reported as a
+// conflict and the directory contents are merged against nothing.
+func (m *treeMerger) mergeDirEntry(res *treeMergeResult, name string, b, o, t *object.TreeEntry) error {
+	trees := make([]*object.Tree, 3)
+	var files []*object.TreeEntry
+	for i, e := range []*object.TreeEntry{b, o, t} {
+		if !isDirEntry(e) {
+			files = append(files, e)
+			continue
+		}
+
+		files = append(files, nil)
+
+		var err error
+		trees[i], err = object.GetTree(m.s, e.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	if files[1] != nil || files[2] != nil {
+		res.Conflicts = append(res.Conflicts, &mergeConflict{
+			Path: name, Base: files[0], Ours: files[1], Theirs: files[2],
+		})
+	}
+
+	return m.mergeDir(res, name, trees[0], trees[1], trees[2])
+}
+
+// mergeFile merges a file modified by both sides, the mode and the contents
+// are merged independently.
+func (m *treeMerger) mergeFile(res *treeMergeResult, name string, b, o, t *object.TreeEntry) error {
+	conflict := &mergeConflict{Path: name, Base: b, Ours: o, Theirs: t}
+
+	var baseMode filemode.FileMode
+	var baseHash plumbing.Hash
+	if b != nil {
+		baseMode, baseHash = b.Mode, b.Hash
+	}
+
+	mode, ok := mergeMode(baseMode, o.Mode, t.Mode)
+	if !ok || mode == filemode.Submodule {
+		res.Conflicts = append(res.Conflicts, conflict)
+		return nil
+	}
+
+	hash, ok := mergeHash(baseHash, o.Hash, t.Hash)
+	if !ok && isMergeableFile(o) && isMergeableFile(t) {
+		var merged []byte
+		var err error
+		hash, merged, err = m.mergeContents(b, o, t)
+		if err != nil {
+			return err
+		}
+
+		conflict.Merged = merged
+		ok = merged == nil
+	}
+
+	if !ok {
+		res.Conflicts = append(res.Conflicts, conflict)
+		return nil
+	}
+
+	res.Entries[name] = &object.TreeEntry{Name: path.Base(name), Mode: mode, Hash: hash}
+	return nil
+}
+
+// mergeContents merges line by line the contents of the given files. If the
+// merge is clean the hash of the stored result is returned, otherwise the
+// result including the conflict markers.
+func (m *treeMerger) mergeContents(b, o, t *object.TreeEntry) (plumbing.Hash, []byte, error) {
+	var base []byte
+	if b != nil && isMergeableFile(b) {
+		var err error
+		base, err = blobContent(m.s, b.Hash)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+	}
+
+	ours, err := blobContent(m.s, o.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	theirs, err := blobContent(m.s, t.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	res := diff.Merge(string(base), string(ours), string(theirs), &diff.MergeOptions{
+		Style:       m.style,
+		OursLabel:   m.oursLabel,
+		BaseLabel:   m.baseLabel,
+		TheirsLabel: m.theirsLabel,
+	})
+
+	if len(res.Conflicts) != 0 {
+		if res.Binary {
+			// binary files are not written with conflict markers
+			return plumbing.ZeroHash, nil, nil
+		}
+
+		return plumbing.ZeroHash, []byte(res.Text), nil
+	}
+
+	h, err := m.writeBlob([]byte(res.Text))
+	return h, nil, err
+}
+
+func (m *treeMerger) writeBlob(content []byte) (plumbing.Hash, error) {
+	return writeBlob(m.s, content)
+}
+
+// writeBlob stores the given content as a blob.
+func writeBlob(s storer.EncodedObjectStorer, content []byte) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(obj)
+}
+
+// take adds the given entry to the result, expanding it if it is a directory.
+func (m *treeMerger) take(res *treeMergeResult, name string, e *object.TreeEntry) error {
+	if e == nil {
+		return nil
+	}
+
+	if !isDirEntry(e) {
+		res.Entries[name] = e
+		return nil
+	}
+
+	t, err := object.GetTree(m.s, e.Hash)
+	if err != nil {
+		return err
+	}
+
+	walker := object.NewTreeWalker(t, true, nil)
+	defer walker.Close()
+
+	for {
+		n, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+
+		e := entry
+		res.Entries[path.Join(name, n)] = &e
+	}
+}
+
+// writeTree stores the tree objects for the cleanly merged entries of res,
+// returning the hash of the root tree.
+func (m *treeMerger) writeTree(res *treeMergeResult) (plumbing.Hash, error) {
+	idx := &index.Index{Version: 2}
+	for name, e := range res.Entries {
+		idx.Entries = append(idx.Entries, &index.Entry{
+			Name: name,
+			Hash: e.Hash,
+			Mode: e.Mode,
+		})
+	}
+
+	h := &buildTreeHelper{s: m.s}
+	return h.BuildTree(idx)
+}
+
+// indexEntries returns the entries of the given tree indexed by name, nil
+// if the tree is nil.
+func indexEntries(t *object.Tree) map[string]*object.TreeEntry {
+	if t == nil {
+		return nil
+	}
+
+	entries := make(map[string]*object.TreeEntry, len(t.Entries))
+	for i := range t.Entries {
+		entries[t.Entries[i].Name] = &t.Entries[i]
+	}
+
+	return entries
+}
+
+// entryNames returns the sorted union of the names of the given entries.
+func entryNames(entries ...map[string]*object.TreeEntry) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range entries {
+		for name := range m {
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func sameEntry(a, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func isDirEntry(e *object.TreeEntry) bool {
+	return e != nil && e.Mode == filemode.Dir
+}
+
+func mergeMode(base, ours, theirs filemode.FileMode) (filemode.FileMode, bool) {
+	switch {
+	case ours == theirs:
+		return ours, true
+	case base == ours:
+		return theirs, true
+	case base == theirs:
+		return ours, true
+	}
+
+	return filemode.Empty, false
+}
+
+func mergeHash(base, ours, theirs plumbing.Hash) (plumbing.Hash, bool) {
+	switch {
+	case ours == theirs:
+		return ours, true
+	case base == ours:
+		return theirs, true
+	case base == theirs:
+		return ours, true
+	}
+
+	return plumbing.ZeroHash, false
+}
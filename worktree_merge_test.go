@@ -0,0 +1,514 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newMergeTestRepository returns a repository with a commit on master adding
+// the files "foo" and "bar", and a branch "feature" pointing to it.
+func newMergeTestRepository(c *C) (*Repository, *Worktree) {
+	r, w := newTestRepository(c, map[string]string{
+		"foo": "foo\n",
+		"bar": "bar\n",
+	})
+
+	err := w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+
+	return r, w
+}
+
+// newTestRepository returns an in-memory repository with a commit adding the
+// given files, if any.
+func newTestRepository(c *C, files map[string]string) (*Repository, *Worktree) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	if len(files) > 0 {
+		commitFiles(c, w, files)
+	}
+
+	return r, w
+}
+
+// commitFiles writes the given files in the worktree and commits them.
+func commitFiles(c *C, w *Worktree, files map[string]string) plumbing.Hash {
+	for name, content := range files {
+		err := util.WriteFile(w.Filesystem, name, []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	h, err := w.Commit("changes\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	return h
+}
+
+// readWorktreeFile returns the contents of the given file in the worktree.
+func readWorktreeFile(c *C, w *Worktree, name string) string {
+	f, err := w.Filesystem.Open(name)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	return string(b)
+}
+
+func (s *WorktreeSuite) TestMerge(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	h, err := w.Merge(&MergeOptions{
+		Commit: theirs,
+		Author: defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours, theirs})
+	c.Assert(commit.Message, Equals, "Merge commit '"+theirs.String()+"'\n")
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash(), Equals, h)
+
+	for name, content := range map[string]string{
+		"foo": "foo\n",
+		"bar": "bar modified\n",
+		"qux": "qux\n",
+	} {
+		f, err := commit.File(name)
+		c.Assert(err, IsNil)
+		contents, err := f.Contents()
+		c.Assert(err, IsNil)
+		c.Assert(contents, Equals, content)
+
+		c.Assert(readWorktreeFile(c, w, name), Equals, content)
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	orig, err := r.Reference(plumbing.OrigHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(orig.Hash(), Equals, ours)
+
+	msgs := reflogMessages(c, r, plumbing.HEAD)
+	c.Assert(msgs[0], Equals, "merge "+theirs.String()+": Merge made by the 'ort' strategy.")
+}
+
+func (s *WorktreeSuite) TestMergeFastForward(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+
+	h, err := w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, theirs)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, theirs)
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+
+	msgs := reflogMessages(c, r, plumbing.HEAD)
+	c.Assert(msgs[0], Equals, "merge "+theirs.String()+": Fast-forward")
+
+	_, err = w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *WorktreeSuite) TestMergeNoFastForward(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+
+	h, err := w.Merge(&MergeOptions{
+		Commit:      theirs,
+		FastForward: NoFastForward,
+		Author:      defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{head.Hash(), theirs})
+}
+
+func (s *WorktreeSuite) TestMergeFastForwardOnly(c *C) {
+	_, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	_, err := w.Merge(&MergeOptions{
+		Commit:      theirs,
+		FastForward: FastForwardOnly,
+	})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+}
+
+func (s *WorktreeSuite) TestMergeNoCommit(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	h, err := w.Merge(&MergeOptions{Commit: theirs, NoCommit: true})
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, plumbing.ZeroHash)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, ours)
+
+	mergeHead, err := r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(mergeHead.Hash(), Equals, theirs)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, Modified)
+
+	_, err = w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, ErrMergeInProgress)
+
+	h, err = w.Commit("merge\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours, theirs})
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *WorktreeSuite) TestMergeConflict(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	ours := commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+	_, err := w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, ours)
+
+	mergeHead, err := r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(mergeHead.Hash(), Equals, theirs)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+
+	stages := map[index.Stage]string{}
+	for _, e := range idx.Entries {
+		if e.Name != "bar" {
+			continue
+		}
+
+		blob, err := r.BlobObject(e.Hash)
+		c.Assert(err, IsNil)
+		r, err := blob.Reader()
+		c.Assert(err, IsNil)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		stages[e.Stage] = string(content)
+	}
+
+	c.Assert(stages, DeepEquals, map[index.Stage]string{
+		index.AncestorMode: "bar\n",
+		index.OurMode:      "ours\n",
+		index.TheirMode:    "theirs\n",
+	})
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals,
+		"<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> "+theirs.String()+"\n",
+	)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, UpdatedButUnmerged)
+	c.Assert(status.File("bar").Worktree, Equals, UpdatedButUnmerged)
+	c.Assert(status, HasLen, 1)
+
+	_, err = w.Commit("merge\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrUnmergedEntries)
+
+	_, err = w.Commit("merge\n", &CommitOptions{Author: defaultSignature(), All: true})
+	c.Assert(err, Equals, ErrUnmergedEntries)
+
+	// the conflicts are not resolved by adding all the files
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, UpdatedButUnmerged)
+
+	err = util.WriteFile(w.Filesystem, "bar", []byte("resolved\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("bar")
+	c.Assert(err, IsNil)
+
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, Modified)
+	c.Assert(status.File("bar").Worktree, Equals, Unmodified)
+
+	h, err := w.Commit("merge\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours, theirs})
+
+	f, err := commit.File("bar")
+	c.Assert(err, IsNil)
+	content, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "resolved\n")
+}
+
+func (s *WorktreeSuite) TestMergeContents(c *C) {
+	r, w := newMergeTestRepository(c)
+	commitFiles(c, w, map[string]string{"bar": "a\nb\nc\nd\ne\n"})
+
+	err := w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("topic"),
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "a\nb\nc\nd\nE\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"bar": "A\nb\nc\nd\ne\n"})
+
+	h, err := w.Merge(&MergeOptions{Commit: theirs, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	f, err := commit.File("bar")
+	c.Assert(err, IsNil)
+	content, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "A\nb\nc\nd\nE\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, content)
+}
+
+func (s *WorktreeSuite) TestMergeConflictDiff3(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	base, err := r.Head()
+	c.Assert(err, IsNil)
+	commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+	_, err = w.Merge(&MergeOptions{Commit: theirs, ConflictStyle: diff.Diff3Style})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals,
+		"<<<<<<< HEAD\nours\n||||||| "+base.Hash().String()+"\nbar\n=======\ntheirs\n>>>>>>> "+theirs.String()+"\n",
+	)
+}
+
+func (s *WorktreeSuite) TestMergeConflictResolve(c *C) {
+	for _, t := range []struct {
+		resolution ConflictResolution
+		expected   string
+	}{
+		{ResolveWithOurs, "ours\n"},
+		{ResolveWithTheirs, "theirs\n"},
+		{ResolveWithWorktree, "resolved\n"},
+	} {
+		_, w := newMergeTestRepository(c)
+
+		feature := plumbing.NewBranchReferenceName("feature")
+		c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+		theirs := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+		c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+		commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+		_, err := w.Merge(&MergeOptions{Commit: theirs})
+		c.Assert(err, Equals, ErrMergeConflicts)
+
+		err = util.WriteFile(w.Filesystem, "bar", []byte("resolved\n"), 0644)
+		c.Assert(err, IsNil)
+
+		err = w.ResolveConflict("bar", t.resolution)
+		c.Assert(err, IsNil)
+		c.Assert(readWorktreeFile(c, w, "bar"), Equals, t.expected)
+
+		status, err := w.Status()
+		c.Assert(err, IsNil)
+		if fs, ok := status["bar"]; ok {
+			c.Assert(fs.Worktree, Equals, Unmodified)
+		}
+
+		err = w.ResolveConflict("bar", t.resolution)
+		c.Assert(err, Equals, ErrNotConflicted)
+	}
+}
+
+func (s *WorktreeSuite) TestMergeConflictModifyDelete(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	_, err := w.Remove("bar")
+	c.Assert(err, IsNil)
+	_, err = w.Commit("remove bar\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	_, err = w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "theirs\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, Deleted)
+	c.Assert(status.File("bar").Worktree, Equals, UpdatedButUnmerged)
+
+	err = w.ResolveConflict("bar", ResolveWithOurs)
+	c.Assert(err, IsNil)
+
+	_, err = w.Filesystem.Lstat("bar")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	_, err = idx.Entry("bar")
+	c.Assert(err, Equals, index.ErrEntryNotFound)
+}
+
+func (s *WorktreeSuite) TestMergeConflictReset(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "theirs\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"bar": "ours\n"})
+
+	_, err := w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	err = w.Reset(&ResetOptions{Mode: HardReset})
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "ours\n")
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *WorktreeSuite) TestMergeUnstagedChanges(c *C) {
+	_, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("local\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Merge(&MergeOptions{Commit: theirs})
+	c.Assert(err, Equals, ErrUnstagedChanges)
+}
+
+func (s *WorktreeSuite) TestMergeMissingCommit(c *C) {
+	_, w := newMergeTestRepository(c)
+
+	_, err := w.Merge(&MergeOptions{})
+	c.Assert(err, Equals, ErrMissingCommit)
+}
+
+func (s *WorktreeSuite) TestMergeTreesDirectories(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: feature}), IsNil)
+	theirs := commitFiles(c, w, map[string]string{
+		"dir/a":     "a\n",
+		"dir/sub/b": "b\n",
+	})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	commitFiles(c, w, map[string]string{"dir/c": "c\n"})
+
+	h, err := w.Merge(&MergeOptions{Commit: theirs, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+
+	for _, name := range []string{"foo", "bar", "dir/a", "dir/c", "dir/sub/b"} {
+		_, err := commit.File(name)
+		c.Assert(err, IsNil, Commentf("file %s", name))
+	}
+}
@@ -0,0 +1,773 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	stdioutil "io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+var (
+	// ErrRebaseInProgress is returned when a rebase is attempted while a
+	// previous one has not been concluded.
+	ErrRebaseInProgress = errors.New("a rebase is already in progress")
+	// ErrNoRebaseInProgress is returned when continuing, skipping or
+	// aborting a rebase that was never started.
+	ErrNoRebaseInProgress = errors.New("no rebase in progress")
+	// ErrRebaseStopped is returned when a rebase stops after applying a
+	// commit marked with RebaseEdit. The rebase is resumed with
+	// Worktree.RebaseContinue.
+	ErrRebaseStopped = errors.New("rebase stopped to edit a commit")
+	// ErrInvalidRebaseTodo is returned when the todo list of a rebase
+	// contains an unknown action, a squash or fixup without a previous
+	// commit, or a reword without a message.
+	ErrInvalidRebaseTodo = errors.New("invalid rebase todo list")
+)
+
+// RebaseAction is the action performed by a rebase for a commit.
+type RebaseAction int8
+
+const (
+	// RebasePick applies the commit.
+	RebasePick RebaseAction = iota
+	// RebaseReword applies the commit using RebaseTodo.Message as message.
+	RebaseReword
+	// RebaseEdit applies the commit and stops, allowing to amend it.
+	RebaseEdit
+	// RebaseSquash melds the commit into the previous one, joining their
+	// messages.
+	RebaseSquash
+	// RebaseFixup melds the commit into the previous one, keeping the
+	// message of the previous one.
+	RebaseFixup
+	// RebaseDrop removes the commit.
+	RebaseDrop
+)
+
+var rebaseActionNames = []string{"pick", "reword", "edit", "squash", "fixup", "drop"}
+
+func (a RebaseAction) String() string {
+	if a < RebasePick || a > RebaseDrop {
+		return "unknown"
+	}
+
+	return rebaseActionNames[a]
+}
+
+func parseRebaseAction(s string) (RebaseAction, error) {
+	for i, name := range rebaseActionNames {
+		if s == name || s == name[:1] {
+			return RebaseAction(i), nil
+		}
+	}
+
+	return RebasePick, ErrInvalidRebaseTodo
+}
+
+// RebaseTodo is an entry of the todo list of a rebase.
+type RebaseTodo struct {
+	Action RebaseAction
+	Commit plumbing.Hash
+	// Message replaces the message of the commit, it is required by
+	// RebaseReword. For RebaseSquash and RebaseFixup it replaces the message
+	// of the combined commit.
+	Message string
+}
+
+// RebaseTodo returns the default todo list of the rebase described by opts:
+// every commit of the branch not reachable from the upstream is picked, the
+// oldest first.
+func (w *Worktree) RebaseTodo(opts *RebaseOptions) ([]RebaseTodo, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return nil, err
+	}
+
+	var head plumbing.Hash
+	if opts.Branch != "" {
+		ref, err := w.r.Reference(opts.Branch, true)
+		if err != nil {
+			return nil, err
+		}
+
+		head = ref.Hash()
+	} else {
+		ref, err := w.r.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		head = ref.Hash()
+	}
+
+	return w.rebaseTodo(head, opts)
+}
+
+func (w *Worktree) rebaseTodo(head plumbing.Hash, opts *RebaseOptions) ([]RebaseTodo, error) {
+	upstream, err := w.r.CommitObject(opts.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(upstream, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := w.r.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+
+	// the parents are visited before their children, so the todo list is
+	// sorted topologically, the oldest commit first
+	var todo []RebaseTodo
+	var visit func(c *object.Commit) error
+	visit = func(c *object.Commit) error {
+		if seen[c.Hash] {
+			return nil
+		}
+
+		seen[c.Hash] = true
+		if err := c.Parents().ForEach(visit); err != nil {
+			return err
+		}
+
+		if c.NumParents() <= 1 || opts.IncludeMerges {
+			todo = append(todo, RebaseTodo{Action: RebasePick, Commit: c.Hash})
+		}
+
+		return nil
+	}
+
+	return todo, visit(c)
+}
+
+// Rebase replays the commits of the todo list on top of RebaseOptions.Onto,
+// one by one, and moves the rebased branch to the result. By default, the
+// commits of the branch not reachable from RebaseOptions.Upstream are
+// replayed, see Worktree.RebaseTodo.
+//
+// The rebase stops when a commit can not be applied cleanly, returning
+// ErrMergeConflicts with the conflicts recorded in the index and the
+// worktree, or after applying a commit marked with RebaseEdit, returning
+// ErrRebaseStopped. Then it can be resumed with Worktree.RebaseContinue or
+// Worktree.RebaseSkip, or aborted with Worktree.RebaseAbort. The state of the
+// rebase is persisted in the `go-git-rebase` directory of the repository, so
+// it can be resumed by another process, but not by git, which keeps its own
+// state in a different layout. As with git, the committer and the conflict
+// style are not persisted, they are given again when resuming.
+//
+// Commits which changes are already present in the new base are dropped.
+func (w *Worktree) Rebase(opts *RebaseOptions) error {
+	if err := opts.Validate(w.r); err != nil {
+		return err
+	}
+
+	if err := w.checkRebaseInProgress(); err != nil {
+		return err
+	}
+
+	if err := w.checkMergeInProgress(); err != nil {
+		return err
+	}
+
+	if opts.Branch != "" {
+		if err := w.Checkout(&CheckoutOptions{Branch: opts.Branch}); err != nil {
+			return err
+		}
+	}
+
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkMergeable(resolved.Hash()); err != nil {
+		return err
+	}
+
+	if _, err := w.r.CommitObject(opts.Onto); err != nil {
+		return err
+	}
+
+	todo := opts.Todo
+	if len(todo) == 0 {
+		todo, err = w.rebaseTodo(resolved.Hash(), opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	st := &rebaseState{
+		HeadName:      rebaseDetachedHead,
+		Onto:          opts.Onto,
+		OrigHead:      resolved.Hash(),
+		Todo:          todo,
+		ConflictStyle: opts.ConflictStyle,
+		Committer:     opts.Committer,
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		st.HeadName = head.Target()
+	}
+
+	if err := w.r.Storer.SetReference(
+		plumbing.NewHashReference(plumbing.OrigHead, st.OrigHead),
+	); err != nil {
+		return err
+	}
+
+	if err := st.save(w.r.stateFilesystem()); err != nil {
+		return err
+	}
+
+	if err := w.setHEADToCommit(st.Onto, fmt.Sprintf("rebase (start): checkout %s", st.Onto)); err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: MergeReset, Commit: st.Onto}); err != nil {
+		return err
+	}
+
+	return w.rebaseRun(st)
+}
+
+// RebaseContinue resumes a stopped rebase. If it was stopped because of
+// conflicts, the contents of the index, once all the conflicts are resolved,
+// are committed with the message and the author of the commit being
+// applied. If it was stopped to edit a commit, the changes in the index, if
+// any, are amended to it.
+func (w *Worktree) RebaseContinue(opts *RebaseContinueOptions) error {
+	if opts == nil {
+		opts = &RebaseContinueOptions{}
+	}
+
+	st, err := w.loadRebaseState()
+	if err != nil {
+		return err
+	}
+
+	st.ConflictStyle, st.Committer = opts.ConflictStyle, opts.Committer
+
+	if !st.Stopped.IsZero() {
+		if err := w.rebaseCommitIndex(st); err != nil {
+			return err
+		}
+
+		if err := w.clearRebaseStop(st); err != nil {
+			return err
+		}
+	}
+
+	return w.rebaseRun(st)
+}
+
+// RebaseSkip resumes a stopped rebase discarding the changes of the commit
+// being applied, and any other change in the index and the worktree.
+func (w *Worktree) RebaseSkip(opts *RebaseContinueOptions) error {
+	if opts == nil {
+		opts = &RebaseContinueOptions{}
+	}
+
+	st, err := w.loadRebaseState()
+	if err != nil {
+		return err
+	}
+
+	st.ConflictStyle, st.Committer = opts.ConflictStyle, opts.Committer
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset, Commit: head.Hash()}); err != nil {
+		return err
+	}
+
+	if err := w.clearRebaseStop(st); err != nil {
+		return err
+	}
+
+	return w.rebaseRun(st)
+}
+
+// RebaseAbort stops the rebase in progress and restores the branch, the
+// index and the worktree to their state before the rebase was started.
+func (w *Worktree) RebaseAbort() error {
+	st, err := w.loadRebaseState()
+	if err != nil {
+		return err
+	}
+
+	// the rebased branch is only updated when the rebase is completed, so
+	// it still points to the original commit
+	head := plumbing.NewHashReference(plumbing.HEAD, st.OrigHead)
+	if st.HeadName != rebaseDetachedHead {
+		head = plumbing.NewSymbolicReference(plumbing.HEAD, st.HeadName)
+	}
+
+	if err := w.r.setReference(head, nil, "rebase (abort): returning to "+st.HeadName.String()); err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset, Commit: st.OrigHead}); err != nil {
+		return err
+	}
+
+	if err := w.r.Storer.RemoveReference(plumbing.RebaseHead); err != nil {
+		return err
+	}
+
+	return util.RemoveAll(w.r.stateFilesystem(), rebaseStateDir)
+}
+
+// rebaseRun applies the pending entries of the todo list, updating the
+// rebased branch when all of them are applied.
+func (w *Worktree) rebaseRun(st *rebaseState) error {
+	fs := w.r.stateFilesystem()
+	for len(st.Todo) != 0 {
+		t := st.Todo[0]
+		st.Todo = st.Todo[1:]
+		st.Done = append(st.Done, t)
+
+		if err := st.save(fs); err != nil {
+			return err
+		}
+
+		if err := w.rebaseApply(st, t); err != nil {
+			return err
+		}
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	if st.HeadName != rebaseDetachedHead {
+		if err := w.r.setReference(
+			plumbing.NewHashReference(st.HeadName, head.Hash()), st.Committer,
+			fmt.Sprintf("rebase (finish): %s onto %s", st.HeadName, st.Onto),
+		); err != nil {
+			return err
+		}
+
+		if err := w.r.setReference(
+			plumbing.NewSymbolicReference(plumbing.HEAD, st.HeadName), st.Committer,
+			"rebase (finish): returning to "+st.HeadName.String(),
+		); err != nil {
+			return err
+		}
+	}
+
+	return util.RemoveAll(fs, rebaseStateDir)
+}
+
+// rebaseApply applies a single entry of the todo list on top of HEAD.
+func (w *Worktree) rebaseApply(st *rebaseState, t RebaseTodo) error {
+	if t.Action == RebaseDrop {
+		return nil
+	}
+
+	c, err := w.r.CommitObject(t.Commit)
+	if err != nil {
+		return err
+	}
+
+	ref, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	canFastForward := (t.Action == RebasePick || t.Action == RebaseEdit) &&
+		t.Message == "" && c.NumParents() == 1 && c.ParentHashes[0] == ref.Hash()
+
+	if canFastForward {
+		err = w.updateHEAD(c.Hash, st.Committer, "rebase: fast-forward")
+		if err == nil {
+			err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: c.Hash})
+		}
+	} else {
+		err = w.rebasePick(st, t, c)
+	}
+
+	if err == ErrMergeConflicts {
+		st.Stopped = c.Hash
+		if err := st.save(w.r.stateFilesystem()); err != nil {
+			return err
+		}
+
+		return ErrMergeConflicts
+	}
+
+	if err != nil || t.Action != RebaseEdit {
+		return err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	st.Stopped = c.Hash
+	st.Amend = head.Hash()
+	if err := st.save(w.r.stateFilesystem()); err != nil {
+		return err
+	}
+
+	return ErrRebaseStopped
+}
+
+// rebasePick applies the changes of c on top of HEAD and commits them. If
+// the changes are already present in HEAD nothing is committed.
+func (w *Worktree) rebasePick(st *rebaseState, t RebaseTodo, c *object.Commit) error {
+	mainline := 0
+	if c.NumParents() > 1 {
+		mainline = 1
+	}
+
+	parent, err := mainlineParent(c, mainline)
+	if err != nil {
+		return err
+	}
+
+	label := commitLabel(c)
+	p := &commitPick{
+		head:        plumbing.RebaseHead,
+		commit:      c,
+		parent:      parent,
+		style:       st.ConflictStyle,
+		baseLabel:   "parent of " + label,
+		theirsLabel: label,
+	}
+
+	_, err = w.applyPick(p)
+	if err == ErrEmptyChanges {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return w.rebaseCommit(st, t, c, p.tree)
+}
+
+// rebaseCommitIndex commits the contents of the index when a stopped rebase
+// is resumed.
+func (w *Worktree) rebaseCommitIndex(st *rebaseState) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if hasUnmergedEntries(idx) {
+		return ErrUnmergedEntries
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	tree, err := h.BuildTree(idx)
+	if err != nil {
+		return err
+	}
+
+	ref, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	head, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	if tree == head.TreeHash {
+		return nil
+	}
+
+	t := st.Done[len(st.Done)-1]
+	if !st.Amend.IsZero() {
+		if head.Hash != st.Amend {
+			// new commits were created while stopped, the changes are left
+			// uncommitted
+			return nil
+		}
+
+		t = RebaseTodo{Action: RebaseFixup, Commit: head.Hash}
+	}
+
+	c, err := w.r.CommitObject(t.Commit)
+	if err != nil {
+		return err
+	}
+
+	return w.rebaseCommit(st, t, c, tree)
+}
+
+// rebaseCommit commits the given tree with the message and the author of c,
+// on top of HEAD. Squash and fixup actions amend HEAD instead.
+func (w *Worktree) rebaseCommit(st *rebaseState, t RebaseTodo, c *object.Commit, tree plumbing.Hash) error {
+	ref, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	head, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	author, parents, msg := &c.Author, []plumbing.Hash{head.Hash}, c.Message
+	switch t.Action {
+	case RebaseSquash, RebaseFixup:
+		author, parents, msg = &head.Author, head.ParentHashes, head.Message
+		if t.Action == RebaseSquash {
+			msg = fmt.Sprintf("%s\n\n%s", strings.TrimRight(head.Message, "\n"), c.Message)
+		}
+	}
+
+	opts, err := w.commitOptionsFor(author, st.Committer)
+	if err != nil {
+		return err
+	}
+
+	opts.Parents = parents
+
+	if t.Message != "" {
+		msg = t.Message
+	}
+
+	commit, err := w.buildCommitObject(msg, opts, tree)
+	if err != nil {
+		return err
+	}
+
+	op := fmt.Sprintf("rebase (%s)", t.Action)
+	if err := w.updateHEAD(commit, opts.Committer, commitReflogMessage(op, msg)); err != nil {
+		return err
+	}
+
+	return w.Reset(&ResetOptions{Mode: MergeReset, Commit: commit})
+}
+
+func (w *Worktree) clearRebaseStop(st *rebaseState) error {
+	st.Stopped = plumbing.ZeroHash
+	st.Amend = plumbing.ZeroHash
+	if err := w.r.Storer.RemoveReference(plumbing.RebaseHead); err != nil {
+		return err
+	}
+
+	return st.save(w.r.stateFilesystem())
+}
+
+// checkRebaseInProgress returns ErrRebaseInProgress if a rebase was started
+// and has not been concluded.
+func (w *Worktree) checkRebaseInProgress() error {
+	_, err := w.r.stateFilesystem().Stat(rebaseStateDir)
+	if err == nil {
+		return ErrRebaseInProgress
+	}
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (w *Worktree) loadRebaseState() (*rebaseState, error) {
+	err := w.checkRebaseInProgress()
+	if err == nil {
+		return nil, ErrNoRebaseInProgress
+	}
+
+	if err != ErrRebaseInProgress {
+		return nil, err
+	}
+
+	st := &rebaseState{}
+	return st, st.load(w.r.stateFilesystem())
+}
+
+const (
+	rebaseStateDir     = "go-git-rebase"
+	rebaseDetachedHead = "detached HEAD"
+)
+
+// rebaseState is the state of a rebase in progress, persisted in the
+// go-git-rebase directory. The names and the formats of its files follow the
+// ones of the rebase-merge directory of git, but it's not complete enough to
+// be used by git, so a different directory is used.
+type rebaseState struct {
+	// HeadName is the rebased branch, or "detached HEAD".
+	HeadName plumbing.ReferenceName
+	Onto     plumbing.Hash
+	OrigHead plumbing.Hash
+	// Todo are the pending entries, and Done the applied ones, the last
+	// being the one in progress.
+	Todo, Done []RebaseTodo
+	// Stopped is the commit being applied when the rebase stopped.
+	Stopped plumbing.Hash
+	// Amend is the commit created before stopping to edit it.
+	Amend plumbing.Hash
+
+	// ConflictStyle and Committer are given when the rebase is started or
+	// resumed, they are not persisted as git doesn't.
+	ConflictStyle diff.ConflictStyle
+	Committer     *object.Signature
+}
+
+func (s *rebaseState) save(fs billy.Filesystem) error {
+	files := map[string]string{
+		"head-name":       s.HeadName.String(),
+		"onto":            s.Onto.String(),
+		"orig-head":       s.OrigHead.String(),
+		"git-rebase-todo": encodeRebaseTodo(s.Todo),
+		"done":            encodeRebaseTodo(s.Done),
+	}
+
+	if !s.Stopped.IsZero() {
+		files["stopped-sha"] = s.Stopped.String()
+	}
+
+	if !s.Amend.IsZero() {
+		files["amend"] = s.Amend.String()
+	}
+
+	for _, t := range append(s.Done, s.Todo...) {
+		if t.Message != "" {
+			files["message-"+t.Commit.String()] = t.Message
+		}
+	}
+
+	for _, name := range []string{"stopped-sha", "amend"} {
+		if _, ok := files[name]; ok {
+			continue
+		}
+
+		err := fs.Remove(fs.Join(rebaseStateDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for name, content := range files {
+		if name != "done" && name != "git-rebase-todo" && !strings.HasPrefix(name, "message-") {
+			content += "\n"
+		}
+
+		err := util.WriteFile(fs, fs.Join(rebaseStateDir, name), []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *rebaseState) load(fs billy.Filesystem) error {
+	files := make(map[string]string)
+	for _, name := range []string{
+		"head-name", "onto", "orig-head", "git-rebase-todo", "done",
+		"stopped-sha", "amend",
+	} {
+		content, err := readRebaseFile(fs, name)
+		if err != nil {
+			return err
+		}
+
+		files[name] = content
+	}
+
+	s.HeadName = plumbing.ReferenceName(strings.TrimSpace(files["head-name"]))
+	s.Onto = plumbing.NewHash(strings.TrimSpace(files["onto"]))
+	s.OrigHead = plumbing.NewHash(strings.TrimSpace(files["orig-head"]))
+	s.Stopped = plumbing.NewHash(strings.TrimSpace(files["stopped-sha"]))
+	s.Amend = plumbing.NewHash(strings.TrimSpace(files["amend"]))
+
+	var err error
+	if s.Todo, err = decodeRebaseTodo(fs, files["git-rebase-todo"]); err != nil {
+		return err
+	}
+
+	s.Done, err = decodeRebaseTodo(fs, files["done"])
+	return err
+}
+
+// readRebaseFile returns the content of a file of the rebase state, or an
+// empty string if it doesn't exist.
+func readRebaseFile(fs billy.Filesystem, name string) (string, error) {
+	f, err := fs.Open(fs.Join(rebaseStateDir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	content, err := stdioutil.ReadAll(f)
+	return string(content), err
+}
+
+func encodeRebaseTodo(todo []RebaseTodo) string {
+	var buf bytes.Buffer
+	for _, t := range todo {
+		fmt.Fprintf(&buf, "%s %s\n", t.Action, t.Commit)
+	}
+
+	return buf.String()
+}
+
+func decodeRebaseTodo(fs billy.Filesystem, content string) ([]RebaseTodo, error) {
+	var todo []RebaseTodo
+	s := bufio.NewScanner(strings.NewReader(content))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, ErrInvalidRebaseTodo
+		}
+
+		action, err := parseRebaseAction(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		t := RebaseTodo{Action: action, Commit: plumbing.NewHash(fields[1])}
+		t.Message, err = readRebaseFile(fs, "message-"+t.Commit.String())
+		if err != nil {
+			return nil, err
+		}
+
+		todo = append(todo, t)
+	}
+
+	return todo, s.Err()
+}
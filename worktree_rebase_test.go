@@ -0,0 +1,420 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// newRebaseTestRepository returns a repository where master and feature
+// diverged, master adding the file "qux" and feature modifying "foo" and
+// "bar" in two commits. The feature branch is checked out.
+func newRebaseTestRepository(c *C) (r *Repository, w *Worktree, master plumbing.Hash, feature []plumbing.Hash) {
+	r, w = newMergeTestRepository(c)
+	master = commitFiles(c, w, map[string]string{"qux": "qux\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")}), IsNil)
+	feature = append(feature,
+		commitFiles(c, w, map[string]string{"foo": "foo modified\n"}),
+		commitFiles(c, w, map[string]string{"bar": "bar modified\n"}),
+	)
+
+	return r, w, master, feature
+}
+
+// logMessages returns the messages of the first parent history of HEAD,
+// the newest first.
+func logMessages(c *C, r *Repository) []string {
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+
+	var msgs []string
+	for {
+		msgs = append(msgs, commit.Message)
+		if commit.NumParents() == 0 {
+			return msgs
+		}
+
+		commit, err = commit.Parent(0)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *WorktreeSuite) TestRebase(c *C) {
+	r, w, master, feature := newRebaseTestRepository(c)
+
+	todo, err := w.RebaseTodo(&RebaseOptions{Upstream: master})
+	c.Assert(err, IsNil)
+	c.Assert(todo, DeepEquals, []RebaseTodo{
+		{Action: RebasePick, Commit: feature[0]},
+		{Action: RebasePick, Commit: feature[1]},
+	})
+
+	committer := defaultSignature()
+	committer.Name = "bar"
+	err = w.Rebase(&RebaseOptions{Upstream: master, Committer: committer})
+	c.Assert(err, IsNil)
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, plumbing.NewBranchReferenceName("feature"))
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.Author.Name, Equals, "foo")
+	c.Assert(commit.Committer.Name, Equals, "bar")
+
+	parent, err := commit.Parent(0)
+	c.Assert(err, IsNil)
+	c.Assert(parent.ParentHashes, DeepEquals, []plumbing.Hash{master})
+
+	origHead, err := r.Reference(plumbing.OrigHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(origHead.Hash(), Equals, feature[1])
+
+	for name, content := range map[string]string{
+		"foo": "foo modified\n",
+		"bar": "bar modified\n",
+		"qux": "qux\n",
+	} {
+		c.Assert(readWorktreeFile(c, w, name), Equals, content)
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	_, err = r.stateFilesystem().Stat(rebaseStateDir)
+	c.Assert(err, NotNil)
+
+	err = w.RebaseContinue(nil)
+	c.Assert(err, Equals, ErrNoRebaseInProgress)
+}
+
+func (s *WorktreeSuite) TestRebaseBranch(c *C) {
+	r, w, master, _ := newRebaseTestRepository(c)
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+
+	err := w.Rebase(&RebaseOptions{
+		Upstream:  master,
+		Branch:    plumbing.NewBranchReferenceName("feature"),
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, plumbing.NewBranchReferenceName("feature"))
+	c.Assert(logMessages(c, r), HasLen, 4)
+}
+
+func (s *WorktreeSuite) TestRebaseFastForward(c *C) {
+	r, w, _, feature := newRebaseTestRepository(c)
+
+	err := w.Rebase(&RebaseOptions{Upstream: feature[0]})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, feature[1])
+}
+
+func (s *WorktreeSuite) TestRebaseTodoActions(c *C) {
+	r, w, master, feature := newRebaseTestRepository(c)
+	third := commitFiles(c, w, map[string]string{"baz": "baz\n"})
+	fourth := commitFiles(c, w, map[string]string{"baz": "baz modified\n"})
+
+	err := w.Rebase(&RebaseOptions{
+		Upstream:  master,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: RebaseReword, Commit: feature[0], Message: "reworded\n"},
+			{Action: RebaseDrop, Commit: feature[1]},
+			{Action: RebasePick, Commit: third},
+			{Action: RebaseSquash, Commit: fourth},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(logMessages(c, r), DeepEquals, []string{
+		"changes\n\nchanges\n", "reworded\n", "changes\n", "changes\n",
+	})
+
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar\n")
+	c.Assert(readWorktreeFile(c, w, "baz"), Equals, "baz modified\n")
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo modified\n")
+}
+
+func (s *WorktreeSuite) TestRebaseFixup(c *C) {
+	r, w, master, feature := newRebaseTestRepository(c)
+
+	err := w.Rebase(&RebaseOptions{
+		Upstream:  master,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: RebasePick, Commit: feature[0]},
+			{Action: RebaseFixup, Commit: feature[1]},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{master})
+
+	c.Assert(commit.Message, Equals, "changes\n")
+
+	for name, content := range map[string]string{
+		"foo": "foo modified\n",
+		"bar": "bar modified\n",
+	} {
+		f, err := commit.File(name)
+		c.Assert(err, IsNil)
+		got, err := f.Contents()
+		c.Assert(err, IsNil)
+		c.Assert(got, Equals, content)
+	}
+}
+
+func (s *WorktreeSuite) TestRebaseInvalidTodo(c *C) {
+	_, w, master, feature := newRebaseTestRepository(c)
+
+	for _, todo := range [][]RebaseTodo{
+		{{Action: RebaseSquash, Commit: feature[0]}},
+		{{Action: RebaseReword, Commit: feature[0]}},
+		{{Action: RebaseAction(42), Commit: feature[0]}},
+	} {
+		err := w.Rebase(&RebaseOptions{Upstream: master, Todo: todo})
+		c.Assert(err, Equals, ErrInvalidRebaseTodo)
+	}
+
+	err := w.Rebase(&RebaseOptions{})
+	c.Assert(err, Equals, ErrMissingUpstream)
+}
+
+func (s *WorktreeSuite) TestRebaseConflictContinue(c *C) {
+	r, w, _, feature := newRebaseTestRepository(c)
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	master := commitFiles(c, w, map[string]string{"foo": "foo on master\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")}), IsNil)
+
+	err := w.Rebase(&RebaseOptions{Upstream: master, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	err = w.Rebase(&RebaseOptions{Upstream: master})
+	c.Assert(err, Equals, ErrRebaseInProgress)
+
+	ref, err := r.Reference(plumbing.RebaseHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, feature[0])
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, UpdatedButUnmerged)
+
+	err = w.RebaseContinue(&RebaseContinueOptions{Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrUnmergedEntries)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("resolved\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	err = w.RebaseContinue(&RebaseContinueOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	_, err = r.Reference(plumbing.RebaseHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	c.Assert(logMessages(c, r), HasLen, 5)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "resolved\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+}
+
+func (s *WorktreeSuite) TestRebaseConflictSkip(c *C) {
+	r, w, _, _ := newRebaseTestRepository(c)
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	master := commitFiles(c, w, map[string]string{"foo": "foo on master\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")}), IsNil)
+
+	err := w.Rebase(&RebaseOptions{Upstream: master, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	err = w.RebaseSkip(&RebaseContinueOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	c.Assert(logMessages(c, r), HasLen, 4)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo on master\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+}
+
+func (s *WorktreeSuite) TestRebaseAbort(c *C) {
+	r, w, _, feature := newRebaseTestRepository(c)
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	master := commitFiles(c, w, map[string]string{"foo": "foo on master\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")}), IsNil)
+
+	err := w.Rebase(&RebaseOptions{Upstream: master, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	err = w.RebaseAbort()
+	c.Assert(err, IsNil)
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, plumbing.NewBranchReferenceName("feature"))
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, feature[1])
+
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo modified\n")
+	_, err = w.Filesystem.Stat("qux")
+	c.Assert(err, NotNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	err = w.RebaseAbort()
+	c.Assert(err, Equals, ErrNoRebaseInProgress)
+}
+
+func (s *WorktreeSuite) TestRebaseEdit(c *C) {
+	r, w, master, feature := newRebaseTestRepository(c)
+
+	err := w.Rebase(&RebaseOptions{
+		Upstream:  master,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: RebaseEdit, Commit: feature[0]},
+			{Action: RebasePick, Commit: feature[1]},
+		},
+	})
+	c.Assert(err, Equals, ErrRebaseStopped)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo modified\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar\n")
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo amended\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	err = w.RebaseContinue(&RebaseContinueOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+
+	parent, err := commit.Parent(0)
+	c.Assert(err, IsNil)
+	c.Assert(parent.ParentHashes, DeepEquals, []plumbing.Hash{master})
+
+	f, err := parent.File("foo")
+	c.Assert(err, IsNil)
+	content, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo amended\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+}
+
+func (s *WorktreeSuite) TestRebaseResumeFromState(c *C) {
+	dot := memfs.New()
+	wt := memfs.New()
+	storage := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	r, err := Init(storage, wt)
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, map[string]string{"foo": "foo\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	}), IsNil)
+	picked := commitFiles(c, w, map[string]string{"foo": "feature\n"})
+
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.Master}), IsNil)
+	master := commitFiles(c, w, map[string]string{"foo": "master\n"})
+	c.Assert(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")}), IsNil)
+
+	err = w.Rebase(&RebaseOptions{
+		Upstream: master,
+		Todo: []RebaseTodo{
+			{Action: RebaseReword, Commit: picked, Message: "reworded\n"},
+		},
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, Equals, ErrMergeConflicts)
+
+	for name, content := range map[string]string{
+		"head-name":                  "refs/heads/feature\n",
+		"onto":                       master.String() + "\n",
+		"stopped-sha":                picked.String() + "\n",
+		"done":                       "reword " + picked.String() + "\n",
+		"git-rebase-todo":            "",
+		"message-" + picked.String(): "reworded\n",
+	} {
+		f, err := dot.Open(dot.Join(rebaseStateDir, name))
+		c.Assert(err, IsNil)
+		got, err := ioutil.ReadAll(f)
+		c.Assert(err, IsNil)
+		c.Assert(f.Close(), IsNil)
+		c.Assert(string(got), Equals, content, Commentf("file %s", name))
+	}
+
+	// the committer and the conflict style are not persisted
+	for _, name := range []string{"committer", "conflict-style"} {
+		_, err := dot.Stat(dot.Join(rebaseStateDir, name))
+		c.Assert(os.IsNotExist(err), Equals, true, Commentf("file %s", name))
+	}
+
+	// git doesn't see the rebase as its own
+	_, err = dot.Stat("rebase-merge")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// a new repository instance, as if the process was restarted
+	r, err = Open(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), wt)
+	c.Assert(err, IsNil)
+	w, err = r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("resolved\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	err = w.RebaseContinue(&RebaseContinueOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "reworded\n")
+	c.Assert(commit.Committer.Name, Equals, defaultSignature().Name)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{master})
+
+	_, err = dot.Stat(rebaseStateDir)
+	c.Assert(err, NotNil)
+}
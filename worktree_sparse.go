@@ -0,0 +1,471 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// ErrSparseCheckoutDisabled is returned when the patterns of a sparse checkout
+// are added while the sparse checkout is not enabled.
+var ErrSparseCheckoutDisabled = errors.New("sparse checkout is not enabled")
+
+// SetSparseCheckout enables the sparse checkout with the given patterns, as
+// git sparse-checkout set does. The files not matching the patterns are
+// removed from the worktree, and kept in the index with the skip-worktree
+// bit; the modified files are left in the worktree. The checkouts and the
+// resets of the worktree honor the patterns until the sparse checkout is
+// disabled.
+func (w *Worktree) SetSparseCheckout(opts *SparseCheckoutOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.SparseCheckout = true
+	cfg.Core.SparseCheckoutCone = opts.Cone
+	cfg.Index.Sparse = opts.SparseIndex
+	if err := w.r.Storer.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	patterns := opts.Patterns
+	if opts.Cone {
+		patterns = conePatterns(patterns)
+	}
+
+	if err := w.writeSparseCheckoutFile(patterns); err != nil {
+		return err
+	}
+
+	return w.updateSparseCheckout()
+}
+
+// AddSparseCheckout adds patterns, or directories in cone mode, to the sparse
+// checkout, as git sparse-checkout add does.
+func (w *Worktree) AddSparseCheckout(patterns []string) error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		return ErrSparseCheckoutDisabled
+	}
+
+	current, err := w.SparseCheckoutPatterns()
+	if err != nil {
+		return err
+	}
+
+	return w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns:    append(current, patterns...),
+		Cone:        cfg.Core.SparseCheckoutCone,
+		SparseIndex: cfg.Index.Sparse,
+	})
+}
+
+// SparseCheckoutPatterns returns the patterns of the sparse checkout, or the
+// directories checked out recursively in cone mode, as git sparse-checkout
+// list does.
+func (w *Worktree) SparseCheckoutPatterns() ([]string, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := w.readSparseCheckoutFile()
+	if err != nil || !cfg.Core.SparseCheckoutCone {
+		return patterns, err
+	}
+
+	return coneDirectories(patterns), nil
+}
+
+// DisableSparseCheckout disables the sparse checkout, checking out all the
+// files, as git sparse-checkout disable does.
+func (w *Worktree) DisableSparseCheckout() error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.SparseCheckout = false
+	cfg.Core.SparseCheckoutCone = false
+	cfg.Index.Sparse = false
+	if err := w.r.Storer.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	return w.updateSparseCheckout()
+}
+
+// updateSparseCheckout updates the worktree and the skip-worktree bits of the
+// index to the patterns of the sparse checkout.
+func (w *Worktree) updateSparseCheckout() error {
+	m, err := w.sparseCheckoutMatcher()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	// the sparse directories still outside of the sparse checkout are kept
+	err = w.expandSparseDirectories(idx, func(e *index.Entry) bool {
+		return !sparseIndexEnabled(cfg) || outOfConeDirectory(m, e.Name) == ""
+	})
+	if err != nil {
+		return err
+	}
+
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged || e.Mode == filemode.Submodule || e.IsSparseDirectory() {
+			continue
+		}
+
+		in := inSparseCheckout(m, e.Name)
+		switch {
+		case in && e.SkipWorktree:
+			if err := w.checkoutIndexEntry(e, c); err != nil {
+				return err
+			}
+
+			e.SkipWorktree = false
+		case !in && !e.SkipWorktree:
+			// as git, the files with changes are left in the worktree
+			fs, ok := status[e.Name]
+			if ok && fs.Worktree != Unmodified && fs.Worktree != Deleted {
+				continue
+			}
+
+			if err := w.removeSparseFile(e.Name); err != nil {
+				return err
+			}
+
+			e.SkipWorktree = true
+		}
+	}
+
+	t, err := w.headTree()
+	if err != nil {
+		return err
+	}
+
+	if err := w.updateSparseIndex(idx, t); err != nil {
+		return err
+	}
+
+	setIndexVersion(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// applySparseCheckout sets the skip-worktree bit of the entries of the index
+// not matching the patterns of the sparse checkout, if enabled.
+func (w *Worktree) applySparseCheckout(idx *index.Index) error {
+	m, err := w.sparseCheckoutMatcher()
+	if err != nil || m == nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged || e.Mode == filemode.Submodule || e.IsSparseDirectory() {
+			continue
+		}
+
+		e.SkipWorktree = !inSparseCheckout(m, e.Name)
+	}
+
+	setIndexVersion(idx)
+	return nil
+}
+
+// removeSkipWorktreeFiles removes from the worktree the files of the entries
+// of the index with the skip-worktree bit.
+func (w *Worktree) removeSkipWorktreeFiles(idx *index.Index) error {
+	for _, e := range idx.Entries {
+		if !e.SkipWorktree || e.IsSparseDirectory() {
+			continue
+		}
+
+		if _, err := w.Filesystem.Lstat(e.Name); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if err := w.removeSparseFile(e.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeSparseFile removes the file from the worktree, and its directories
+// once empty.
+func (w *Worktree) removeSparseFile(name string) error {
+	if err := util.RemoveAll(w.Filesystem, name); err != nil {
+		return err
+	}
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		files, err := w.Filesystem.ReadDir(dir)
+		if err != nil || len(files) != 0 {
+			return err
+		}
+
+		if err := w.Filesystem.Remove(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkoutIndexEntry writes the file of the entry to the worktree, unless
+// there is already a file.
+func (w *Worktree) checkoutIndexEntry(e *index.Entry, c *converter) error {
+	if _, err := w.Filesystem.Lstat(e.Name); err == nil {
+		return nil
+	}
+
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutFile(object.NewFile(e.Name, e.Mode, blob), c); err != nil {
+		return err
+	}
+
+	fi, err := w.Filesystem.Lstat(e.Name)
+	if err != nil {
+		return err
+	}
+
+	e.ModifiedAt = fi.ModTime()
+	e.Size = uint32(fi.Size())
+	if fillSystemInfo != nil {
+		fillSystemInfo(e, fi.Sys())
+	}
+
+	return nil
+}
+
+// excludeSkipWorktreeChanges removes the changes of the paths with the
+// skip-worktree bit in the index, which are not compared with the worktree.
+func excludeSkipWorktreeChanges(idx *index.Index, changes merkletrie.Changes) merkletrie.Changes {
+	skipped := make(map[string]bool)
+	for _, e := range idx.Entries {
+		if e.SkipWorktree {
+			skipped[e.Name] = true
+		}
+	}
+
+	if len(skipped) == 0 {
+		return changes
+	}
+
+	var res merkletrie.Changes
+	for _, ch := range changes {
+		if !skipped[nameFromAction(&ch)] {
+			res = append(res, ch)
+		}
+	}
+
+	return res
+}
+
+// setIndexVersion sets the lowest version of the index supporting its
+// entries, as git does.
+func setIndexVersion(idx *index.Index) {
+	if idx.Version > 3 {
+		return
+	}
+
+	idx.Version = 2
+	for _, e := range idx.Entries {
+		if e.SkipWorktree || e.IntentToAdd {
+			idx.Version = 3
+			return
+		}
+	}
+}
+
+// sparseCheckoutMatcher returns the matcher of the files checked out by the
+// sparse checkout, or nil if the sparse checkout is disabled.
+func (w *Worktree) sparseCheckoutMatcher() (gitignore.Matcher, error) {
+	cfg, err := w.r.Config()
+	if err != nil || !cfg.Core.SparseCheckout {
+		return nil, err
+	}
+
+	patterns, err := w.readSparseCheckoutFile()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make([]gitignore.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		ps = append(ps, gitignore.ParsePattern(p, nil))
+	}
+
+	return gitignore.NewMatcher(ps), nil
+}
+
+// inSparseCheckout tells whether the file at name is checked out by the
+// sparse checkout of the matcher, all the files being checked out if nil. The
+// matcher excluding the files matching the patterns, as with .gitignore, the
+// files excluded are the ones checked out.
+func inSparseCheckout(m gitignore.Matcher, name string) bool {
+	return m == nil || m.Match(strings.Split(name, "/"), false)
+}
+
+func (w *Worktree) readSparseCheckoutFile() ([]string, error) {
+	fs := w.r.stateFilesystem()
+	f, err := fs.Open(sparseCheckoutPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+
+	return patterns, s.Err()
+}
+
+func (w *Worktree) writeSparseCheckoutFile(patterns []string) error {
+	var content string
+	for _, p := range patterns {
+		content += p + "\n"
+	}
+
+	fs := w.r.stateFilesystem()
+	return util.WriteFile(fs, sparseCheckoutPath, []byte(content), 0644)
+}
+
+// conePatterns returns the patterns of a sparse checkout in cone mode of the
+// directories, as written by git: the files at the root and in the parents of
+// the directories, and the directories recursively.
+func conePatterns(dirs []string) []string {
+	recursive := make(map[string]bool)
+	for _, d := range dirs {
+		recursive[d] = true
+	}
+
+	parents := make(map[string]bool)
+	var rec []string
+	for d := range recursive {
+		if hasRecursiveParent(recursive, d) {
+			continue
+		}
+
+		rec = append(rec, d)
+		for p := path.Dir(d); p != "."; p = path.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	var par []string
+	for p := range parents {
+		if !recursive[p] && !hasRecursiveParent(recursive, p) {
+			par = append(par, p)
+		}
+	}
+
+	sort.Strings(rec)
+	sort.Strings(par)
+
+	patterns := []string{"/*", "!/*/"}
+	for _, p := range par {
+		patterns = append(patterns, "/"+p+"/", "!/"+p+"/*/")
+	}
+
+	for _, d := range rec {
+		patterns = append(patterns, "/"+d+"/")
+	}
+
+	return patterns
+}
+
+// hasRecursiveParent tells whether a parent of the directory is checked out
+// recursively.
+func hasRecursiveParent(recursive map[string]bool, dir string) bool {
+	for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+		if recursive[p] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coneDirectories returns the directories checked out recursively by the
+// patterns of a sparse checkout in cone mode, the ones not followed by the
+// pattern excluding their subdirectories.
+func coneDirectories(patterns []string) []string {
+	var dirs []string
+	for i, p := range patterns {
+		if p == "/*" || !strings.HasPrefix(p, "/") || !strings.HasSuffix(p, "/") {
+			continue
+		}
+
+		if i+1 < len(patterns) && patterns[i+1] == "!"+p+"*/" {
+			continue
+		}
+
+		dirs = append(dirs, strings.Trim(p, "/"))
+	}
+
+	return dirs
+}
+
+const sparseCheckoutPath = "info/sparse-checkout"
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// sparseIndexEnabled tells whether the index is a sparse index, which is
+// only supported by the cone mode sparse checkouts, as git does.
+func sparseIndexEnabled(cfg *config.Config) bool {
+	return cfg.Core.SparseCheckout && cfg.Core.SparseCheckoutCone && cfg.Index.Sparse
+}
+
+// updateSparseIndex collapses the directories outside of the sparse checkout
+// matching the tree t into sparse directory entries if the sparse index is
+// enabled, or expands all the sparse directory entries otherwise.
+func (w *Worktree) updateSparseIndex(idx *index.Index, t *object.Tree) error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	if !sparseIndexEnabled(cfg) {
+		if !idx.Sparse {
+			return nil
+		}
+
+		idx.Sparse = false
+		return w.expandSparseDirectories(idx, func(*index.Entry) bool { return true })
+	}
+
+	idx.Sparse = true
+	if t == nil {
+		return nil
+	}
+
+	m, err := w.sparseCheckoutMatcher()
+	if err != nil {
+		return err
+	}
+
+	return w.collapseSparseDirectories(idx, t, m)
+}
+
+// headTree returns the tree of the HEAD commit, or nil if there is none.
+func (w *Worktree) headTree() (*object.Tree, error) {
+	ref, err := w.r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w.getTreeFromCommitHash(ref.Hash())
+}
+
+// expandSparseDirectories replaces the sparse directory entries of the
+// directories matching expand by the entries of all their files, with the
+// skip-worktree bit.
+func (w *Worktree) expandSparseDirectories(idx *index.Index, expand func(*index.Entry) bool) error {
+	var entries []*index.Entry
+	for i, e := range idx.Entries {
+		if !e.IsSparseDirectory() || !expand(e) {
+			if entries != nil {
+				entries = append(entries, e)
+			}
+
+			continue
+		}
+
+		if entries == nil {
+			entries = append(entries, idx.Entries[:i]...)
+		}
+
+		files, err := w.sparseDirectoryEntries(e)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, files...)
+	}
+
+	if entries != nil {
+		idx.Entries = entries
+	}
+
+	return nil
+}
+
+// expandSparseDirectoriesOf expands the sparse directories containing one of
+// the paths, or contained by one of them.
+func (w *Worktree) expandSparseDirectoriesOf(idx *index.Index, paths ...string) error {
+	return w.expandSparseDirectories(idx, func(e *index.Entry) bool {
+		for _, p := range paths {
+			p = strings.Trim(filepath.ToSlash(p), "/")
+			if p == "" || p == "." || strings.HasPrefix(p, e.Name) || strings.HasPrefix(e.Name, p+"/") {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// expandChangedSparseDirectories expands the sparse directories not matching
+// the directories of the tree t, so the index can be compared with it.
+func (w *Worktree) expandChangedSparseDirectories(idx *index.Index, t *object.Tree) error {
+	return w.expandSparseDirectories(idx, func(e *index.Entry) bool {
+		if t == nil {
+			return true
+		}
+
+		te, err := t.FindEntry(strings.TrimSuffix(e.Name, "/"))
+		return err != nil || te.Mode != filemode.Dir || te.Hash != e.Hash
+	})
+}
+
+// sparseDirectoryEntries returns the entries of the files of the sparse
+// directory entry.
+func (w *Worktree) sparseDirectoryEntries(e *index.Entry) ([]*index.Entry, error) {
+	t, err := w.r.TreeObject(e.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	walker := object.NewTreeWalker(t, true, nil)
+	defer walker.Close()
+
+	var entries []*index.Entry
+	for {
+		name, te, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if te.Mode == filemode.Dir {
+			continue
+		}
+
+		entries = append(entries, &index.Entry{
+			Name:         e.Name + name,
+			Hash:         te.Hash,
+			Mode:         te.Mode,
+			SkipWorktree: true,
+		})
+	}
+
+	return entries, nil
+}
+
+// collapseSparseDirectories replaces the entries of each directory outside of
+// the sparse checkout of m by a sparse directory entry, if all of them have
+// the skip-worktree bit and match the directory of the tree t.
+func (w *Worktree) collapseSparseDirectories(idx *index.Index, t *object.Tree, m gitignore.Matcher) error {
+	dirs := make(map[string][]*index.Entry)
+	var order []string
+	for _, e := range idx.Entries {
+		if e.IsSparseDirectory() {
+			continue
+		}
+
+		dir := outOfConeDirectory(m, e.Name)
+		if dir == "" {
+			continue
+		}
+
+		if _, ok := dirs[dir]; !ok {
+			order = append(order, dir)
+		}
+
+		dirs[dir] = append(dirs[dir], e)
+	}
+
+	collapsed := make(map[*index.Entry]*index.Entry)
+	for _, dir := range order {
+		sparse, err := w.collapseSparseDirectory(t, dir, dirs[dir])
+		if err != nil {
+			return err
+		}
+
+		if sparse == nil {
+			continue
+		}
+
+		for _, e := range dirs[dir] {
+			collapsed[e] = nil
+		}
+
+		collapsed[dirs[dir][0]] = sparse
+	}
+
+	if len(collapsed) == 0 {
+		return nil
+	}
+
+	entries := make([]*index.Entry, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		sparse, ok := collapsed[e]
+		switch {
+		case !ok:
+			entries = append(entries, e)
+		case sparse != nil:
+			entries = append(entries, sparse)
+		}
+	}
+
+	idx.Entries = entries
+	return nil
+}
+
+// collapseSparseDirectory returns the sparse directory entry of the directory
+// standing for the given entries, or nil if they don't match the directory of
+// the tree t.
+func (w *Worktree) collapseSparseDirectory(t *object.Tree, dir string, entries []*index.Entry) (*index.Entry, error) {
+	for _, e := range entries {
+		if !e.SkipWorktree || e.Stage != index.Merged || e.Mode == filemode.Submodule {
+			return nil, nil
+		}
+	}
+
+	te, err := t.FindEntry(dir)
+	if err != nil || te.Mode != filemode.Dir {
+		return nil, nil
+	}
+
+	sparse := &index.Entry{
+		Name:         dir + "/",
+		Hash:         te.Hash,
+		Mode:         filemode.Dir,
+		SkipWorktree: true,
+	}
+
+	files, err := w.sparseDirectoryEntries(sparse)
+	if err != nil || len(files) != len(entries) {
+		return nil, err
+	}
+
+	expected := make(map[string]*index.Entry, len(files))
+	for _, f := range files {
+		expected[f.Name] = f
+	}
+
+	for _, e := range entries {
+		f, ok := expected[e.Name]
+		if !ok || f.Hash != e.Hash || f.Mode != e.Mode {
+			return nil, nil
+		}
+	}
+
+	return sparse, nil
+}
+
+// outOfConeDirectory returns the topmost directory of the file at name outside
+// of the cone mode sparse checkout of m, or an empty string if there is none.
+func outOfConeDirectory(m gitignore.Matcher, name string) string {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if !m.Match(parts[:i], true) {
+			return strings.Join(parts[:i], "/")
+		}
+	}
+
+	return ""
+}
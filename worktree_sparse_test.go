@@ -0,0 +1,299 @@
+package git
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+// sparseTestFiles are the files of the repositories of the sparse checkout
+// tests.
+var sparseTestFiles = map[string]string{
+	"r":     "r\n",
+	"A/a":   "a\n",
+	"A/B/b": "b\n",
+	"A/D/d": "d\n",
+	"E/e":   "e\n",
+}
+
+// assertSparseFiles checks the files in the worktree and the skip-worktree
+// bits of the index.
+func assertSparseFiles(c *C, w *Worktree, files ...string) {
+	checkedOut := make(map[string]bool)
+	for _, f := range files {
+		checkedOut[f] = true
+	}
+
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		_, err := idx.Entry(f)
+		c.Assert(err, IsNil, Commentf("%s", f))
+	}
+
+	for _, e := range idx.Entries {
+		c.Assert(e.IsSparseDirectory(), Equals, false, Commentf("%s", e.Name))
+		_, err := w.Filesystem.Lstat(e.Name)
+		c.Assert(err == nil, Equals, checkedOut[e.Name], Commentf("%s", e.Name))
+		c.Assert(e.SkipWorktree, Equals, !checkedOut[e.Name], Commentf("%s", e.Name))
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+}
+
+func (s *WorktreeSuite) TestSetSparseCheckoutCone(c *C) {
+	r, w := newTestRepository(c, sparseTestFiles)
+
+	err := w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns: []string{"A/B"},
+		Cone:     true,
+	})
+	c.Assert(err, IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b")
+
+	_, err = w.Filesystem.Lstat("A/D")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = w.Filesystem.Lstat("E")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.SparseCheckout, Equals, true)
+	c.Assert(cfg.Core.SparseCheckoutCone, Equals, true)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Version, Equals, uint32(3))
+
+	patterns, err := w.SparseCheckoutPatterns()
+	c.Assert(err, IsNil)
+	c.Assert(patterns, DeepEquals, []string{"A/B"})
+
+	c.Assert(w.AddSparseCheckout([]string{"E"}), IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b", "E/e")
+
+	patterns, err = w.SparseCheckoutPatterns()
+	c.Assert(err, IsNil)
+	c.Assert(patterns, DeepEquals, []string{"A/B", "E"})
+}
+
+func (s *WorktreeSuite) TestSetSparseCheckoutConeInvalid(c *C) {
+	_, w := newTestRepository(c, sparseTestFiles)
+
+	err := w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns: []string{"A/*"},
+		Cone:     true,
+	})
+	c.Assert(err, Equals, ErrSparseConePattern)
+	c.Assert(w.AddSparseCheckout([]string{"A"}), Equals, ErrSparseCheckoutDisabled)
+}
+
+func (s *WorktreeSuite) TestConePatterns(c *C) {
+	c.Assert(conePatterns([]string{"A/B", "E/F", "A/B/C"}), DeepEquals, []string{
+		"/*", "!/*/", "/A/", "!/A/*/", "/E/", "!/E/*/", "/A/B/", "/E/F/",
+	})
+
+	c.Assert(conePatterns([]string{"A", "A/B"}), DeepEquals, []string{
+		"/*", "!/*/", "/A/",
+	})
+}
+
+func (s *WorktreeSuite) TestSetSparseCheckoutPatterns(c *C) {
+	_, w := newTestRepository(c, sparseTestFiles)
+
+	err := w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns: []string{"/*", "!/A/", "**/d"},
+	})
+	c.Assert(err, IsNil)
+	assertSparseFiles(c, w, "r", "A/D/d", "E/e")
+
+	patterns, err := w.SparseCheckoutPatterns()
+	c.Assert(err, IsNil)
+	c.Assert(patterns, DeepEquals, []string{"/*", "!/A/", "**/d"})
+}
+
+func (s *WorktreeSuite) TestDisableSparseCheckout(c *C) {
+	r, w := newTestRepository(c, sparseTestFiles)
+
+	err := w.SetSparseCheckout(&SparseCheckoutOptions{Cone: true})
+	c.Assert(err, IsNil)
+	assertSparseFiles(c, w, "r")
+
+	c.Assert(w.DisableSparseCheckout(), IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b", "A/D/d", "E/e")
+	c.Assert(readWorktreeFile(c, w, "A/D/d"), Equals, "d\n")
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.SparseCheckout, Equals, false)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Version, Equals, uint32(2))
+}
+
+func (s *WorktreeSuite) TestSetSparseCheckoutKeepsModifiedFiles(c *C) {
+	_, w := newTestRepository(c, sparseTestFiles)
+
+	err := util.WriteFile(w.Filesystem, "E/e", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.SetSparseCheckout(&SparseCheckoutOptions{Cone: true})
+	c.Assert(err, IsNil)
+	c.Assert(readWorktreeFile(c, w, "E/e"), Equals, "modified\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("E/e").Worktree, Equals, Modified)
+}
+
+func (s *WorktreeSuite) TestCheckoutSparse(c *C) {
+	_, w := newTestRepository(c, sparseTestFiles)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	err := w.Checkout(&CheckoutOptions{Branch: feature, Create: true})
+	c.Assert(err, IsNil)
+	commitFiles(c, w, map[string]string{
+		"E/e":   "e modified\n",
+		"A/B/b": "b modified\n",
+	})
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+
+	err = w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns: []string{"A/B"},
+		Cone:     true,
+	})
+	c.Assert(err, IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Branch: feature})
+	c.Assert(err, IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b")
+	c.Assert(readWorktreeFile(c, w, "A/B/b"), Equals, "b modified\n")
+
+	err = w.Reset(&ResetOptions{Mode: HardReset})
+	c.Assert(err, IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b")
+}
+
+// assertSparseIndex checks the names of the entries of the index, and that
+// the sparse directories are the ones ending with a slash.
+func assertSparseIndex(c *C, w *Worktree, names ...string) {
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Sparse, Equals, true)
+
+	var entries []string
+	for _, e := range idx.Entries {
+		entries = append(entries, e.Name)
+		c.Assert(e.IsSparseDirectory(), Equals, strings.HasSuffix(e.Name, "/"))
+		c.Assert(e.SkipWorktree, Equals, e.IsSparseDirectory() || e.Name == "E/e")
+	}
+
+	sort.Strings(entries)
+	c.Assert(entries, DeepEquals, names)
+}
+
+func (s *WorktreeSuite) TestSetSparseCheckoutSparseIndex(c *C) {
+	r, w := newTestRepository(c, sparseTestFiles)
+
+	err := w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns:    []string{"A/B"},
+		Cone:        true,
+		SparseIndex: true,
+	})
+	c.Assert(err, IsNil)
+	assertSparseIndex(c, w, "A/B/b", "A/D/", "A/a", "E/", "r")
+
+	head, err := w.headTree()
+	c.Assert(err, IsNil)
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	e, err := idx.Entry("E/")
+	c.Assert(err, IsNil)
+	te, err := head.FindEntry("E")
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash, Equals, te.Hash)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	// only the directory of the added file is expanded
+	err = util.WriteFile(w.Filesystem, "E/f", []byte("f\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("E/f")
+	c.Assert(err, IsNil)
+	assertSparseIndex(c, w, "A/B/b", "A/D/", "A/a", "E/e", "E/f", "r")
+
+	h, err := w.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	for _, name := range []string{"r", "A/a", "A/B/b", "A/D/d", "E/e", "E/f"} {
+		_, err := tree.File(name)
+		c.Assert(err, IsNil, Commentf("%s", name))
+	}
+
+	c.Assert(w.DisableSparseCheckout(), IsNil)
+	assertSparseFiles(c, w, "r", "A/a", "A/B/b", "A/D/d", "E/e", "E/f")
+
+	idx, err = r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Sparse, Equals, false)
+}
+
+func (s *WorktreeSuite) TestCheckoutSparseIndex(c *C) {
+	_, w := newTestRepository(c, sparseTestFiles)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	err := w.Checkout(&CheckoutOptions{Branch: feature, Create: true})
+	c.Assert(err, IsNil)
+	commitFiles(c, w, map[string]string{
+		"E/e":   "e modified\n",
+		"A/B/b": "b modified\n",
+	})
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+
+	err = w.SetSparseCheckout(&SparseCheckoutOptions{
+		Patterns:    []string{"A/B"},
+		Cone:        true,
+		SparseIndex: true,
+	})
+	c.Assert(err, IsNil)
+
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	before, err := idx.Entry("E/")
+	c.Assert(err, IsNil)
+	hash := before.Hash
+
+	err = w.Checkout(&CheckoutOptions{Branch: feature})
+	c.Assert(err, IsNil)
+	assertSparseIndex(c, w, "A/B/b", "A/D/", "A/a", "E/", "r")
+	c.Assert(readWorktreeFile(c, w, "A/B/b"), Equals, "b modified\n")
+
+	idx, err = w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	after, err := idx.Entry("E/")
+	c.Assert(err, IsNil)
+	c.Assert(after.Hash, Not(Equals), hash)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
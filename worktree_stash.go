@@ -0,0 +1,581 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+var (
+	// ErrNoLocalChanges is returned by Worktree.Stash when there are no
+	// changes to be stashed.
+	ErrNoLocalChanges = errors.New("no local changes to save")
+	// ErrStashNotFound is returned when the given stash doesn't exist.
+	ErrStashNotFound = errors.New("stash not found")
+	// ErrStashUntrackedExists is returned when applying a stash with
+	// untracked files that already exist in the worktree.
+	ErrStashUntrackedExists = errors.New("untracked file of the stash already exists")
+	// ErrStashReflogNotSupported is returned by Worktree.StashDrop when the
+	// storer doesn't keep the reflogs, where the older stashes are listed.
+	ErrStashReflogNotSupported = errors.New("stash list requires a storer with reflogs")
+)
+
+// StashRefName is the reference pointing to the newest stash, the previous
+// ones are kept in its reflog.
+const StashRefName plumbing.ReferenceName = "refs/stash"
+
+// StashEntry is an entry of the stash list.
+type StashEntry struct {
+	// Index is the position of the stash in the list, the newest being 0. It
+	// matches the stash@{<index>} notation used by git.
+	Index int
+	// Hash is the hash of the stash commit.
+	Hash plumbing.Hash
+	// Message is the description of the stash.
+	Message string
+}
+
+// Stash records the changes of the index and the worktree, in the same
+// format used by git, and resets the tracked files to HEAD. Untracked files
+// are kept, unless StashOptions.IncludeUntracked is set, in which case they
+// are stashed and removed.
+//
+// The stash is pushed on top of the stash list, and the hash of the stash
+// commit is returned. If there are no changes ErrNoLocalChanges is returned.
+func (w *Worktree) Stash(opts *StashOptions) (plumbing.Hash, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	ref, err := w.r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if hasUnmergedEntries(idx) {
+		return plumbing.ZeroHash, ErrUnmergedEntries
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var tracked, untracked []string
+	for path, s := range status {
+		switch {
+		case s.Worktree == Untracked:
+			untracked = append(untracked, path)
+		case s.Staging != Unmodified || s.Worktree != Unmodified:
+			tracked = append(tracked, path)
+		}
+	}
+
+	if !opts.IncludeUntracked {
+		untracked = nil
+	}
+
+	if len(tracked) == 0 && len(untracked) == 0 {
+		return plumbing.ZeroHash, ErrNoLocalChanges
+	}
+
+	sort.Strings(tracked)
+	sort.Strings(untracked)
+
+	branch := "(no branch)"
+	if ref.Name().IsBranch() {
+		branch = ref.Name().Short()
+	}
+
+	desc := fmt.Sprintf("%s: %s %s", branch, head.Hash.String()[:7], commitSubject(head.Message))
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	indexTree, err := h.BuildTree(idx)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	indexCommit, err := w.stashCommit("index on "+desc, indexTree, opts, head.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parents := []plumbing.Hash{head.Hash, indexCommit}
+	if len(untracked) != 0 {
+		untrackedIdx := &index.Index{Version: 2}
+		if err := w.addToStashIndex(untrackedIdx, untracked); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		tree, err := h.BuildTree(untrackedIdx)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		commit, err := w.stashCommit("untracked files on "+desc, tree, opts)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = append(parents, commit)
+	}
+
+	worktreeIdx := &index.Index{Version: idx.Version}
+	for _, e := range idx.Entries {
+		copied := *e
+		worktreeIdx.Entries = append(worktreeIdx.Entries, &copied)
+	}
+
+	if err := w.addToStashIndex(worktreeIdx, tracked); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	worktreeTree, err := h.BuildTree(worktreeIdx)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := "WIP on " + desc
+	if opts.Message != "" {
+		msg = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	stash, err := w.stashCommit(msg, worktreeTree, opts, parents...)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.pushStash(stash, opts.Author, msg); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return stash, w.resetStashedFiles(head, tracked, untracked)
+}
+
+// addToStashIndex updates the given index with the current content of the
+// given paths, removing them if they don't exist.
+func (w *Worktree) addToStashIndex(idx *index.Index, paths []string) error {
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	for _, path := range paths {
+		h, err := w.copyFileToStorage(c, path)
+		if os.IsNotExist(err) {
+			if _, err := idx.Remove(path); err != nil && err != index.ErrEntryNotFound {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := w.addOrUpdateFileToIndex(idx, path, h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Worktree) stashCommit(msg string, tree plumbing.Hash, opts *StashOptions, parents ...plumbing.Hash) (plumbing.Hash, error) {
+	return w.buildCommitObject(msg+"\n", &CommitOptions{
+		Author:    opts.Author,
+		Committer: opts.Author,
+		Parents:   parents,
+	}, tree)
+}
+
+// resetStashedFiles restores the index and the given tracked paths to HEAD,
+// and removes the given untracked paths. Other untracked files are kept.
+func (w *Worktree) resetStashedFiles(head *object.Commit, tracked, untracked []string) error {
+	if err := w.Reset(&ResetOptions{Mode: MixedReset, Commit: head.Hash}); err != nil {
+		return err
+	}
+
+	tree, err := head.Tree()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range tracked {
+		e, err := tree.FindEntry(path)
+		if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+			if err := rmFileAndDirIfEmpty(w.Filesystem, path); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := w.deleteFromFilesystem(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := w.checkoutBlob(path, e.Mode, e.Hash); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range untracked {
+		if err := rmFileAndDirIfEmpty(w.Filesystem, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StashList returns the stash list, the newest stash first.
+func (w *Worktree) StashList() ([]*StashEntry, error) {
+	ref, err := w.r.Storer.Reference(StashRefName)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*StashEntry
+	if rs, ok := w.r.Storer.(storer.ReflogStorer); ok {
+		iter, err := rs.IterReflog(StashRefName)
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(e *reflog.Entry) error {
+			list = append(list, &StashEntry{
+				Index:   len(list),
+				Hash:    e.New,
+				Message: e.Message,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(list) != 0 {
+		return list, nil
+	}
+
+	// without a reflog, the stash list only contains refs/stash
+	stash, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return []*StashEntry{{
+		Hash:    stash.Hash,
+		Message: commitSubject(stash.Message),
+	}}, nil
+}
+
+// StashApply applies the changes of the stash at the given position of the
+// stash list on top of the current HEAD, keeping it in the list. The changes
+// are merged with a three-way merge, and left unstaged in the worktree,
+// except the files added by the stash, which are added to the index.
+//
+// If some paths can not be merged ErrMergeConflicts is returned, with the
+// conflicts recorded in the index and the worktree.
+func (w *Worktree) StashApply(index int) error {
+	stash, err := w.stashCommitAt(index)
+	if err != nil {
+		return err
+	}
+
+	ref, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	head, err := w.r.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkMergeable(head.Hash); err != nil {
+		return err
+	}
+
+	var untracked *object.Tree
+	if stash.NumParents() > 2 {
+		if untracked, err = w.stashUntrackedTree(stash); err != nil {
+			return err
+		}
+	}
+
+	base, err := stash.Parent(0)
+	if err != nil {
+		return err
+	}
+
+	baseTree, err := base.Tree()
+	if err != nil {
+		return err
+	}
+
+	oursTree, err := head.Tree()
+	if err != nil {
+		return err
+	}
+
+	theirsTree, err := stash.Tree()
+	if err != nil {
+		return err
+	}
+
+	m := &treeMerger{
+		s:           w.r.Storer,
+		oursLabel:   "Updated upstream",
+		baseLabel:   "Stash base",
+		theirsLabel: "Stashed changes",
+	}
+
+	res, err := m.mergeTrees(baseTree, oursTree, theirsTree)
+	if err != nil {
+		return err
+	}
+
+	tree, err := m.writeTree(res)
+	if err != nil {
+		return err
+	}
+
+	merged, err := w.r.TreeObject(tree)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutStashChanges(oursTree, merged, res.Conflicts); err != nil {
+		return err
+	}
+
+	if untracked != nil {
+		if err := w.checkoutTree(untracked); err != nil {
+			return err
+		}
+	}
+
+	if len(res.Conflicts) == 0 {
+		return nil
+	}
+
+	if err := w.writeConflicts(res.Conflicts); err != nil {
+		return err
+	}
+
+	return ErrMergeConflicts
+}
+
+// StashPop applies the stash at the given position of the stash list, as
+// StashApply does, and drops it from the list if it was applied without
+// conflicts.
+func (w *Worktree) StashPop(index int) error {
+	if err := w.StashApply(index); err != nil {
+		return err
+	}
+
+	return w.StashDrop(index)
+}
+
+// StashDrop removes the stash at the given position from the stash list.
+func (w *Worktree) StashDrop(index int) error {
+	list, err := w.StashList()
+	if err != nil {
+		return err
+	}
+
+	if index < 0 || index >= len(list) {
+		return ErrStashNotFound
+	}
+
+	if len(list) == 1 {
+		return w.r.Storer.RemoveReference(StashRefName)
+	}
+
+	rs, ok := w.r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return ErrStashReflogNotSupported
+	}
+
+	if err := rs.DeleteReflogEntry(StashRefName, index); err != nil {
+		return err
+	}
+
+	if index != 0 {
+		return nil
+	}
+
+	return w.r.Storer.SetReference(
+		plumbing.NewHashReference(StashRefName, list[1].Hash),
+	)
+}
+
+func (w *Worktree) stashCommitAt(index int) (*object.Commit, error) {
+	list, err := w.StashList()
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(list) {
+		return nil, ErrStashNotFound
+	}
+
+	return w.r.CommitObject(list[index].Hash)
+}
+
+// stashUntrackedTree returns the tree of the untracked files of the stash,
+// checking that none of them exists in the worktree.
+func (w *Worktree) stashUntrackedTree(stash *object.Commit) (*object.Tree, error) {
+	commit, err := stash.Parent(2)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		_, err := w.Filesystem.Lstat(f.Name)
+		if err == nil {
+			return ErrStashUntrackedExists
+		}
+
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	})
+
+	return tree, err
+}
+
+// checkoutStashChanges writes to the worktree the changes between HEAD's
+// tree and the merged one, adding to the index only the new files. The
+// conflicting paths are removed from the index.
+func (w *Worktree) checkoutStashChanges(head, merged *object.Tree, conflicts []*mergeConflict) error {
+	changes, err := object.DiffTree(head, merged)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if ch.To.Name == "" {
+			if err := rmFileAndDirIfEmpty(w.Filesystem, ch.From.Name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		e := ch.To.TreeEntry
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := w.deleteFromFilesystem(ch.To.Name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := w.checkoutBlob(ch.To.Name, e.Mode, e.Hash); err != nil {
+			return err
+		}
+
+		if ch.From.Name == "" {
+			if err := w.addOrUpdateFileToIndex(idx, ch.To.Name, e.Hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range conflicts {
+		if _, err := idx.Remove(c.Path); err != nil && err != index.ErrEntryNotFound {
+			return err
+		}
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutTree writes the files of the given tree to the worktree.
+func (w *Worktree) checkoutTree(t *object.Tree) error {
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
+	return t.Files().ForEach(func(f *object.File) error {
+		return w.checkoutFile(f, c)
+	})
+}
+
+// pushStash points refs/stash to the given commit, adding it to the stash
+// list kept in the reflog of refs/stash. When the storer doesn't support
+// reflogs, only the newest stash is kept.
+func (w *Worktree) pushStash(h plumbing.Hash, committer *object.Signature, msg string) error {
+	old := resolvedHash(w.r.Storer, StashRefName)
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(StashRefName, h)); err != nil {
+		return err
+	}
+
+	rs, ok := w.r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	return rs.AppendReflog(StashRefName, &reflog.Entry{
+		Old: old,
+		New: h,
+		Committer: reflog.Signature{
+			Name:  committer.Name,
+			Email: committer.Email,
+			When:  committer.When,
+		},
+		Message: msg,
+	})
+}
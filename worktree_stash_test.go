@@ -0,0 +1,261 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+func (s *WorktreeSuite) TestStash(c *C) {
+	r, w := newMergeTestRepository(c)
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo staged\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo modified\n"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(w.Filesystem.Remove("bar"), IsNil)
+	err = util.WriteFile(w.Filesystem, "qux", []byte("qux\n"), 0644)
+	c.Assert(err, IsNil)
+
+	h, err := w.Stash(&StashOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	ref, err := r.Reference(StashRefName, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, h)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(stash.ParentHashes, HasLen, 2)
+	c.Assert(stash.ParentHashes[0], Equals, head.Hash())
+	c.Assert(stash.Message, Equals,
+		fmt.Sprintf("WIP on master: %s changes\n", head.Hash().String()[:7]),
+	)
+
+	_, err = stash.File("bar")
+	c.Assert(err, NotNil)
+	_, err = stash.File("qux")
+	c.Assert(err, NotNil)
+
+	f, err := stash.File("foo")
+	c.Assert(err, IsNil)
+	content, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo modified\n")
+
+	indexCommit, err := stash.Parent(1)
+	c.Assert(err, IsNil)
+	c.Assert(indexCommit.Message, Equals,
+		fmt.Sprintf("index on master: %s changes\n", head.Hash().String()[:7]),
+	)
+
+	f, err = indexCommit.File("foo")
+	c.Assert(err, IsNil)
+	content, err = f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo staged\n")
+
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar\n")
+	c.Assert(readWorktreeFile(c, w, "qux"), Equals, "qux\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("qux").Worktree, Equals, Untracked)
+
+	_, err = w.Stash(&StashOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrNoLocalChanges)
+}
+
+func (s *WorktreeSuite) TestStashIncludeUntracked(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	err := util.WriteFile(w.Filesystem, "qux", []byte("qux\n"), 0644)
+	c.Assert(err, IsNil)
+
+	h, err := w.Stash(&StashOptions{
+		Message:          "untracked",
+		IncludeUntracked: true,
+		Author:           defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(stash.Message, Equals, "On master: untracked\n")
+	c.Assert(stash.ParentHashes, HasLen, 3)
+
+	untracked, err := stash.Parent(2)
+	c.Assert(err, IsNil)
+	c.Assert(untracked.ParentHashes, HasLen, 0)
+
+	_, err = untracked.File("qux")
+	c.Assert(err, IsNil)
+
+	_, err = w.Filesystem.Stat("qux")
+	c.Assert(err, NotNil)
+
+	err = util.WriteFile(w.Filesystem, "qux", []byte("other\n"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(w.StashApply(0), Equals, ErrStashUntrackedExists)
+
+	c.Assert(w.Filesystem.Remove("qux"), IsNil)
+	c.Assert(w.StashPop(0), IsNil)
+	c.Assert(readWorktreeFile(c, w, "qux"), Equals, "qux\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("qux").Worktree, Equals, Untracked)
+
+	_, err = r.Reference(StashRefName, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *WorktreeSuite) TestStashApply(c *C) {
+	_, w := newMergeTestRepository(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\nmodified\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "qux", []byte("qux\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("qux")
+	c.Assert(err, IsNil)
+
+	_, err = w.Stash(&StashOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, map[string]string{"bar": "bar modified\n"})
+
+	c.Assert(w.StashApply(0), IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "foo\nmodified\n")
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals, "bar modified\n")
+	c.Assert(readWorktreeFile(c, w, "qux"), Equals, "qux\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Unmodified)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+	c.Assert(status.File("qux").Staging, Equals, Added)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+}
+
+func (s *WorktreeSuite) TestStashApplyConflict(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	err := util.WriteFile(w.Filesystem, "bar", []byte("stashed\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Stash(&StashOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, map[string]string{"bar": "committed\n"})
+
+	c.Assert(w.StashPop(0), Equals, ErrMergeConflicts)
+	c.Assert(readWorktreeFile(c, w, "bar"), Equals,
+		"<<<<<<< Updated upstream\ncommitted\n=======\nstashed\n>>>>>>> Stashed changes\n",
+	)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(unmergedStages(idx, "bar"), HasLen, 3)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+}
+
+func (s *WorktreeSuite) TestStashListAndDrop(c *C) {
+	r, w := newMergeTestRepository(c)
+
+	var hashes []plumbing.Hash
+	for _, msg := range []string{"first", "second", "third"} {
+		err := util.WriteFile(w.Filesystem, "foo", []byte(msg+"\n"), 0644)
+		c.Assert(err, IsNil)
+
+		h, err := w.Stash(&StashOptions{Message: msg, Author: defaultSignature()})
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 3)
+	for i, e := range list {
+		c.Assert(e.Index, Equals, i)
+		c.Assert(e.Hash, Equals, hashes[2-i])
+	}
+
+	c.Assert(list[0].Message, Equals, "On master: third")
+
+	c.Assert(w.StashDrop(3), Equals, ErrStashNotFound)
+	c.Assert(w.StashDrop(1), IsNil)
+
+	list, err = w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 2)
+	c.Assert(list[0].Hash, Equals, hashes[2])
+	c.Assert(list[1].Hash, Equals, hashes[0])
+
+	c.Assert(w.StashDrop(0), IsNil)
+
+	ref, err := r.Reference(StashRefName, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, hashes[0])
+
+	c.Assert(w.StashPop(0), IsNil)
+	c.Assert(readWorktreeFile(c, w, "foo"), Equals, "first\n")
+
+	list, err = w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+}
+
+func (s *WorktreeSuite) TestStashReflog(c *C) {
+	dotgit := memfs.New()
+	r, err := Init(filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault()), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	commitFiles(c, w, map[string]string{"foo": "foo\n"})
+
+	var hashes []plumbing.Hash
+	for _, msg := range []string{"first", "second"} {
+		err := util.WriteFile(w.Filesystem, "foo", []byte(msg+"\n"), 0644)
+		c.Assert(err, IsNil)
+
+		h, err := w.Stash(&StashOptions{Message: msg, Author: defaultSignature()})
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	f, err := dotgit.Open("logs/refs/stash")
+	c.Assert(err, IsNil)
+	b, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[0], Equals, fmt.Sprintf(
+		"%s %s foo <foo@foo.foo> 1493849023 +0200\tOn master: first",
+		plumbing.ZeroHash, hashes[0],
+	))
+	c.Assert(lines[1], Matches, hashes[0].String()+" "+hashes[1].String()+" .*\tOn master: second")
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/utils/ioutil"
 	"github.com/go-git/go-git/v5/utils/merkletrie"
 	"github.com/go-git/go-git/v5/utils/merkletrie/filesystem"
@@ -101,9 +102,63 @@ func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
 		}
 	}
 
+	if err := w.unmergedStatus(s); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
+// unmergedStatus sets the status of the paths with conflicts recorded in the
+// index, using the same codes as `git status --short`.
+func (w *Worktree) unmergedStatus(s Status) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	stages := make(map[string]map[index.Stage]bool)
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged {
+			continue
+		}
+
+		if stages[e.Name] == nil {
+			stages[e.Name] = make(map[index.Stage]bool)
+		}
+
+		stages[e.Name][e.Stage] = true
+	}
+
+	for name, st := range stages {
+		fs := s.File(name)
+		fs.Staging, fs.Worktree = unmergedStatusCodes(
+			st[index.AncestorMode], st[index.OurMode], st[index.TheirMode],
+		)
+	}
+
+	return nil
+}
+
+func unmergedStatusCodes(base, ours, theirs bool) (staging, worktree StatusCode) {
+	switch {
+	case !ours && !theirs:
+		return Deleted, Deleted
+	case !ours && base:
+		return Deleted, UpdatedButUnmerged
+	case !ours:
+		return UpdatedButUnmerged, Added
+	case !theirs && base:
+		return UpdatedButUnmerged, Deleted
+	case !theirs:
+		return Added, UpdatedButUnmerged
+	case !base:
+		return Added, Added
+	}
+
+	return UpdatedButUnmerged, UpdatedButUnmerged
+}
+
 func nameFromAction(ch *merkletrie.Change) string {
 	name := ch.To.String()
 	if name == "" {
@@ -125,7 +180,14 @@ func (w *Worktree) diffStagingWithWorktree(reverse bool) (merkletrie.Changes, er
 		return nil, err
 	}
 
-	to := filesystem.NewRootNode(w.Filesystem, submodules)
+	conv, err := w.newHashConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conv.close()
+
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, conv.nodeOptions())
 
 	var c merkletrie.Changes
 	if reverse {
@@ -135,9 +197,10 @@ func (w *Worktree) diffStagingWithWorktree(reverse bool) (merkletrie.Changes, er
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, conv.nodeError(err)
 	}
 
+	c = excludeSkipWorktreeChanges(idx, c)
 	return w.excludeIgnoredChanges(c), nil
 }
 
@@ -230,6 +293,10 @@ func (w *Worktree) diffTreeWithStaging(t *object.Tree, reverse bool) (merkletrie
 		return nil, err
 	}
 
+	if err := w.expandChangedSparseDirectories(idx, t); err != nil {
+		return nil, err
+	}
+
 	to := mindex.NewRootNode(idx)
 
 	if reverse {
@@ -239,6 +306,43 @@ func (w *Worktree) diffTreeWithStaging(t *object.Tree, reverse bool) (merkletrie
 	return merkletrie.DiffTree(from, to, diffTreeIsEquals)
 }
 
+func (w *Worktree) diffCommitWithWorktree(commit plumbing.Hash) (merkletrie.Changes, error) {
+	var from noder.Noder
+	if !commit.IsZero() {
+		c, err := w.r.CommitObject(commit)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := c.Tree()
+		if err != nil {
+			return nil, err
+		}
+
+		from = object.NewTreeRootNode(t)
+	}
+
+	submodules, err := w.getSubmodulesStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	conv, err := w.newHashConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conv.close()
+
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, conv.nodeOptions())
+	c, err := merkletrie.DiffTree(from, to, diffTreeIsEquals)
+	if err != nil {
+		return nil, conv.nodeError(err)
+	}
+
+	return w.excludeIgnoredChanges(c), nil
+}
+
 var emptyNoderHash = make([]byte, 24)
 
 // diffTreeIsEquals is a implementation of noder.Equals, used to compare
@@ -260,7 +364,8 @@ func diffTreeIsEquals(a, b noder.Hasher) bool {
 
 // Add adds the file contents of a file in the worktree to the index. if the
 // file is already staged in the index no error is returned. If a file deleted
-// from the Workspace is given, the file is removed from the index. If a
+// from the Workspace is given, the file is removed from the index. If the
+// file has conflicts recorded in the index, they are marked as resolved. If a
 // directory given, adds the files and all his sub-directories recursively in
 // the worktree to the index. If any of the files is already staged in the index
 // no error is returned. When path is a file, the blob.Hash is returned.
@@ -269,7 +374,7 @@ func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	return w.doAdd(path, make([]gitignore.Pattern, 0))
 }
 
-func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string, ignorePattern []gitignore.Pattern) (added bool, err error) {
+func (w *Worktree) doAddDirectory(idx *index.Index, s Status, c *converter, directory string, ignorePattern []gitignore.Pattern) (added bool, err error) {
 	files, err := w.Filesystem.ReadDir(directory)
 	if err != nil {
 		return false, err
@@ -292,9 +397,9 @@ func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string,
 				// ignore special git directory
 				continue
 			}
-			a, err = w.doAddDirectory(idx, s, name, ignorePattern)
+			a, err = w.doAddDirectory(idx, s, c, name, ignorePattern)
 		} else {
-			a, _, err = w.doAddFile(idx, s, name, ignorePattern)
+			a, _, err = w.doAddFile(idx, s, c, name, ignorePattern)
 		}
 
 		if err != nil {
@@ -322,6 +427,10 @@ func (w *Worktree) AddWithOptions(opts *AddOptions) error {
 		return err
 	}
 
+	if opts.Renormalize {
+		return w.renormalize(opts.Path)
+	}
+
 	if opts.All {
 		_, err := w.doAdd(".", w.Excludes)
 		return err
@@ -346,14 +455,21 @@ func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern) (plumbi
 		return plumbing.ZeroHash, err
 	}
 
+	c, err := w.newConverter()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer c.close()
+
 	var h plumbing.Hash
 	var added bool
 
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil || !fi.IsDir() {
-		added, h, err = w.doAddFile(idx, s, path, ignorePattern)
+		added, h, err = w.doAddFile(idx, s, c, path, ignorePattern)
 	} else {
-		added, err = w.doAddDirectory(idx, s, path, ignorePattern)
+		added, err = w.doAddDirectory(idx, s, c, path, ignorePattern)
 	}
 
 	if err != nil {
@@ -391,6 +507,13 @@ func (w *Worktree) AddGlob(pattern string) error {
 		return err
 	}
 
+	c, err := w.newConverter()
+	if err != nil {
+		return err
+	}
+
+	defer c.close()
+
 	var saveIndex bool
 	for _, file := range files {
 		fi, err := w.Filesystem.Lstat(file)
@@ -400,9 +523,9 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 		var added bool
 		if fi.IsDir() {
-			added, err = w.doAddDirectory(idx, s, file, make([]gitignore.Pattern, 0))
+			added, err = w.doAddDirectory(idx, s, c, file, make([]gitignore.Pattern, 0))
 		} else {
-			added, _, err = w.doAddFile(idx, s, file, make([]gitignore.Pattern, 0))
+			added, _, err = w.doAddFile(idx, s, c, file, make([]gitignore.Pattern, 0))
 		}
 
 		if err != nil {
@@ -423,7 +546,7 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 // doAddFile create a new blob from path and update the index, added is true if
 // the file added is different from the index.
-func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePattern []gitignore.Pattern) (added bool, h plumbing.Hash, err error) {
+func (w *Worktree) doAddFile(idx *index.Index, s Status, c *converter, path string, ignorePattern []gitignore.Pattern) (added bool, h plumbing.Hash, err error) {
 	if s.File(path).Worktree == Unmodified {
 		return false, h, nil
 	}
@@ -436,7 +559,7 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 		}
 	}
 
-	h, err = w.copyFileToStorage(path)
+	h, err = w.copyFileToStorage(c, path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			added = true
@@ -453,37 +576,35 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 	return true, h, err
 }
 
-func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error) {
+func (w *Worktree) copyFileToStorage(c *converter, path string) (hash plumbing.Hash, err error) {
+	return w.copyFileToStorer(w.r.Storer, c, path)
+}
+
+// copyFileToStorer writes the content of the file at path as a blob of s,
+// applying the line ending conversions of c.
+func (w *Worktree) copyFileToStorer(s storer.EncodedObjectStorer, c *converter, path string) (hash plumbing.Hash, err error) {
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	obj := w.r.Storer.NewEncodedObject()
+	obj := s.NewEncodedObject()
 	obj.SetType(plumbing.BlobObject)
-	obj.SetSize(fi.Size())
-
-	writer, err := obj.Writer()
-	if err != nil {
-		return plumbing.ZeroHash, err
-	}
-
-	defer ioutil.CheckClose(writer, &err)
 
 	if fi.Mode()&os.ModeSymlink != 0 {
-		err = w.fillEncodedObjectFromSymlink(writer, path, fi)
+		err = w.fillEncodedObjectFromSymlink(obj, path, fi)
 	} else {
-		err = w.fillEncodedObjectFromFile(writer, path, fi)
+		err = w.fillEncodedObjectFromFile(obj, c, path, fi)
 	}
 
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	return w.r.Storer.SetEncodedObject(obj)
+	return s.SetEncodedObject(obj)
 }
 
-func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.FileInfo) (err error) {
+func (w *Worktree) fillEncodedObjectFromFile(obj plumbing.EncodedObject, c *converter, path string, fi os.FileInfo) (err error) {
 	src, err := w.Filesystem.Open(path)
 	if err != nil {
 		return err
@@ -491,24 +612,51 @@ func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.F
 
 	defer ioutil.CheckClose(src, &err)
 
-	if _, err := io.Copy(dst, src); err != nil {
+	r, size, err := c.toRepository(path, src, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	obj.SetSize(size)
+	dst, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(dst, &err)
+
+	if _, err := io.Copy(dst, r); err != nil {
 		return err
 	}
 
 	return err
 }
 
-func (w *Worktree) fillEncodedObjectFromSymlink(dst io.Writer, path string, fi os.FileInfo) error {
+func (w *Worktree) fillEncodedObjectFromSymlink(obj plumbing.EncodedObject, path string, fi os.FileInfo) (err error) {
 	target, err := w.Filesystem.Readlink(path)
 	if err != nil {
 		return err
 	}
 
+	obj.SetSize(fi.Size())
+	dst, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(dst, &err)
+
 	_, err = dst.Write([]byte(target))
 	return err
 }
 
 func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h plumbing.Hash) error {
+	if err := w.expandSparseDirectoriesOf(idx, filename); err != nil {
+		return err
+	}
+
+	removeUnmergedStages(idx, filename)
+
 	e, err := idx.Entry(filename)
 	if err != nil && err != index.ErrEntryNotFound {
 		return err
@@ -624,11 +772,16 @@ func (w *Worktree) doRemoveFile(idx *index.Index, path string) (plumbing.Hash, e
 }
 
 func (w *Worktree) deleteFromIndex(idx *index.Index, path string) (plumbing.Hash, error) {
+	if err := w.expandSparseDirectoriesOf(idx, path); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	e, err := idx.Remove(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	removeUnmergedStages(idx, path)
 	return e.Hash, nil
 }
 
@@ -650,6 +803,11 @@ func (w *Worktree) RemoveGlob(pattern string) error {
 		return err
 	}
 
+	// any sparse directory may contain files matching the pattern
+	if err := w.expandSparseDirectoriesOf(idx, ""); err != nil {
+		return err
+	}
+
 	entries, err := idx.Glob(pattern)
 	if err != nil {
 		return err
@@ -122,6 +122,105 @@ func (s *WorktreeSuite) TestPullNonFastForward(c *C) {
 	c.Assert(err, Equals, ErrNonFastForwardUpdate)
 }
 
+func (s *WorktreeSuite) TestPullNonFastForwardMerge(c *C) {
+	url := c.MkDir()
+	path := fixtures.Basic().ByTag("worktree").One().Worktree().Root()
+
+	server, err := PlainClone(url, false, &CloneOptions{
+		URL: path,
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainClone(c.MkDir(), false, &CloneOptions{
+		URL: url,
+	})
+	c.Assert(err, IsNil)
+
+	w, err := server.Worktree()
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo"), 0755)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+	theirs, err := w.Commit("foo", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	w, err = r.Worktree()
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "bar", []byte("bar"), 0755)
+	c.Assert(err, IsNil)
+	_, err = w.Add("bar")
+	c.Assert(err, IsNil)
+	ours, err := w.Commit("bar", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: PullMerge, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours, theirs})
+	c.Assert(commit.Message, Equals, "Merge branch 'master' of "+url+"\n")
+
+	_, err = w.Filesystem.Lstat("foo")
+	c.Assert(err, IsNil)
+	_, err = w.Filesystem.Lstat("bar")
+	c.Assert(err, IsNil)
+}
+
+func (s *WorktreeSuite) TestPullNonFastForwardRebase(c *C) {
+	url := c.MkDir()
+	path := fixtures.Basic().ByTag("worktree").One().Worktree().Root()
+
+	server, err := PlainClone(url, false, &CloneOptions{
+		URL: path,
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainClone(c.MkDir(), false, &CloneOptions{
+		URL: url,
+	})
+	c.Assert(err, IsNil)
+
+	w, err := server.Worktree()
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "foo", []byte("foo"), 0755)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+	theirs, err := w.Commit("foo", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	w, err = r.Worktree()
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "bar", []byte("bar"), 0755)
+	c.Assert(err, IsNil)
+	_, err = w.Add("bar")
+	c.Assert(err, IsNil)
+	_, err = w.Commit("bar", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: PullRebase, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{theirs})
+	c.Assert(commit.Message, Equals, "bar")
+
+	_, err = w.Filesystem.Lstat("foo")
+	c.Assert(err, IsNil)
+	_, err = w.Filesystem.Lstat("bar")
+	c.Assert(err, IsNil)
+}
+
 func (s *WorktreeSuite) TestPullUpdateReferencesIfNeeded(c *C) {
 	r, _ := Init(memory.NewStorage(), memfs.New())
 	r.CreateRemote(&config.RemoteConfig{